@@ -3,74 +3,103 @@ package backup
 import (
     "context"
     "crypto/md5"
+    "encoding/hex"
     "encoding/json"
+    "errors"
     "fmt"
     "io"
-    "net/url"
     "os"
     "path/filepath"
+    "reflect"
+    "sort"
+    "strings"
     "sync"
     "time"
 
     "github.com/Azure/azure-storage-blob-go/azblob"
+    "shared/pkg/azure"
     "shared/pkg/config"
     "shared/pkg/utils"
 )
 
 type BlobMetadata struct {
-    LastModified time.Time `json:"lastModified"`
-    MD5Hash      string    `json:"md5hash"`
-    Size         int64     `json:"size"`
+    LastModified time.Time             `json:"lastModified"`
+    MD5Hash      string                `json:"md5hash"`                 // hex-encoded, same form as calculateMD5
+    Size         int64                 `json:"size"`
+    MissingSince *time.Time            `json:"missingSince,omitempty"`  // first sync that no longer listed the blob in Azure
+    Properties   *utils.BlobProperties `json:"properties,omitempty"`    // content headers and metadata, with BACKUP_PRESERVE_METADATA
 }
 
 type ContainerMetadata struct {
     Files    map[string]BlobMetadata `json:"files"`
-    LastSync time.Time              `json:"lastSync"`
+    LastSync time.Time               `json:"lastSync"`
 }
 
 type SyncMetadata struct {
-    LastSync   time.Time                         `json:"lastSync"`
-    Containers map[string]ContainerMetadata      `json:"containers"`
+    LastSync   time.Time                    `json:"lastSync"`
+    Containers map[string]ContainerMetadata `json:"containers"`
 }
 
 type ContainerStats struct {
-    FilesCount      int   `json:"filesCount"`
-    TotalSize       int64 `json:"totalSize"`
-    DownloadedFiles int   `json:"downloadedFiles"`
-    SkippedFiles    int   `json:"skippedFiles"`
+    FilesCount      int                 `json:"filesCount"`
+    TotalSize       int64               `json:"totalSize"`
+    DownloadedFiles int                 `json:"downloadedFiles"`
+    SkippedFiles    int                 `json:"skippedFiles"`
+    ExcludedFiles   int                 `json:"excludedFiles"`            // blobs matching BACKUP_EXCLUDE_BLOBS
+    SizeSkipped     int                 `json:"sizeSkipped,omitempty"`    // blobs outside BACKUP_MIN_BLOB_SIZE/BACKUP_MAX_BLOB_SIZE
+    FailedFiles     []string            `json:"failedFiles,omitempty"`    // blobs still failing after retries
+    RetainedFiles   int                 `json:"retainedFiles,omitempty"`  // blobs deleted in Azure but kept for BACKUP_DELETE_GRACE_DAYS
+    DeletedFiles    int                 `json:"deletedFiles,omitempty"`   // files removed from the local copy because their blob was deleted
+    TimedOut        bool                `json:"timedOut,omitempty"`       // abandoned after BACKUP_CONTAINER_TIMEOUT
+    Changed         bool                `json:"changed"`                  // blobs were added, modified or deleted since the last sync
+    UploadedFile    string              `json:"uploadedFile,omitempty"`   // name of the archive uploaded to Drive in this run
+    UploadedFileID  string              `json:"uploadedFileId,omitempty"` // Drive file ID of that archive
+    Destinations    []DestinationResult `json:"destinations,omitempty"`   // outcome per shared drive when uploading to several
+    ChangedFiles    []string            `json:"-"`                        // blobs downloaded in this run
+    CurrentFiles    []string            `json:"-"`                        // all blobs present in the container
+}
+
+// maxChunkWorkers limits concurrent range requests for a single blob
+const maxChunkWorkers = 4
+
+// progressLogThreshold is the blob size above which download progress is
+// logged; smaller blobs finish too quickly for it to be useful. Many blobs
+// download at once, so progress is logged at most every downloadProgressInterval.
+const (
+    progressLogThreshold     = 100 * 1024 * 1024
+    downloadProgressInterval = 10 * time.Second
+)
+
+// Delay before each retry pass over failed blobs, doubling up to the maximum
+const (
+    blobRetryBaseDelay = 5 * time.Second
+    blobRetryMaxDelay  = time.Minute
+)
+
+// blobRetryDelay returns the wait before retry pass attempt (starting at 1)
+func blobRetryDelay(attempt int) time.Duration {
+    delay := blobRetryBaseDelay << uint(attempt-1)
+    if delay <= 0 || delay > blobRetryMaxDelay {
+        delay = blobRetryMaxDelay
+    }
+    return delay
 }
 
 type AzureService struct {
-    serviceURL    azblob.ServiceURL
+    serviceURL   azblob.ServiceURL
     config       *config.BackupServiceConfig
     logger       *utils.Logger
     metadataPath string
 }
 
 func NewAzureService(cfg *config.BackupServiceConfig, logger *utils.Logger) (*AzureService, error) {
-    credential, err := azblob.NewSharedKeyCredential(
-        cfg.Azure.AccountName,
-        cfg.Azure.AccountKey,
-    )
+    serviceURL, err := azure.NewServiceURL(cfg.Azure)
     if err != nil {
-        return nil, fmt.Errorf("invalid credentials: %v", err)
+        return nil, err
     }
 
-    pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{
-        Retry: azblob.RetryOptions{
-            MaxTries:      3,
-            TryTimeout:    2 * time.Minute,
-            RetryDelay:    time.Second * 5,
-            MaxRetryDelay: time.Second * 30,
-        },
-    })
-
-    URL, _ := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/",
-        cfg.Azure.AccountName))
-    serviceURL := azblob.NewServiceURL(*URL, pipeline)
-
     return &AzureService{
-        serviceURL:    serviceURL,
+        serviceURL:   serviceURL,
         config:       cfg,
         logger:       logger,
         metadataPath: filepath.Join(cfg.Backup.BackupPath, "sync_metadata.json"),
@@ -138,6 +167,34 @@ func (s *AzureService) saveSyncMetadata(metadata *SyncMetadata) error {
     return nil
 }
 
+// markUploadPending records that containerName was synced with changes that
+// are not in Drive yet. The marker is written before the metadata that
+// counts the changes as synced and removed once the container's archive is
+// uploaded, so a run that dies in between leaves it behind.
+func (s *AzureService) markUploadPending(containerName string, stats *ContainerStats) {
+    if !stats.Changed {
+        return
+    }
+    if err := os.WriteFile(uploadPendingPath(s.config.Backup.BackupPath, containerName), nil, 0644); err != nil {
+        s.logger.Warn("Failed to mark %s as pending upload: %v", containerName, err)
+    }
+}
+
+// resumeInterruptedSync turns the upload-pending markers left by a run that
+// died before uploading into full-required markers: the sync metadata
+// already counts those changes as synced, so only a full backup of the
+// container captures them.
+func (s *AzureService) resumeInterruptedSync() {
+    markers, _ := filepath.Glob(uploadPendingPath(s.config.Backup.BackupPath, "*"))
+    for _, marker := range markers {
+        containerName := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(marker), "."), uploadPendingExt)
+        s.logger.Warn("The last run stopped before uploading %s, its next backup will be a full one", containerName)
+        if err := os.Rename(marker, fullRequiredPath(s.config.Backup.BackupPath, containerName)); err != nil {
+            s.logger.Warn("Failed to mark %s for a full backup: %v", containerName, err)
+        }
+    }
+}
+
 func (s *AzureService) calculateMD5(filePath string) (string, error) {
     file, err := os.Open(filePath)
     if err != nil {
@@ -153,7 +210,13 @@ func (s *AzureService) calculateMD5(filePath string) (string, error) {
     return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
 
-func (s *AzureService) DownloadBlobs(ctx context.Context, backupRootDir string) (map[string]*ContainerStats, error) {
+// encodeContentMD5 converts the raw Content-MD5 bytes reported by Azure into
+// the hex form stored in BlobMetadata
+func encodeContentMD5(contentMD5 []byte) string {
+    return hex.EncodeToString(contentMD5)
+}
+
+func (s *AzureService) DownloadBlobs(ctx context.Context, backupRootDir string, dryRun bool) (map[string]*ContainerStats, error) {
     startTime := time.Now()
     s.logger.Info("Starting blob download to: %s", backupRootDir)
 
@@ -165,27 +228,69 @@ func (s *AzureService) DownloadBlobs(ctx context.Context, backupRootDir string)
         }
     }
 
+    if !dryRun {
+        s.resumeInterruptedSync()
+    }
+
     stats := make(map[string]*ContainerStats)
     newMetadata := &SyncMetadata{
         LastSync:   time.Now(),
         Containers: make(map[string]ContainerMetadata),
     }
     var mu sync.Mutex
+    var checkpointMu sync.Mutex
+
+    // checkpoint persists the containers finished so far on top of the
+    // previous metadata, so an interrupted run only syncs the rest again.
+    // Containers not finished yet keep their previous state, which keeps
+    // every container's entry consistent with its local mirror.
+    checkpoint := func() {
+        checkpointMu.Lock()
+        defer checkpointMu.Unlock()
+
+        mu.Lock()
+        partial := &SyncMetadata{
+            LastSync:   metadata.LastSync,
+            Containers: make(map[string]ContainerMetadata, len(metadata.Containers)+len(newMetadata.Containers)),
+        }
+        for name, container := range metadata.Containers {
+            partial.Containers[name] = container
+        }
+        for name, container := range newMetadata.Containers {
+            partial.Containers[name] = container
+        }
+        mu.Unlock()
+
+        if err := s.saveSyncMetadata(partial); err != nil {
+            s.logger.Warn("Failed to checkpoint sync metadata: %v", err)
+        }
+    }
 
     if s.config.Azure.ContainerName == "ALL" {
         // Process all containers
         var containerWg sync.WaitGroup
         containerSemaphore := make(chan struct{}, 5)
+        var excludedContainers int
 
         for marker := (azblob.Marker{}); marker.NotDone(); {
-            listContainer, err := s.serviceURL.ListContainersSegment(ctx, marker, azblob.ListContainersSegmentOptions{})
+            listContainer, err := s.serviceURL.ListContainersSegment(ctx, marker, azblob.ListContainersSegmentOptions{
+                MaxResults: int32(s.config.Azure.ListPageSize),
+            })
             if err != nil {
-                return nil, fmt.Errorf("failed to list containers: %v", err)
+                return nil, fmt.Errorf("failed to list containers: %w", azure.ContainerError(err))
             }
 
             marker = listContainer.NextMarker
 
             for _, container := range listContainer.ContainerItems {
+                if ctx.Err() != nil {
+                    break
+                }
+                if !s.includeContainer(container.Name) {
+                    s.logger.Info("Skipping excluded container: %s", container.Name)
+                    excludedContainers++
+                    continue
+                }
                 containerWg.Add(1)
                 go func(container azblob.ContainerItem) {
                     defer containerWg.Done()
@@ -198,12 +303,27 @@ func (s *AzureService) DownloadBlobs(ctx context.Context, backupRootDir string)
                         container.Name,
                         backupRootDir,
                         metadata.Containers[container.Name],
+                        dryRun,
                     )
                     if err != nil {
                         s.logger.Error("Failed to process container %s: %v", container.Name, err)
+                        // Keep the previous sync state so the next run only
+                        // re-downloads what changed
+                        mu.Lock()
+                        if previous, exists := metadata.Containers[container.Name]; exists {
+                            newMetadata.Containers[container.Name] = previous
+                        }
+                        if errors.Is(err, errContainerTimeout) {
+                            stats[container.Name] = &ContainerStats{TimedOut: true}
+                        }
+                        mu.Unlock()
                         return
                     }
 
+                    if !dryRun {
+                        s.markUploadPending(container.Name, containerStats)
+                    }
+
                     mu.Lock()
                     stats[container.Name] = containerStats
                     newMetadata.Containers[container.Name] = ContainerMetadata{
@@ -212,11 +332,18 @@ func (s *AzureService) DownloadBlobs(ctx context.Context, backupRootDir string)
                     }
                     mu.Unlock()
 
+                    if !dryRun {
+                        checkpoint()
+                    }
                 }(container)
             }
 
             containerWg.Wait()
         }
+
+        if excludedContainers > 0 {
+            s.logger.Info("Excluded %d containers by BACKUP_INCLUDE_CONTAINERS/BACKUP_EXCLUDE_CONTAINERS", excludedContainers)
+        }
     } else {
         // Process single container
         containerStats, currentFiles, err := s.processContainer(
@@ -224,9 +351,13 @@ func (s *AzureService) DownloadBlobs(ctx context.Context, backupRootDir string)
             s.config.Azure.ContainerName,
             backupRootDir,
             metadata.Containers[s.config.Azure.ContainerName],
+            dryRun,
         )
         if err != nil {
-            return nil, fmt.Errorf("failed to process container %s: %v", s.config.Azure.ContainerName, err)
+            return nil, fmt.Errorf("failed to process container %s: %w", s.config.Azure.ContainerName, err)
+        }
+        if !dryRun {
+            s.markUploadPending(s.config.Azure.ContainerName, containerStats)
         }
         stats[s.config.Azure.ContainerName] = containerStats
         newMetadata.Containers[s.config.Azure.ContainerName] = ContainerMetadata{
@@ -235,8 +366,16 @@ func (s *AzureService) DownloadBlobs(ctx context.Context, backupRootDir string)
         }
     }
 
+    // Containers finished before the interruption are already checkpointed;
+    // the others keep their previous metadata and are synced again next time
+    if err := ctx.Err(); err != nil {
+        return nil, fmt.Errorf("sync cancelled: %v", err)
+    }
+
     // Save updated metadata
-    if err := s.saveSyncMetadata(newMetadata); err != nil {
+    if dryRun {
+        s.logger.Info("[DRY RUN] Sync metadata not updated")
+    } else if err := s.saveSyncMetadata(newMetadata); err != nil {
         s.logger.Error("Failed to save sync metadata: %v", err)
     } else {
         s.logger.Info("Successfully updated sync metadata")
@@ -259,40 +398,249 @@ func (s *AzureService) DownloadBlobs(ctx context.Context, backupRootDir string)
 }
 
 
-func (s *AzureService) processContainer(ctx context.Context, containerName string, backupRootDir string, metadata ContainerMetadata) (*ContainerStats, map[string]BlobMetadata, error) {
+func (s *AzureService) processContainer(ctx context.Context, containerName string, backupRootDir string, metadata ContainerMetadata, dryRun bool) (*ContainerStats, map[string]BlobMetadata, error) {
     containerURL := s.serviceURL.NewContainerURL(containerName)
 
+    var mu sync.Mutex
+    inFlight := make(map[string]struct{}) // blobs being downloaded right now
+
+    // Bound the whole container so one hung blob cannot stall the run
+    parentCtx := ctx
+    timeout := s.config.Backup.ContainerTimeout
+    if timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, timeout)
+        defer cancel()
+
+        stop := context.AfterFunc(ctx, func() {
+            if parentCtx.Err() != nil {
+                return
+            }
+            mu.Lock()
+            outstanding := make([]string, 0, len(inFlight))
+            for name := range inFlight {
+                outstanding = append(outstanding, name)
+            }
+            mu.Unlock()
+            sort.Strings(outstanding)
+            s.logger.Error("[%s] Container timed out after %v with %d blobs outstanding: %s",
+                containerName, timeout, len(outstanding), strings.Join(outstanding, ", "))
+        })
+        defer stop()
+    }
+    timedOut := func() bool {
+        return errors.Is(ctx.Err(), context.DeadlineExceeded) && parentCtx.Err() == nil
+    }
+
     // Verify container exists and is accessible
     _, err := containerURL.GetProperties(ctx, azblob.LeaseAccessConditions{})
     if err != nil {
-        return nil, nil, fmt.Errorf("container not accessible: %v", err)
+        return nil, nil, azure.ContainerError(err)
     }
 
     stats := &ContainerStats{}
     currentFiles := make(map[string]BlobMetadata)
-    var mu sync.Mutex
     var wg sync.WaitGroup
     semaphore := make(chan struct{}, s.config.Backup.MaxConcurrent)
-    errChan := make(chan error, s.config.Backup.MaxConcurrent)
+    failed := make(map[string]blobFailure)
 
     // Create permanent container directory
     containerDir := filepath.Join(backupRootDir, containerName)
-    if err := os.MkdirAll(containerDir, 0755); err != nil {
-        return nil, nil, fmt.Errorf("failed to create container directory: %v", err)
+    if !dryRun {
+        if err := os.MkdirAll(containerDir, 0755); err != nil {
+            return nil, nil, fmt.Errorf("failed to create container directory: %v", err)
+        }
     }
 
+    // Only blobs under the prefix are listed; the rest of the mirror is left
+    // as it is
+    prefix := s.config.Azure.BlobPrefix
+    if prefix != "" {
+        s.logger.Info("[%s] Only syncing blobs with prefix %q", containerName, prefix)
+    }
+
+    // snapshots maps blobs to the snapshot they are downloaded from when
+    // BACKUP_USE_SNAPSHOTS is set; it is filled before any download starts
+    var snapshots map[string]string
+
+    // fetch downloads a blob, listing it as in flight meanwhile, and records
+    // it for retry if the download fails
+    fetch := func(blobInfo azblob.BlobItemInternal) {
+        mu.Lock()
+        inFlight[blobInfo.Name] = struct{}{}
+        mu.Unlock()
+
+        err := s.fetchBlob(ctx, containerURL, containerName, containerDir, blobInfo, snapshots[blobInfo.Name], stats, &mu)
+
+        mu.Lock()
+        delete(inFlight, blobInfo.Name)
+        if err != nil {
+            failed[blobInfo.Name] = blobFailure{blobInfo: blobInfo, err: err}
+        }
+        mu.Unlock()
+    }
+
+    // process records a listed blob and downloads it unless the local copy
+    // is up to date
+    process := func(blobInfo azblob.BlobItemInternal) {
+        if ctx.Err() != nil {
+            return
+        }
+
+        mu.Lock()
+        stats.FilesCount++
+        var contentLength int64
+        if blobInfo.Properties.ContentLength != nil {
+            contentLength = *blobInfo.Properties.ContentLength
+            stats.TotalSize += contentLength
+        }
+
+        // Update current file metadata
+        md5Hash := encodeContentMD5(blobInfo.Properties.ContentMD5)
+        current := BlobMetadata{
+            LastModified: blobInfo.Properties.LastModified,
+            MD5Hash:      md5Hash,
+            Size:         contentLength,
+        }
+        if s.config.Backup.PreserveMetadata {
+            current.Properties = blobProperties(blobInfo)
+        }
+        currentFiles[blobInfo.Name] = current
+        mu.Unlock()
+
+        // Check if blob needs download
+        previousMetadata, exists := metadata.Files[blobInfo.Name]
+        needsDownload := true
+
+        if exists {
+            targetPath := filepath.Join(containerDir, blobInfo.Name)
+            if _, err := os.Stat(targetPath); err == nil { // File exists locally
+                // LastModified is the fast path; fall back to ContentMD5 for
+                // blobs rewritten with identical content
+                unchanged := blobInfo.Properties.LastModified.Equal(previousMetadata.LastModified)
+                if !unchanged && md5Hash != "" && md5Hash == previousMetadata.MD5Hash {
+                    unchanged = true
+                    s.logger.Debug("[%s] Timestamp changed but content identical: %s", containerName, blobInfo.Name)
+                }
+
+                if unchanged {
+                    mu.Lock()
+                    stats.SkippedFiles++
+                    mu.Unlock()
+                    if !dryRun {
+                        filesSkippedTotal.Inc()
+                    }
+                    needsDownload = false
+                    s.logger.Debug("[%s] File unchanged: %s", containerName, blobInfo.Name)
+                }
+            }
+        }
+
+        if needsDownload && dryRun {
+            mu.Lock()
+            stats.DownloadedFiles++
+            stats.ChangedFiles = append(stats.ChangedFiles, blobInfo.Name)
+            mu.Unlock()
+
+            s.logger.Info("[DRY RUN] [%s] Would download: %s (%s)",
+                containerName, blobInfo.Name, utils.FormatBytes(contentLength))
+        } else if needsDownload {
+            fetch(blobInfo)
+        }
+    }
+
+    // spawn processes a blob in the background, bounded by MaxConcurrent
+    spawn := func(blobInfo azblob.BlobItemInternal) {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+
+            semaphore <- struct{}{} // Acquire
+            defer func() { <-semaphore }() // Release
+
+            process(blobInfo)
+        }()
+    }
+
+    useSnapshots := s.config.Backup.UseSnapshots && !dryRun
+    var pending []azblob.BlobItemInternal
+
     // List and process blobs
     for marker := (azblob.Marker{}); marker.NotDone(); {
         listBlob, err := containerURL.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{
-            MaxResults: 5000,
+            MaxResults: int32(s.config.Azure.ListPageSize),
+            Prefix:     prefix,
+            Details:    azblob.BlobListingDetails{Metadata: true},
         })
         if err != nil {
+            if timedOut() {
+                return nil, nil, fmt.Errorf("%w after %v", errContainerTimeout, timeout)
+            }
             return nil, nil, fmt.Errorf("failed to list blobs: %v", err)
         }
 
         marker = listBlob.NextMarker
 
         for _, blobInfo := range listBlob.Segment.BlobItems {
+            if matchBlob(s.config.Backup.ExcludeBlobs, blobInfo.Name) {
+                s.logger.Debug("[%s] Excluded: %s", containerName, blobInfo.Name)
+                stats.ExcludedFiles++
+                continue
+            }
+
+            // A blob outside the size range keeps its local copy and sync
+            // state, so one that grew past the limit is not pruned
+            var size int64
+            if blobInfo.Properties.ContentLength != nil {
+                size = *blobInfo.Properties.ContentLength
+            }
+            if !blobSizeInRange(size, s.config.Backup.MinBlobSize, s.config.Backup.MaxBlobSize) {
+                s.logger.Debug("[%s] Skipped by size (%s): %s", containerName, utils.FormatBytes(size), blobInfo.Name)
+                mu.Lock()
+                stats.SizeSkipped++
+                if previous, exists := metadata.Files[blobInfo.Name]; exists {
+                    currentFiles[blobInfo.Name] = previous
+                }
+                mu.Unlock()
+                continue
+            }
+
+            // With snapshots every blob is snapshotted before the first
+            // download, so all of them are captured at the same moment
+            if useSnapshots {
+                pending = append(pending, blobInfo)
+                continue
+            }
+            spawn(blobInfo)
+        }
+    }
+
+    if len(pending) > 0 {
+        snapshots = s.snapshotBlobs(ctx, containerURL, containerName, containerDir, pending, metadata)
+        defer s.deleteSnapshots(containerURL, containerName, snapshots)
+        for _, blobInfo := range pending {
+            spawn(blobInfo)
+        }
+    }
+
+    wg.Wait()
+
+    // Give failed blobs a few more chances before giving up on them
+    for attempt := 1; attempt <= s.config.Backup.BlobMaxRetries && len(failed) > 0 && ctx.Err() == nil; attempt++ {
+        delay := blobRetryDelay(attempt)
+        s.logger.Warn("[%s] Retrying %d failed blobs in %v (attempt %d/%d)",
+            containerName, len(failed), delay, attempt, s.config.Backup.BlobMaxRetries)
+        select {
+        case <-ctx.Done():
+        case <-time.After(delay):
+        }
+        if ctx.Err() != nil {
+            break
+        }
+
+        retrying := failed
+        failed = make(map[string]blobFailure)
+        for _, failure := range retrying {
             wg.Add(1)
             go func(blobInfo azblob.BlobItemInternal) {
                 defer wg.Done()
@@ -300,62 +648,70 @@ func (s *AzureService) processContainer(ctx context.Context, containerName strin
                 semaphore <- struct{}{} // Acquire
                 defer func() { <-semaphore }() // Release
 
-                mu.Lock()
-                stats.FilesCount++
-                var contentLength int64
-                if blobInfo.Properties.ContentLength != nil {
-                    contentLength = *blobInfo.Properties.ContentLength
-                    stats.TotalSize += contentLength
-                }
-
-                // Update current file metadata
-                currentFiles[blobInfo.Name] = BlobMetadata{
-                    LastModified: blobInfo.Properties.LastModified,
-                    MD5Hash:      string(blobInfo.Properties.ContentMD5),
-                    Size:         contentLength,
-                }
-                mu.Unlock()
+                fetch(blobInfo)
+            }(failure.blobInfo)
+        }
+        wg.Wait()
+    }
 
-                // Check if blob needs download
-                previousMetadata, exists := metadata.Files[blobInfo.Name]
-                needsDownload := true
-
-                if exists {
-                    targetPath := filepath.Join(containerDir, blobInfo.Name)
-                    if _, err := os.Stat(targetPath); err == nil { // File exists locally
-                        if blobInfo.Properties.LastModified.Equal(previousMetadata.LastModified) {
-                            mu.Lock()
-                            stats.SkippedFiles++
-                            mu.Unlock()
-                            needsDownload = false
-                            s.logger.Debug("[%s] File unchanged: %s", containerName, blobInfo.Name)
-                        }
-                    }
-                }
+    // currentFiles is incomplete after cancellation, so stop before pruning
+    if timedOut() {
+        return nil, nil, fmt.Errorf("%w after %v", errContainerTimeout, timeout)
+    }
+    if err := ctx.Err(); err != nil {
+        return nil, nil, err
+    }
 
-                if needsDownload {
-                    targetPath := filepath.Join(containerDir, blobInfo.Name)
-                    if err := s.downloadBlob(ctx, containerURL, blobInfo.Name, targetPath); err != nil {
-                        errChan <- fmt.Errorf("error downloading %s: %v", blobInfo.Name, err)
-                        return
-                    }
+    // Blobs that still fail keep their previous sync state, so the next run
+    // downloads them again instead of treating them as up to date
+    for name, failure := range failed {
+        s.logger.Error("[%s] Error downloading %s: %v", containerName, name, failure.err)
+        if previous, exists := metadata.Files[name]; exists {
+            currentFiles[name] = previous
+        } else {
+            delete(currentFiles, name)
+        }
+        stats.FailedFiles = append(stats.FailedFiles, name)
+    }
+    sort.Strings(stats.FailedFiles)
+    if len(stats.FailedFiles) > 0 {
+        s.logger.Warn("[%s] %d blobs could not be downloaded after %d retries; the backup will miss their latest version",
+            containerName, len(stats.FailedFiles), s.config.Backup.BlobMaxRetries)
+    }
 
-                    mu.Lock()
-                    stats.DownloadedFiles++
-                    mu.Unlock()
+    if stats.ExcludedFiles > 0 {
+        s.logger.Info("[%s] Excluded %d blobs matching BACKUP_EXCLUDE_BLOBS", containerName, stats.ExcludedFiles)
+    }
+    if stats.SizeSkipped > 0 {
+        s.logger.Info("[%s] Skipped %d blobs outside BACKUP_MIN_BLOB_SIZE/BACKUP_MAX_BLOB_SIZE; existing local copies are kept",
+            containerName, stats.SizeSkipped)
+    }
 
-                    s.logger.Info("[%s] Downloaded: %s", containerName, blobInfo.Name)
-                }
-            }(blobInfo)
+    // Blobs outside the prefix were not listed, so carry their previous state
+    // over instead of treating them as deleted
+    if prefix != "" {
+        for name, previous := range metadata.Files {
+            if !strings.HasPrefix(name, prefix) {
+                currentFiles[name] = previous
+            }
         }
     }
 
-    wg.Wait()
-    close(errChan)
+    s.retainDeletedBlobs(containerName, metadata, currentFiles, stats, time.Now())
+
+    stats.Changed = hasChanges(metadata.Files, currentFiles)
+
+    for name := range currentFiles {
+        stats.CurrentFiles = append(stats.CurrentFiles, name)
+    }
+    sort.Strings(stats.CurrentFiles)
 
     // Check for files that no longer exist in Azure
     err = filepath.Walk(containerDir, func(path string, info os.FileInfo, err error) error {
         if err != nil {
+            if dryRun && os.IsNotExist(err) {
+                return nil
+            }
             return err
         }
         if !info.IsDir() {
@@ -363,7 +719,15 @@ func (s *AzureService) processContainer(ctx context.Context, containerName strin
             if err != nil {
                 return err
             }
+            if !strings.HasPrefix(filepath.ToSlash(relPath), prefix) || relPath == utils.BlobPropertiesFile {
+                return nil
+            }
             if _, exists := currentFiles[relPath]; !exists {
+                stats.DeletedFiles++
+                if dryRun {
+                    s.logger.Info("[DRY RUN] [%s] Would remove deleted file: %s", containerName, relPath)
+                    return nil
+                }
                 s.logger.Info("[%s] Removing deleted file: %s", containerName, relPath)
                 if err := os.Remove(path); err != nil {
                     return err
@@ -377,26 +741,188 @@ func (s *AzureService) processContainer(ctx context.Context, containerName strin
         s.logger.Error("[%s] Error cleaning up deleted files: %v", containerName, err)
     }
 
-    // Check for download errors
-    var errors []error
-    for err := range errChan {
-        errors = append(errors, err)
+    if !dryRun {
+        if err := s.writeBlobProperties(containerDir, currentFiles); err != nil {
+            return nil, nil, err
+        }
     }
 
-    if len(errors) > 0 {
-        return stats, currentFiles, fmt.Errorf("encountered %d download errors: %v", len(errors), errors)
+    return stats, currentFiles, nil
+}
+
+// blobProperties returns the content headers and custom metadata of a
+// listed blob
+func blobProperties(blobInfo azblob.BlobItemInternal) *utils.BlobProperties {
+    value := func(s *string) string {
+        if s == nil {
+            return ""
+        }
+        return *s
+    }
+    // nil rather than empty, so the properties compare equal to those read
+    // back from the sync metadata, where an empty map is omitted
+    var metadata map[string]string
+    if len(blobInfo.Metadata) > 0 {
+        metadata = blobInfo.Metadata
+    }
+    return &utils.BlobProperties{
+        ContentType:        value(blobInfo.Properties.ContentType),
+        ContentEncoding:    value(blobInfo.Properties.ContentEncoding),
+        ContentLanguage:    value(blobInfo.Properties.ContentLanguage),
+        ContentDisposition: value(blobInfo.Properties.ContentDisposition),
+        CacheControl:       value(blobInfo.Properties.CacheControl),
+        Metadata:           metadata,
     }
+}
 
-    return stats, currentFiles, nil
+// writeBlobProperties writes the properties of the blobs in currentFiles
+// into containerDir, so they are archived with the blobs, or removes the
+// file left by an earlier run once BACKUP_PRESERVE_METADATA is turned off
+func (s *AzureService) writeBlobProperties(containerDir string, currentFiles map[string]BlobMetadata) error {
+    if !s.config.Backup.PreserveMetadata {
+        if err := os.Remove(filepath.Join(containerDir, utils.BlobPropertiesFile)); err != nil && !os.IsNotExist(err) {
+            return fmt.Errorf("failed to remove blob properties: %v", err)
+        }
+        return nil
+    }
+
+    properties := make(map[string]utils.BlobProperties, len(currentFiles))
+    for name, blob := range currentFiles {
+        if blob.Properties != nil {
+            properties[name] = *blob.Properties
+        }
+    }
+    return utils.WriteBlobProperties(containerDir, properties)
+}
+
+// retainDeletedBlobs keeps blobs that vanished from Azure in currentFiles,
+// and so in the local mirror, until BACKUP_DELETE_GRACE_DAYS have passed since
+// they were first missing. An accidental deletion in Azure then still reaches
+// the backups for a while.
+func (s *AzureService) retainDeletedBlobs(containerName string, metadata ContainerMetadata, currentFiles map[string]BlobMetadata, stats *ContainerStats, now time.Time) {
+    grace := time.Duration(s.config.Backup.DeleteGraceDays) * 24 * time.Hour
+    if grace <= 0 {
+        return
+    }
+
+    for name, previous := range metadata.Files {
+        if _, exists := currentFiles[name]; exists || matchBlob(s.config.Backup.ExcludeBlobs, name) {
+            continue
+        }
+
+        missingSince := now
+        if previous.MissingSince != nil {
+            missingSince = *previous.MissingSince
+        } else {
+            s.logger.Warn("[%s] Blob deleted in Azure, keeping it until %s: %s",
+                containerName, missingSince.Add(grace).Format("2006-01-02"), name)
+        }
+        if now.Sub(missingSince) >= grace {
+            continue // Grace period over, let the cleanup remove it
+        }
+
+        previous.MissingSince = &missingSince
+        currentFiles[name] = previous
+        stats.RetainedFiles++
+    }
+
+    if stats.RetainedFiles > 0 {
+        s.logger.Info("[%s] Keeping %d blobs deleted in Azure within the %d day grace period",
+            containerName, stats.RetainedFiles, s.config.Backup.DeleteGraceDays)
+    }
+}
+
+// hasChanges reports whether any blob was added, modified or deleted between
+// the previous sync and the current listing
+func hasChanges(previous, current map[string]BlobMetadata) bool {
+    if len(previous) != len(current) {
+        return true
+    }
+    for name, blob := range current {
+        old, exists := previous[name]
+        if !exists ||
+            !old.LastModified.Equal(blob.LastModified) ||
+            old.MD5Hash != blob.MD5Hash ||
+            old.Size != blob.Size ||
+            !reflect.DeepEqual(old.Properties, blob.Properties) {
+            return true
+        }
+    }
+    return false
 }
-func (s *AzureService) downloadBlob(ctx context.Context, containerURL azblob.ContainerURL, blobName, targetPath string) error {
+
+// errContainerTimeout marks a container abandoned after BACKUP_CONTAINER_TIMEOUT
+var errContainerTimeout = errors.New("container timed out")
+
+// blobFailure records a blob whose download failed so it can be retried
+type blobFailure struct {
+    blobInfo azblob.BlobItemInternal
+    err      error
+}
+
+// fetchBlob downloads a single blob, from snapshot when one is given, into
+// containerDir and records it in stats
+func (s *AzureService) fetchBlob(ctx context.Context, containerURL azblob.ContainerURL, containerName, containerDir string, blobInfo azblob.BlobItemInternal, snapshot string, stats *ContainerStats, mu *sync.Mutex) error {
+    var contentLength int64
+    if blobInfo.Properties.ContentLength != nil {
+        contentLength = *blobInfo.Properties.ContentLength
+    }
+
+    targetPath := filepath.Join(containerDir, blobInfo.Name)
+    if err := s.downloadBlob(ctx, containerURL, blobInfo.Name, snapshot, targetPath, contentLength); err != nil {
+        return err
+    }
+
+    s.applyFileAttributes(targetPath, blobInfo)
+
+    mu.Lock()
+    stats.DownloadedFiles++
+    stats.ChangedFiles = append(stats.ChangedFiles, blobInfo.Name)
+    mu.Unlock()
+    filesDownloadedTotal.Inc()
+    bytesDownloadedTotal.Add(float64(contentLength))
+
+    s.logger.Info("[%s] Downloaded: %s", containerName, blobInfo.Name)
+    return nil
+}
+
+// applyFileAttributes stamps a downloaded blob with its modification time so
+// the archive entry keeps it. An mtime/mode recorded by a previous restore
+// takes precedence over the blob's LastModified.
+func (s *AzureService) applyFileAttributes(targetPath string, blobInfo azblob.BlobItemInternal) {
+    modTime := blobInfo.Properties.LastModified
+    originalTime, mode, hasTime, hasMode := utils.ParseFileMetadata(blobInfo.Metadata)
+    if hasTime {
+        modTime = originalTime
+    }
+    if hasMode {
+        if err := os.Chmod(targetPath, mode); err != nil {
+            s.logger.Warn("Failed to set permissions on %s: %v", targetPath, err)
+        }
+    }
+    if err := os.Chtimes(targetPath, modTime, modTime); err != nil {
+        s.logger.Warn("Failed to set modification time on %s: %v", targetPath, err)
+    }
+}
+
+// downloadBlob downloads blobName, or the given snapshot of it, to targetPath
+func (s *AzureService) downloadBlob(ctx context.Context, containerURL azblob.ContainerURL, blobName, snapshot, targetPath string, size int64) error {
     blobURL := containerURL.NewBlockBlobURL(blobName)
+    if snapshot != "" {
+        blobURL = blobURL.WithSnapshot(snapshot)
+    }
 
     // Create parent directories if needed
     if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
         return fmt.Errorf("failed to create directory: %v", err)
     }
 
+    // Large blobs are fetched as concurrent ranged requests
+    chunkSize := s.config.Backup.BlobChunkSize
+    if chunkSize > 0 && size > chunkSize {
+        return s.downloadBlobChunked(ctx, blobURL, blobName, targetPath, size, chunkSize)
+    }
+
     // Create temp file
     tempPath := targetPath + ".tmp"
     outFile, err := os.Create(tempPath)
@@ -413,12 +939,21 @@ func (s *AzureService) downloadBlob(ctx context.Context, containerURL azblob.Con
     }
 
     reader := downloadResponse.Body(azblob.RetryReaderOptions{
-        MaxRetryRequests: 3,
+        MaxRetryRequests: s.config.Azure.ReaderMaxRetries,
     })
     defer reader.Close()
 
     // Copy with progress tracking
-    written, err := io.Copy(outFile, reader)
+    var source io.Reader = reader
+    if size > progressLogThreshold {
+        s.logger.Info("Downloading %s (%s)", blobName, utils.FormatBytes(size))
+        source = &utils.ProgressReader{
+            Reader:     reader,
+            Total:      size,
+            OnProgress: s.logDownloadProgress(blobName),
+        }
+    }
+    written, err := io.Copy(outFile, source)
     if err != nil {
         os.Remove(tempPath)
         return fmt.Errorf("failed to save blob data: %v", err)
@@ -439,6 +974,140 @@ func (s *AzureService) downloadBlob(ctx context.Context, containerURL azblob.Con
         return fmt.Errorf("failed to rename temp file: %v", err)
     }
 
-    s.logger.Debug("Downloaded %s (%d bytes)", blobName, written)
+    if size > progressLogThreshold {
+        s.logger.Info("Downloaded %s (%s)", blobName, utils.FormatBytes(written))
+    } else {
+        s.logger.Debug("Downloaded %s (%d bytes)", blobName, written)
+    }
+    return nil
+}
+
+// logDownloadProgress returns a progress callback logging the download of
+// blobName at most once per downloadProgressInterval
+func (s *AzureService) logDownloadProgress(blobName string) func(utils.Progress) {
+    lastLog := time.Now()
+    return func(p utils.Progress) {
+        if time.Since(lastLog) < downloadProgressInterval {
+            return
+        }
+        lastLog = time.Now()
+        s.logger.Info("Downloading %s: %.1f%% (%.2f MB/s, ETA %v)", blobName, p.Percent, p.Speed/1024/1024, p.ETA)
+    }
+}
+
+func (s *AzureService) downloadBlobChunked(ctx context.Context, blobURL azblob.BlockBlobURL, blobName, targetPath string, size, chunkSize int64) error {
+    // Create temp file
+    tempPath := targetPath + ".tmp"
+    outFile, err := os.Create(tempPath)
+    if err != nil {
+        return fmt.Errorf("failed to create temp file: %v", err)
+    }
+    defer outFile.Close()
+
+    if err := outFile.Truncate(size); err != nil {
+        os.Remove(tempPath)
+        return fmt.Errorf("failed to allocate temp file: %v", err)
+    }
+
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    // The ranges are written concurrently, so their bytes are summed by the meter
+    meter := &utils.ProgressMeter{Total: size}
+    if size > progressLogThreshold {
+        s.logger.Info("Downloading %s (%s)", blobName, utils.FormatBytes(size))
+        meter.OnProgress = s.logDownloadProgress(blobName)
+    }
+
+    var wg sync.WaitGroup
+    semaphore := make(chan struct{}, maxChunkWorkers)
+    errChan := make(chan error, 1)
+
+    for offset := int64(0); offset < size; offset += chunkSize {
+        count := chunkSize
+        if offset+count > size {
+            count = size - offset
+        }
+
+        wg.Add(1)
+        go func(offset, count int64) {
+            defer wg.Done()
+            semaphore <- struct{}{} // Acquire
+            defer func() { <-semaphore }() // Release
+
+            if err := s.downloadRange(ctx, blobURL, outFile, offset, count, meter); err != nil {
+                select {
+                case errChan <- fmt.Errorf("range %d-%d: %v", offset, offset+count-1, err):
+                    cancel()
+                default:
+                }
+            }
+        }(offset, count)
+    }
+
+    wg.Wait()
+    close(errChan)
+
+    if err := <-errChan; err != nil {
+        os.Remove(tempPath)
+        return fmt.Errorf("failed to download blob: %v", err)
+    }
+
+    // Sync to disk
+    if err := outFile.Sync(); err != nil {
+        os.Remove(tempPath)
+        return fmt.Errorf("failed to sync file: %v", err)
+    }
+
+    // Close file before rename
+    outFile.Close()
+
+    // Atomic rename
+    if err := os.Rename(tempPath, targetPath); err != nil {
+        os.Remove(tempPath)
+        return fmt.Errorf("failed to rename temp file: %v", err)
+    }
+
+    if size > progressLogThreshold {
+        s.logger.Info("Downloaded %s (%s)", blobName, utils.FormatBytes(size))
+    } else {
+        s.logger.Debug("Downloaded %s (%d bytes in %d byte chunks)", blobName, size, chunkSize)
+    }
     return nil
-}
\ No newline at end of file
+}
+
+// downloadRange writes count bytes of the blob from offset into outFile at
+// the same offset, adding them to meter as they arrive
+func (s *AzureService) downloadRange(ctx context.Context, blobURL azblob.BlockBlobURL, outFile *os.File, offset, count int64, meter *utils.ProgressMeter) error {
+    downloadResponse, err := blobURL.Download(ctx, offset, count, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+    if err != nil {
+        return err
+    }
+
+    reader := downloadResponse.Body(azblob.RetryReaderOptions{
+        MaxRetryRequests: s.config.Azure.ReaderMaxRetries,
+    })
+    defer reader.Close()
+
+    written, err := io.Copy(&meterWriter{Writer: io.NewOffsetWriter(outFile, offset), meter: meter}, reader)
+    if err != nil {
+        return err
+    }
+    if written != count {
+        return fmt.Errorf("short read: got %d of %d bytes", written, count)
+    }
+
+    return nil
+}
+
+// meterWriter adds every write to meter
+type meterWriter struct {
+    io.Writer
+    meter *utils.ProgressMeter
+}
+
+func (w *meterWriter) Write(p []byte) (int, error) {
+    n, err := w.Writer.Write(p)
+    w.meter.Add(int64(n))
+    return n, err
+}
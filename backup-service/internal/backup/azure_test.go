@@ -0,0 +1,233 @@
+package backup
+
+import (
+    "crypto/md5"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "shared/pkg/config"
+    "shared/pkg/utils"
+)
+
+func TestSyncMetadataMD5RoundTrip(t *testing.T) {
+    dir := t.TempDir()
+    s := &AzureService{
+        logger:       utils.NewLogger("[TEST]", "error", "text"),
+        metadataPath: filepath.Join(dir, "sync_metadata.json"),
+    }
+
+    content := []byte("hello azure backup")
+    blobPath := filepath.Join(dir, "blob.txt")
+    if err := os.WriteFile(blobPath, content, 0644); err != nil {
+        t.Fatalf("write blob: %v", err)
+    }
+
+    // Azure reports Content-MD5 as the raw digest bytes
+    sum := md5.Sum(content)
+    lastModified := time.Date(2024, 11, 14, 14, 41, 23, 0, time.UTC)
+
+    metadata := &SyncMetadata{
+        LastSync: lastModified,
+        Containers: map[string]ContainerMetadata{
+            "assets": {
+                Files: map[string]BlobMetadata{
+                    "blob.txt": {
+                        LastModified: lastModified,
+                        MD5Hash:      encodeContentMD5(sum[:]),
+                        Size:         int64(len(content)),
+                    },
+                },
+                LastSync: lastModified,
+            },
+        },
+    }
+
+    if err := s.saveSyncMetadata(metadata); err != nil {
+        t.Fatalf("saveSyncMetadata: %v", err)
+    }
+
+    loaded, err := s.loadSyncMetadata()
+    if err != nil {
+        t.Fatalf("loadSyncMetadata: %v", err)
+    }
+
+    got := loaded.Containers["assets"].Files["blob.txt"]
+    if got.MD5Hash != metadata.Containers["assets"].Files["blob.txt"].MD5Hash {
+        t.Fatalf("hash did not survive JSON round trip: got %q", got.MD5Hash)
+    }
+
+    local, err := s.calculateMD5(blobPath)
+    if err != nil {
+        t.Fatalf("calculateMD5: %v", err)
+    }
+    if got.MD5Hash != local {
+        t.Fatalf("stored hash %q does not match calculateMD5 %q", got.MD5Hash, local)
+    }
+}
+
+func TestEncodeContentMD5Empty(t *testing.T) {
+    if got := encodeContentMD5(nil); got != "" {
+        t.Fatalf("expected empty hash for blobs without Content-MD5, got %q", got)
+    }
+}
+
+func TestHasChanges(t *testing.T) {
+    lastModified := time.Date(2024, 11, 14, 14, 41, 23, 0, time.UTC)
+    previous := map[string]BlobMetadata{
+        "a.txt": {LastModified: lastModified, MD5Hash: "abc", Size: 10},
+        "b.txt": {LastModified: lastModified, MD5Hash: "def", Size: 20},
+    }
+
+    tests := []struct {
+        name    string
+        current map[string]BlobMetadata
+        want    bool
+    }{
+        {"unchanged", map[string]BlobMetadata{
+            "a.txt": {LastModified: lastModified, MD5Hash: "abc", Size: 10},
+            "b.txt": {LastModified: lastModified.In(time.Local), MD5Hash: "def", Size: 20},
+        }, false},
+        {"added", map[string]BlobMetadata{
+            "a.txt": previous["a.txt"],
+            "b.txt": previous["b.txt"],
+            "c.txt": {LastModified: lastModified, Size: 5},
+        }, true},
+        {"deleted", map[string]BlobMetadata{
+            "a.txt": previous["a.txt"],
+        }, true},
+        {"renamed", map[string]BlobMetadata{
+            "a.txt": previous["a.txt"],
+            "c.txt": previous["b.txt"],
+        }, true},
+        {"modified", map[string]BlobMetadata{
+            "a.txt": previous["a.txt"],
+            "b.txt": {LastModified: lastModified.Add(time.Second), MD5Hash: "def", Size: 20},
+        }, true},
+        {"headers changed", map[string]BlobMetadata{
+            "a.txt": previous["a.txt"],
+            "b.txt": {LastModified: lastModified, MD5Hash: "def", Size: 20,
+                Properties: &utils.BlobProperties{CacheControl: "max-age=3600"}},
+        }, true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := hasChanges(previous, tt.current); got != tt.want {
+                t.Errorf("hasChanges = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestRetainDeletedBlobs(t *testing.T) {
+    now := time.Date(2024, 11, 20, 1, 0, 0, 0, time.UTC)
+    firstMissing := now.Add(-48 * time.Hour)
+    longAgo := now.Add(-8 * 24 * time.Hour)
+
+    s := &AzureService{
+        logger: utils.NewLogger("[TEST]", "error", "text"),
+        config: &config.BackupServiceConfig{Backup: config.BackupConfig{
+            DeleteGraceDays: 7,
+            ExcludeBlobs:    []string{"*.tmp"},
+        }},
+    }
+
+    metadata := ContainerMetadata{Files: map[string]BlobMetadata{
+        "kept.txt":     {Size: 1},
+        "new-gone.txt": {Size: 2},
+        "old-gone.txt": {Size: 3, MissingSince: &firstMissing},
+        "expired.txt":  {Size: 4, MissingSince: &longAgo},
+        "scratch.tmp":  {Size: 5},
+    }}
+    currentFiles := map[string]BlobMetadata{"kept.txt": {Size: 1}}
+    stats := &ContainerStats{}
+
+    s.retainDeletedBlobs("assets", metadata, currentFiles, stats, now)
+
+    if got := currentFiles["new-gone.txt"].MissingSince; got == nil || !got.Equal(now) {
+        t.Errorf("new-gone.txt missing since %v, want %v", got, now)
+    }
+    if got := currentFiles["old-gone.txt"].MissingSince; got == nil || !got.Equal(firstMissing) {
+        t.Errorf("old-gone.txt missing since %v, want first missing time kept", got)
+    }
+    for _, name := range []string{"expired.txt", "scratch.tmp"} {
+        if _, exists := currentFiles[name]; exists {
+            t.Errorf("%s should be pruned", name)
+        }
+    }
+    if stats.RetainedFiles != 2 {
+        t.Errorf("RetainedFiles = %d, want 2", stats.RetainedFiles)
+    }
+}
+
+func TestInterruptedUploadRequiresFullBackup(t *testing.T) {
+    dir := t.TempDir()
+    s := &AzureService{
+        config: &config.BackupServiceConfig{Backup: config.BackupConfig{BackupPath: dir}},
+        logger: utils.NewLogger("[TEST]", "error", "text"),
+    }
+
+    s.markUploadPending("unchanged", &ContainerStats{})
+    s.markUploadPending("assets", &ContainerStats{Changed: true})
+    if _, err := os.Stat(uploadPendingPath(dir, "unchanged")); !os.IsNotExist(err) {
+        t.Errorf("unchanged container marked as pending upload")
+    }
+
+    // The run died before uploading; the next one must take a full backup
+    s.resumeInterruptedSync()
+    if _, err := os.Stat(uploadPendingPath(dir, "assets")); !os.IsNotExist(err) {
+        t.Errorf("pending marker still present after resume")
+    }
+    if _, err := os.Stat(fullRequiredPath(dir, "assets")); err != nil {
+        t.Errorf("full-required marker missing after resume: %v", err)
+    }
+}
+
+func TestNeedsUploadAfterInterruptedRun(t *testing.T) {
+    dir := t.TempDir()
+    cfg := &config.BackupServiceConfig{Backup: config.BackupConfig{BackupPath: dir}}
+    logger := utils.NewLogger("[TEST]", "error", "text")
+    azureService := &AzureService{config: cfg, logger: logger}
+    s := &BackupService{config: cfg, logger: logger, azureService: azureService}
+
+    // The interrupted run synced both containers but only uploaded "done"
+    azureService.markUploadPending("done", &ContainerStats{Changed: true})
+    azureService.markUploadPending("pending", &ContainerStats{Changed: true})
+    os.Remove(uploadPendingPath(dir, "done"))
+
+    // Dry runs see the marker as it was left
+    if !s.needsUpload("pending", &ContainerStats{}) {
+        t.Errorf("needsUpload(pending) = false before resume, want true")
+    }
+
+    azureService.resumeInterruptedSync()
+    if s.needsUpload("done", &ContainerStats{}) {
+        t.Errorf("needsUpload(done) = true, want the uploaded container skipped")
+    }
+    if !s.needsUpload("pending", &ContainerStats{}) {
+        t.Errorf("needsUpload(pending) = false, want the interrupted container uploaded")
+    }
+    if !s.needsUpload("changed", &ContainerStats{Changed: true}) {
+        t.Errorf("needsUpload(changed) = false, want true")
+    }
+}
+
+func TestMarkFullRequiredReportsFailure(t *testing.T) {
+    dir := t.TempDir()
+    cfg := &config.BackupServiceConfig{Backup: config.BackupConfig{BackupPath: filepath.Join(dir, "missing")}}
+    s := &BackupService{config: cfg, logger: utils.NewLogger("[TEST]", "error", "text")}
+
+    if err := s.markFullRequired("assets"); err == nil {
+        t.Errorf("markFullRequired succeeded without a writable backup path")
+    }
+
+    cfg.Backup.BackupPath = dir
+    if err := s.markFullRequired("assets"); err != nil {
+        t.Fatalf("markFullRequired: %v", err)
+    }
+    if _, err := os.Stat(s.fullRequiredPath("assets")); err != nil {
+        t.Errorf("full-required marker missing: %v", err)
+    }
+}
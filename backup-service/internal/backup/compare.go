@@ -0,0 +1,222 @@
+package backup
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "sort"
+    "time"
+
+    "github.com/Azure/azure-storage-blob-go/azblob"
+    "shared/pkg/azure"
+    "shared/pkg/gdrive"
+    "shared/pkg/utils"
+)
+
+// liveBlob is a blob currently stored in Azure
+type liveBlob struct {
+    Size         int64
+    LastModified time.Time
+}
+
+// comparison lists the blobs that differ between a backup and the live
+// container, each sorted by name
+type comparison struct {
+    Added     []string // in Azure but not in the backup
+    Removed   []string // in the backup but no longer in Azure
+    Changed   []string // size differs or modified after the backup was taken
+    Unchanged int
+}
+
+// compareFiles diffs the files of a backup taken at backupTime against the
+// live blobs of the same container
+func compareFiles(backup map[string]int64, live map[string]liveBlob, backupTime time.Time) comparison {
+    var result comparison
+    for name, blob := range live {
+        size, ok := backup[name]
+        switch {
+        case !ok:
+            result.Added = append(result.Added, name)
+        case size != blob.Size || blob.LastModified.After(backupTime):
+            result.Changed = append(result.Changed, name)
+        default:
+            result.Unchanged++
+        }
+    }
+    for name := range backup {
+        if _, ok := live[name]; !ok {
+            result.Removed = append(result.Removed, name)
+        }
+    }
+
+    sort.Strings(result.Added)
+    sort.Strings(result.Removed)
+    sort.Strings(result.Changed)
+    return result
+}
+
+// applyIncrementalFiles returns the files of a backup after the incremental
+// backup holding changed, whose manifest lists the kept blobs, is applied to
+// files: blobs missing from kept were deleted, the others take their size
+// from changed when the incremental holds them
+func applyIncrementalFiles(files, changed map[string]int64, kept map[string]struct{}) map[string]int64 {
+    result := make(map[string]int64, len(kept))
+    for name := range kept {
+        if size, ok := changed[name]; ok {
+            result[name] = size
+        } else if size, ok := files[name]; ok {
+            result[name] = size
+        }
+    }
+    return result
+}
+
+// latestBackupFiles returns the files of the latest backup of containerName:
+// its newest full backup with every incremental backup taken since applied.
+// The newest backup of that chain is returned with them.
+func (s *BackupService) latestBackupFiles(ctx context.Context, containerName string) (*gdrive.DriveBackup, map[string]int64, error) {
+    backup, err := s.driveService.LatestFullBackup(containerName)
+    if err != nil {
+        return nil, nil, err
+    }
+    files, _, err := s.driveService.BackupFiles(ctx, backup)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to read backup %s: %w", backup.Name, err)
+    }
+
+    incrementals, err := s.driveService.IncrementalBackups(containerName, backup.CreatedTime)
+    if err != nil {
+        return nil, nil, err
+    }
+    for _, inc := range incrementals {
+        changed, kept, err := s.driveService.BackupFiles(ctx, inc)
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to read incremental backup %s: %w", inc.Name, err)
+        }
+        files = applyIncrementalFiles(files, changed, kept)
+        backup = inc
+    }
+
+    // Files the backup adds next to the blobs
+    delete(files, utils.BlobPropertiesFile)
+    delete(files, utils.IncrementalManifest)
+    return backup, files, nil
+}
+
+// Compare diffs the latest backup of each configured container, its newest
+// full backup with every incremental backup taken since applied, against
+// what is in Azure now and writes a summary per container to w, followed by
+// every added (+), removed (-) and changed (~) blob when details is set.
+func (s *BackupService) Compare(ctx context.Context, w io.Writer, details bool) error {
+    containers, err := s.azureService.containerNames(ctx)
+    if err != nil {
+        return err
+    }
+
+    var failed int
+    for _, containerName := range containers {
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+
+        backup, backupFiles, err := s.latestBackupFiles(ctx, containerName)
+        if errors.Is(err, gdrive.ErrNoBackupFound) {
+            fmt.Fprintf(w, "%s: no backup in Google Drive\n", containerName)
+            continue
+        }
+        if err != nil {
+            s.logger.Error("[%s] Failed to read the latest backup: %v", containerName, err)
+            failed++
+            continue
+        }
+
+        live, err := s.azureService.liveBlobs(ctx, containerName)
+        if err != nil {
+            s.logger.Error("[%s] Failed to list blobs: %v", containerName, err)
+            failed++
+            continue
+        }
+
+        result := compareFiles(backupFiles, live, backup.CreatedTime)
+        fmt.Fprintf(w, "%s: %d added, %d removed, %d changed, %d unchanged since %s (%s)\n",
+            containerName, len(result.Added), len(result.Removed), len(result.Changed), result.Unchanged,
+            backup.Name, backup.CreatedTime.Format(time.RFC3339))
+
+        if details {
+            for _, name := range result.Added {
+                fmt.Fprintf(w, "  + %s\n", name)
+            }
+            for _, name := range result.Removed {
+                fmt.Fprintf(w, "  - %s\n", name)
+            }
+            for _, name := range result.Changed {
+                fmt.Fprintf(w, "  ~ %s\n", name)
+            }
+        }
+    }
+
+    if failed > 0 {
+        return fmt.Errorf("failed to compare %d of %d containers", failed, len(containers))
+    }
+    return nil
+}
+
+// containerNames returns the configured container or, for ALL, every
+// container that passes the include and exclude lists
+func (s *AzureService) containerNames(ctx context.Context) ([]string, error) {
+    if s.config.Azure.ContainerName != "ALL" {
+        return []string{s.config.Azure.ContainerName}, nil
+    }
+
+    var names []string
+    for marker := (azblob.Marker{}); marker.NotDone(); {
+        listContainer, err := s.serviceURL.ListContainersSegment(ctx, marker, azblob.ListContainersSegmentOptions{
+            MaxResults: int32(s.config.Azure.ListPageSize),
+        })
+        if err != nil {
+            return nil, fmt.Errorf("failed to list containers: %w", azure.ContainerError(err))
+        }
+        marker = listContainer.NextMarker
+
+        for _, container := range listContainer.ContainerItems {
+            if s.includeContainer(container.Name) {
+                names = append(names, container.Name)
+            }
+        }
+    }
+    return names, nil
+}
+
+// liveBlobs lists the blobs of containerName a backup would include, applying
+// the same prefix, exclude and size filters as the sync
+func (s *AzureService) liveBlobs(ctx context.Context, containerName string) (map[string]liveBlob, error) {
+    containerURL := s.serviceURL.NewContainerURL(containerName)
+    blobs := make(map[string]liveBlob)
+
+    for marker := (azblob.Marker{}); marker.NotDone(); {
+        listBlob, err := containerURL.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{
+            MaxResults: int32(s.config.Azure.ListPageSize),
+            Prefix:     s.config.Azure.BlobPrefix,
+        })
+        if err != nil {
+            return nil, fmt.Errorf("failed to list blobs: %w", azure.ContainerError(err))
+        }
+        marker = listBlob.NextMarker
+
+        for _, blobInfo := range listBlob.Segment.BlobItems {
+            if matchBlob(s.config.Backup.ExcludeBlobs, blobInfo.Name) {
+                continue
+            }
+            var size int64
+            if blobInfo.Properties.ContentLength != nil {
+                size = *blobInfo.Properties.ContentLength
+            }
+            if !blobSizeInRange(size, s.config.Backup.MinBlobSize, s.config.Backup.MaxBlobSize) {
+                continue
+            }
+            blobs[blobInfo.Name] = liveBlob{Size: size, LastModified: blobInfo.Properties.LastModified}
+        }
+    }
+    return blobs, nil
+}
@@ -0,0 +1,50 @@
+package backup
+
+import (
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestCompareFiles(t *testing.T) {
+    backupTime := time.Date(2024, 11, 14, 1, 0, 0, 0, time.UTC)
+    before := backupTime.Add(-time.Hour)
+
+    backup := map[string]int64{
+        "same.txt":      10,
+        "resized.txt":   10,
+        "touched.txt":   10,
+        "deleted.txt":   10,
+        "dir/other.txt": 5,
+    }
+    live := map[string]liveBlob{
+        "same.txt":      {Size: 10, LastModified: before},
+        "resized.txt":   {Size: 12, LastModified: before},
+        "touched.txt":   {Size: 10, LastModified: backupTime.Add(time.Minute)},
+        "dir/other.txt": {Size: 5, LastModified: before},
+        "new.txt":       {Size: 1, LastModified: backupTime.Add(time.Minute)},
+    }
+
+    result := compareFiles(backup, live, backupTime)
+    want := comparison{
+        Added:     []string{"new.txt"},
+        Removed:   []string{"deleted.txt"},
+        Changed:   []string{"resized.txt", "touched.txt"},
+        Unchanged: 2,
+    }
+    if !reflect.DeepEqual(result, want) {
+        t.Errorf("compareFiles = %+v, want %+v", result, want)
+    }
+}
+
+func TestApplyIncrementalFiles(t *testing.T) {
+    full := map[string]int64{"same.txt": 10, "changed.txt": 10, "deleted.txt": 10}
+    changed := map[string]int64{"changed.txt": 20, "added.txt": 5}
+    kept := map[string]struct{}{"same.txt": {}, "changed.txt": {}, "added.txt": {}}
+
+    got := applyIncrementalFiles(full, changed, kept)
+    want := map[string]int64{"same.txt": 10, "changed.txt": 20, "added.txt": 5}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("applyIncrementalFiles = %v, want %v", got, want)
+    }
+}
@@ -0,0 +1,54 @@
+package backup
+
+import (
+    "context"
+    "errors"
+
+    "shared/pkg/azure"
+    "shared/pkg/gdrive"
+)
+
+// Errors returned by a backup run, wrapped with the details of the failure.
+// Check for them with errors.Is; Drive failures wrap the gdrive errors.
+var (
+    // ErrAzureAuth means Azure Storage rejected the account credentials
+    ErrAzureAuth = azure.ErrAzureAuth
+    // ErrContainerNotAccessible means a container could not be read, e.g.
+    // it does not exist
+    ErrContainerNotAccessible = azure.ErrContainerNotAccessible
+    // ErrPartialBackup means an archive was uploaded but some changed blobs
+    // failed to download and are missing from it
+    ErrPartialBackup = errors.New("partial backup")
+    // ErrUploadFailed means an archive could not be uploaded to Google Drive
+    ErrUploadFailed = errors.New("upload to google drive failed")
+)
+
+// ErrorKind classifies a backup error for notifications and scripts. The
+// most specific cause wins, so a run failing on expired Drive credentials is
+// reported as "drive_auth" rather than "upload_failed".
+func ErrorKind(err error) string {
+    switch {
+    case err == nil:
+        return ""
+    case errors.Is(err, gdrive.ErrDriveAuth):
+        return "drive_auth"
+    case errors.Is(err, ErrAzureAuth):
+        return "azure_auth"
+    case errors.Is(err, gdrive.ErrDriveNotAccessible):
+        return "drive_not_accessible"
+    case errors.Is(err, ErrContainerNotAccessible):
+        return "container_not_accessible"
+    case errors.Is(err, gdrive.ErrDriveQuota):
+        return "drive_quota"
+    case errors.Is(err, errContainerTimeout):
+        return "timeout"
+    case errors.Is(err, context.Canceled):
+        return "cancelled"
+    case errors.Is(err, ErrUploadFailed):
+        return "upload_failed"
+    case errors.Is(err, ErrPartialBackup):
+        return "partial_backup"
+    default:
+        return "unknown"
+    }
+}
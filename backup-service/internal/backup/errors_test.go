@@ -0,0 +1,40 @@
+package backup
+
+import (
+    "errors"
+    "fmt"
+    "testing"
+
+    "shared/pkg/azure"
+    "shared/pkg/gdrive"
+)
+
+func TestErrorKind(t *testing.T) {
+    quota := fmt.Errorf("%w: %w", ErrUploadFailed, fmt.Errorf("%w: upload needs 2 GB", gdrive.ErrDriveQuota))
+    run := azure.NewContainerErrors("backup failed for 2 of 3 containers: assets, media",
+        fmt.Errorf("assets: %w", fmt.Errorf("%w uploaded, 1 blobs failed to download", ErrPartialBackup)),
+        fmt.Errorf("media: %w", fmt.Errorf("%w: %w", ErrUploadFailed, errors.New("connection reset"))),
+    )
+
+    tests := []struct {
+        name string
+        err  error
+        want string
+    }{
+        {"nil", nil, ""},
+        {"drive auth", fmt.Errorf("failed to access shared drive: %w", fmt.Errorf("%w: token expired", gdrive.ErrDriveAuth)), "drive_auth"},
+        {"container", fmt.Errorf("failed to process container assets: %w", azure.ContainerError(errors.New("ContainerNotFound"))), "container_not_accessible"},
+        {"quota wins over upload", quota, "drive_quota"},
+        {"upload wins over partial", run, "upload_failed"},
+        {"plain", errors.New("boom"), "unknown"},
+    }
+
+    for _, tt := range tests {
+        if got := ErrorKind(tt.err); got != tt.want {
+            t.Errorf("%s: ErrorKind() = %q, want %q", tt.name, got, tt.want)
+        }
+    }
+    if run.Error() != "backup failed for 2 of 3 containers: assets, media" {
+        t.Errorf("ContainerErrors message = %q", run.Error())
+    }
+}
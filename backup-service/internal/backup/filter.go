@@ -0,0 +1,56 @@
+package backup
+
+import (
+    "path"
+    "strings"
+)
+
+// matchContainer reports whether containerName matches any of the globs
+func matchContainer(patterns []string, containerName string) bool {
+    for _, pattern := range patterns {
+        if matched, _ := path.Match(pattern, containerName); matched {
+            return true
+        }
+    }
+    return false
+}
+
+// includeContainer applies the container allowlist and exclude list used
+// with ContainerName=ALL. A container must match BACKUP_INCLUDE_CONTAINERS,
+// when set, and not match BACKUP_EXCLUDE_CONTAINERS; exclude wins.
+func (s *AzureService) includeContainer(containerName string) bool {
+    if matchContainer(s.config.Backup.ExcludeContainers, containerName) {
+        return false
+    }
+    if len(s.config.Backup.IncludeContainers) == 0 {
+        return true
+    }
+    return matchContainer(s.config.Backup.IncludeContainers, containerName)
+}
+
+// blobSizeInRange reports whether a blob of size bytes lies within
+// BACKUP_MIN_BLOB_SIZE and BACKUP_MAX_BLOB_SIZE; a limit of 0 is no limit
+func blobSizeInRange(size, minSize, maxSize int64) bool {
+    if size < minSize {
+        return false
+    }
+    return maxSize == 0 || size <= maxSize
+}
+
+// matchBlob reports whether blobName matches any of the globs. A pattern
+// without "/" is also tried against the last path segment, so "*.tmp"
+// excludes "cache/a.tmp" as well as "a.tmp".
+func matchBlob(patterns []string, blobName string) bool {
+    base := path.Base(blobName)
+    for _, pattern := range patterns {
+        if matched, _ := path.Match(pattern, blobName); matched {
+            return true
+        }
+        if !strings.Contains(pattern, "/") {
+            if matched, _ := path.Match(pattern, base); matched {
+                return true
+            }
+        }
+    }
+    return false
+}
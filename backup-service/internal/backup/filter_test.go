@@ -0,0 +1,111 @@
+package backup
+
+import (
+    "testing"
+
+    "shared/pkg/config"
+)
+
+func TestMatchContainer(t *testing.T) {
+    patterns := []string{"tmp-*", "*-logs", "data?"}
+
+    tests := []struct {
+        name string
+        want bool
+    }{
+        {"tmp-build", true},
+        {"tmp-", true},
+        {"tmp", false},
+        {"app-logs", true},
+        {"-logs", true},
+        {"app-logs-archive", false},
+        {"data1", true},
+        {"data", false},
+        {"data12", false},
+        {"production", false},
+    }
+
+    for _, tt := range tests {
+        if got := matchContainer(patterns, tt.name); got != tt.want {
+            t.Errorf("matchContainer(%q) = %v, want %v", tt.name, got, tt.want)
+        }
+    }
+
+    if matchContainer(nil, "anything") {
+        t.Error("no patterns should match nothing")
+    }
+}
+
+func TestIncludeContainer(t *testing.T) {
+    s := &AzureService{config: &config.BackupServiceConfig{Backup: config.BackupConfig{
+        IncludeContainers: []string{"prod-*", "shared"},
+        ExcludeContainers: []string{"*-logs"},
+    }}}
+
+    tests := []struct {
+        name string
+        want bool
+    }{
+        {"prod-assets", true},
+        {"shared", true},
+        {"staging-assets", false},
+        {"prod-logs", false}, // exclude wins over include
+    }
+
+    for _, tt := range tests {
+        if got := s.includeContainer(tt.name); got != tt.want {
+            t.Errorf("includeContainer(%q) = %v, want %v", tt.name, got, tt.want)
+        }
+    }
+
+    s.config.Backup.IncludeContainers = nil
+    if !s.includeContainer("staging-assets") {
+        t.Error("without an allowlist every non-excluded container should be included")
+    }
+}
+
+func TestMatchBlob(t *testing.T) {
+    patterns := []string{"*.tmp", "cache/*", "data?"}
+
+    tests := []struct {
+        name string
+        want bool
+    }{
+        {"a.tmp", true},
+        {"nested/dir/a.tmp", true},
+        {"a.tmp.bak", false},
+        {"cache/item", true},
+        {"cache/nested/item", false},
+        {"other/cache/item", false},
+        {"data1", true},
+        {"dir/data1", true},
+        {"data/file", false},
+    }
+
+    for _, tt := range tests {
+        if got := matchBlob(patterns, tt.name); got != tt.want {
+            t.Errorf("matchBlob(%q) = %v, want %v", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestBlobSizeInRange(t *testing.T) {
+    tests := []struct {
+        size, min, max int64
+        want           bool
+    }{
+        {100, 0, 0, true},
+        {0, 0, 0, true},
+        {99, 100, 0, false},
+        {100, 100, 0, true},
+        {1000, 0, 1000, true},
+        {1001, 0, 1000, false},
+        {500, 100, 1000, true},
+    }
+
+    for _, tt := range tests {
+        if got := blobSizeInRange(tt.size, tt.min, tt.max); got != tt.want {
+            t.Errorf("blobSizeInRange(%d, %d, %d) = %v, want %v", tt.size, tt.min, tt.max, got, tt.want)
+        }
+    }
+}
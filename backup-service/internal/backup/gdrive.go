@@ -1,7 +1,15 @@
 package backup
 
 import (
+    "bytes"
     "context"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
 
     "shared/pkg/config"
     "shared/pkg/gdrive"
@@ -9,37 +17,229 @@ import (
 )
 
 type GoogleDriveBackup struct {
-    service *gdrive.GoogleDriveService
-    config  *config.BackupServiceConfig
-    logger  *utils.Logger
+    service      *gdrive.GoogleDriveService // first destination, used for every read
+    destinations []driveDestination         // every destination, the first one first
+    config       *config.BackupServiceConfig
+    logger       *utils.Logger
 }
 
+// driveDestination is one of the shared drives backups are uploaded to
+type driveDestination struct {
+    sharedDriveID string
+    service       *gdrive.GoogleDriveService
+}
+
+// DestinationResult is the outcome of uploading a backup to one shared drive
+type DestinationResult struct {
+    SharedDriveID string `json:"sharedDriveId"`
+    FileID        string `json:"fileId,omitempty"`
+    Error         string `json:"error,omitempty"`
+}
+
+// NewGoogleDriveBackup connects to every shared drive of
+// GOOGLE_SHARED_DRIVE_IDS. GOOGLE_FOLDER_ID belongs to one shared drive, so
+// it only applies to the first; the others receive backups at their root.
 func NewGoogleDriveBackup(cfg *config.BackupServiceConfig, logger *utils.Logger) (*GoogleDriveBackup, error) {
-    driveConfig := &gdrive.DriveConfig{
-        CredentialsPath: cfg.GoogleDrive.CredentialsPath,
-        TokenPath:       cfg.GoogleDrive.TokenPath,
-        SharedDriveID:   cfg.GoogleDrive.SharedDriveID,
-        FolderID:        cfg.GoogleDrive.FolderID,
+    b := &GoogleDriveBackup{
+        config: cfg,
+        logger: logger,
+    }
+
+    for i, sharedDriveID := range cfg.GoogleDrive.SharedDriveIDs {
+        driveConfig := &gdrive.DriveConfig{
+            CredentialsPath:    cfg.GoogleDrive.CredentialsPath,
+            TokenPath:          cfg.GoogleDrive.TokenPath,
+            TokenJSON:          cfg.GoogleDrive.TokenJSON,
+            SharedDriveID:      sharedDriveID,
+            AuthMode:           cfg.GoogleDrive.AuthMode,
+            ImpersonateSubject: cfg.GoogleDrive.ImpersonateSubject,
+            MaxRetries:         cfg.GoogleDrive.MaxRetries,
+            ListPageSize:       cfg.GoogleDrive.ListPageSize,
+            UploadChunkSize:    cfg.GoogleDrive.UploadChunkSize,
+            QuotaCheck:         cfg.GoogleDrive.QuotaCheck,
+            Progress:           &metricsProgressSink{next: utils.NewLogProgressSink(logger, "Uploading")},
+        }
+        if i == 0 {
+            driveConfig.FolderID = cfg.GoogleDrive.FolderID
+        }
+
+        service, err := gdrive.NewGoogleDriveService(driveConfig, logger)
+        if err != nil {
+            return nil, fmt.Errorf("shared drive %s: %w", sharedDriveID, err)
+        }
+        b.destinations = append(b.destinations, driveDestination{sharedDriveID: sharedDriveID, service: service})
+    }
+    b.service = b.destinations[0].service
+
+    return b, nil
+}
+
+// uploadEverywhere runs upload against every destination in turn; a failed
+// destination does not stop the others. It returns the backup stored in the
+// first destination that succeeded, the outcome per destination and an
+// error when any destination failed.
+func (b *GoogleDriveBackup) uploadEverywhere(upload func(service *gdrive.GoogleDriveService) (*gdrive.DriveBackup, error)) (*gdrive.DriveBackup, []DestinationResult, error) {
+    var uploaded *gdrive.DriveBackup
+    var failed []string
+    var errs []error
+    results := make([]DestinationResult, 0, len(b.destinations))
+
+    for _, destination := range b.destinations {
+        backup, err := upload(destination.service)
+        result := DestinationResult{SharedDriveID: destination.sharedDriveID}
+        if err != nil {
+            if len(b.destinations) > 1 {
+                b.logger.Error("Upload to shared drive %s failed: %v", destination.sharedDriveID, err)
+            }
+            result.Error = err.Error()
+            failed = append(failed, destination.sharedDriveID)
+            errs = append(errs, err)
+        } else {
+            result.FileID = backup.ID
+            if uploaded == nil {
+                uploaded = backup
+            }
+        }
+        results = append(results, result)
+    }
+
+    switch {
+    case len(errs) == 0:
+        return uploaded, results, nil
+    case len(b.destinations) == 1:
+        return nil, results, errs[0]
+    default:
+        return uploaded, results, fmt.Errorf("upload failed to %d of %d shared drives (%s): %w",
+            len(errs), len(b.destinations), strings.Join(failed, ", "), errors.Join(errs...))
+    }
+}
+
+// UploadBackup uploads the archive at zipPath to every destination
+func (b *GoogleDriveBackup) UploadBackup(ctx context.Context, zipPath string, containerName string) (*gdrive.DriveBackup, []DestinationResult, error) {
+    return b.uploadEverywhere(func(service *gdrive.GoogleDriveService) (*gdrive.DriveBackup, error) {
+        return service.UploadBackup(ctx, zipPath, containerName)
+    })
+}
+
+// UploadBackupVolumes uploads the archive at zipPath split into volumes of
+// at most volumeSize bytes as one backup to every destination
+func (b *GoogleDriveBackup) UploadBackupVolumes(ctx context.Context, zipPath string, volumeSize int64, containerName string) (*gdrive.DriveBackup, []DestinationResult, error) {
+    return b.uploadEverywhere(func(service *gdrive.GoogleDriveService) (*gdrive.DriveBackup, error) {
+        return service.UploadBackupVolumes(ctx, zipPath, volumeSize, containerName)
+    })
+}
+
+// UploadBackupStream uploads a backup of unknown size read from r. The
+// stream can only be read once, so the configuration allows a single
+// destination with it.
+func (b *GoogleDriveBackup) UploadBackupStream(ctx context.Context, r io.Reader, name string, containerName string) (*gdrive.DriveBackup, []DestinationResult, error) {
+    return b.uploadEverywhere(func(service *gdrive.GoogleDriveService) (*gdrive.DriveBackup, error) {
+        return service.UploadBackupStream(ctx, r, name, containerName)
+    })
+}
+
+// UploadTree uploads the files below sourceDir as a Drive folder tree to
+// every destination
+func (b *GoogleDriveBackup) UploadTree(ctx context.Context, sourceDir, name, containerName string) (*gdrive.DriveBackup, []DestinationResult, error) {
+    return b.uploadEverywhere(func(service *gdrive.GoogleDriveService) (*gdrive.DriveBackup, error) {
+        return service.UploadTree(ctx, sourceDir, name, containerName, b.config.Backup.MaxConcurrent)
+    })
+}
+
+// LatestFullBackupTime returns when the newest full backup of containerName was created
+func (b *GoogleDriveBackup) LatestFullBackupTime(containerName string) (time.Time, error) {
+    backup, err := b.service.GetLatestBackup(containerName)
+    if err != nil {
+        return time.Time{}, err
+    }
+    return backup.CreatedTime, nil
+}
+
+// LatestFullBackup returns the newest full backup of containerName
+func (b *GoogleDriveBackup) LatestFullBackup(containerName string) (*gdrive.DriveBackup, error) {
+    return b.service.GetLatestBackup(containerName)
+}
+
+// IncrementalBackups returns the incremental backups of containerName
+// created after the given time, oldest first
+func (b *GoogleDriveBackup) IncrementalBackups(containerName string, after time.Time) ([]*gdrive.DriveBackup, error) {
+    return b.service.GetIncrementalBackups(containerName, after, time.Time{})
+}
+
+// BackupFiles returns the size of every file stored in backup, keyed by its
+// slash-separated path in the container. For an incremental backup it also
+// returns the blobs listed in its manifest, which existed when it was taken;
+// kept is nil for other backups. Archives are downloaded into
+// BACKUP_TEMP_DIR, decrypted if needed and removed once listed; tree backups
+// only need their manifest.
+func (b *GoogleDriveBackup) BackupFiles(ctx context.Context, backup *gdrive.DriveBackup) (files map[string]int64, kept map[string]struct{}, err error) {
+    files = make(map[string]int64)
+
+    if gdrive.IsTreeBackup(backup.Name) {
+        manifest, err := b.service.ReadTreeManifest(ctx, backup.ID)
+        if err != nil {
+            return nil, nil, err
+        }
+        for _, file := range manifest.Files {
+            files[file.Path] = file.Size
+        }
+        return files, nil, nil
+    }
+
+    archivePath := filepath.Join(b.config.Backup.TempDir, backup.Name)
+    defer os.Remove(archivePath)
+    if err := b.service.DownloadBackup(ctx, backup, archivePath); err != nil {
+        return nil, nil, fmt.Errorf("failed to download %s: %w", backup.Name, err)
     }
 
-    service, err := gdrive.NewGoogleDriveService(driveConfig, logger)
+    plainPath, err := utils.DecryptIfNeeded(archivePath, b.config.Backup.EncryptionKey)
     if err != nil {
-        return nil, err
+        return nil, nil, fmt.Errorf("failed to decrypt %s: %v", backup.Name, err)
     }
+    defer os.Remove(plainPath)
 
-    return &GoogleDriveBackup{
-        service: service,
-        config:  cfg,
-        logger:  logger,
-    }, nil
+    entries, err := utils.ListArchive(plainPath)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to list %s: %v", backup.Name, err)
+    }
+    for _, entry := range entries {
+        files[entry.Name] = entry.Size
+    }
+
+    if gdrive.IsIncrementalBackup(backup.Name) {
+        data, err := utils.ReadArchiveFile(plainPath, utils.IncrementalManifest)
+        if err != nil {
+            return nil, nil, fmt.Errorf("incremental backup %s has no manifest: %v", backup.Name, err)
+        }
+        kept, err = utils.ParseIncrementalManifest(bytes.NewReader(data))
+        if err != nil {
+            return nil, nil, fmt.Errorf("invalid manifest in %s: %v", backup.Name, err)
+        }
+    }
+    return files, kept, nil
+}
+
+// CleanupOldBackups applies the retention policy to every destination on
+// its own; a failure in one destination does not stop the others
+func (b *GoogleDriveBackup) CleanupOldBackups(ctx context.Context, retentionDays, retentionCount int, dryRun bool) error {
+    var errs []error
+    for _, destination := range b.destinations {
+        if err := destination.service.CleanupOldBackups(ctx, retentionDays, retentionCount, dryRun); err != nil {
+            errs = append(errs, fmt.Errorf("shared drive %s: %w", destination.sharedDriveID, err))
+        }
+    }
+    return errors.Join(errs...)
 }
 
-func (b *GoogleDriveBackup) UploadBackup(ctx context.Context, zipPath string, containerName string) error {
-    return b.service.UploadBackup(ctx, zipPath, containerName)
+// StoredBytes returns the size of every file stored in the first
+// destination's backup folder
+func (b *GoogleDriveBackup) StoredBytes(ctx context.Context) (int64, error) {
+    return b.service.StoredBytes(ctx)
 }
 
-func (b *GoogleDriveBackup) CleanupOldBackups(ctx context.Context, retentionDays int) error {
-    return b.service.CleanupOldBackups(ctx, retentionDays)
+// ListAvailableBackups returns every backup in the first destination
+func (b *GoogleDriveBackup) ListAvailableBackups() ([]*gdrive.DriveBackup, error) {
+    return b.service.ListAvailableBackups()
 }
 
 func (b *GoogleDriveBackup) ListAvailableFolders() error {
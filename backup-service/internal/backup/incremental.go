@@ -0,0 +1,150 @@
+package backup
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "time"
+
+    "shared/pkg/utils"
+)
+
+// useIncremental reports whether the next archive of containerName can be an
+// incremental one in the given backup mode. A full backup is taken when none
+// exists yet, the newest one is older than FullEveryDays or a previous
+// incremental failed to upload.
+func (s *BackupService) useIncremental(mode, containerName string) bool {
+    if mode != "incremental" {
+        return false
+    }
+
+    if _, err := os.Stat(s.fullRequiredPath(containerName)); err == nil {
+        s.logger.Info("A previous backup of %s failed, taking a full backup", containerName)
+        return false
+    }
+    // Only seen by dry runs; a real run turns it into a full-required marker
+    if _, err := os.Stat(uploadPendingPath(s.config.Backup.BackupPath, containerName)); err == nil {
+        s.logger.Info("A previous backup of %s was interrupted, taking a full backup", containerName)
+        return false
+    }
+
+    lastFull, err := s.driveService.LatestFullBackupTime(containerName)
+    if err != nil {
+        s.logger.Info("No usable full backup for %s, taking a full backup: %v", containerName, err)
+        return false
+    }
+
+    interval := time.Duration(s.config.Backup.FullEveryDays) * 24 * time.Hour
+    if time.Since(lastFull) >= interval {
+        s.logger.Info("Last full backup of %s is older than %d days, taking a full backup",
+            containerName, s.config.Backup.FullEveryDays)
+        return false
+    }
+    return true
+}
+
+// fullRequiredPath marks a container whose changes since the last uploaded
+// archive are no longer tracked by the sync metadata. Container names cannot
+// start with ".", so the marker never clashes with a synced container.
+func (s *BackupService) fullRequiredPath(containerName string) string {
+    return fullRequiredPath(s.config.Backup.BackupPath, containerName)
+}
+
+func fullRequiredPath(backupPath, containerName string) string {
+    return filepath.Join(backupPath, "."+containerName+".full-required")
+}
+
+// markFullRequired writes the full-required marker of containerName. Without
+// it the next incremental backup would silently miss the changes, so a
+// failure is logged as an error and returned.
+func (s *BackupService) markFullRequired(containerName string) error {
+    if err := os.WriteFile(s.fullRequiredPath(containerName), nil, 0644); err != nil {
+        s.logger.Error("Failed to mark %s for a full backup, its next incremental backup would miss changes: %v", containerName, err)
+        return fmt.Errorf("failed to mark %s for a full backup: %v", containerName, err)
+    }
+    return nil
+}
+
+// uploadPendingExt ends the marker of a container synced with changes that
+// are not uploaded yet, see markUploadPending
+const uploadPendingExt = ".upload-pending"
+
+func uploadPendingPath(backupPath, containerName string) string {
+    return filepath.Join(backupPath, "."+containerName+uploadPendingExt)
+}
+
+// needsUpload reports whether containerName must be archived and uploaded:
+// its blobs changed in this sync, or a previous run failed to upload it or
+// stopped before uploading it. A run restarted after an interruption thereby
+// skips the containers that were already uploaded, since their sync metadata
+// is saved and their markers are cleared.
+func (s *BackupService) needsUpload(containerName string, stats *ContainerStats) bool {
+    if stats.Changed {
+        return true
+    }
+    for _, marker := range []string{
+        s.fullRequiredPath(containerName),
+        uploadPendingPath(s.config.Backup.BackupPath, containerName),
+    } {
+        if _, err := os.Stat(marker); err == nil {
+            return true
+        }
+    }
+    return false
+}
+
+// stageIncremental copies the blobs changed in this run into stagingDir,
+// together with the manifest of all current blobs so deletions can be replayed
+// and the properties of all of them when BACKUP_PRESERVE_METADATA is set
+func (s *BackupService) stageIncremental(containerDir, stagingDir string, stats *ContainerStats) error {
+    staged := stats.ChangedFiles
+    if _, err := os.Stat(filepath.Join(containerDir, utils.BlobPropertiesFile)); err == nil {
+        staged = append(staged[:len(staged):len(staged)], utils.BlobPropertiesFile)
+    }
+
+    for _, name := range staged {
+        source := filepath.Join(containerDir, name)
+        target := filepath.Join(stagingDir, name)
+        if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+            return fmt.Errorf("failed to create staging directory: %v", err)
+        }
+
+        // Hard links are free; fall back to a copy across file systems
+        if err := os.Link(source, target); err != nil {
+            if err := copyFile(source, target); err != nil {
+                return fmt.Errorf("failed to stage %s: %v", name, err)
+            }
+        }
+    }
+
+    return utils.WriteIncrementalManifest(stagingDir, stats.CurrentFiles)
+}
+
+// copyFile copies source to target, keeping its permissions and mtime
+func copyFile(source, target string) error {
+    in, err := os.Open(source)
+    if err != nil {
+        return err
+    }
+    defer in.Close()
+
+    info, err := in.Stat()
+    if err != nil {
+        return err
+    }
+
+    out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+    if err != nil {
+        return err
+    }
+    if _, err := io.Copy(out, in); err != nil {
+        out.Close()
+        return err
+    }
+    if err := out.Close(); err != nil {
+        return err
+    }
+
+    return os.Chtimes(target, info.ModTime(), info.ModTime())
+}
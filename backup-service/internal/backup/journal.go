@@ -0,0 +1,129 @@
+package backup
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/robfig/cron/v3"
+)
+
+// progressJournalName is the file in TEMP_DIR recording the containers a run
+// has uploaded. It matches the backup_* cleanup pattern, so a journal left
+// behind for longer than TEMP_CLEANUP_AGE is removed on startup.
+const progressJournalName = "backup_progress.json"
+
+// progressJournal records which containers a run has uploaded so far. A run
+// restarted in the same mode before the next scheduled backup is due skips
+// them instead of archiving and uploading them again. It is removed once a
+// run finishes without failures.
+type progressJournal struct {
+    Mode     string    `json:"mode"`
+    Started  time.Time `json:"started"`
+    Uploaded []string  `json:"uploaded"`
+}
+
+func (s *BackupService) progressJournalPath() string {
+    return filepath.Join(s.config.Backup.TempDir, progressJournalName)
+}
+
+// loadProgressJournal returns the journal of an unfinished run in mode that
+// belongs to the current schedule cycle, or a new one starting now
+func (s *BackupService) loadProgressJournal(mode string) *progressJournal {
+    now := time.Now()
+    fresh := &progressJournal{Mode: mode, Started: now}
+
+    data, err := os.ReadFile(s.progressJournalPath())
+    if err != nil {
+        if !os.IsNotExist(err) {
+            s.logger.Warn("Failed to read progress journal: %v", err)
+        }
+        return fresh
+    }
+
+    var journal progressJournal
+    if err := json.Unmarshal(data, &journal); err != nil {
+        s.logger.Warn("Ignoring unreadable progress journal: %v", err)
+        return fresh
+    }
+    if journal.Mode != mode || !s.sameCycle(journal.Started, now) {
+        s.logger.Info("Ignoring the progress journal of the %s run started %s",
+            journal.Mode, journal.Started.Format("2006-01-02 15:04:05"))
+        return fresh
+    }
+
+    s.logger.Info("Resuming the %s run started %s: %d containers already uploaded",
+        mode, journal.Started.Format("2006-01-02 15:04:05"), len(journal.Uploaded))
+    return &journal
+}
+
+// sameCycle reports whether no scheduled backup became due between started
+// and now, so a run at now still retries the run that began at started
+func (s *BackupService) sameCycle(started, now time.Time) bool {
+    location := s.config.Backup.TimeZone
+    if location == nil {
+        location = time.Local
+    }
+    for _, entry := range s.config.Backup.Schedules {
+        schedule, err := cron.ParseStandard(entry.Spec)
+        if err != nil {
+            return false
+        }
+        if !schedule.Next(started.In(location)).After(now) {
+            return false
+        }
+    }
+    return true
+}
+
+// uploaded reports whether containerName was uploaded earlier in this run
+func (j *progressJournal) uploaded(containerName string) bool {
+    for _, name := range j.Uploaded {
+        if name == containerName {
+            return true
+        }
+    }
+    return false
+}
+
+// recordUpload adds containerName to the journal and saves it
+func (s *BackupService) recordUpload(journal *progressJournal, containerName string) {
+    journal.Uploaded = append(journal.Uploaded, containerName)
+    if err := s.saveProgressJournal(journal); err != nil {
+        s.logger.Warn("Failed to update progress journal: %v", err)
+    }
+}
+
+// saveProgressJournal writes the journal through a temp file and rename, so
+// a crash never leaves a truncated journal behind
+func (s *BackupService) saveProgressJournal(journal *progressJournal) error {
+    if err := os.MkdirAll(s.config.Backup.TempDir, 0755); err != nil {
+        return fmt.Errorf("failed to create temp directory: %v", err)
+    }
+
+    data, err := json.MarshalIndent(journal, "", "    ")
+    if err != nil {
+        return fmt.Errorf("failed to encode progress journal: %v", err)
+    }
+
+    path := s.progressJournalPath()
+    tempPath := path + ".tmp"
+    if err := os.WriteFile(tempPath, data, 0644); err != nil {
+        os.Remove(tempPath)
+        return fmt.Errorf("failed to write progress journal: %v", err)
+    }
+    if err := os.Rename(tempPath, path); err != nil {
+        os.Remove(tempPath)
+        return fmt.Errorf("failed to save progress journal: %v", err)
+    }
+    return nil
+}
+
+// clearProgressJournal removes the journal once a run has finished
+func (s *BackupService) clearProgressJournal() {
+    if err := os.Remove(s.progressJournalPath()); err != nil && !os.IsNotExist(err) {
+        s.logger.Warn("Failed to remove progress journal: %v", err)
+    }
+}
@@ -0,0 +1,52 @@
+package backup
+
+import (
+    "os"
+    "testing"
+    "time"
+
+    "shared/pkg/config"
+    "shared/pkg/utils"
+)
+
+func TestProgressJournalResumesSameCycle(t *testing.T) {
+    cfg := &config.BackupServiceConfig{Backup: config.BackupConfig{
+        TempDir:   t.TempDir(),
+        Schedules: []config.ScheduleEntry{{Spec: "0 1 * * *", Mode: "incremental"}},
+        TimeZone:  time.UTC,
+    }}
+    s := &BackupService{config: cfg, logger: utils.NewLogger("[TEST]", "error", "text")}
+
+    // A run that uploaded one container before it died
+    journal := s.loadProgressJournal("incremental")
+    s.recordUpload(journal, "assets")
+
+    if restarted := s.loadProgressJournal("incremental"); !restarted.uploaded("assets") || restarted.uploaded("logs") {
+        t.Errorf("restarted run sees uploaded %v, want [assets]", restarted.Uploaded)
+    }
+    // A full backup must not skip containers an incremental run uploaded
+    if full := s.loadProgressJournal("full"); full.uploaded("assets") {
+        t.Errorf("full run resumed the journal of an incremental run")
+    }
+
+    s.clearProgressJournal()
+    if _, err := os.Stat(s.progressJournalPath()); !os.IsNotExist(err) {
+        t.Errorf("journal still exists after clearProgressJournal: %v", err)
+    }
+}
+
+func TestSameCycle(t *testing.T) {
+    cfg := &config.BackupServiceConfig{Backup: config.BackupConfig{
+        Schedules: []config.ScheduleEntry{{Spec: "0 1 * * *", Mode: "full"}},
+        TimeZone:  time.UTC,
+    }}
+    s := &BackupService{config: cfg}
+    started := time.Date(2024, 11, 14, 1, 0, 5, 0, time.UTC)
+
+    if !s.sameCycle(started, started.Add(6*time.Hour)) {
+        t.Errorf("a restart before the next scheduled run is not in the same cycle")
+    }
+    if s.sameCycle(started, started.Add(24*time.Hour)) {
+        t.Errorf("the next scheduled run resumed the previous cycle")
+    }
+}
@@ -0,0 +1,141 @@
+package backup
+
+import (
+    "fmt"
+    "net/http"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+
+    "shared/pkg/utils"
+)
+
+var (
+    backupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+        Name: "backup_runs_total",
+        Help: "Total number of backup runs by result",
+    }, []string{"result"})
+
+    filesDownloadedTotal = promauto.NewCounter(prometheus.CounterOpts{
+        Name: "backup_files_downloaded_total",
+        Help: "Total number of blobs downloaded from Azure",
+    })
+
+    filesSkippedTotal = promauto.NewCounter(prometheus.CounterOpts{
+        Name: "backup_files_skipped_total",
+        Help: "Total number of unchanged blobs skipped during sync",
+    })
+
+    bytesDownloadedTotal = promauto.NewCounter(prometheus.CounterOpts{
+        Name: "backup_bytes_downloaded_total",
+        Help: "Total bytes downloaded from Azure",
+    })
+
+    bytesUploadedTotal = promauto.NewCounter(prometheus.CounterOpts{
+        Name: "backup_bytes_uploaded_total",
+        Help: "Total bytes of backup archives uploaded to Google Drive",
+    })
+
+    uploadFailuresTotal = promauto.NewCounter(prometheus.CounterOpts{
+        Name: "backup_upload_failures_total",
+        Help: "Total number of failed archive or upload operations",
+    })
+
+    lastSuccessTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+        Name: "backup_last_success_timestamp_seconds",
+        Help: "Unix timestamp of the last successful backup run",
+    })
+
+    storedBackups = promauto.NewGauge(prometheus.GaugeOpts{
+        Name: "backup_drive_backups",
+        Help: "Number of backups stored in Google Drive, set when the storage report is enabled",
+    })
+
+    storedBytes = promauto.NewGauge(prometheus.GaugeOpts{
+        Name: "backup_drive_stored_bytes",
+        Help: "Total size of the files stored in the Google Drive backup folder, set when the storage report is enabled",
+    })
+
+    uploadProgressBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "backup_upload_progress_bytes",
+        Help: "Bytes sent so far of each archive being uploaded to Google Drive",
+    }, []string{"file"})
+
+    uploadSizeBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "backup_upload_size_bytes",
+        Help: "Size of each archive being uploaded to Google Drive, 0 while unknown",
+    }, []string{"file"})
+)
+
+// metricsProgressSink exports upload progress as gauges, removed again once
+// an upload ends, and passes it on to next
+type metricsProgressSink struct {
+    next utils.ProgressSink
+}
+
+// OnDone removes the gauges of an upload that ended, including one that
+// failed or was cancelled before reaching its total
+func (m *metricsProgressSink) OnDone(name string) {
+    uploadProgressBytes.DeleteLabelValues(name)
+    uploadSizeBytes.DeleteLabelValues(name)
+    utils.FinishProgress(m.next, name)
+}
+
+func (m *metricsProgressSink) OnProgress(name string, uploaded, total int64) {
+    if total > 0 && uploaded >= total {
+        uploadProgressBytes.DeleteLabelValues(name)
+        uploadSizeBytes.DeleteLabelValues(name)
+    } else {
+        uploadProgressBytes.WithLabelValues(name).Set(float64(uploaded))
+        uploadSizeBytes.WithLabelValues(name).Set(float64(total))
+    }
+    m.next.OnProgress(name, uploaded, total)
+}
+
+// StartMetricsServer exposes /metrics, /healthz and /trigger on the configured port
+func (s *BackupService) StartMetricsServer() {
+    mux := http.NewServeMux()
+    mux.Handle("/metrics", promhttp.Handler())
+    mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+        if !s.ready.Load() {
+            http.Error(w, "scheduler not started", http.StatusServiceUnavailable)
+            return
+        }
+        w.WriteHeader(http.StatusOK)
+        w.Write([]byte("ok"))
+    })
+    mux.HandleFunc("/trigger", s.handleTrigger)
+
+    addr := fmt.Sprintf(":%d", s.config.Common.MetricsPort)
+    go func() {
+        if err := http.ListenAndServe(addr, mux); err != nil && err != http.ErrServerClosed {
+            s.logger.Error("Metrics server stopped: %v", err)
+        }
+    }()
+    s.logger.Info("Metrics server listening on %s", addr)
+}
+
+// handleTrigger starts a backup in the background. It responds 409 when a
+// backup is already running.
+func (s *BackupService) handleTrigger(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    if !s.backupMu.TryLock() {
+        http.Error(w, ErrBackupInProgress.Error(), http.StatusConflict)
+        return
+    }
+
+    s.logger.Info("Manual backup triggered via HTTP")
+    go func() {
+        defer s.backupMu.Unlock()
+        s.executeBackup(s.ctx, s.config.Backup.Mode)
+    }()
+
+    w.WriteHeader(http.StatusAccepted)
+    w.Write([]byte("backup started"))
+}
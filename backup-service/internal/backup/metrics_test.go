@@ -0,0 +1,22 @@
+package backup
+
+import "testing"
+
+// nopProgressSink discards progress
+type nopProgressSink struct{}
+
+func (nopProgressSink) OnProgress(name string, uploaded, total int64) {}
+
+func TestMetricsProgressSinkRemovesGaugesOfFailedUpload(t *testing.T) {
+    sink := &metricsProgressSink{next: nopProgressSink{}}
+    sink.OnProgress("assets_20241114_010000.zip", 400, 1000)
+    sink.OnDone("assets_20241114_010000.zip")
+
+    // DeleteLabelValues reports whether the series still existed
+    if uploadProgressBytes.DeleteLabelValues("assets_20241114_010000.zip") {
+        t.Errorf("progress gauge kept after the upload ended")
+    }
+    if uploadSizeBytes.DeleteLabelValues("assets_20241114_010000.zip") {
+        t.Errorf("size gauge kept after the upload ended")
+    }
+}
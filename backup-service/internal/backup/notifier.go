@@ -0,0 +1,110 @@
+package backup
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "time"
+
+    "shared/pkg/utils"
+)
+
+// BackupReport summarizes a finished backup run for notifications and the
+// -json output of -once
+type BackupReport struct {
+    Status         string                     `json:"status"`
+    Mode           string                     `json:"mode"`
+    Duration       string                     `json:"duration"`
+    Containers     int                        `json:"containers"`
+    TotalBytes     int64                      `json:"totalBytes"`
+    Error          string                     `json:"error,omitempty"`
+    ErrorKind      string                     `json:"errorKind,omitempty"` // see ErrorKind
+    Timestamp      string                     `json:"timestamp"`
+    ContainerStats map[string]*ContainerStats `json:"containerStats,omitempty"`
+}
+
+type Notifier struct {
+    url    string
+    format string
+    client *http.Client
+    logger *utils.Logger
+}
+
+func NewNotifier(url, format string, logger *utils.Logger) *Notifier {
+    return &Notifier{
+        url:    url,
+        format: format,
+        client: &http.Client{Timeout: 10 * time.Second},
+        logger: logger,
+    }
+}
+
+// Notify posts the report to the webhook. Failures are logged and never
+// returned so a broken webhook can't affect the backup itself.
+func (n *Notifier) Notify(ctx context.Context, report *BackupReport) {
+    if n == nil || n.url == "" {
+        return
+    }
+
+    var payload interface{} = report
+    if n.format == "slack" {
+        payload = map[string]string{"text": slackText(report)}
+    }
+
+    body, err := json.Marshal(payload)
+    if err != nil {
+        n.logger.Warn("Failed to encode webhook payload: %v", err)
+        return
+    }
+
+    // One retry after a short pause
+    for attempt := 1; attempt <= 2; attempt++ {
+        if err = n.post(ctx, body); err == nil {
+            n.logger.Debug("Webhook notification sent (%s)", report.Status)
+            return
+        }
+        if attempt < 2 {
+            select {
+            case <-ctx.Done():
+                n.logger.Warn("Failed to send webhook notification: %v", err)
+                return
+            case <-time.After(2 * time.Second):
+            }
+        }
+    }
+    n.logger.Warn("Failed to send webhook notification: %v", err)
+}
+
+func (n *Notifier) post(ctx context.Context, body []byte) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+
+    resp, err := n.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        return fmt.Errorf("webhook returned status %s", resp.Status)
+    }
+    return nil
+}
+
+func slackText(report *BackupReport) string {
+    icon := ":white_check_mark:"
+    if report.Status != "success" {
+        icon = ":x:"
+    }
+    text := fmt.Sprintf("%s Backup %s in %s\n• Containers: %d\n• Total size: %s",
+        icon, report.Status, report.Duration, report.Containers, utils.FormatBytes(report.TotalBytes))
+    if report.Error != "" {
+        text += fmt.Sprintf("\n• Error (%s): `%s`", report.ErrorKind, report.Error)
+    }
+    return text
+}
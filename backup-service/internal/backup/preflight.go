@@ -0,0 +1,42 @@
+package backup
+
+import (
+    "context"
+    "fmt"
+    "strings"
+
+    "shared/pkg/azure"
+    "shared/pkg/config"
+    "shared/pkg/utils"
+)
+
+// Preflight returns the checks run by -check, in order: the Azure
+// credentials and access to the configured container (or to the account
+// listing for ALL), then the Google Drive credentials and access to the
+// shared drive and folder
+func Preflight(cfg *config.BackupServiceConfig) []utils.Check {
+    logger := utils.NewLogger("[CHECK]", cfg.Common.LogLevel, cfg.Common.LogFormat)
+
+    return []utils.Check{
+        {
+            Name: fmt.Sprintf("Azure Storage access (account %s, container %s)", cfg.Azure.AccountName, cfg.Azure.ContainerName),
+            Run: func(ctx context.Context) error {
+                serviceURL, err := azure.NewServiceURL(cfg.Azure)
+                if err != nil {
+                    return err
+                }
+                if err := azure.CheckContainerAccess(ctx, serviceURL, cfg.Azure.ContainerName); err != nil {
+                    return azure.ContainerError(err)
+                }
+                return nil
+            },
+        },
+        {
+            Name: fmt.Sprintf("Google Drive access (shared drive %s)", strings.Join(cfg.GoogleDrive.SharedDriveIDs, ", ")),
+            Run: func(ctx context.Context) error {
+                _, err := NewGoogleDriveBackup(cfg, logger)
+                return err
+            },
+        },
+    }
+}
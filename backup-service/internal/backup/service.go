@@ -2,13 +2,21 @@ package backup
 
 import (
     "context"
+    "errors"
     "fmt"
+    "io"
     "os"
     "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "sync/atomic"
     "time"
 
     "github.com/robfig/cron/v3"
+    "shared/pkg/azure"
     "shared/pkg/config"
+    "shared/pkg/gdrive"
     "shared/pkg/utils"
 )
 
@@ -17,10 +25,30 @@ type BackupService struct {
     logger       *utils.Logger
     azureService *AzureService
     driveService *GoogleDriveBackup
+    notifier     *Notifier
+    ready        atomic.Bool
+    lastReport   atomic.Pointer[BackupReport] // outcome of the last finished backup
+    backupMu     sync.Mutex // serializes scheduled, one-shot and triggered backups
+    cron         *cron.Cron
+    ctx          context.Context // cancelled by Shutdown to abort the running backup
+    cancel       context.CancelFunc
 }
 
+// ErrBackupInProgress is returned when a backup is requested while another one is running
+var ErrBackupInProgress = errors.New("a backup is already in progress")
+
+// errArchiveUnchanged is returned by archiveAndUpload when a deterministic
+// archive matches the one uploaded last time
+var errArchiveUnchanged = errors.New("archive unchanged since the last upload")
+
 func NewBackupService(cfg *config.BackupServiceConfig) (*BackupService, error) {
-    logger := utils.NewLogger("[BACKUP]", cfg.Common.LogLevel)
+    logger := utils.NewLogger("[BACKUP]", cfg.Common.LogLevel, cfg.Common.LogFormat)
+
+    // Archives and incremental staging directories left by a crashed run
+    if cfg.Backup.TempCleanupAge > 0 {
+        utils.CleanupTempDir(cfg.Backup.TempDir, cfg.Backup.TempCleanupAge,
+            []string{"backup_*", "inc_*", "*.zip", "*.tar.gz", "*.tar.zst", "*.enc", "*.[0-9][0-9][0-9]"}, logger)
+    }
 
     azureService, err := NewAzureService(cfg, logger)
     if err != nil {
@@ -32,65 +60,284 @@ func NewBackupService(cfg *config.BackupServiceConfig) (*BackupService, error) {
         return nil, fmt.Errorf("failed to initialize drive service: %v", err)
     }
 
+    ctx, cancel := context.WithCancel(context.Background())
+
     return &BackupService{
         config:       cfg,
         logger:       logger,
         azureService: azureService,
         driveService: driveService,
+        notifier:     NewNotifier(cfg.Backup.WebhookURL, cfg.Backup.WebhookFormat, logger),
+        ctx:          ctx,
+        cancel:       cancel,
     }, nil
 }
 
-func (s *BackupService) performBackup(ctx context.Context) error {
+// lockPath is the lock file a backup holds while it runs, so two processes
+// never share BackupPath and TempDir. Container names cannot start with
+// ".", so it never clashes with a synced container.
+func (s *BackupService) lockPath() string {
+    return filepath.Join(s.config.Backup.BackupPath, ".backup.lock")
+}
+
+// performBackup runs a full sync, archive and upload cycle in the given
+// backup mode ("full" or "incremental"). In dry-run mode nothing is written,
+// uploaded or deleted; planned actions are only logged. A backup started
+// while another process runs one returns ErrBackupInProgress.
+func (s *BackupService) performBackup(ctx context.Context, mode string, dryRun bool) (err error) {
+    if !dryRun {
+        lock, err := utils.AcquireFileLock(s.lockPath(), s.config.Backup.LockStaleAfter, s.logger)
+        if errors.Is(err, utils.ErrLocked) {
+            return fmt.Errorf("%w: %v", ErrBackupInProgress, err)
+        }
+        if err != nil {
+            return err
+        }
+        defer func() {
+            if err := lock.Release(); err != nil {
+                s.logger.Warn("Failed to release %s: %v", s.lockPath(), err)
+            }
+        }()
+    }
+
     startTime := time.Now()
-    s.logger.Info("Starting backup process...")
+    var stats map[string]*ContainerStats
+    var totalSize int64
+
+    if !dryRun {
+        defer func() {
+            report := &BackupReport{
+                Status:         "success",
+                Mode:           mode,
+                Duration:       time.Since(startTime).Round(time.Second).String(),
+                Containers:     len(stats),
+                TotalBytes:     totalSize,
+                Timestamp:      time.Now().Format(time.RFC3339),
+                ContainerStats: stats,
+            }
+            if err != nil {
+                report.Status = "failure"
+                report.Error = err.Error()
+                report.ErrorKind = ErrorKind(err)
+            }
+            s.lastReport.Store(report)
+            // ctx may already be cancelled; the notifier has its own timeout
+            s.notifier.Notify(context.Background(), report)
+        }()
+    }
+
+    if dryRun {
+        s.logger.Info("[DRY RUN] Starting %s backup process...", mode)
+    } else {
+        s.logger.Info("Starting %s backup process...", mode)
+    }
 
     // Create backup root directory if not exists
     backupRootDir := s.config.Backup.BackupPath
-    if err := os.MkdirAll(backupRootDir, 0755); err != nil {
-        return fmt.Errorf("failed to create backup directory: %v", err)
+    if !dryRun {
+        if err := os.MkdirAll(backupRootDir, 0755); err != nil {
+            return fmt.Errorf("failed to create backup directory: %v", err)
+        }
     }
 
     // Download/sync from Azure
-    stats, err := s.azureService.DownloadBlobs(ctx, backupRootDir)
+    stats, err = s.azureService.DownloadBlobs(ctx, backupRootDir, dryRun)
     if err != nil {
-        return fmt.Errorf("azure download failed: %v", err)
+        return fmt.Errorf("azure download failed: %w", err)
+    }
+    if err := ctx.Err(); err != nil {
+        return fmt.Errorf("backup cancelled: %w", err)
     }
 
-    // Create zip file for each container that had changes
-    var totalSize int64
+    // Containers a restarted run already uploaded in this schedule cycle
+    journal := s.loadProgressJournal(mode)
+
+    // Archive and upload every container that had changes, bounded by MaxConcurrent
+    var archives int
+    var succeeded, failed []string
+    var failures []error
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    semaphore := make(chan struct{}, s.config.Backup.MaxConcurrent)
+
     for containerName, containerStats := range stats {
-        if containerStats.DownloadedFiles > 0 {
-            // Create zip file
-            containerDir := filepath.Join(backupRootDir, containerName)
-            timestamp := time.Now().Format("20060102_150405")
-            zipPath := filepath.Join(s.config.Backup.TempDir,
-                fmt.Sprintf("%s_%s.zip", containerName, timestamp))
-
-            s.logger.Info("Creating backup archive for %s...", containerName)
-            if err := utils.ZipDirectory(containerDir, zipPath); err != nil {
-                s.logger.Error("Failed to create zip for %s: %v", containerName, err)
-                continue
+        if containerStats.TimedOut {
+            mu.Lock()
+            failed = append(failed, containerName)
+            failures = append(failures, fmt.Errorf("%s: %w", containerName, errContainerTimeout))
+            mu.Unlock()
+            continue
+        }
+
+        if containerStats.DownloadedFiles == 0 && len(containerStats.FailedFiles) > 0 {
+            s.logger.Error("Backup of %s failed: all %d changed blobs failed to download",
+                containerName, len(containerStats.FailedFiles))
+            mu.Lock()
+            failed = append(failed, containerName)
+            failures = append(failures, fmt.Errorf("%s: all %d changed blobs failed to download",
+                containerName, len(containerStats.FailedFiles)))
+            mu.Unlock()
+            continue
+        }
+
+        // Nothing was added, modified or deleted, and nothing is left over from
+        // a failed or interrupted run; after an interrupted run this skips the
+        // containers it had already uploaded
+        if !s.needsUpload(containerName, containerStats) {
+            s.logger.Info("Container %s is up to date, skipping backup", containerName)
+            if s.config.Backup.LocalMode == "ephemeral" && !dryRun {
+                if err := os.RemoveAll(filepath.Join(backupRootDir, containerName)); err != nil {
+                    s.logger.Warn("Failed to remove local copy of %s: %v", containerName, err)
+                }
             }
+            continue
+        }
 
-            // Upload to Google Drive
-            s.logger.Info("Uploading %s to Google Drive...", containerName)
-            if err := s.driveService.UploadBackup(ctx, zipPath, containerName); err != nil {
-                s.logger.Error("Failed to upload %s: %v", containerName, err)
-                os.Remove(zipPath)
+        if journal.uploaded(containerName) {
+            if dryRun {
+                s.logger.Info("[DRY RUN] Would skip %s, already uploaded in this cycle", containerName)
                 continue
             }
+            s.logger.Info("Container %s was already uploaded in this cycle, skipping backup", containerName)
+            // Changes synced since that upload are only in the local copy,
+            // so its next backup has to be a full one
+            if containerStats.Changed {
+                if err := s.markFullRequired(containerName); err != nil {
+                    mu.Lock()
+                    failed = append(failed, containerName)
+                    failures = append(failures, fmt.Errorf("%s: %w", containerName, err))
+                    mu.Unlock()
+                    continue
+                }
+            }
+            os.Remove(uploadPendingPath(s.config.Backup.BackupPath, containerName))
+            if s.config.Backup.LocalMode == "ephemeral" {
+                if err := os.RemoveAll(filepath.Join(backupRootDir, containerName)); err != nil {
+                    s.logger.Warn("Failed to remove local copy of %s: %v", containerName, err)
+                }
+            }
+            mu.Lock()
+            succeeded = append(succeeded, containerName)
+            mu.Unlock()
+            continue
+        }
 
-            // Cleanup temp zip file
-            os.Remove(zipPath)
+        if dryRun {
+            archiveName := s.archiveName(containerName, s.useIncremental(mode, containerName))
+            if s.config.Backup.EncryptionKey != "" {
+                archiveName += utils.EncryptedExt
+            }
+            s.logger.Info("[DRY RUN] Would create archive %s (%d changed, %d deleted files) and upload it to Google Drive",
+                archiveName, containerStats.DownloadedFiles, containerStats.DeletedFiles)
+            archives++
             totalSize += containerStats.TotalSize
+            continue
         }
+
+        wg.Add(1)
+        go func(containerName string, containerStats *ContainerStats) {
+            defer wg.Done()
+
+            semaphore <- struct{}{} // Acquire
+            defer func() { <-semaphore }() // Release
+
+            err := ctx.Err()
+            if err == nil {
+                err = s.archiveAndUpload(ctx, mode, backupRootDir, containerName, containerStats)
+            }
+            if errors.Is(err, errArchiveUnchanged) {
+                s.logger.Info("Skipping upload of %s: %v", containerName, err)
+                err = nil
+            }
+            // What did download is uploaded, but the container still counts as failed
+            if err == nil && len(containerStats.FailedFiles) > 0 {
+                err = fmt.Errorf("%w uploaded, %d blobs failed to download: %s", ErrPartialBackup,
+                    len(containerStats.FailedFiles), strings.Join(containerStats.FailedFiles, ", "))
+            }
+
+            // The sync metadata already counts these blobs as backed up, so
+            // the next run would see no changes and an incremental chain
+            // would silently miss them. If the marker cannot be written, the
+            // upload-pending marker is left for the next run to convert.
+            if err != nil {
+                if markErr := s.markFullRequired(containerName); markErr != nil {
+                    err = fmt.Errorf("%w; %v", err, markErr)
+                } else {
+                    os.Remove(uploadPendingPath(s.config.Backup.BackupPath, containerName))
+                }
+            } else {
+                os.Remove(s.fullRequiredPath(containerName))
+                os.Remove(uploadPendingPath(s.config.Backup.BackupPath, containerName))
+            }
+
+            mu.Lock()
+            defer mu.Unlock()
+            if err != nil {
+                s.logger.Error("Backup of %s failed: %v", containerName, err)
+                uploadFailuresTotal.Inc()
+                failed = append(failed, containerName)
+                failures = append(failures, fmt.Errorf("%s: %w", containerName, err))
+                return
+            }
+            succeeded = append(succeeded, containerName)
+            totalSize += containerStats.TotalSize
+            archives++
+            s.recordUpload(journal, containerName)
+
+            // The next run downloads the container again since nothing is kept
+            if s.config.Backup.LocalMode == "ephemeral" {
+                if err := os.RemoveAll(filepath.Join(backupRootDir, containerName)); err != nil {
+                    s.logger.Warn("Failed to remove local copy of %s: %v", containerName, err)
+                }
+            }
+        }(containerName, containerStats)
+    }
+    wg.Wait()
+
+    if err := ctx.Err(); err != nil {
+        return fmt.Errorf("backup cancelled: %w", err)
     }
 
     // Cleanup old backups from Google Drive
-    if err := s.driveService.CleanupOldBackups(ctx, s.config.Backup.RetentionDays); err != nil {
+    if err := s.driveService.CleanupOldBackups(ctx, s.config.Backup.RetentionDays, s.config.Backup.RetentionCount, dryRun); err != nil {
         s.logger.Error("Failed to cleanup old backups: %v", err)
     }
 
+    // After retention, so the total is what stays stored until the next run
+    if !dryRun && (s.config.Backup.StorageReport || s.config.Backup.StorageHistory) {
+        s.reportStorage(ctx)
+    }
+
+    if dryRun {
+        var downloads, skipped, excluded int
+        for _, containerStats := range stats {
+            downloads += containerStats.DownloadedFiles
+            skipped += containerStats.SkippedFiles
+            excluded += containerStats.ExcludedFiles
+        }
+        s.logger.Info("[DRY RUN] Summary:")
+        s.logger.Info("- Containers: %d", len(stats))
+        s.logger.Info("- Blobs to download: %d", downloads)
+        s.logger.Info("- Blobs unchanged: %d", skipped)
+        s.logger.Info("- Blobs excluded: %d", excluded)
+        s.logger.Info("- Archives to upload: %d (%.2f MB)", archives, float64(totalSize)/(1024*1024))
+        return nil
+    }
+
+    sort.Strings(succeeded)
+    sort.Strings(failed)
+    if len(succeeded) > 0 {
+        s.logger.Info("Uploaded containers: %s", strings.Join(succeeded, ", "))
+    }
+    if len(failed) > 0 {
+        s.logger.Error("Failed containers: %s", strings.Join(failed, ", "))
+        return azure.NewContainerErrors(fmt.Sprintf("backup failed for %d of %d containers: %s",
+            len(failed), len(failed)+len(succeeded), strings.Join(failed, ", ")), failures...)
+    }
+
+    s.clearProgressJournal()
+    lastSuccessTimestamp.SetToCurrentTime()
+
     duration := time.Since(startTime)
     s.logger.Info("Backup completed in %v", duration)
     s.logger.Info("Total containers processed: %d", len(stats))
@@ -99,28 +346,342 @@ func (s *BackupService) performBackup(ctx context.Context) error {
     return nil
 }
 
+// archiveName returns the file name of a new backup archive for containerName
+func (s *BackupService) archiveName(containerName string, incremental bool) string {
+    timestamp := time.Now().Format("20060102_150405")
+    ext := utils.ArchiveExt(s.config.Backup.ArchiveFormat)
+    if s.config.Backup.Layout == "tree" {
+        ext = gdrive.TreeManifestExt
+    }
+    name := fmt.Sprintf("%s_%s%s", containerName, timestamp, ext)
+    if incremental {
+        name = gdrive.IncrementalPrefix + name
+    }
+    return name
+}
+
+// newArchiver returns the archiver for ARCHIVE_FORMAT with the configured
+// compression and symlink handling
+func (s *BackupService) newArchiver() (utils.Archiver, error) {
+    return utils.NewArchiver(s.config.Backup.ArchiveFormat, utils.ArchiveOptions{
+        Symlinks:           s.config.Backup.ArchiveSymlinks,
+        Deterministic:      s.config.Backup.DeterministicZip,
+        Level:              s.config.Backup.CompressionLevel,
+        Store:              s.config.Backup.CompressionLevel == 0,
+        SmartCompression:   s.config.Backup.SmartCompression,
+        IncompressibleExts: incompressibleExts(s.config.Backup.StoreExtensions),
+    })
+}
+
+// incompressibleExts normalizes the configured extensions to a leading dot,
+// keeping nil so the default list applies when none are configured
+func incompressibleExts(exts []string) []string {
+    if len(exts) == 0 {
+        return nil
+    }
+    normalized := make([]string, len(exts))
+    for i, ext := range exts {
+        normalized[i] = "." + strings.TrimPrefix(ext, ".")
+    }
+    return normalized
+}
+
+// archiveAndUpload archives the synced directory of a single container,
+// encrypts it when a key is configured and uploads it to Google Drive.
+// In incremental mode only the blobs changed in this run are archived.
+// The temporary archive is always removed afterwards.
+func (s *BackupService) archiveAndUpload(ctx context.Context, mode, backupRootDir, containerName string, stats *ContainerStats) error {
+    containerDir := filepath.Join(backupRootDir, containerName)
+    if s.config.Backup.Layout == "tree" {
+        return s.uploadTree(ctx, containerDir, containerName, stats)
+    }
+
+    incremental := s.useIncremental(mode, containerName)
+    zipPath := filepath.Join(s.config.Backup.TempDir, s.archiveName(containerName, incremental))
+
+    archiver, err := s.newArchiver()
+    if err != nil {
+        return err
+    }
+
+    sourceDir := containerDir
+    if incremental {
+        sourceDir = strings.TrimSuffix(zipPath, archiver.Extension())
+        defer os.RemoveAll(sourceDir)
+        if err := s.stageIncremental(containerDir, sourceDir, stats); err != nil {
+            return fmt.Errorf("failed to stage incremental backup: %v", err)
+        }
+        s.logger.Info("Creating incremental backup archive for %s (%d changed files, compression level %d)...",
+            containerName, len(stats.ChangedFiles), s.config.Backup.CompressionLevel)
+    } else {
+        s.logger.Info("Creating backup archive for %s (compression level %d)...",
+            containerName, s.config.Backup.CompressionLevel)
+    }
+
+    if s.config.Backup.StreamUpload {
+        return s.streamArchive(ctx, archiver, sourceDir, filepath.Base(zipPath), containerName, stats)
+    }
+    if err := utils.ArchiveToFile(archiver, sourceDir, zipPath); err != nil {
+        os.Remove(zipPath)
+        return fmt.Errorf("failed to create archive: %v", err)
+    }
+
+    // A deterministic full archive identical to the last uploaded one adds
+    // nothing; the plain archive is hashed since encryption is randomized
+    var archiveHash string
+    if s.config.Backup.DeterministicZip && !incremental {
+        hash, err := utils.FileSHA256(zipPath)
+        if err != nil {
+            os.Remove(zipPath)
+            return fmt.Errorf("failed to hash archive: %v", err)
+        }
+        if previous, err := os.ReadFile(s.archiveHashPath(containerName)); err == nil && string(previous) == hash {
+            os.Remove(zipPath)
+            return errArchiveUnchanged
+        }
+        archiveHash = hash
+    }
+
+    // Encrypt archive if a key is configured
+    if s.config.Backup.EncryptionKey != "" {
+        encPath := zipPath + utils.EncryptedExt
+        s.logger.Info("Encrypting backup archive for %s...", containerName)
+        err := utils.EncryptFile(zipPath, encPath, s.config.Backup.EncryptionKey)
+        os.Remove(zipPath)
+        if err != nil {
+            return fmt.Errorf("failed to encrypt archive: %v", err)
+        }
+        zipPath = encPath
+    }
+    defer os.Remove(zipPath)
+
+    // Upload to Google Drive
+    s.logger.Info("Uploading %s to Google Drive...", containerName)
+    uploaded, results, err := s.uploadArchive(ctx, zipPath, containerName)
+    recordUpload(stats, uploaded, results)
+    if err != nil {
+        return fmt.Errorf("%w: %w", ErrUploadFailed, err)
+    }
+
+    if archiveHash != "" {
+        if err := os.WriteFile(s.archiveHashPath(containerName), []byte(archiveHash), 0644); err != nil {
+            s.logger.Warn("Failed to record archive hash for %s: %v", containerName, err)
+        }
+    }
+
+    return nil
+}
+
+// uploadArchive uploads the archive at zipPath, split into volumes of
+// BACKUP_MAX_VOLUME_SIZE when it is larger than that
+func (s *BackupService) uploadArchive(ctx context.Context, zipPath, containerName string) (*gdrive.DriveBackup, []DestinationResult, error) {
+    volumeSize := s.config.Backup.MaxVolumeSize
+    if volumeSize <= 0 {
+        return s.driveService.UploadBackup(ctx, zipPath, containerName)
+    }
+    info, err := os.Stat(zipPath)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to get archive info: %v", err)
+    }
+    if info.Size() <= volumeSize {
+        return s.driveService.UploadBackup(ctx, zipPath, containerName)
+    }
+
+    s.logger.Info("Uploading %s (%s) in volumes of up to %s",
+        filepath.Base(zipPath), utils.FormatBytes(info.Size()), utils.FormatBytes(volumeSize))
+    return s.driveService.UploadBackupVolumes(ctx, zipPath, volumeSize, containerName)
+}
+
+// uploadTree uploads the synced directory of a single container file by
+// file, mirroring its structure in a Drive folder instead of an archive
+func (s *BackupService) uploadTree(ctx context.Context, containerDir, containerName string, stats *ContainerStats) error {
+    s.logger.Info("Uploading %s to Google Drive as a folder tree...", containerName)
+    uploaded, results, err := s.driveService.UploadTree(ctx, containerDir, s.archiveName(containerName, false), containerName)
+    recordUpload(stats, uploaded, results)
+    if err != nil {
+        return fmt.Errorf("%w: %w", ErrUploadFailed, err)
+    }
+    return nil
+}
+
+// recordUpload stores the backup uploaded for a container in its stats,
+// along with the outcome per shared drive when there are several. uploaded
+// is nil when every destination failed.
+func recordUpload(stats *ContainerStats, uploaded *gdrive.DriveBackup, results []DestinationResult) {
+    if len(results) > 1 {
+        stats.Destinations = results
+    }
+    if uploaded != nil {
+        stats.UploadedFile, stats.UploadedFileID = uploaded.Name, uploaded.ID
+        bytesUploadedTotal.Add(float64(uploaded.Size))
+    }
+}
+
+// streamArchive archives sourceDir, encrypting it when a key is configured,
+// straight into a Drive upload through a pipe, so no temporary archive is
+// written to disk
+func (s *BackupService) streamArchive(ctx context.Context, archiver utils.Archiver, sourceDir, name, containerName string, stats *ContainerStats) error {
+    if s.config.Backup.EncryptionKey != "" {
+        name += utils.EncryptedExt
+    }
+
+    pr, pw := io.Pipe()
+    archived := make(chan struct{})
+    go func() {
+        defer close(archived)
+        pw.CloseWithError(s.writeArchive(pw, archiver, sourceDir))
+    }()
+
+    s.logger.Info("Streaming %s to Google Drive...", containerName)
+    uploaded, results, err := s.driveService.UploadBackupStream(ctx, pr, name, containerName)
+    // Unblocks the archiver if the upload stopped reading early, then waits
+    // for it to stop reading sourceDir, which the caller may remove next
+    pr.CloseWithError(err)
+    <-archived
+    recordUpload(stats, uploaded, results)
+    if err != nil {
+        return fmt.Errorf("%w: %w", ErrUploadFailed, err)
+    }
+    return nil
+}
+
+// writeArchive writes the archive of sourceDir to w, encrypted when a key is
+// configured
+func (s *BackupService) writeArchive(w io.Writer, archiver utils.Archiver, sourceDir string) error {
+    if s.config.Backup.EncryptionKey == "" {
+        return archiver.Archive(sourceDir, w)
+    }
+
+    pr, pw := io.Pipe()
+    archived := make(chan struct{})
+    go func() {
+        defer close(archived)
+        pw.CloseWithError(archiver.Archive(sourceDir, pw))
+    }()
+
+    err := utils.EncryptStream(pr, w, s.config.Backup.EncryptionKey)
+    pr.CloseWithError(err)
+    <-archived
+    return err
+}
+
+// archiveHashPath stores the SHA-256 of the last uploaded deterministic
+// archive of containerName
+func (s *BackupService) archiveHashPath(containerName string) string {
+    return filepath.Join(s.config.Backup.BackupPath, "."+containerName+".archive-sha256")
+}
+
+// StartScheduler registers every BACKUP_SCHEDULE entry. Runs never overlap:
+// an entry firing while another backup runs waits for it to finish, and an
+// entry that is still running or waiting skips its next tick.
 func (s *BackupService) StartScheduler() error {
     c := cron.New(cron.WithLocation(s.config.Backup.TimeZone))
 
-    _, err := c.AddFunc(s.config.Backup.Schedule, func() {
-        ctx := context.Background()
-        if err := s.performBackup(ctx); err != nil {
-            s.logger.Error("Backup failed: %v", err)
+    ids := make([]cron.EntryID, len(s.config.Backup.Schedules))
+    for i, entry := range s.config.Backup.Schedules {
+        entry := entry
+        var pending atomic.Bool
+        id, err := c.AddFunc(entry.Spec, func() {
+            if !pending.CompareAndSwap(false, true) {
+                s.logger.Warn("Skipping scheduled %s backup (%s): the previous run has not finished", entry.Mode, entry.Spec)
+                return
+            }
+            defer pending.Store(false)
+
+            s.backupMu.Lock()
+            defer s.backupMu.Unlock()
+            if s.ctx.Err() != nil {
+                return // shutting down
+            }
+            s.executeBackup(s.ctx, entry.Mode)
+        })
+        if err != nil {
+            return fmt.Errorf("failed to schedule backup %q: %v", entry.Spec, err)
         }
-    })
+        ids[i] = id
+    }
 
-    if err != nil {
-        return fmt.Errorf("failed to schedule backup: %v", err)
+    if s.config.Common.EnableMetrics {
+        s.StartMetricsServer()
     }
 
     c.Start()
+    s.cron = c
+    s.ready.Store(true)
     s.logger.Info("Backup scheduler started with schedule: %s", s.config.Backup.Schedule)
-    s.logger.Info("Next backup scheduled for: %s",
-        c.Entries()[0].Schedule.Next(time.Now()).Format("2006-01-02 15:04:05"))
+    for i, entry := range s.config.Backup.Schedules {
+        s.logger.Info("Next %s backup (%s) scheduled for: %s", entry.Mode, entry.Spec,
+            c.Entry(ids[i]).Schedule.Next(time.Now()).Format("2006-01-02 15:04:05"))
+    }
 
     return nil
 }
 
+// Shutdown stops the scheduler and cancels a running backup, then waits up
+// to timeout for it to abort and remove its temporary files. No new backups
+// can start afterwards.
+func (s *BackupService) Shutdown(timeout time.Duration) error {
+    s.ready.Store(false)
+    if s.cron != nil {
+        s.cron.Stop()
+    }
+    s.cancel()
+
+    // Every backup holds backupMu while it runs
+    done := make(chan struct{})
+    go func() {
+        s.backupMu.Lock()
+        close(done)
+    }()
+
+    select {
+    case <-done:
+        s.logger.Info("Backup service stopped")
+        return nil
+    case <-time.After(timeout):
+        return fmt.Errorf("timed out after %v waiting for the running backup to stop", timeout)
+    }
+}
+
+// RunOnce performs a single backup immediately. It returns ErrBackupInProgress
+// if another backup is currently running.
+func (s *BackupService) RunOnce(ctx context.Context) error {
+    if !s.backupMu.TryLock() {
+        return ErrBackupInProgress
+    }
+    defer s.backupMu.Unlock()
+
+    return s.executeBackup(ctx, s.config.Backup.Mode)
+}
+
+// executeBackup runs a backup in the given mode and records the outcome.
+// Callers must hold backupMu.
+func (s *BackupService) executeBackup(ctx context.Context, mode string) error {
+    err := s.performBackup(ctx, mode, false)
+    if errors.Is(err, ErrBackupInProgress) {
+        s.logger.Warn("Skipping %s backup: %v", mode, err)
+        return err
+    }
+    if err != nil {
+        backupsTotal.WithLabelValues("failure").Inc()
+        s.logger.Error("Backup failed: %v", err)
+        return err
+    }
+    backupsTotal.WithLabelValues("success").Inc()
+    return nil
+}
+
+// LastReport returns the outcome of the most recent backup, or nil if none
+// has finished yet
+func (s *BackupService) LastReport() *BackupReport {
+    return s.lastReport.Load()
+}
+
+// DryRun reports what the next backup would do without changing anything
+func (s *BackupService) DryRun(ctx context.Context) error {
+    return s.performBackup(ctx, s.config.Backup.Mode, true)
+}
+
 func (s *BackupService) ListFolders() error {
     return s.driveService.ListAvailableFolders()
 }
\ No newline at end of file
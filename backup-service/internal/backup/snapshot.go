@@ -0,0 +1,128 @@
+package backup
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "sync"
+    "time"
+
+    "github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// snapshotCleanupTimeout bounds the deletion of a container's snapshots,
+// which runs even after the container was cancelled or timed out
+const snapshotCleanupTimeout = 5 * time.Minute
+
+// snapshotBlobs snapshots every blob in blobs that may have to be downloaded
+// and returns the snapshot of each, keyed by blob name. A blob modified
+// between listing and snapshot gets the snapshot's properties, so the sync
+// state matches what is downloaded. A blob that cannot be snapshotted is
+// downloaded live.
+func (s *AzureService) snapshotBlobs(ctx context.Context, containerURL azblob.ContainerURL, containerName, containerDir string, blobs []azblob.BlobItemInternal, metadata ContainerMetadata) map[string]string {
+    snapshots := make(map[string]string)
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    semaphore := make(chan struct{}, s.config.Backup.MaxConcurrent)
+
+    for i := range blobs {
+        if !mayNeedDownload(containerDir, blobs[i], metadata) {
+            continue
+        }
+
+        wg.Add(1)
+        go func(blobInfo *azblob.BlobItemInternal) {
+            defer wg.Done()
+            semaphore <- struct{}{} // Acquire
+            defer func() { <-semaphore }() // Release
+
+            blobURL := containerURL.NewBlockBlobURL(blobInfo.Name)
+            resp, err := blobURL.CreateSnapshot(ctx, azblob.Metadata{}, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+            if err != nil {
+                s.logger.Warn("[%s] Failed to snapshot %s, downloading the live blob: %v", containerName, blobInfo.Name, err)
+                return
+            }
+            snapshot := resp.Snapshot()
+
+            if resp.ETag() != blobInfo.Properties.Etag {
+                props, err := blobURL.WithSnapshot(snapshot).GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+                if err != nil {
+                    s.logger.Warn("[%s] Failed to read snapshot of %s, downloading the live blob: %v", containerName, blobInfo.Name, err)
+                    s.deleteSnapshot(ctx, blobURL, snapshot)
+                    return
+                }
+                contentLength := props.ContentLength()
+                blobInfo.Properties.ContentLength = &contentLength
+                blobInfo.Properties.ContentMD5 = props.ContentMD5()
+                blobInfo.Properties.LastModified = props.LastModified()
+                blobInfo.Properties.Etag = props.ETag()
+            }
+
+            mu.Lock()
+            snapshots[blobInfo.Name] = snapshot
+            mu.Unlock()
+        }(&blobs[i])
+    }
+    wg.Wait()
+
+    s.logger.Info("[%s] Created %d blob snapshots", containerName, len(snapshots))
+    return snapshots
+}
+
+// mayNeedDownload reports whether blobInfo differs from the previous sync
+// by its timestamp or is missing locally. Blobs rewritten with identical
+// content are still snapshotted, since their MD5 is only compared later.
+func mayNeedDownload(containerDir string, blobInfo azblob.BlobItemInternal, metadata ContainerMetadata) bool {
+    previous, exists := metadata.Files[blobInfo.Name]
+    if !exists || !blobInfo.Properties.LastModified.Equal(previous.LastModified) {
+        return true
+    }
+    _, err := os.Stat(filepath.Join(containerDir, blobInfo.Name))
+    return err != nil
+}
+
+// deleteSnapshots removes the snapshots created by snapshotBlobs. It runs
+// with its own deadline so snapshots are cleaned up after a failed or
+// cancelled container as well.
+func (s *AzureService) deleteSnapshots(containerURL azblob.ContainerURL, containerName string, snapshots map[string]string) {
+    if len(snapshots) == 0 {
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), snapshotCleanupTimeout)
+    defer cancel()
+
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    var failed int
+    semaphore := make(chan struct{}, s.config.Backup.MaxConcurrent)
+
+    for name, snapshot := range snapshots {
+        wg.Add(1)
+        go func(name, snapshot string) {
+            defer wg.Done()
+            semaphore <- struct{}{} // Acquire
+            defer func() { <-semaphore }() // Release
+
+            if err := s.deleteSnapshot(ctx, containerURL.NewBlockBlobURL(name), snapshot); err != nil {
+                s.logger.Warn("[%s] Failed to delete snapshot %s of %s: %v", containerName, snapshot, name, err)
+                mu.Lock()
+                failed++
+                mu.Unlock()
+            }
+        }(name, snapshot)
+    }
+    wg.Wait()
+
+    if failed > 0 {
+        s.logger.Warn("[%s] %d of %d blob snapshots could not be deleted", containerName, failed, len(snapshots))
+        return
+    }
+    s.logger.Info("[%s] Deleted %d blob snapshots", containerName, len(snapshots))
+}
+
+// deleteSnapshot deletes a single snapshot of blobURL
+func (s *AzureService) deleteSnapshot(ctx context.Context, blobURL azblob.BlockBlobURL, snapshot string) error {
+    _, err := blobURL.WithSnapshot(snapshot).Delete(ctx, azblob.DeleteSnapshotsOptionNone, azblob.BlobAccessConditions{})
+    return err
+}
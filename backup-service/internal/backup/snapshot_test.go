@@ -0,0 +1,44 @@
+package backup
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+func TestMayNeedDownload(t *testing.T) {
+    containerDir := t.TempDir()
+    if err := os.WriteFile(filepath.Join(containerDir, "synced.txt"), []byte("x"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    synced := time.Date(2024, 11, 14, 1, 0, 0, 0, time.UTC)
+    metadata := ContainerMetadata{Files: map[string]BlobMetadata{
+        "synced.txt":  {LastModified: synced},
+        "missing.txt": {LastModified: synced},
+    }}
+
+    tests := []struct {
+        name         string
+        lastModified time.Time
+        want         bool
+    }{
+        {"synced.txt", synced, false},
+        {"synced.txt", synced.Add(time.Minute), true},
+        {"missing.txt", synced, true},
+        {"new.txt", synced, true},
+    }
+
+    for _, tt := range tests {
+        blobInfo := azblob.BlobItemInternal{
+            Name:       tt.name,
+            Properties: azblob.BlobPropertiesInternal{LastModified: tt.lastModified},
+        }
+        if got := mayNeedDownload(containerDir, blobInfo, metadata); got != tt.want {
+            t.Errorf("mayNeedDownload(%s, %v) = %v, want %v", tt.name, tt.lastModified, got, tt.want)
+        }
+    }
+}
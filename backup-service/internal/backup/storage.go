@@ -0,0 +1,153 @@
+package backup
+
+import (
+    "context"
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "time"
+
+    "shared/pkg/gdrive"
+    "shared/pkg/utils"
+)
+
+// storageHistoryHeader is the first line of the storage history file
+var storageHistoryHeader = []string{"timestamp", "backups", "total_bytes"}
+
+// storageRecord is one line of the storage history: the backups stored in
+// Google Drive at the end of a run
+type storageRecord struct {
+    Time       time.Time
+    Backups    int
+    TotalBytes int64
+}
+
+// storageHistoryPath is the CSV file the storage history is appended to.
+// Container names cannot start with ".", so it never clashes with a synced
+// container.
+func (s *BackupService) storageHistoryPath() string {
+    return filepath.Join(s.config.Backup.BackupPath, ".storage_history.csv")
+}
+
+// reportStorage logs the number of backups stored in Google Drive and the
+// size of every file they take up there, exports them as gauges and, with
+// StorageHistory, appends them to the history file together with the growth
+// since the previous run. Failures are only logged; they never fail the
+// backup.
+func (s *BackupService) reportStorage(ctx context.Context) {
+    backups, err := s.driveService.ListAvailableBackups()
+    if err != nil && !errors.Is(err, gdrive.ErrNoBackupFound) {
+        s.logger.Warn("Failed to list backups for the storage report: %v", err)
+        return
+    }
+
+    // The backups' own sizes leave out checksum files and the files of tree
+    // backups, so the stored files are summed instead
+    totalBytes, err := s.driveService.StoredBytes(ctx)
+    if err != nil {
+        s.logger.Warn("Failed to measure Google Drive storage: %v", err)
+        return
+    }
+    record := storageRecord{Time: time.Now(), Backups: len(backups), TotalBytes: totalBytes}
+    storedBackups.Set(float64(record.Backups))
+    storedBytes.Set(float64(record.TotalBytes))
+
+    if !s.config.Backup.StorageHistory {
+        s.logger.Info("Google Drive holds %d backups (%s)", record.Backups, utils.FormatBytes(record.TotalBytes))
+        return
+    }
+
+    path := s.storageHistoryPath()
+    previous, err := readLastStorageRecord(path)
+    if err != nil {
+        s.logger.Warn("Failed to read storage history: %v", err)
+    }
+    if previous != nil {
+        growth := record.TotalBytes - previous.TotalBytes
+        sign := "+"
+        if growth < 0 {
+            sign, growth = "-", -growth
+        }
+        s.logger.Info("Google Drive holds %d backups (%s, %s%s since %s)", record.Backups,
+            utils.FormatBytes(record.TotalBytes), sign, utils.FormatBytes(growth), previous.Time.Format(time.RFC3339))
+    } else {
+        s.logger.Info("Google Drive holds %d backups (%s)", record.Backups, utils.FormatBytes(record.TotalBytes))
+    }
+
+    if err := appendStorageRecord(path, record); err != nil {
+        s.logger.Warn("Failed to write storage history: %v", err)
+    }
+}
+
+// readLastStorageRecord returns the newest record of the history file at
+// path, or nil if the file does not exist or holds no records yet
+func readLastStorageRecord(path string) (*storageRecord, error) {
+    file, err := os.Open(path)
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    lines, err := csv.NewReader(file).ReadAll()
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+    }
+    if len(lines) < 2 {
+        return nil, nil
+    }
+
+    last := lines[len(lines)-1]
+    if len(last) != len(storageHistoryHeader) {
+        return nil, fmt.Errorf("malformed line in %s: %v", path, last)
+    }
+    recordTime, err := time.Parse(time.RFC3339, last[0])
+    if err != nil {
+        return nil, fmt.Errorf("malformed timestamp in %s: %v", path, err)
+    }
+    backups, err := strconv.Atoi(last[1])
+    if err != nil {
+        return nil, fmt.Errorf("malformed backup count in %s: %v", path, err)
+    }
+    totalBytes, err := strconv.ParseInt(last[2], 10, 64)
+    if err != nil {
+        return nil, fmt.Errorf("malformed size in %s: %v", path, err)
+    }
+    return &storageRecord{Time: recordTime, Backups: backups, TotalBytes: totalBytes}, nil
+}
+
+// appendStorageRecord appends record to the history file at path, writing
+// the header first when the file is new
+func appendStorageRecord(path string, record storageRecord) error {
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+    if err != nil {
+        return err
+    }
+
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return err
+    }
+
+    w := csv.NewWriter(file)
+    if info.Size() == 0 {
+        w.Write(storageHistoryHeader)
+    }
+    w.Write([]string{
+        record.Time.Format(time.RFC3339),
+        strconv.Itoa(record.Backups),
+        strconv.FormatInt(record.TotalBytes, 10),
+    })
+    w.Flush()
+    if err := w.Error(); err != nil {
+        file.Close()
+        return err
+    }
+    return file.Close()
+}
@@ -0,0 +1,32 @@
+package backup
+
+import (
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestStorageHistoryRoundTrip(t *testing.T) {
+    path := filepath.Join(t.TempDir(), ".storage_history.csv")
+
+    last, err := readLastStorageRecord(path)
+    if err != nil || last != nil {
+        t.Fatalf("readLastStorageRecord on a missing file = %v, %v, want nil, nil", last, err)
+    }
+
+    first := storageRecord{Time: time.Date(2024, 11, 14, 1, 0, 0, 0, time.UTC), Backups: 3, TotalBytes: 1000}
+    second := storageRecord{Time: time.Date(2024, 11, 15, 1, 0, 0, 0, time.UTC), Backups: 4, TotalBytes: 1500}
+    for _, record := range []storageRecord{first, second} {
+        if err := appendStorageRecord(path, record); err != nil {
+            t.Fatalf("appendStorageRecord: %v", err)
+        }
+    }
+
+    last, err = readLastStorageRecord(path)
+    if err != nil {
+        t.Fatalf("readLastStorageRecord: %v", err)
+    }
+    if last == nil || !last.Time.Equal(second.Time) || last.Backups != 4 || last.TotalBytes != 1500 {
+        t.Errorf("last record = %+v, want %+v", last, second)
+    }
+}
@@ -1,23 +1,53 @@
 package main
 
 import (
+    "context"
+    "encoding/json"
     "flag"
     "log"
     "os"
     "os/signal"
     "syscall"
+    "time"
 
     "shared/pkg/config"
+    "shared/pkg/utils"
     "backup-service/internal/backup"
 )
 
+// shutdownTimeout bounds how long a running backup may take to abort and
+// clean up after SIGINT/SIGTERM
+const shutdownTimeout = 30 * time.Second
+
 func main() {
     // Parse command line flags
     listFolders := flag.Bool("list-folders", false, "List available folders in Shared Drive")
+    once := flag.Bool("once", false, "Run a single backup immediately and exit")
+    dryRun := flag.Bool("dry-run", false, "Show what a backup would do without writing, uploading or deleting anything")
+    jsonOutput := flag.Bool("json", false, "With -once, print the backup result as JSON on stdout and send logs to stderr")
+    check := flag.Bool("check", false, "Check the configuration, Azure and Google Drive access, print PASS/FAIL for each and exit")
+    compare := flag.Bool("compare", false, "Compare the latest Google Drive backup of each container with live Azure, print what changed and exit")
+    details := flag.Bool("details", false, "With -compare, list every added, removed and changed blob")
     flag.Parse()
 
+    if *jsonOutput {
+        if !*once {
+            log.Fatalf("-json can only be used with -once")
+        }
+        utils.SetLogOutput(os.Stderr)
+    }
+    if *details && !*compare {
+        log.Fatalf("-details can only be used with -compare")
+    }
+
     // Load configuration
     cfg, err := config.LoadBackupConfig()
+    if *check {
+        if !utils.RunPreflight(context.Background(), os.Stdout, err, func() []utils.Check { return backup.Preflight(cfg) }) {
+            os.Exit(1)
+        }
+        os.Exit(0)
+    }
     if err != nil {
         log.Fatalf("Failed to load configuration: %v", err)
     }
@@ -36,15 +66,54 @@ func main() {
         return
     }
 
+    // Cancelled on SIGINT/SIGTERM
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
+
+    // If compare flag is set, diff the latest backups against Azure and exit
+    if *compare {
+        if err := service.Compare(ctx, os.Stdout, *details); err != nil {
+            log.Fatalf("Compare failed: %v", err)
+        }
+        return
+    }
+
+    // If dry-run flag is set, report the planned backup and exit
+    if *dryRun {
+        if err := service.DryRun(ctx); err != nil {
+            log.Fatalf("Dry run failed: %v", err)
+        }
+        return
+    }
+
+    // If once flag is set, run a backup now and exit
+    if *once {
+        err := service.RunOnce(ctx)
+        if *jsonOutput {
+            if report := service.LastReport(); report != nil {
+                encoder := json.NewEncoder(os.Stdout)
+                encoder.SetIndent("", "    ")
+                if err := encoder.Encode(report); err != nil {
+                    log.Printf("Failed to write JSON result: %v", err)
+                }
+            }
+        }
+        if err != nil {
+            log.Fatalf("Backup failed: %v", err)
+        }
+        return
+    }
+
     // Start scheduler
     if err := service.StartScheduler(); err != nil {
         log.Fatalf("Failed to start scheduler: %v", err)
     }
 
     // Wait for shutdown signal
-    sigChan := make(chan os.Signal, 1)
-    signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-    <-sigChan
+    <-ctx.Done()
 
-    log.Println("Shutting down...")
-}
\ No newline at end of file
+    log.Println("Shutting down, waiting for the running backup to stop...")
+    if err := service.Shutdown(shutdownTimeout); err != nil {
+        log.Fatalf("Shutdown failed: %v", err)
+    }
+}
@@ -2,20 +2,40 @@ package main
 
 import (
     "context"
+    "flag"
     "fmt"
     "os"
 
     "shared/pkg/config"
+    "shared/pkg/utils"
     "do-restore-service/internal/restore"
 )
 
 func main() {
+    workers := flag.Int("workers", 0, "Number of files uploaded to Spaces/S3 in parallel, overrides SPACES_MAX_CONCURRENT (0 = use the configured value)")
+    check := flag.Bool("check", false, "Check the configuration, Google Drive and object store access, print PASS/FAIL for each and exit")
+    flag.Parse()
+
+    if *workers < 0 {
+        fmt.Println("-workers cannot be negative")
+        os.Exit(1)
+    }
+
     // Load configuration from environment variables
     cfg, err := config.LoadDORestoreConfig()
+    if *check {
+        if !utils.RunPreflight(context.Background(), os.Stdout, err, func() []utils.Check { return restore.Preflight(cfg) }) {
+            os.Exit(1)
+        }
+        os.Exit(0)
+    }
     if err != nil {
         fmt.Printf("Failed to load configuration: %v\n", err)
         os.Exit(1)
     }
+    if *workers > 0 {
+        cfg.ObjectStore.MaxConcurrent = *workers
+    }
 
     // Create restore service
     service, err := restore.NewRestoreService(cfg)
@@ -30,4 +50,4 @@ func main() {
         fmt.Printf("Restore failed: %v\n", err)
         os.Exit(1)
     }
-}
\ No newline at end of file
+}
@@ -0,0 +1,165 @@
+package gcs
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "time"
+
+    "cloud.google.com/go/storage"
+    "google.golang.org/api/iterator"
+    "google.golang.org/api/option"
+
+    sconfig "shared/pkg/config"
+    "shared/pkg/utils"
+    "do-restore-service/internal/spaces"
+)
+
+// GCSService uploads restored files to a Google Cloud Storage bucket. It has
+// the same surface as spaces.SpacesService so either can be the restore target.
+type GCSService struct {
+    client   *storage.Client
+    bucket   *storage.BucketHandle
+    config   *sconfig.DORestoreServiceConfig
+    logger   *utils.Logger
+    progress utils.ProgressSink
+}
+
+// NewGCSService connects to the configured bucket. Upload progress is
+// reported to progress, or logged when it is nil.
+func NewGCSService(cfg *sconfig.DORestoreServiceConfig, logger *utils.Logger, progress utils.ProgressSink) (*GCSService, error) {
+    ctx := context.Background()
+
+    // Without a key file the client falls back to Application Default Credentials
+    var opts []option.ClientOption
+    if cfg.ObjectStore.GCSCredentialsPath != "" {
+        opts = append(opts, option.WithCredentialsFile(cfg.ObjectStore.GCSCredentialsPath))
+    }
+
+    client, err := storage.NewClient(ctx, opts...)
+    if err != nil {
+        return nil, fmt.Errorf("unable to create GCS client: %v", err)
+    }
+
+    // Verify bucket access
+    bucket := client.Bucket(cfg.ObjectStore.BucketName)
+    if _, err := bucket.Attrs(ctx); err != nil {
+        client.Close()
+        return nil, fmt.Errorf("failed to access bucket: %v", err)
+    }
+
+    logger.Info("Connected to GCS bucket %s", cfg.ObjectStore.BucketName)
+
+    if progress == nil {
+        progress = utils.NewLogProgressSink(logger, "Uploading")
+    }
+
+    return &GCSService{
+        client:   client,
+        bucket:   bucket,
+        config:   cfg,
+        logger:   logger,
+        progress: progress,
+    }, nil
+}
+
+func (s *GCSService) UploadFiles(ctx context.Context, sourcePath string, prefix string) (*spaces.UploadStats, error) {
+    stats := &spaces.UploadStats{}
+
+    err := filepath.Walk(sourcePath, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+
+        if info.IsDir() {
+            return nil
+        }
+
+        // Calculate object name (path in the bucket)
+        relPath, err := filepath.Rel(sourcePath, path)
+        if err != nil {
+            return fmt.Errorf("failed to get relative path: %v", err)
+        }
+
+        relPath = filepath.ToSlash(relPath)
+        objectName := filepath.Join(prefix, relPath)
+
+        startTime := time.Now()
+        s.logger.Info("Starting upload of %s (%s)", relPath, utils.FormatBytes(info.Size()))
+
+        if err := s.uploadFile(ctx, path, objectName, info); err != nil {
+            return fmt.Errorf("failed to upload %s: %v", path, err)
+        }
+
+        duration := time.Since(startTime)
+        speed := float64(info.Size()) / duration.Seconds() / 1024 / 1024 // MB/s
+        s.logger.Info("Uploaded %s (%s, %.2f MB/s)", relPath, utils.FormatBytes(info.Size()), speed)
+
+        stats.FilesCount++
+        stats.TotalSize += info.Size()
+
+        return nil
+    })
+
+    if err != nil {
+        return nil, fmt.Errorf("upload failed: %v", err)
+    }
+
+    return stats, nil
+}
+
+func (s *GCSService) uploadFile(ctx context.Context, path, objectName string, info os.FileInfo) error {
+    file, err := os.Open(path)
+    if err != nil {
+        return fmt.Errorf("failed to open file: %v", err)
+    }
+    defer file.Close()
+
+    progressReader := &utils.ProgressReader{
+        Reader: file,
+        Name:   objectName,
+        Total:  info.Size(),
+        Sink:   s.progress,
+    }
+    defer progressReader.Done()
+
+    // Large files go up as resumable uploads in PartSize chunks
+    writer := s.bucket.Object(objectName).NewWriter(ctx)
+    writer.ChunkSize = int(s.config.ObjectStore.PartSize)
+    writer.ContentType = utils.ContentType(path)
+    writer.Metadata = utils.FileMetadata(info) // original mtime and permissions
+
+    if _, err := io.Copy(writer, progressReader); err != nil {
+        writer.Close()
+        return err
+    }
+    return writer.Close()
+}
+
+func (s *GCSService) DeletePrefix(ctx context.Context, prefix string) error {
+    var deleted int
+    objects := s.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+    for {
+        attrs, err := objects.Next()
+        if errors.Is(err, iterator.Done) {
+            break
+        }
+        if err != nil {
+            return fmt.Errorf("failed to list objects: %v", err)
+        }
+
+        if err := s.bucket.Object(attrs.Name).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+            return fmt.Errorf("failed to delete %s: %v", attrs.Name, err)
+        }
+        deleted++
+    }
+
+    if deleted > 0 {
+        s.logger.Info("Deleted %d objects with prefix: %s", deleted, prefix)
+    }
+
+    return nil
+}
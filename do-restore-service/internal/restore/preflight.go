@@ -0,0 +1,35 @@
+package restore
+
+import (
+    "context"
+    "fmt"
+
+    "shared/pkg/config"
+    "shared/pkg/gdrive"
+    "shared/pkg/utils"
+)
+
+// Preflight returns the checks run by -check, in order: the Google Drive
+// credentials and access to the shared drive and folder, then the object
+// store credentials and access to the bucket. Both reuse the verification
+// the services do when they are created.
+func Preflight(cfg *config.DORestoreServiceConfig) []utils.Check {
+    logger := utils.NewLogger("[CHECK]", cfg.Common.LogLevel, cfg.Common.LogFormat)
+
+    return []utils.Check{
+        {
+            Name: fmt.Sprintf("Google Drive access (shared drive %s)", cfg.GoogleDrive.SharedDriveID),
+            Run: func(ctx context.Context) error {
+                _, err := gdrive.NewGoogleDriveService(newDriveConfig(cfg), logger)
+                return err
+            },
+        },
+        {
+            Name: fmt.Sprintf("Object store access (%s bucket %s)", cfg.ObjectStore.Provider, cfg.ObjectStore.BucketName),
+            Run: func(ctx context.Context) error {
+                _, err := newObjectStore(cfg, logger)
+                return err
+            },
+        },
+    }
+}
@@ -10,44 +10,85 @@ import (
     "shared/pkg/config"
     "shared/pkg/gdrive"
     "shared/pkg/utils"
+    "do-restore-service/internal/gcs"
     "do-restore-service/internal/spaces"
 )
 
+// ObjectStore is the restore target selected by OBJECT_STORE
+type ObjectStore interface {
+    UploadFiles(ctx context.Context, sourcePath string, prefix string) (*spaces.UploadStats, error)
+    DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// treeDownloadConcurrency is the number of files of a tree backup
+// downloaded at once
+const treeDownloadConcurrency = 4
+
 type RestoreService struct {
     config       *config.DORestoreServiceConfig
     logger       *utils.Logger
     driveService *gdrive.GoogleDriveService
-    spacesService *spaces.SpacesService
+    objectStore  ObjectStore
 }
 
 func NewRestoreService(cfg *config.DORestoreServiceConfig) (*RestoreService, error) {
-    logger := utils.NewLogger("[DO-RESTORE]", cfg.Common.LogLevel)
+    logger := utils.NewLogger("[DO-RESTORE]", cfg.Common.LogLevel, cfg.Common.LogFormat)
 
-    driveConfig := &gdrive.DriveConfig{
-        CredentialsPath: cfg.GoogleDrive.CredentialsPath,
-        TokenPath:       cfg.GoogleDrive.TokenPath,
-        SharedDriveID:   cfg.GoogleDrive.SharedDriveID,
-        FolderID:        cfg.GoogleDrive.FolderID,
+    // Restore directories left by a crashed run
+    if cfg.Restore.TempCleanupAge > 0 {
+        utils.CleanupTempDir(cfg.Restore.TempDir, cfg.Restore.TempCleanupAge, []string{"restore_*"}, logger)
     }
 
-    driveService, err := gdrive.NewGoogleDriveService(driveConfig, logger)
+    driveService, err := gdrive.NewGoogleDriveService(newDriveConfig(cfg), logger)
     if err != nil {
         return nil, fmt.Errorf("failed to initialize drive service: %v", err)
     }
 
-    spacesService, err := spaces.NewSpacesService(cfg, logger)
+    objectStore, err := newObjectStore(cfg, logger)
     if err != nil {
-        return nil, fmt.Errorf("failed to initialize spaces service: %v", err)
+        return nil, err
     }
 
     return &RestoreService{
-        config:        cfg,
-        logger:        logger,
-        driveService:  driveService,
-        spacesService: spacesService,
+        config:       cfg,
+        logger:       logger,
+        driveService: driveService,
+        objectStore:  objectStore,
     }, nil
 }
 
+// newDriveConfig returns the Google Drive settings of cfg
+func newDriveConfig(cfg *config.DORestoreServiceConfig) *gdrive.DriveConfig {
+    return &gdrive.DriveConfig{
+        CredentialsPath:    cfg.GoogleDrive.CredentialsPath,
+        TokenPath:          cfg.GoogleDrive.TokenPath,
+        TokenJSON:          cfg.GoogleDrive.TokenJSON,
+        SharedDriveID:      cfg.GoogleDrive.SharedDriveID,
+        FolderID:           cfg.GoogleDrive.FolderID,
+        AuthMode:           cfg.GoogleDrive.AuthMode,
+        ImpersonateSubject: cfg.GoogleDrive.ImpersonateSubject,
+        MaxRetries:         cfg.GoogleDrive.MaxRetries,
+        ListPageSize:       cfg.GoogleDrive.ListPageSize,
+    }
+}
+
+// newObjectStore connects to the configured restore target
+func newObjectStore(cfg *config.DORestoreServiceConfig, logger *utils.Logger) (ObjectStore, error) {
+    if cfg.ObjectStore.Provider == "gcs" {
+        gcsService, err := gcs.NewGCSService(cfg, logger, nil)
+        if err != nil {
+            return nil, fmt.Errorf("failed to initialize gcs service: %v", err)
+        }
+        return gcsService, nil
+    }
+
+    spacesService, err := spaces.NewSpacesService(cfg, logger, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize spaces service: %v", err)
+    }
+    return spacesService, nil
+}
+
 func (s *RestoreService) performRestore(ctx context.Context) error {
     startTime := time.Now()
     s.logger.Info("Starting restore process...")
@@ -72,38 +113,100 @@ func (s *RestoreService) performRestore(ctx context.Context) error {
     }
     defer os.RemoveAll(tempDir)
 
+    extractPath := filepath.Join(tempDir, "extracted")
+    if gdrive.IsTreeBackup(backup.Name) {
+        s.logger.Info("Downloading tree backup files...")
+        manifest, err := s.driveService.ReadTreeManifest(ctx, backup.ID)
+        if err != nil {
+            return fmt.Errorf("failed to read backup manifest: %v", err)
+        }
+        if err := s.driveService.DownloadTree(ctx, manifest, extractPath, treeDownloadConcurrency); err != nil {
+            return fmt.Errorf("failed to download backup: %v", err)
+        }
+    } else if err := s.downloadArchive(ctx, backup, tempDir, extractPath); err != nil {
+        return err
+    }
+
+    // Replace the existing files, or merge the restored files over them.
+    // Stale objects left by a failed cleanup would mix into the restored
+    // data, so the restore stops.
+    if s.config.Restore.CleanBefore {
+        s.logger.Info("Cleaning up existing files in bucket %s (RESTORE_CLEAN_BEFORE=true)...", s.config.ObjectStore.BucketName)
+        if err := s.objectStore.DeletePrefix(ctx, s.config.Restore.ContainerName); err != nil {
+            return fmt.Errorf("failed to cleanup existing files: %v", err)
+        }
+    } else {
+        s.logger.Info("Merging restored files over existing files in bucket %s (RESTORE_CLEAN_BEFORE=false)", s.config.ObjectStore.BucketName)
+    }
+
+    // Upload to the object store
+    s.logger.Info("Uploading files to bucket %s...", s.config.ObjectStore.BucketName)
+    stats, err := s.objectStore.UploadFiles(ctx, extractPath, s.config.Restore.ContainerName)
+    if err != nil {
+        return fmt.Errorf("failed to upload to object store: %v", err)
+    }
+
+    duration := time.Since(startTime)
+    s.logger.Info("Restore completed in %v:", duration)
+    s.logger.Info("- Files processed: %d", stats.FilesCount)
+    s.logger.Info("- Total size: %.2f MB", float64(stats.TotalSize)/(1024*1024))
+    s.logger.Info("- Average speed: %.2f MB/s", float64(stats.TotalSize)/(1024*1024)/duration.Seconds())
+
+    return nil
+}
+
+// extractLimits bounds what extracting a single archive may write
+func (s *RestoreService) extractLimits() utils.ExtractLimits {
+    return utils.ExtractLimits{MaxSize: s.config.Restore.MaxExtractSize, MaxEntries: s.config.Restore.MaxEntries}
+}
+
+// downloadArchive downloads, decrypts and extracts an archive backup into
+// extractPath, then replays the incremental backups taken after it
+func (s *RestoreService) downloadArchive(ctx context.Context, backup *gdrive.DriveBackup, tempDir, extractPath string) error {
     // Download backup from Google Drive
     s.logger.Info("Downloading backup file...")
     zipPath := filepath.Join(tempDir, backup.Name)
-    if err := s.driveService.DownloadFile(ctx, backup.ID, zipPath); err != nil {
+    if err := s.driveService.DownloadBackup(ctx, backup, zipPath); err != nil {
         return fmt.Errorf("failed to download backup: %v", err)
     }
 
+    // Decrypt backup if it was encrypted
+    zipPath, err := utils.DecryptIfNeeded(zipPath, s.config.Restore.EncryptionKey)
+    if err != nil {
+        return fmt.Errorf("failed to decrypt backup: %v", err)
+    }
+
     // Extract backup
     s.logger.Info("Extracting backup archive...")
-    extractPath := filepath.Join(tempDir, "extracted")
-    if err := utils.UnzipFile(zipPath, extractPath); err != nil {
+    if err := utils.ExtractArchive(zipPath, extractPath, s.extractLimits()); err != nil {
         return fmt.Errorf("failed to extract backup: %v", err)
     }
 
-    // Delete existing files in Spaces (optional, based on your needs)
-    s.logger.Info("Cleaning up existing files in Spaces...")
-    if err := s.spacesService.DeletePrefix(ctx, s.config.Restore.ContainerName); err != nil {
-        s.logger.Warn("Failed to cleanup existing files: %v", err)
+    // Replay incremental backups taken after the full backup
+    incrementals, err := s.driveService.GetIncrementalBackups(s.config.Restore.ContainerName, backup.CreatedTime, time.Time{})
+    if err != nil {
+        return fmt.Errorf("failed to list incremental backups: %v", err)
+    }
+    for i, inc := range incrementals {
+        s.logger.Info("Applying incremental backup %d/%d: %s", i+1, len(incrementals), inc.Name)
+        archivePath := filepath.Join(tempDir, inc.Name)
+        if err := s.driveService.DownloadBackup(ctx, inc, archivePath); err != nil {
+            return fmt.Errorf("failed to download incremental backup %s: %v", inc.Name, err)
+        }
+        if err := utils.ApplyIncrementalArchive(archivePath, extractPath, s.config.Restore.EncryptionKey, s.extractLimits()); err != nil {
+            return fmt.Errorf("failed to apply incremental backup %s: %v", inc.Name, err)
+        }
     }
 
-    // Upload to Spaces
-    s.logger.Info("Uploading files to Spaces...")
-    stats, err := s.spacesService.UploadFiles(ctx, extractPath, s.config.Restore.ContainerName)
+    // Preserved blob properties are only re-applied by restores to Azure;
+    // here they would otherwise be uploaded as an object
+    properties, err := utils.TakeBlobProperties(extractPath)
     if err != nil {
-        return fmt.Errorf("failed to upload to spaces: %v", err)
+        return err
+    }
+    if properties != nil {
+        s.logger.Info("Ignoring preserved Azure blob properties of %d blobs", len(properties))
     }
-
-    duration := time.Since(startTime)
-    s.logger.Info("Restore completed in %v:", duration)
-    s.logger.Info("- Files processed: %d", stats.FilesCount)
-    s.logger.Info("- Total size: %.2f MB", float64(stats.TotalSize)/(1024*1024))
-    s.logger.Info("- Average speed: %.2f MB/s", float64(stats.TotalSize)/(1024*1024)/duration.Seconds())
 
     return nil
 }
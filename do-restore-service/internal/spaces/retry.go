@@ -0,0 +1,43 @@
+package spaces
+
+import (
+    "context"
+    "errors"
+    "math/rand"
+    "net/http"
+    "time"
+
+    "github.com/aws/aws-sdk-go-v2/aws"
+    "github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+const (
+    uploadRetryBaseDelay = 1 * time.Second
+    uploadRetryMaxDelay  = 30 * time.Second
+)
+
+// uploadRetryables extends the SDK's retryable errors (connection errors,
+// 5xx, throttling codes such as SlowDown) with a plain 429 status, which
+// some S3-compatible stores send without a throttling error code
+var uploadRetryables = retry.IsErrorRetryables(append([]retry.IsErrorRetryable{
+    retry.RetryableHTTPStatusCode{Codes: map[int]struct{}{http.StatusTooManyRequests: {}}},
+}, retry.DefaultRetryables...))
+
+// isRetryable reports whether an upload that failed with err may succeed
+// when tried again
+func isRetryable(err error) bool {
+    if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+        return false
+    }
+    return uploadRetryables.IsErrorRetryable(err) == aws.TrueTernary
+}
+
+// uploadBackoff returns base*2^attempt capped at uploadRetryMaxDelay, plus
+// up to one second of jitter
+func uploadBackoff(attempt int) time.Duration {
+    delay := uploadRetryBaseDelay << uint(attempt)
+    if delay <= 0 || delay > uploadRetryMaxDelay {
+        delay = uploadRetryMaxDelay
+    }
+    return delay + time.Duration(rand.Int63n(int64(time.Second)))
+}
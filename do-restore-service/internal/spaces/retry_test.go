@@ -0,0 +1,58 @@
+package spaces
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+)
+
+// statusError is an error carrying an HTTP status, as the SDK's response
+// errors do
+type statusError int
+
+func (e statusError) Error() string       { return fmt.Sprintf("status %d", int(e)) }
+func (e statusError) HTTPStatusCode() int { return int(e) }
+
+func TestIsRetryable(t *testing.T) {
+    tests := []struct {
+        err  error
+        want bool
+    }{
+        {statusError(http.StatusTooManyRequests), true},
+        {statusError(http.StatusServiceUnavailable), true},
+        {fmt.Errorf("upload failed: %w", statusError(http.StatusInternalServerError)), true},
+        {statusError(http.StatusForbidden), false},
+        {statusError(http.StatusNotFound), false},
+        {errors.New("invalid argument"), false},
+        {context.Canceled, false},
+        {fmt.Errorf("upload failed: %w", context.DeadlineExceeded), false},
+    }
+    for _, tt := range tests {
+        if got := isRetryable(tt.err); got != tt.want {
+            t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+        }
+    }
+}
+
+func TestUploadBackoff(t *testing.T) {
+    tests := []struct {
+        attempt int
+        base    time.Duration
+    }{
+        {0, uploadRetryBaseDelay},
+        {1, 2 * uploadRetryBaseDelay},
+        {3, 8 * uploadRetryBaseDelay},
+        {10, uploadRetryMaxDelay},
+        // A shift past the width of a Duration must not wrap to a short delay
+        {100, uploadRetryMaxDelay},
+    }
+    for _, tt := range tests {
+        delay := uploadBackoff(tt.attempt)
+        if delay < tt.base || delay >= tt.base+time.Second {
+            t.Errorf("uploadBackoff(%d) = %v, want %v plus under a second of jitter", tt.attempt, delay, tt.base)
+        }
+    }
+}
@@ -3,13 +3,18 @@ package spaces
 import (
     "context"
     "fmt"
+    "io"
     "os"
     "path/filepath"
+    "sort"
+    "strings"
+    "sync"
     "time"
 
     "github.com/aws/aws-sdk-go-v2/aws"
     "github.com/aws/aws-sdk-go-v2/config"
     "github.com/aws/aws-sdk-go-v2/credentials"
+    "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
     "github.com/aws/aws-sdk-go-v2/service/s3"
     "github.com/aws/aws-sdk-go-v2/service/s3/types"
 
@@ -20,57 +25,91 @@ import (
 type UploadStats struct {
     FilesCount int64
     TotalSize  int64
+    Errors     []error
 }
 
 type SpacesService struct {
-    client *s3.Client
-    config *sconfig.DORestoreServiceConfig
-    logger *utils.Logger
+    client       *s3.Client
+    uploadClient *s3.Client // uploadFile retries uploads itself, so this client does not
+    uploader     *manager.Uploader
+    config       *sconfig.DORestoreServiceConfig
+    logger       *utils.Logger
+    progress     utils.ProgressSink
 }
 
-func NewSpacesService(cfg *sconfig.DORestoreServiceConfig, logger *utils.Logger) (*SpacesService, error) {
+// NewSpacesService connects to the configured bucket. Upload progress is
+// reported to progress, or logged when it is nil.
+func NewSpacesService(cfg *sconfig.DORestoreServiceConfig, logger *utils.Logger, progress utils.ProgressSink) (*SpacesService, error) {
     resolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
         return aws.Endpoint{
-            URL: cfg.Spaces.Endpoint,
+            URL: cfg.ObjectStore.Endpoint,
         }, nil
     })
 
     customProvider := credentials.NewStaticCredentialsProvider(
-        cfg.Spaces.AccessKeyID,
-        cfg.Spaces.SecretAccessKey,
+        cfg.ObjectStore.AccessKeyID,
+        cfg.ObjectStore.SecretAccessKey,
         "",
     )
 
     awsCfg, err := config.LoadDefaultConfig(context.Background(),
         config.WithEndpointResolverWithOptions(resolver),
         config.WithCredentialsProvider(customProvider),
-        config.WithRegion(cfg.Spaces.Region),
+        config.WithRegion(cfg.ObjectStore.Region),
     )
     if err != nil {
         return nil, fmt.Errorf("unable to load AWS SDK config: %v", err)
     }
 
-    client := s3.NewFromConfig(awsCfg)
+    client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+        o.UsePathStyle = cfg.ObjectStore.UsePathStyle
+    })
+    // Uploads are retried by uploadFile with its own backoff; letting the SDK
+    // retry as well would multiply OBJECT_STORE_UPLOAD_MAX_ATTEMPTS by its
+    // default of 3 attempts
+    uploadClient := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+        o.UsePathStyle = cfg.ObjectStore.UsePathStyle
+        o.RetryMaxAttempts = 1
+    })
 
     // Verify bucket access
     _, err = client.HeadBucket(context.Background(), &s3.HeadBucketInput{
-        Bucket: aws.String(cfg.Spaces.BucketName),
+        Bucket: aws.String(cfg.ObjectStore.BucketName),
     })
     if err != nil {
         return nil, fmt.Errorf("failed to access bucket: %v", err)
     }
 
-    logger.Info("Connected to Spaces bucket: %s", cfg.Spaces.BucketName)
+    logger.Info("Connected to bucket %s at %s", cfg.ObjectStore.BucketName, cfg.ObjectStore.Endpoint)
+
+    // Files above the multipart threshold are split into parts uploaded concurrently
+    uploader := manager.NewUploader(uploadClient, func(u *manager.Uploader) {
+        u.PartSize = cfg.ObjectStore.PartSize
+        u.Concurrency = cfg.ObjectStore.UploadConcurrency
+    })
+
+    if progress == nil {
+        progress = utils.NewLogProgressSink(logger, "Uploading")
+    }
 
     return &SpacesService{
-        client: client,
-        config: cfg,
-        logger: logger,
+        client:       client,
+        uploadClient: uploadClient,
+        uploader:     uploader,
+        config:       cfg,
+        logger:       logger,
+        progress:     progress,
     }, nil
 }
 
+// UploadFiles uploads every file below sourcePath to the bucket under prefix,
+// up to SPACES_MAX_CONCURRENT files at once. A failed file does not stop the
+// others; the failures are collected in the stats and reported together.
 func (s *SpacesService) UploadFiles(ctx context.Context, sourcePath string, prefix string) (*UploadStats, error) {
     stats := &UploadStats{}
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    semaphore := make(chan struct{}, s.config.ObjectStore.MaxConcurrent)
 
     err := filepath.Walk(sourcePath, func(path string, info os.FileInfo, err error) error {
         if err != nil {
@@ -91,63 +130,149 @@ func (s *SpacesService) UploadFiles(ctx context.Context, sourcePath string, pref
         relPath = filepath.ToSlash(relPath)
         objectKey := filepath.Join(prefix, relPath)
 
-        // Open file
-        file, err := os.Open(path)
-        if err != nil {
-            return fmt.Errorf("failed to open file %s: %v", path, err)
-        }
-        defer file.Close()
+        // Acquire before starting the goroutine, so the walk never runs far
+        // ahead of the uploads
+        semaphore <- struct{}{}
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            defer func() { <-semaphore }() // Release
+
+            if err := s.uploadFile(ctx, path, relPath, objectKey, info); err != nil {
+                s.logger.Error("Failed to upload %s: %v", relPath, err)
+                mu.Lock()
+                stats.Errors = append(stats.Errors, fmt.Errorf("failed to upload %s: %v", relPath, err))
+                mu.Unlock()
+                return
+            }
 
-        // Create progress reader
-        progressReader := &utils.ProgressReader{
-            Reader: file,
-            Total:  info.Size(),
-            OnProgress: func(uploaded, total int64) {
-                if uploaded == total {
-                    return // Skip 100% progress
-                }
-                percent := float64(uploaded) / float64(total) * 100
-                s.logger.Info("Uploading %s: %.1f%%", relPath, percent)
-            },
-        }
+            mu.Lock()
+            stats.FilesCount++
+            stats.TotalSize += info.Size()
+            mu.Unlock()
+        }()
 
-        startTime := time.Now()
-        s.logger.Info("Starting upload of %s (%s)", relPath, utils.FormatBytes(info.Size()))
+        return nil
+    })
 
-        // Upload file
-        _, err = s.client.PutObject(ctx, &s3.PutObjectInput{
-            Bucket:        aws.String(s.config.Spaces.BucketName),
-            Key:           aws.String(objectKey),
-            Body:         progressReader,
-            ContentLength: aws.Int64(info.Size()),
-        })
-        if err != nil {
-            return fmt.Errorf("failed to upload %s: %v", path, err)
-        }
+    wg.Wait()
 
-        duration := time.Since(startTime)
-        speed := float64(info.Size()) / duration.Seconds() / 1024 / 1024 // MB/s
-        s.logger.Info("Uploaded %s (%s, %.2f MB/s)", relPath, utils.FormatBytes(info.Size()), speed)
+    if err != nil {
+        return stats, fmt.Errorf("upload failed: %v", err)
+    }
 
-        stats.FilesCount++
-        stats.TotalSize += info.Size()
+    if len(stats.Errors) > 0 {
+        return stats, fmt.Errorf("encountered %d upload errors, first: %v", len(stats.Errors), stats.Errors[0])
+    }
 
-        return nil
-    })
+    return stats, nil
+}
 
+// uploadFile uploads the file at path to objectKey, retrying throttling,
+// server and connection errors with exponential backoff up to
+// OBJECT_STORE_UPLOAD_MAX_ATTEMPTS times. The file is rewound before each
+// attempt, since a failed attempt has consumed part of it.
+func (s *SpacesService) uploadFile(ctx context.Context, path, relPath, objectKey string, info os.FileInfo) error {
+    // Open file
+    file, err := os.Open(path)
     if err != nil {
-        return nil, fmt.Errorf("upload failed: %v", err)
+        return fmt.Errorf("failed to open file %s: %v", path, err)
     }
+    defer file.Close()
+    contentType := utils.ContentType(path)
 
-    return stats, nil
+    maxAttempts := s.config.ObjectStore.UploadMaxAttempts
+    for attempt := 1; ; attempt++ {
+        if _, err := file.Seek(0, io.SeekStart); err != nil {
+            return fmt.Errorf("failed to rewind file %s: %v", path, err)
+        }
+
+        err = s.putFile(ctx, file, relPath, objectKey, contentType, info)
+        if err == nil || !isRetryable(err) || attempt >= maxAttempts {
+            if err != nil && attempt > 1 {
+                return fmt.Errorf("%v (after %d attempts)", err, attempt)
+            }
+            return err
+        }
+
+        delay := uploadBackoff(attempt - 1)
+        s.logger.Warn("Upload of %s failed (attempt %d/%d), retrying in %v: %v",
+            relPath, attempt, maxAttempts, delay.Round(time.Millisecond), err)
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-time.After(delay):
+        }
+    }
+}
+
+// putFile makes one attempt at uploading file to objectKey, as a multipart
+// upload when it is larger than OBJECT_STORE_MULTIPART_THRESHOLD_MB
+func (s *SpacesService) putFile(ctx context.Context, file io.Reader, relPath, objectKey, contentType string, info os.FileInfo) error {
+    // Create progress reader
+    progressReader := &utils.ProgressReader{
+        Reader: file,
+        Name:   relPath,
+        Total:  info.Size(),
+        Sink:   s.progress,
+    }
+    defer progressReader.Done()
+
+    startTime := time.Now()
+    s.logger.Info("Starting upload of %s (%s)", relPath, utils.FormatBytes(info.Size()))
+
+    // Upload file
+    input := &s3.PutObjectInput{
+        Bucket:      aws.String(s.config.ObjectStore.BucketName),
+        Key:         aws.String(objectKey),
+        Body:        progressReader,
+        ContentType: aws.String(contentType),
+        Metadata:    utils.FileMetadata(info), // original mtime and permissions
+    }
+    var err error
+    if info.Size() > s.config.ObjectStore.MultipartThreshold {
+        s.logger.Debug("Using multipart upload for %s", relPath)
+        _, err = s.uploader.Upload(ctx, input)
+    } else {
+        input.ContentLength = aws.Int64(info.Size())
+        _, err = s.uploadClient.PutObject(ctx, input)
+    }
+    if err != nil {
+        return err
+    }
+
+    duration := time.Since(startTime)
+    speed := float64(info.Size()) / duration.Seconds() / 1024 / 1024 // MB/s
+    s.logger.Info("Uploaded %s (%s, %.2f MB/s)", relPath, utils.FormatBytes(info.Size()), speed)
+    return nil
 }
 
+// deleteAttempts is how often DeleteObjects is tried for keys it reports as
+// failed before they are given up on
+const deleteAttempts = 3
+
+// deleteFailure is a key DeleteObjects could not delete, with the reason
+// reported on the last attempt
+type deleteFailure struct {
+    Key    string
+    Reason string
+}
+
+// DeletePrefix deletes every object below prefix. Keys are listed in pages of
+// up to 1000 and each page is deleted with one DeleteObjects call, up to
+// OBJECT_STORE_DELETE_CONCURRENCY pages at once.
 func (s *SpacesService) DeletePrefix(ctx context.Context, prefix string) error {
-    // List all objects with the prefix
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    var deleted int
+    var failed []deleteFailure
+    semaphore := make(chan struct{}, s.config.ObjectStore.DeleteConcurrency)
+
+    var listErr error
     var continuationToken *string
     for {
         input := &s3.ListObjectsV2Input{
-            Bucket: aws.String(s.config.Spaces.BucketName),
+            Bucket: aws.String(s.config.ObjectStore.BucketName),
             Prefix: aws.String(prefix),
         }
         if continuationToken != nil {
@@ -156,10 +281,10 @@ func (s *SpacesService) DeletePrefix(ctx context.Context, prefix string) error {
 
         output, err := s.client.ListObjectsV2(ctx, input)
         if err != nil {
-            return fmt.Errorf("failed to list objects: %v", err)
+            listErr = fmt.Errorf("failed to list objects: %v", err)
+            break
         }
 
-        // Delete objects in batches
         if len(output.Contents) > 0 {
             objects := make([]types.ObjectIdentifier, len(output.Contents))
             for i, obj := range output.Contents {
@@ -168,18 +293,25 @@ func (s *SpacesService) DeletePrefix(ctx context.Context, prefix string) error {
                 }
             }
 
-            _, err = s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
-                Bucket: aws.String(s.config.Spaces.BucketName),
-                Delete: &types.Delete{
-                    Objects: objects,
-                    Quiet:   aws.Bool(true),
-                },
-            })
-            if err != nil {
-                return fmt.Errorf("failed to delete objects: %v", err)
-            }
-
-            s.logger.Info("Deleted %d objects with prefix: %s", len(objects), prefix)
+            // Acquire before listing further pages, so listing never runs
+            // far ahead of the deletes
+            semaphore <- struct{}{}
+            wg.Add(1)
+            go func(objects []types.ObjectIdentifier) {
+                defer wg.Done()
+                defer func() { <-semaphore }() // Release
+
+                remaining := s.deleteBatch(ctx, objects)
+
+                mu.Lock()
+                defer mu.Unlock()
+                deleted += len(objects) - len(remaining)
+                failed = append(failed, remaining...)
+                for _, f := range remaining {
+                    s.logger.Error("Failed to delete %s: %s", f.Key, f.Reason)
+                }
+                s.logger.Info("Deleted %d objects with prefix %s so far", deleted, prefix)
+            }(objects)
         }
 
         if !aws.ToBool(output.IsTruncated) {
@@ -187,6 +319,76 @@ func (s *SpacesService) DeletePrefix(ctx context.Context, prefix string) error {
         }
         continuationToken = output.NextContinuationToken
     }
+    wg.Wait()
+
+    if listErr != nil {
+        return listErr
+    }
+    if len(failed) > 0 {
+        // Stale objects would be mixed into the restored data, so the
+        // restore must not go on
+        sort.Slice(failed, func(i, j int) bool {
+            return failed[i].Key < failed[j].Key
+        })
+        var shown []string
+        for _, f := range failed {
+            if len(shown) == 10 {
+                shown = append(shown, "...")
+                break
+            }
+            shown = append(shown, fmt.Sprintf("%s (%s)", f.Key, f.Reason))
+        }
+        return fmt.Errorf("failed to delete %d objects with prefix %s: %s",
+            len(failed), prefix, strings.Join(shown, ", "))
+    }
 
+    if deleted > 0 {
+        s.logger.Info("Deleted %d objects with prefix: %s", deleted, prefix)
+    }
     return nil
-}
\ No newline at end of file
+}
+
+// deleteBatch deletes objects with DeleteObjects, retrying the keys the store
+// reports as failed. It returns the keys that could not be deleted.
+func (s *SpacesService) deleteBatch(ctx context.Context, objects []types.ObjectIdentifier) []deleteFailure {
+    for attempt := 1; ; attempt++ {
+        output, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+            Bucket: aws.String(s.config.ObjectStore.BucketName),
+            Delete: &types.Delete{
+                Objects: objects,
+                Quiet:   aws.Bool(true),
+            },
+        })
+
+        var retry []types.ObjectIdentifier
+        var failures []deleteFailure
+        if err != nil {
+            s.logger.Warn("Failed to delete %d objects (attempt %d/%d): %v", len(objects), attempt, deleteAttempts, err)
+            retry = objects
+            for _, obj := range objects {
+                failures = append(failures, deleteFailure{Key: aws.ToString(obj.Key), Reason: err.Error()})
+            }
+        } else {
+            // In quiet mode the response only lists the keys that failed
+            for _, e := range output.Errors {
+                reason := fmt.Sprintf("%s: %s", aws.ToString(e.Code), aws.ToString(e.Message))
+                s.logger.Debug("Failed to delete %s (attempt %d/%d): %s", aws.ToString(e.Key), attempt, deleteAttempts, reason)
+                retry = append(retry, types.ObjectIdentifier{Key: e.Key, VersionId: e.VersionId})
+                failures = append(failures, deleteFailure{Key: aws.ToString(e.Key), Reason: reason})
+            }
+        }
+
+        if len(retry) == 0 {
+            return nil
+        }
+        if attempt == deleteAttempts || ctx.Err() != nil {
+            return failures
+        }
+
+        objects = retry
+        select {
+        case <-ctx.Done():
+        case <-time.After(time.Duration(attempt) * time.Second):
+        }
+    }
+}
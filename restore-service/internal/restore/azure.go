@@ -1,24 +1,28 @@
 package restore
 
 import (
+    "bytes"
     "context"
+    "crypto/md5"
     "fmt"
-    "net/url"
+    "io"
     "os"
     "path/filepath"
+    "regexp"
     "strings"
     "sync"
-    "time"
 
     "github.com/Azure/azure-storage-blob-go/azblob"
+    "shared/pkg/azure"
     "shared/pkg/config"
     "shared/pkg/utils"
 )
 
 type UploadStats struct {
-    FilesCount int
-    TotalSize  int64
-    Errors     []error
+    FilesCount   int
+    TotalSize    int64
+    SkippedFiles int // already present with the same size and MD5
+    Errors       []error
 }
 
 type AzureService struct {
@@ -28,26 +32,14 @@ type AzureService struct {
 }
 
 func NewAzureService(cfg *config.RestoreServiceConfig, logger *utils.Logger) (*AzureService, error) {
-    credential, err := azblob.NewSharedKeyCredential(
-        cfg.Azure.AccountName,
-        cfg.Azure.AccountKey,
-    )
-    if err != nil {
-        return nil, fmt.Errorf("invalid credentials: %v", err)
+    if err := cfg.ValidateTarget(); err != nil {
+        return nil, err
     }
 
-    pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{
-        Retry: azblob.RetryOptions{
-            MaxTries:      3,
-            TryTimeout:    2 * time.Minute,
-            RetryDelay:    time.Second * 5,
-            MaxRetryDelay: time.Second * 30,
-        },
-    })
-
-    URL, _ := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/",
-        cfg.Azure.AccountName))
-    serviceURL := azblob.NewServiceURL(*URL, pipeline)
+    serviceURL, err := azure.NewServiceURL(cfg.Azure)
+    if err != nil {
+        return nil, err
+    }
 
     return &AzureService{
         serviceURL: serviceURL,
@@ -56,19 +48,78 @@ func NewAzureService(cfg *config.RestoreServiceConfig, logger *utils.Logger) (*A
     }, nil
 }
 
-func (s *AzureService) UploadFiles(ctx context.Context, sourcePath string, containerName string) (*UploadStats, error) {
+// containerNamePattern enforces Azure naming rules: lowercase letters, digits
+// and single hyphens, starting and ending with a letter or digit
+var containerNamePattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9]|-[a-z0-9])*$`)
+
+// ValidateContainerName checks name against Azure container naming rules
+func ValidateContainerName(name string) error {
+    if len(name) < 3 || len(name) > 63 {
+        return fmt.Errorf("container name %q must be 3-63 characters long", name)
+    }
+    if !containerNamePattern.MatchString(name) {
+        return fmt.Errorf("container name %q may only contain lowercase letters, digits and single hyphens, "+
+            "and must start and end with a letter or digit", name)
+    }
+    return nil
+}
+
+// UploadFiles uploads the files below sourcePath into containerName. Blobs
+// listed in properties get the content headers and metadata recorded by a
+// backup taken with BACKUP_PRESERVE_METADATA; properties may be nil.
+//
+// The walk feeds the files to a fixed pool of MaxConcurrent workers, so a
+// tree of any size runs the same number of goroutines, and failed uploads
+// are collected in the stats rather than sent on a channel that could fill.
+func (s *AzureService) UploadFiles(ctx context.Context, sourcePath string, containerName string, properties map[string]utils.BlobProperties) (*UploadStats, error) {
     stats := &UploadStats{}
     var mu sync.Mutex
     var wg sync.WaitGroup
-    maxConcurrent := 10
-    semaphore := make(chan struct{}, maxConcurrent)
-    errChan := make(chan error, 100)
 
     // Create container if not exists
     containerURL := s.serviceURL.NewContainerURL(containerName)
     _, err := containerURL.Create(ctx, azblob.Metadata{}, azblob.PublicAccessNone)
     if err != nil && !strings.Contains(err.Error(), "ContainerAlreadyExists") {
-        return stats, fmt.Errorf("failed to create container: %v", err)
+        return stats, fmt.Errorf("failed to create container: %w", azure.AuthError(err))
+    }
+
+    upload := func(file uploadJob) {
+        if s.config.SkipUnchanged && s.blobUnchanged(ctx, containerURL, file.path, file.relPath, file.size) {
+            mu.Lock()
+            stats.SkippedFiles++
+            mu.Unlock()
+            s.logger.Debug("Skipped unchanged: %s", file.relPath)
+            return
+        }
+
+        var blobProperties *utils.BlobProperties
+        if props, ok := properties[filepath.ToSlash(file.relPath)]; ok {
+            blobProperties = &props
+        }
+        if err := s.uploadFile(ctx, containerURL, file.path, file.relPath, blobProperties); err != nil {
+            mu.Lock()
+            stats.Errors = append(stats.Errors, fmt.Errorf("failed to upload %s: %v", file.relPath, err))
+            mu.Unlock()
+            return
+        }
+
+        mu.Lock()
+        stats.FilesCount++
+        stats.TotalSize += file.size
+        mu.Unlock()
+
+        s.logger.Info("Uploaded: %s", file.relPath)
+    }
+
+    jobs := make(chan uploadJob, s.config.MaxConcurrent)
+    for i := 0; i < s.config.MaxConcurrent; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for file := range jobs {
+                upload(file)
+            }
+        }()
     }
 
     err = filepath.Walk(sourcePath, func(path string, info os.FileInfo, err error) error {
@@ -85,47 +136,128 @@ func (s *AzureService) UploadFiles(ctx context.Context, sourcePath string, conta
             return fmt.Errorf("failed to get relative path: %v", err)
         }
 
-        wg.Add(1)
-        go func() {
-            defer wg.Done()
-            semaphore <- struct{}{}
-            defer func() { <-semaphore }()
+        select {
+        case jobs <- uploadJob{path: path, relPath: relPath, size: info.Size()}:
+            return nil
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    })
 
-            if err := s.uploadFile(ctx, containerURL, path, relPath); err != nil {
-                errChan <- fmt.Errorf("failed to upload %s: %v", relPath, err)
-                return
+    close(jobs)
+    wg.Wait()
+
+    if err != nil {
+        return stats, fmt.Errorf("failed to walk source directory: %v", err)
+    }
+
+    if len(stats.Errors) > 0 {
+        return stats, fmt.Errorf("%w: encountered %d upload errors", ErrPartialRestore, len(stats.Errors))
+    }
+
+    return stats, nil
+}
+
+// uploadJob is a file found by the walk in UploadFiles and CheckIntegrity
+type uploadJob struct {
+    path    string
+    relPath string // blob name
+    size    int64
+}
+
+// DeleteBlobs deletes the blobs of containerName that match filter and
+// returns how many were deleted. A missing container has nothing to delete.
+func (s *AzureService) DeleteBlobs(ctx context.Context, containerName string, filter PathFilter) (int, error) {
+    containerURL := s.serviceURL.NewContainerURL(containerName)
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    var deleted int
+    var errs []error
+    semaphore := make(chan struct{}, s.config.MaxConcurrent)
+
+    var listErr error
+    for marker := (azblob.Marker{}); marker.NotDone(); {
+        listBlob, err := containerURL.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{
+            Prefix:     filter.Prefix,
+            MaxResults: int32(s.config.Azure.ListPageSize),
+        })
+        if err != nil {
+            if strings.Contains(err.Error(), "ContainerNotFound") {
+                break
             }
+            listErr = fmt.Errorf("failed to list blobs in %s: %v", containerName, err)
+            break
+        }
+        marker = listBlob.NextMarker
 
-            mu.Lock()
-            stats.FilesCount++
-            stats.TotalSize += info.Size()
-            mu.Unlock()
+        for _, blobInfo := range listBlob.Segment.BlobItems {
+            if !filter.Match(blobInfo.Name) {
+                continue
+            }
 
-            s.logger.Info("Uploaded: %s", relPath)
-        }()
+            wg.Add(1)
+            go func(name string) {
+                defer wg.Done()
+                semaphore <- struct{}{}
+                defer func() { <-semaphore }()
 
-        return nil
-    })
+                blobURL := containerURL.NewBlobURL(name)
+                _, err := blobURL.Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
 
+                mu.Lock()
+                defer mu.Unlock()
+                if err != nil && !strings.Contains(err.Error(), "BlobNotFound") {
+                    s.logger.Error("Failed to delete %s: %v", name, err)
+                    errs = append(errs, err)
+                    return
+                }
+                deleted++
+            }(blobInfo.Name)
+        }
+    }
     wg.Wait()
-    close(errChan)
 
-    for err := range errChan {
-        stats.Errors = append(stats.Errors, err)
+    if listErr != nil {
+        return deleted, listErr
     }
+    if len(errs) > 0 {
+        return deleted, fmt.Errorf("failed to delete %d blobs", len(errs))
+    }
+    return deleted, nil
+}
 
+// blobUnchanged reports whether blobName already exists with the size and
+// Content-MD5 of the local file. Blobs without a Content-MD5 are uploaded
+// again, since their content cannot be compared.
+func (s *AzureService) blobUnchanged(ctx context.Context, containerURL azblob.ContainerURL, sourcePath, blobName string, size int64) bool {
+    props, err := containerURL.NewBlockBlobURL(blobName).GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
     if err != nil {
-        return stats, fmt.Errorf("failed to walk source directory: %v", err)
+        return false
     }
 
-    if len(stats.Errors) > 0 {
-        return stats, fmt.Errorf("encountered %d upload errors", len(stats.Errors))
+    remoteMD5 := props.ContentMD5()
+    if props.ContentLength() != size || len(remoteMD5) == 0 {
+        return false
     }
 
-    return stats, nil
+    localMD5, err := calculateMD5(sourcePath)
+    if err != nil {
+        s.logger.Warn("Failed to hash %s, uploading it again: %v", blobName, err)
+        return false
+    }
+    return bytes.Equal(localMD5, remoteMD5)
+}
+
+// accessTier returns the configured tier for restored blobs, or the account
+// default when none is set
+func (s *AzureService) accessTier() azblob.AccessTierType {
+    if s.config.AccessTier == "" {
+        return azblob.DefaultAccessTier
+    }
+    return azblob.AccessTierType(s.config.AccessTier)
 }
 
-func (s *AzureService) uploadFile(ctx context.Context, containerURL azblob.ContainerURL, sourcePath, blobName string) error {
+func (s *AzureService) uploadFile(ctx context.Context, containerURL azblob.ContainerURL, sourcePath, blobName string, properties *utils.BlobProperties) error {
     blobURL := containerURL.NewBlockBlobURL(blobName)
 
     file, err := os.Open(sourcePath)
@@ -134,12 +266,20 @@ func (s *AzureService) uploadFile(ctx context.Context, containerURL azblob.Conta
     }
     defer file.Close()
 
+    info, err := file.Stat()
+    if err != nil {
+        return fmt.Errorf("failed to stat source file: %v", err)
+    }
+
+    // Record the original mtime and permissions as blob metadata, and the
+    // content type so the container can serve the files to browsers
+    headers, metadata := blobHeaders(sourcePath, info, properties)
     _, err = blobURL.Upload(ctx,
         file,
-        azblob.BlobHTTPHeaders{},
-        azblob.Metadata{},
+        headers,
+        metadata,
         azblob.BlobAccessConditions{},
-        azblob.DefaultAccessTier,
+        s.accessTier(),
         azblob.BlobTagsMap{},
         azblob.ClientProvidedKeyOptions{},
         azblob.ImmutabilityPolicyOptions{},
@@ -149,5 +289,78 @@ func (s *AzureService) uploadFile(ctx context.Context, containerURL azblob.Conta
         return fmt.Errorf("failed to upload blob: %v", err)
     }
 
+    return s.verifyUpload(ctx, blobURL, blobName, sourcePath, info.Size())
+}
+
+// blobHeaders returns the content headers and metadata of the blob restored
+// from sourcePath: those preserved by the backup, if any, with the content
+// type guessed from the file when none was recorded and the file's mtime and
+// permissions added to the metadata
+func blobHeaders(sourcePath string, info os.FileInfo, properties *utils.BlobProperties) (azblob.BlobHTTPHeaders, azblob.Metadata) {
+    var headers azblob.BlobHTTPHeaders
+    metadata := azblob.Metadata{}
+    if properties != nil {
+        headers = azblob.BlobHTTPHeaders{
+            ContentType:        properties.ContentType,
+            ContentEncoding:    properties.ContentEncoding,
+            ContentLanguage:    properties.ContentLanguage,
+            ContentDisposition: properties.ContentDisposition,
+            CacheControl:       properties.CacheControl,
+        }
+        for key, value := range properties.Metadata {
+            metadata[key] = value
+        }
+    }
+    if headers.ContentType == "" {
+        headers.ContentType = utils.ContentType(sourcePath)
+    }
+    for key, value := range utils.FileMetadata(info) {
+        metadata[key] = value
+    }
+    return headers, metadata
+}
+
+// verifyUpload compares the uploaded blob's size and Content-MD5, which Azure
+// computes for single-shot uploads, against the local file
+func (s *AzureService) verifyUpload(ctx context.Context, blobURL azblob.BlockBlobURL, blobName, sourcePath string, size int64) error {
+    props, err := blobURL.GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+    if err != nil {
+        return fmt.Errorf("failed to read uploaded blob properties: %v", err)
+    }
+
+    if props.ContentLength() != size {
+        return fmt.Errorf("size mismatch after upload: local %d bytes, blob %d bytes", size, props.ContentLength())
+    }
+
+    remoteMD5 := props.ContentMD5()
+    if len(remoteMD5) == 0 {
+        s.logger.Debug("No Content-MD5 on %s, verified size only", blobName)
+        return nil
+    }
+
+    localMD5, err := calculateMD5(sourcePath)
+    if err != nil {
+        return fmt.Errorf("failed to hash local file: %v", err)
+    }
+    if !bytes.Equal(localMD5, remoteMD5) {
+        return fmt.Errorf("MD5 mismatch after upload: local %x, blob %x", localMD5, remoteMD5)
+    }
+
     return nil
+}
+
+// calculateMD5 returns the raw MD5 digest of the file at path
+func calculateMD5(path string) ([]byte, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    hash := md5.New()
+    if _, err := io.Copy(hash, file); err != nil {
+        return nil, err
+    }
+
+    return hash.Sum(nil), nil
 }
\ No newline at end of file
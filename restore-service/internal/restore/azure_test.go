@@ -0,0 +1,100 @@
+package restore
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/Azure/azure-storage-blob-go/azblob"
+    "shared/pkg/config"
+    "shared/pkg/utils"
+)
+
+func TestBlobHeadersPrefersPreservedProperties(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "index.html")
+    if err := os.WriteFile(path, []byte("<html></html>"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    info, err := os.Stat(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    headers, metadata := blobHeaders(path, info, nil)
+    if headers.ContentType != "text/html; charset=utf-8" {
+        t.Errorf("guessed content type = %q, want text/html", headers.ContentType)
+    }
+    if metadata[utils.MetaMtime] == "" {
+        t.Errorf("metadata %v has no mtime", metadata)
+    }
+
+    headers, metadata = blobHeaders(path, info, &utils.BlobProperties{
+        ContentType:  "application/xhtml+xml",
+        CacheControl: "max-age=3600",
+        Metadata:     map[string]string{"owner": "web"},
+    })
+    if headers.ContentType != "application/xhtml+xml" || headers.CacheControl != "max-age=3600" {
+        t.Errorf("headers = %+v, want the preserved content type and cache control", headers)
+    }
+    if metadata["owner"] != "web" || metadata[utils.MetaMtime] == "" {
+        t.Errorf("metadata = %v, want the preserved metadata plus mtime", metadata)
+    }
+}
+
+func TestUploadFilesRecordsEveryFailure(t *testing.T) {
+    // The container can be created, but every blob upload fails
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Query().Get("restype") == "container" {
+            w.WriteHeader(http.StatusCreated)
+            return
+        }
+        w.WriteHeader(http.StatusForbidden)
+    }))
+    defer server.Close()
+
+    endpoint, err := url.Parse(server.URL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    service := &AzureService{
+        serviceURL: azblob.NewServiceURL(*endpoint, azblob.NewPipeline(azblob.NewAnonymousCredential(),
+            azblob.PipelineOptions{Retry: azblob.RetryOptions{MaxTries: 1}})),
+        config: &config.RestoreServiceConfig{MaxConcurrent: 4},
+        logger: utils.NewLogger("[TEST]", "error", "text"),
+    }
+
+    // More failures than any fixed error buffer would hold
+    source := t.TempDir()
+    const files = 150
+    for i := 0; i < files; i++ {
+        if err := os.WriteFile(filepath.Join(source, fmt.Sprintf("file%03d.txt", i)), []byte("x"), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    done := make(chan struct{})
+    var stats *UploadStats
+    go func() {
+        defer close(done)
+        stats, err = service.UploadFiles(context.Background(), source, "target", nil)
+    }()
+    select {
+    case <-done:
+    case <-time.After(30 * time.Second):
+        t.Fatal("UploadFiles did not return")
+    }
+
+    if !errors.Is(err, ErrPartialRestore) {
+        t.Errorf("error = %v, want ErrPartialRestore", err)
+    }
+    if len(stats.Errors) != files || stats.FilesCount != 0 {
+        t.Errorf("recorded %d errors and %d uploads, want %d errors", len(stats.Errors), stats.FilesCount, files)
+    }
+}
@@ -0,0 +1,51 @@
+package restore
+
+import (
+    "errors"
+
+    "shared/pkg/azure"
+    "shared/pkg/gdrive"
+)
+
+// Errors returned by a restore, wrapped with the details of the failure.
+// Check for them with errors.Is; Drive failures wrap the gdrive errors.
+var (
+    // ErrAzureAuth means the target Azure Storage account rejected the
+    // credentials
+    ErrAzureAuth = azure.ErrAzureAuth
+    // ErrPartialRestore means some files were restored and others failed to
+    // upload, or some containers of an ALL restore failed
+    ErrPartialRestore = errors.New("partial restore")
+)
+
+// Exit codes of restore-service, so automation can tell a missing backup
+// (retry later) from rejected credentials (page someone) from a restore
+// that stopped midway (alert)
+const (
+    ExitFailure  = 1 // any other failure
+    ExitNotFound = 2 // no backup matched the date, ID or name
+    ExitAuth     = 3 // Google Drive or Azure credentials rejected
+    ExitPartial  = 4 // some files or containers failed to restore
+)
+
+// ExitCode returns the exit code for err
+func ExitCode(err error) int {
+    switch {
+    case err == nil:
+        return 0
+    case errors.Is(err, gdrive.ErrDriveAuth), errors.Is(err, ErrAzureAuth):
+        return ExitAuth
+    case errors.Is(err, gdrive.ErrNoBackupFound):
+        return ExitNotFound
+    case errors.Is(err, ErrPartialRestore):
+        return ExitPartial
+    default:
+        return ExitFailure
+    }
+}
+
+// containerErrors reports the containers that failed in an ALL restore;
+// errors.Is matches ErrPartialRestore and the error of any of them
+func containerErrors(msg string, errs []error) error {
+    return azure.NewContainerErrors(msg, append([]error{ErrPartialRestore}, errs...)...)
+}
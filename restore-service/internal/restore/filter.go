@@ -0,0 +1,70 @@
+package restore
+
+import (
+    "fmt"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+)
+
+// PathFilter selects which extracted files are restored
+type PathFilter struct {
+    Prefix string
+    Glob   string
+}
+
+func (f PathFilter) IsEmpty() bool {
+    return f.Prefix == "" && f.Glob == ""
+}
+
+// Match reports whether a slash-separated relative path passes the filter
+func (f PathFilter) Match(relPath string) bool {
+    if f.Prefix != "" && !strings.HasPrefix(relPath, f.Prefix) {
+        return false
+    }
+    if f.Glob != "" {
+        matched, err := path.Match(f.Glob, relPath)
+        if err != nil || !matched {
+            return false
+        }
+    }
+    return true
+}
+
+// Validate checks the glob pattern syntax
+func (f PathFilter) Validate() error {
+    if f.Glob != "" {
+        if _, err := path.Match(f.Glob, ""); err != nil {
+            return fmt.Errorf("invalid glob pattern %q: %v", f.Glob, err)
+        }
+    }
+    return nil
+}
+
+// applyFilter removes extracted files that don't match the filter so the
+// upload walk only sees the selected subset
+func applyFilter(root string, filter PathFilter) (matched int, skipped int, err error) {
+    err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if info.IsDir() {
+            return nil
+        }
+
+        relPath, err := filepath.Rel(root, p)
+        if err != nil {
+            return fmt.Errorf("failed to get relative path: %v", err)
+        }
+
+        if filter.Match(filepath.ToSlash(relPath)) {
+            matched++
+            return nil
+        }
+
+        skipped++
+        return os.Remove(p)
+    })
+    return matched, skipped, err
+}
@@ -2,6 +2,8 @@ package restore
 
 import (
     "context"
+    "io"
+    "path/filepath"
     "time"
 
     "shared/pkg/config"
@@ -9,6 +11,10 @@ import (
     "shared/pkg/utils"
 )
 
+// archiveCacheDir is the directory in TempDir holding recently downloaded
+// archives when RESTORE_CACHE_SIZE is set
+const archiveCacheDir = "archive-cache"
+
 type GoogleDriveRestore struct {
     service *gdrive.GoogleDriveService
     config  *config.RestoreServiceConfig
@@ -17,10 +23,23 @@ type GoogleDriveRestore struct {
 
 func NewGoogleDriveRestore(cfg *config.RestoreServiceConfig, logger *utils.Logger) (*GoogleDriveRestore, error) {
     driveConfig := &gdrive.DriveConfig{
-        CredentialsPath: cfg.GoogleDrive.CredentialsPath,
-        TokenPath:       cfg.GoogleDrive.TokenPath,
-        SharedDriveID:   cfg.GoogleDrive.SharedDriveID,
-        FolderID:        cfg.GoogleDrive.FolderID,
+        CredentialsPath:    cfg.GoogleDrive.CredentialsPath,
+        TokenPath:          cfg.GoogleDrive.TokenPath,
+        TokenJSON:          cfg.GoogleDrive.TokenJSON,
+        SharedDriveID:      cfg.GoogleDrive.SharedDriveID,
+        FolderID:           cfg.GoogleDrive.FolderID,
+        AuthMode:           cfg.GoogleDrive.AuthMode,
+        ImpersonateSubject: cfg.GoogleDrive.ImpersonateSubject,
+        MaxRetries:         cfg.GoogleDrive.MaxRetries,
+        ListPageSize:       cfg.GoogleDrive.ListPageSize,
+    }
+
+    if cfg.CacheSize > 0 {
+        cache, err := gdrive.NewDownloadCache(filepath.Join(cfg.TempDir, archiveCacheDir), cfg.CacheSize, logger)
+        if err != nil {
+            return nil, err
+        }
+        driveConfig.DownloadCache = cache
     }
 
     service, err := gdrive.NewGoogleDriveService(driveConfig, logger)
@@ -47,6 +66,42 @@ func (r *GoogleDriveRestore) GetBackupFromDate(date time.Time, containerName str
     return r.service.GetBackupFromDate(date, containerName)
 }
 
+func (r *GoogleDriveRestore) GetBackupBefore(before time.Time, containerName string) (*gdrive.DriveBackup, error) {
+    return r.service.GetBackupBefore(before, containerName)
+}
+
+func (r *GoogleDriveRestore) GetBackupByID(fileID string) (*gdrive.DriveBackup, error) {
+    return r.service.GetBackupByID(fileID)
+}
+
+func (r *GoogleDriveRestore) GetBackupByName(name string) (*gdrive.DriveBackup, error) {
+    return r.service.GetBackupByName(name)
+}
+
+func (r *GoogleDriveRestore) GetIncrementalBackups(containerName string, after, until time.Time) ([]*gdrive.DriveBackup, error) {
+    return r.service.GetIncrementalBackups(containerName, after, until)
+}
+
 func (r *GoogleDriveRestore) DownloadFile(ctx context.Context, fileID string, destinationPath string) error {
     return r.service.DownloadFile(ctx, fileID, destinationPath)
-}
\ No newline at end of file
+}
+
+// DownloadBackup downloads an archive backup, joining its volumes if it was split
+func (r *GoogleDriveRestore) DownloadBackup(ctx context.Context, backup *gdrive.DriveBackup, destinationPath string) error {
+    return r.service.DownloadBackup(ctx, backup, destinationPath)
+}
+
+// ReadTreeManifest returns the file list of a tree backup
+func (r *GoogleDriveRestore) ReadTreeManifest(ctx context.Context, fileID string) (*gdrive.TreeManifest, error) {
+    return r.service.ReadTreeManifest(ctx, fileID)
+}
+
+// OpenFile streams the content of a single Drive file
+func (r *GoogleDriveRestore) OpenFile(ctx context.Context, fileID string) (io.ReadCloser, error) {
+    return r.service.OpenFile(ctx, fileID)
+}
+
+// DownloadTree downloads the files of a tree backup below destDir
+func (r *GoogleDriveRestore) DownloadTree(ctx context.Context, manifest *gdrive.TreeManifest, destDir string) error {
+    return r.service.DownloadTree(ctx, manifest, destDir, r.config.MaxConcurrent)
+}
@@ -0,0 +1,151 @@
+package restore
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "sync"
+
+    "github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// IntegrityReport is the outcome of comparing the restored files against the
+// blobs found in the destination container
+type IntegrityReport struct {
+    Checked    int
+    Missing    []string // files with no blob of the same name
+    Mismatched []string // blobs whose size or Content-MD5 differ from the file
+}
+
+// OK reports whether every restored file was found with matching content
+func (r IntegrityReport) OK() bool {
+    return len(r.Missing) == 0 && len(r.Mismatched) == 0
+}
+
+// CheckIntegrity lists containerName and confirms that every file under
+// sourcePath exists as a blob with the same size and, when Azure reports one,
+// the same Content-MD5
+func (s *AzureService) CheckIntegrity(ctx context.Context, sourcePath string, containerName string) (*IntegrityReport, error) {
+    blobs, err := s.listBlobProperties(ctx, containerName)
+    if err != nil {
+        return nil, err
+    }
+
+    report := &IntegrityReport{}
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+
+    check := func(file uploadJob) {
+        blob, exists := blobs[file.relPath]
+        var mismatch error
+        if exists {
+            mismatch = compareBlob(file.path, file.size, blob)
+        }
+
+        mu.Lock()
+        defer mu.Unlock()
+        report.Checked++
+        switch {
+        case !exists:
+            s.logger.Error("Integrity check: %s is missing from container %s", file.relPath, containerName)
+            report.Missing = append(report.Missing, file.relPath)
+        case mismatch != nil:
+            s.logger.Error("Integrity check: %s: %v", file.relPath, mismatch)
+            report.Mismatched = append(report.Mismatched, file.relPath)
+        }
+    }
+
+    // A fixed pool of workers fed by the walk, as in UploadFiles
+    jobs := make(chan uploadJob, s.config.MaxConcurrent)
+    for i := 0; i < s.config.MaxConcurrent; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for file := range jobs {
+                check(file)
+            }
+        }()
+    }
+
+    err = filepath.Walk(sourcePath, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if info.IsDir() {
+            return nil
+        }
+
+        relPath, err := filepath.Rel(sourcePath, path)
+        if err != nil {
+            return fmt.Errorf("failed to get relative path: %v", err)
+        }
+
+        select {
+        case jobs <- uploadJob{path: path, relPath: relPath, size: info.Size()}:
+            return nil
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    })
+
+    close(jobs)
+    wg.Wait()
+
+    if err != nil {
+        return nil, fmt.Errorf("failed to walk restored files: %v", err)
+    }
+
+    sort.Strings(report.Missing)
+    sort.Strings(report.Mismatched)
+    return report, nil
+}
+
+// listBlobProperties returns the properties of every blob in containerName,
+// keyed by blob name
+func (s *AzureService) listBlobProperties(ctx context.Context, containerName string) (map[string]azblob.BlobPropertiesInternal, error) {
+    containerURL := s.serviceURL.NewContainerURL(containerName)
+    blobs := make(map[string]azblob.BlobPropertiesInternal)
+
+    for marker := (azblob.Marker{}); marker.NotDone(); {
+        listBlob, err := containerURL.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{
+            MaxResults: int32(s.config.Azure.ListPageSize),
+        })
+        if err != nil {
+            return nil, fmt.Errorf("failed to list blobs in %s: %v", containerName, err)
+        }
+        marker = listBlob.NextMarker
+
+        for _, blobInfo := range listBlob.Segment.BlobItems {
+            blobs[blobInfo.Name] = blobInfo.Properties
+        }
+    }
+
+    return blobs, nil
+}
+
+// compareBlob checks the local file at path against a listed blob
+func compareBlob(path string, size int64, blob azblob.BlobPropertiesInternal) error {
+    var blobSize int64
+    if blob.ContentLength != nil {
+        blobSize = *blob.ContentLength
+    }
+    if blobSize != size {
+        return fmt.Errorf("size mismatch: local %d bytes, blob %d bytes", size, blobSize)
+    }
+
+    if len(blob.ContentMD5) == 0 {
+        return nil
+    }
+
+    localMD5, err := calculateMD5(path)
+    if err != nil {
+        return fmt.Errorf("failed to hash local file: %v", err)
+    }
+    if !bytes.Equal(localMD5, blob.ContentMD5) {
+        return fmt.Errorf("MD5 mismatch: local %x, blob %x", localMD5, blob.ContentMD5)
+    }
+    return nil
+}
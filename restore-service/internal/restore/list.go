@@ -0,0 +1,113 @@
+package restore
+
+import (
+    "fmt"
+    "sort"
+    "time"
+
+    "shared/pkg/gdrive"
+)
+
+// BackupSummary describes the backups stored in Google Drive for one container
+type BackupSummary struct {
+    Container string
+    Count     int
+    Latest    time.Time
+    TotalSize int64
+}
+
+// ListBackups summarizes the backups in Google Drive per container, including
+// incremental ones. An empty containerName lists every container. Only Google
+// Drive is queried.
+func (s *RestoreService) ListBackups(containerName string) ([]BackupSummary, error) {
+    backups, err := s.driveService.ListAvailableBackups()
+    if err != nil {
+        return nil, fmt.Errorf("failed to list backups: %w", err)
+    }
+    return summarizeBackups(backups, containerName), nil
+}
+
+// BackupEntry is a single backup of a container stored in Google Drive
+type BackupEntry struct {
+    Container   string
+    Name        string
+    ID          string
+    Created     time.Time
+    Size        int64
+    Incremental bool
+}
+
+// ListBackupDates lists the backups of containerName, newest first, to pick
+// a -date from. An empty containerName or "ALL" lists every container,
+// grouped by container name. Only Google Drive is queried.
+func (s *RestoreService) ListBackupDates(containerName string) ([]BackupEntry, error) {
+    backups, err := s.driveService.ListAvailableBackups()
+    if err != nil {
+        return nil, fmt.Errorf("failed to list backups: %w", err)
+    }
+    if containerName == "ALL" {
+        containerName = ""
+    }
+    return backupEntries(backups, containerName), nil
+}
+
+// backupEntries returns the backups of containerName, or of every container
+// when it is empty, sorted by container name and then newest first. Files
+// that are not backup archives are ignored.
+func backupEntries(backups []*gdrive.DriveBackup, containerName string) []BackupEntry {
+    var entries []BackupEntry
+    for _, backup := range backups {
+        name, _, ok := gdrive.ParseBackupName(backup.Name)
+        if !ok || (containerName != "" && name != containerName) {
+            continue
+        }
+        entries = append(entries, BackupEntry{
+            Container:   name,
+            Name:        backup.Name,
+            ID:          backup.ID,
+            Created:     backup.CreatedTime,
+            Size:        backup.Size,
+            Incremental: gdrive.IsIncrementalBackup(backup.Name),
+        })
+    }
+
+    sort.SliceStable(entries, func(i, j int) bool {
+        if entries[i].Container != entries[j].Container {
+            return entries[i].Container < entries[j].Container
+        }
+        return entries[i].Created.After(entries[j].Created)
+    })
+    return entries
+}
+
+// summarizeBackups groups backups by the container parsed from their name,
+// sorted by container name. Files that are not backup archives are ignored.
+func summarizeBackups(backups []*gdrive.DriveBackup, containerName string) []BackupSummary {
+    byContainer := make(map[string]*BackupSummary)
+    for _, backup := range backups {
+        name, _, ok := gdrive.ParseBackupName(backup.Name)
+        if !ok || (containerName != "" && name != containerName) {
+            continue
+        }
+
+        summary, exists := byContainer[name]
+        if !exists {
+            summary = &BackupSummary{Container: name}
+            byContainer[name] = summary
+        }
+        summary.Count++
+        summary.TotalSize += backup.Size
+        if backup.CreatedTime.After(summary.Latest) {
+            summary.Latest = backup.CreatedTime
+        }
+    }
+
+    summaries := make([]BackupSummary, 0, len(byContainer))
+    for _, summary := range byContainer {
+        summaries = append(summaries, *summary)
+    }
+    sort.Slice(summaries, func(i, j int) bool {
+        return summaries[i].Container < summaries[j].Container
+    })
+    return summaries
+}
@@ -0,0 +1,48 @@
+package restore
+
+import (
+    "context"
+    "errors"
+    "fmt"
+
+    "github.com/Azure/azure-storage-blob-go/azblob"
+    "shared/pkg/azure"
+    "shared/pkg/config"
+    "shared/pkg/utils"
+)
+
+// Preflight returns the checks run by -check, in order: the Google Drive
+// credentials and access to the shared drive and folder, then the target
+// Azure credentials and access to the target container. A target container
+// that does not exist yet passes, since a restore creates it.
+func Preflight(cfg *config.RestoreServiceConfig) []utils.Check {
+    logger := utils.NewLogger("[CHECK]", cfg.Common.LogLevel, cfg.Common.LogFormat)
+
+    return []utils.Check{
+        {
+            Name: fmt.Sprintf("Google Drive access (shared drive %s)", cfg.GoogleDrive.SharedDriveID),
+            Run: func(ctx context.Context) error {
+                _, err := NewGoogleDriveRestore(cfg, logger)
+                return err
+            },
+        },
+        {
+            Name: fmt.Sprintf("Azure Storage access (account %s, container %s)", cfg.Azure.AccountName, cfg.Azure.ContainerName),
+            Run: func(ctx context.Context) error {
+                azureService, err := NewAzureService(cfg, logger)
+                if err != nil {
+                    return err
+                }
+                err = azure.CheckContainerAccess(ctx, azureService.serviceURL, cfg.Azure.ContainerName)
+                var storageErr azblob.StorageError
+                if errors.As(err, &storageErr) && storageErr.ServiceCode() == azblob.ServiceCodeContainerNotFound {
+                    return nil
+                }
+                if err != nil {
+                    return azure.AuthError(err)
+                }
+                return nil
+            },
+        },
+    }
+}
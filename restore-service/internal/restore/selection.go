@@ -0,0 +1,118 @@
+package restore
+
+import (
+    "fmt"
+    "regexp"
+    "strconv"
+    "time"
+
+    "shared/pkg/gdrive"
+)
+
+// Selection chooses which full backup of a container is restored. The zero
+// value selects the latest backup. Before takes precedence over Date.
+type Selection struct {
+    Date   *time.Time // Calendar day, picks the backup closest to it
+    Before *time.Time // Instant, picks the newest backup at or before it
+}
+
+// daysPattern matches a leading day count such as "3d" or "1d12h", which
+// time.ParseDuration does not accept
+var daysPattern = regexp.MustCompile(`^(\d+)d(.*)$`)
+
+// ParseSince turns a -since value into an instant: either a duration before
+// now ("72h", "3d", "1d12h") or an RFC3339 timestamp
+func ParseSince(value string, now time.Time) (time.Time, error) {
+    if value == "" {
+        return time.Time{}, fmt.Errorf("empty duration")
+    }
+    if t, err := time.Parse(time.RFC3339, value); err == nil {
+        return t, nil
+    }
+
+    var ago time.Duration
+    rest := value
+    if match := daysPattern.FindStringSubmatch(value); match != nil {
+        days, err := strconv.Atoi(match[1])
+        if err != nil {
+            return time.Time{}, fmt.Errorf("invalid day count in %q: %v", value, err)
+        }
+        ago = time.Duration(days) * 24 * time.Hour
+        rest = match[2]
+    }
+    if rest != "" {
+        d, err := time.ParseDuration(rest)
+        if err != nil {
+            return time.Time{}, fmt.Errorf("invalid duration %q: use e.g. 72h, 3d or an RFC3339 timestamp", value)
+        }
+        ago += d
+    }
+    if ago < 0 {
+        return time.Time{}, fmt.Errorf("duration %q must not be negative", value)
+    }
+    return now.Add(-ago), nil
+}
+
+// find picks the backup to restore from backups, sorted newest first
+func (sel Selection) find(backups []*gdrive.DriveBackup) *gdrive.DriveBackup {
+    switch {
+    case sel.Before != nil:
+        return findBackupAtOrBefore(backups, *sel.Before)
+    case sel.Date != nil:
+        return findClosestBackup(backups, *sel.Date)
+    case len(backups) > 0:
+        return backups[0]
+    }
+    return nil
+}
+
+// until bounds the incremental backups applied on top of the full backup:
+// up to the selected instant, or the end of the selected day
+func (sel Selection) until() time.Time {
+    switch {
+    case sel.Before != nil:
+        // Drive compares creation times to the second and the bound is exclusive
+        return sel.Before.UTC().Truncate(time.Second).Add(time.Second)
+    case sel.Date != nil:
+        date := *sel.Date
+        return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC).Add(24 * time.Hour)
+    }
+    return time.Time{}
+}
+
+// String describes the selection for log messages
+func (sel Selection) String() string {
+    switch {
+    case sel.Before != nil:
+        return "at or before " + sel.Before.UTC().Format(time.RFC3339)
+    case sel.Date != nil:
+        return "on date " + sel.Date.Format("2006-01-02")
+    }
+    return "latest"
+}
+
+// getBackup looks up the full backup of containerName chosen by sel
+func (s *RestoreService) getBackup(containerName string, sel Selection) (*gdrive.DriveBackup, error) {
+    switch {
+    case sel.Before != nil:
+        return s.driveService.GetBackupBefore(*sel.Before, containerName)
+    case sel.Date != nil:
+        return s.driveService.GetBackupFromDate(*sel.Date, containerName)
+    }
+    return s.driveService.GetLatestBackup(containerName)
+}
+
+// findBackupAtOrBefore returns the newest of backups created at or before
+// the given instant, or nil if all are newer
+func findBackupAtOrBefore(backups []*gdrive.DriveBackup, before time.Time) *gdrive.DriveBackup {
+    var newest *gdrive.DriveBackup
+    for _, backup := range backups {
+        if backup.CreatedTime.After(before) {
+            continue
+        }
+        if newest == nil || backup.CreatedTime.After(newest.CreatedTime) {
+            newest = backup
+        }
+    }
+    return newest
+}
@@ -5,7 +5,9 @@ import (
     "fmt"
     "os"
     "path/filepath"
+    "sort"
     "strings"
+    "sync"
     "time"
 
     "shared/pkg/config"
@@ -14,158 +16,530 @@ import (
 )
 
 type RestoreService struct {
-    config       *config.RestoreServiceConfig
-    logger       *utils.Logger
-    driveService *GoogleDriveRestore
-    azureService *AzureService
+    config          *config.RestoreServiceConfig
+    logger          *utils.Logger
+    driveService    *GoogleDriveRestore
+    azureService    *AzureService // created on first use, see azure
+    azureOnce       sync.Once
+    azureErr        error
+    filter          PathFilter
+    targetContainer string
 }
 
+// NewRestoreService connects to Google Drive. The target Azure account is
+// only set up once a restore starts, so listing and verifying backups work
+// with Google Drive credentials alone.
 func NewRestoreService(cfg *config.RestoreServiceConfig) (*RestoreService, error) {
-    logger := utils.NewLogger("[RESTORE]", cfg.Common.LogLevel)
+    logger := utils.NewLogger("[RESTORE]", cfg.Common.LogLevel, cfg.Common.LogFormat)
 
-    driveService, err := NewGoogleDriveRestore(cfg, logger)
-    if err != nil {
-        return nil, fmt.Errorf("failed to initialize drive service: %v", err)
+    // Restore and verify directories left by a crashed run
+    if cfg.TempCleanupAge > 0 {
+        utils.CleanupTempDir(cfg.TempDir, cfg.TempCleanupAge, []string{"restore_*", "verify_*"}, logger)
     }
 
-    azureService, err := NewAzureService(cfg, logger)
+    driveService, err := NewGoogleDriveRestore(cfg, logger)
     if err != nil {
-        return nil, fmt.Errorf("failed to initialize azure service: %v", err)
+        return nil, fmt.Errorf("failed to initialize drive service: %w", err)
     }
 
     return &RestoreService{
         config:       cfg,
         logger:       logger,
         driveService: driveService,
-        azureService: azureService,
     }, nil
 }
 
-// RestoreLatest restores the most recent backup
-func (s *RestoreService) RestoreLatest(ctx context.Context) error {
+// SetAzureService makes restores upload through azureService instead of one
+// created from the configuration
+func (s *RestoreService) SetAzureService(azureService *AzureService) {
+    s.azureService = azureService
+}
+
+// azure returns the target Azure service, creating it on first use
+func (s *RestoreService) azure() (*AzureService, error) {
+    s.azureOnce.Do(func() {
+        if s.azureService != nil {
+            return
+        }
+        s.azureService, s.azureErr = NewAzureService(s.config, s.logger)
+        if s.azureErr != nil {
+            s.azureErr = fmt.Errorf("failed to initialize azure service: %w", s.azureErr)
+        }
+    })
+    return s.azureService, s.azureErr
+}
+
+// SetFilter limits restores to files matching the given prefix and/or glob
+func (s *RestoreService) SetFilter(filter PathFilter) error {
+    if err := filter.Validate(); err != nil {
+        return err
+    }
+    s.filter = filter
+    return nil
+}
+
+// SetTargetContainer uploads restored files into name instead of the
+// container the backup was taken from
+func (s *RestoreService) SetTargetContainer(name string) error {
     if s.config.Azure.ContainerName == "ALL" {
-        return s.restoreAllContainers(ctx, nil)
+        return fmt.Errorf("a target container can only be used when restoring a single container")
+    }
+    if err := ValidateContainerName(name); err != nil {
+        return err
+    }
+    s.targetContainer = name
+    return nil
+}
+
+// targetContainerFor returns the container the backup of containerName is
+// restored into: the one set with SetTargetContainer, or containerName with
+// TARGET_CONTAINER_PREFIX in front
+func (s *RestoreService) targetContainerFor(containerName string) (string, error) {
+    if s.targetContainer != "" {
+        return s.targetContainer, nil
+    }
+    if s.config.TargetPrefix == "" {
+        return containerName, nil
+    }
+
+    name := s.config.TargetPrefix + containerName
+    if err := ValidateContainerName(name); err != nil {
+        return "", fmt.Errorf("container %s cannot be restored with TARGET_CONTAINER_PREFIX %q: %v",
+            containerName, s.config.TargetPrefix, err)
     }
-    return s.restoreContainer(ctx, s.config.Azure.ContainerName, nil)
+    return name, nil
+}
+
+// extractLimits bounds what extracting a single archive may write
+func (s *RestoreService) extractLimits() utils.ExtractLimits {
+    return utils.ExtractLimits{MaxSize: s.config.MaxExtractSize, MaxEntries: s.config.MaxEntries}
+}
+
+// RestoreLatest restores the most recent backup
+func (s *RestoreService) RestoreLatest(ctx context.Context) error {
+    return s.Restore(ctx, Selection{})
 }
 
 // RestoreFromDate restores backup from a specific date
 func (s *RestoreService) RestoreFromDate(ctx context.Context, date time.Time) error {
+    return s.Restore(ctx, Selection{Date: &date})
+}
+
+// RestoreBefore restores the newest backup taken at or before the given
+// instant, with the incremental backups taken up to that instant
+func (s *RestoreService) RestoreBefore(ctx context.Context, before time.Time) error {
+    return s.Restore(ctx, Selection{Before: &before})
+}
+
+// Restore restores the backup chosen by sel for every configured container
+func (s *RestoreService) Restore(ctx context.Context, sel Selection) error {
     if s.config.Azure.ContainerName == "ALL" {
-        return s.restoreAllContainers(ctx, &date)
+        return s.restoreAllContainers(ctx, sel)
+    }
+    return s.restoreContainer(ctx, s.config.Azure.ContainerName, sel)
+}
+
+// RestoreBackupByID restores exactly the archive with the given Drive file ID
+func (s *RestoreService) RestoreBackupByID(ctx context.Context, fileID string) error {
+    backup, err := s.driveService.GetBackupByID(fileID)
+    if err != nil {
+        return fmt.Errorf("failed to get backup: %w", err)
+    }
+    return s.restoreBackup(ctx, backup)
+}
+
+// RestoreBackupByName restores exactly the archive with the given file name
+func (s *RestoreService) RestoreBackupByName(ctx context.Context, name string) error {
+    backup, err := s.driveService.GetBackupByName(name)
+    if err != nil {
+        return fmt.Errorf("failed to get backup: %w", err)
+    }
+    return s.restoreBackup(ctx, backup)
+}
+
+// restoreBackup restores a single archive into the container it was taken
+// from. Later incremental backups are not applied.
+func (s *RestoreService) restoreBackup(ctx context.Context, backup *gdrive.DriveBackup) error {
+    containerName, _, _ := gdrive.ParseBackupName(backup.Name)
+    if s.config.Azure.ContainerName != "ALL" && s.config.Azure.ContainerName != containerName {
+        return fmt.Errorf("backup %s belongs to container %s, not %s", backup.Name, containerName, s.config.Azure.ContainerName)
+    }
+    if gdrive.IsIncrementalBackup(backup.Name) {
+        s.logger.Warn("%s is an incremental backup and only holds the blobs changed since the previous backup", backup.Name)
     }
-    return s.restoreContainer(ctx, s.config.Azure.ContainerName, &date)
+    return s.processRestore(ctx, containerName, backup, nil)
 }
 
-func (s *RestoreService) restoreAllContainers(ctx context.Context, date *time.Time) error {
+func (s *RestoreService) restoreAllContainers(ctx context.Context, sel Selection) error {
     backups, err := s.driveService.ListAvailableBackups()
     if err != nil {
-        return fmt.Errorf("failed to list backups: %v", err)
+        return fmt.Errorf("failed to list backups: %w", err)
     }
 
-    // Group backups by container
-    containerBackups := make(map[string][]*gdrive.DriveBackup)
-    for _, backup := range backups {
-        // Parse container name from backup file name
-        // Example: "assets_20241114_144123.zip"
-        containerName := backup.Name[:strings.Index(backup.Name, "_")]
-        containerBackups[containerName] = append(containerBackups[containerName], backup)
+    // Set up the target before spending time on downloads
+    azureService, err := s.azure()
+    if err != nil {
+        return err
     }
 
-    // Process each container
-    for containerName, backups := range containerBackups {
-        if len(backups) == 0 {
-            s.logger.Warn("No backups found for container: %s", containerName)
-            continue
+    // Restore as a pipeline: RESTORE_DOWNLOAD_WORKERS downloaders fetch and
+    // extract archives into their own temp directories while
+    // RESTORE_MAX_CONCURRENT_CONTAINERS uploaders push extracted containers
+    // to Azure. A downloader waits for a free uploader before taking the
+    // next container, so at most one extracted copy per worker is on disk.
+    // A failed container does not stop the others, but fails the restore as
+    // a whole.
+    var restored, failed []string
+    var failures []error
+    var mu sync.Mutex
+    startTime := time.Now()
+
+    record := func(containerName string, err error) {
+        mu.Lock()
+        defer mu.Unlock()
+        if err != nil {
+            s.logger.Error("Failed to restore container %s: %v", containerName, err)
+            failed = append(failed, containerName)
+            failures = append(failures, fmt.Errorf("%s: %w", containerName, err))
+            return
         }
+        restored = append(restored, containerName)
+    }
+
+    jobs := make(chan *gdrive.DriveBackup)
+    prepared := make(chan *preparedRestore)
 
-        var backupToRestore *gdrive.DriveBackup
-        if date != nil {
-            // Find backup closest to specified date
-            backupToRestore = findClosestBackup(backups, *date)
-            if backupToRestore == nil {
-                s.logger.Warn("No backup found for container %s on date %s", containerName, date.Format("2006-01-02"))
-                continue
+    var downloaders sync.WaitGroup
+    for i := 0; i < s.config.MaxDownloads; i++ {
+        downloaders.Add(1)
+        go func() {
+            defer downloaders.Done()
+            for backup := range jobs {
+                containerName, _, _ := gdrive.ParseBackupName(backup.Name)
+                err := ctx.Err()
+                var incrementals []*gdrive.DriveBackup
+                if err == nil {
+                    incrementals, err = s.incrementalsFor(containerName, backup, sel)
+                }
+                var p *preparedRestore
+                if err == nil {
+                    s.logger.Info("Restoring container %s from backup: %s", containerName, backup.Name)
+                    p, err = s.prepareRestore(ctx, containerName, backup, incrementals)
+                }
+                if err != nil {
+                    record(containerName, err)
+                    continue
+                }
+                prepared <- p
             }
-        } else {
-            // Use latest backup
-            backupToRestore = backups[0] // Already sorted by date desc
+        }()
+    }
+
+    var uploaders sync.WaitGroup
+    for i := 0; i < s.config.MaxContainers; i++ {
+        uploaders.Add(1)
+        go func() {
+            defer uploaders.Done()
+            for p := range prepared {
+                err := ctx.Err()
+                if err == nil {
+                    err = s.uploadRestore(ctx, azureService, p)
+                }
+                p.cleanup()
+                record(p.containerName, err)
+            }
+        }()
+    }
+
+    for containerName, backups := range groupBackupsByContainer(backups) {
+        if len(backups) == 0 {
+            s.logger.Warn("No backups found for container: %s", containerName)
+            continue
         }
 
-        s.logger.Info("Restoring container %s from backup: %s", containerName, backupToRestore.Name)
-        if err := s.processRestore(ctx, containerName, backupToRestore); err != nil {
-            s.logger.Error("Failed to restore container %s: %v", containerName, err)
+        backupToRestore := sel.find(backups)
+        if backupToRestore == nil {
+            s.logger.Warn("No backup found for container %s %s", containerName, sel)
             continue
         }
+        jobs <- backupToRestore
+    }
+    close(jobs)
+    downloaders.Wait()
+    close(prepared)
+    uploaders.Wait()
+
+    sort.Strings(restored)
+    sort.Strings(failed)
+    s.logger.Info("Restored %d of %d containers in %v", len(restored), len(restored)+len(failed),
+        time.Since(startTime).Round(time.Second))
+    if len(restored) > 0 {
+        s.logger.Info("Restored containers: %s", strings.Join(restored, ", "))
     }
 
+    if len(failed) > 0 {
+        s.logger.Error("Failed containers: %s", strings.Join(failed, ", "))
+        return containerErrors(fmt.Sprintf("restore failed for %d containers: %s",
+            len(failed), strings.Join(failed, ", ")), failures)
+    }
     return nil
 }
 
-func (s *RestoreService) restoreContainer(ctx context.Context, containerName string, date *time.Time) error {
-    var backup *gdrive.DriveBackup
-    var err error
+func (s *RestoreService) restoreContainer(ctx context.Context, containerName string, sel Selection) error {
+    backup, err := s.getBackup(containerName, sel)
+    if err != nil {
+        return fmt.Errorf("failed to get backup: %w", err)
+    }
 
-    if date != nil {
-        backup, err = s.driveService.GetBackupFromDate(*date, containerName)
-    } else {
-        backup, err = s.driveService.GetLatestBackup(containerName)
+    incrementals, err := s.incrementalsFor(containerName, backup, sel)
+    if err != nil {
+        return err
     }
 
+    return s.processRestore(ctx, containerName, backup, incrementals)
+}
+
+// incrementalsFor returns the incremental backups to apply on top of the full
+// backup. For a dated restore only those taken up to the end of that day are
+// used, and for a restore at or before an instant only those up to it.
+func (s *RestoreService) incrementalsFor(containerName string, full *gdrive.DriveBackup, sel Selection) ([]*gdrive.DriveBackup, error) {
+    incrementals, err := s.driveService.GetIncrementalBackups(containerName, full.CreatedTime, sel.until())
+    if err != nil {
+        return nil, fmt.Errorf("failed to list incremental backups: %w", err)
+    }
+    if len(incrementals) > 0 {
+        s.logger.Info("Found %d incremental backups after %s", len(incrementals), full.Name)
+    }
+    return incrementals, nil
+}
+
+func (s *RestoreService) processRestore(ctx context.Context, containerName string, backup *gdrive.DriveBackup, incrementals []*gdrive.DriveBackup) error {
+    // Set up the target before spending time on the download
+    azureService, err := s.azure()
+    if err != nil {
+        return err
+    }
+
+    p, err := s.prepareRestore(ctx, containerName, backup, incrementals)
     if err != nil {
-        return fmt.Errorf("failed to get backup: %v", err)
+        return err
     }
+    defer p.cleanup()
 
-    return s.processRestore(ctx, containerName, backup)
+    return s.uploadRestore(ctx, azureService, p)
 }
 
-func (s *RestoreService) processRestore(ctx context.Context, containerName string, backup *gdrive.DriveBackup) error {
-    startTime := time.Now()
+// preparedRestore is a container whose backup has been downloaded and
+// extracted, ready to be uploaded to Azure
+type preparedRestore struct {
+    containerName   string
+    targetContainer string // Azure container the files are uploaded into
+    backup          *gdrive.DriveBackup
+    tempDir         string // removed by cleanup; empty for tree backups, which are streamed on upload
+    extractPath     string
+    properties      map[string]utils.BlobProperties // preserved content headers and metadata, nil if none
+    startTime       time.Time
+}
+
+// cleanup removes the downloaded and extracted files
+func (p *preparedRestore) cleanup() {
+    if p.tempDir != "" {
+        os.RemoveAll(p.tempDir)
+    }
+}
+
+// prepareRestore downloads, decrypts and extracts backup, replays
+// incrementals on top of it and applies the path filter, leaving the files
+// to upload in a new temp directory
+func (s *RestoreService) prepareRestore(ctx context.Context, containerName string, backup *gdrive.DriveBackup, incrementals []*gdrive.DriveBackup) (_ *preparedRestore, err error) {
+    // An invalid target name fails before anything is downloaded
+    targetContainer, err := s.targetContainerFor(containerName)
+    if err != nil {
+        return nil, err
+    }
+
+    p := &preparedRestore{containerName: containerName, targetContainer: targetContainer, backup: backup, startTime: time.Now()}
     s.logger.Info("Starting restore process for container: %s", containerName)
+    if targetContainer != containerName {
+        s.logger.Info("Restoring into container: %s", targetContainer)
+    }
     s.logger.Info("Using backup: %s (Created: %s, Size: %.2f MB)",
         backup.Name,
         backup.CreatedTime.Format("2006-01-02 15:04:05"),
         float64(backup.Size)/(1024*1024))
 
+    if gdrive.IsTreeBackup(backup.Name) {
+        if len(incrementals) > 0 {
+            s.logger.Warn("Ignoring %d incremental backups: %s is a tree backup", len(incrementals), backup.Name)
+        }
+        return p, nil
+    }
+
     // Create temp directory
-    tempDir := filepath.Join(s.config.TempDir, fmt.Sprintf("restore_%s_%s",
+    p.tempDir = filepath.Join(s.config.TempDir, fmt.Sprintf("restore_%s_%s",
         containerName,
         time.Now().Format("20060102_150405")))
-    if err := os.MkdirAll(tempDir, 0755); err != nil {
-        return fmt.Errorf("failed to create temp directory: %v", err)
+    if err := os.MkdirAll(p.tempDir, 0755); err != nil {
+        return nil, fmt.Errorf("failed to create temp directory: %v", err)
     }
-    defer os.RemoveAll(tempDir)
+    defer func() {
+        if err != nil {
+            p.cleanup()
+        }
+    }()
 
     // Download backup
     s.logger.Info("Downloading backup file...")
-    zipPath := filepath.Join(tempDir, backup.Name)
-    if err := s.driveService.DownloadFile(ctx, backup.ID, zipPath); err != nil {
-        return fmt.Errorf("failed to download backup: %v", err)
+    zipPath := filepath.Join(p.tempDir, backup.Name)
+    if err := s.driveService.DownloadBackup(ctx, backup, zipPath); err != nil {
+        return nil, fmt.Errorf("failed to download backup: %w", err)
+    }
+
+    // Decrypt backup if it was encrypted
+    zipPath, err = utils.DecryptIfNeeded(zipPath, s.config.EncryptionKey)
+    if err != nil {
+        return nil, fmt.Errorf("failed to decrypt backup: %v", err)
     }
 
     // Extract backup
     s.logger.Info("Extracting backup archive...")
-    extractPath := filepath.Join(tempDir, "extracted")
-    if err := utils.UnzipFile(zipPath, extractPath); err != nil {
-        return fmt.Errorf("failed to extract backup: %v", err)
+    p.extractPath = filepath.Join(p.tempDir, "extracted")
+    if err := utils.ExtractArchive(zipPath, p.extractPath, s.extractLimits()); err != nil {
+        return nil, fmt.Errorf("failed to extract backup: %v", err)
+    }
+
+    // Replay incremental backups in order
+    for i, inc := range incrementals {
+        s.logger.Info("Applying incremental backup %d/%d: %s", i+1, len(incrementals), inc.Name)
+        archivePath := filepath.Join(p.tempDir, inc.Name)
+        if err := s.driveService.DownloadBackup(ctx, inc, archivePath); err != nil {
+            return nil, fmt.Errorf("failed to download incremental backup %s: %v", inc.Name, err)
+        }
+        if err := utils.ApplyIncrementalArchive(archivePath, p.extractPath, s.config.EncryptionKey, s.extractLimits()); err != nil {
+            return nil, fmt.Errorf("failed to apply incremental backup %s: %v", inc.Name, err)
+        }
+    }
+
+    // The preserved blob properties are not a blob, so they are taken out
+    // before filtering and uploading
+    p.properties, err = utils.TakeBlobProperties(p.extractPath)
+    if err != nil {
+        return nil, err
+    }
+    if p.properties != nil {
+        s.logger.Info("Restoring preserved content headers and metadata of %d blobs", len(p.properties))
+    }
+
+    // Keep only the requested subset before uploading
+    if !s.filter.IsEmpty() {
+        matched, skipped, err := applyFilter(p.extractPath, s.filter)
+        if err != nil {
+            return nil, fmt.Errorf("failed to filter extracted files: %v", err)
+        }
+        s.logger.Info("Filter (prefix=%q, glob=%q): %d files matched, %d skipped",
+            s.filter.Prefix, s.filter.Glob, matched, skipped)
+        if matched == 0 {
+            return nil, fmt.Errorf("no files in backup %s match the filter", backup.Name)
+        }
+    }
+
+    return p, nil
+}
+
+// uploadRestore uploads a prepared container to Azure, or streams a tree
+// backup straight from Drive, and checks the result when configured to
+func (s *RestoreService) uploadRestore(ctx context.Context, azureService *AzureService, p *preparedRestore) error {
+    if gdrive.IsTreeBackup(p.backup.Name) {
+        return s.restoreTree(ctx, azureService, p.containerName, p.targetContainer, p.backup)
     }
 
     // Upload to Azure
-    s.logger.Info("Uploading files to Azure Storage...")
-    stats, err := s.azureService.UploadFiles(ctx, extractPath, containerName)
+    targetContainer := p.targetContainer
+    if err := s.cleanTarget(ctx, azureService, targetContainer); err != nil {
+        return err
+    }
+
+    s.logger.Info("Uploading files to Azure Storage container %s...", targetContainer)
+    stats, err := azureService.UploadFiles(ctx, p.extractPath, targetContainer, p.properties)
     if err != nil {
-        return fmt.Errorf("failed to upload to azure: %v", err)
+        return fmt.Errorf("failed to upload to azure: %w", err)
     }
 
-    duration := time.Since(startTime)
+    // Confirm every extracted file made it into the container
+    var report *IntegrityReport
+    if s.config.IntegrityCheck {
+        s.logger.Info("Checking restored blobs in container %s...", targetContainer)
+        report, err = azureService.CheckIntegrity(ctx, p.extractPath, targetContainer)
+        if err != nil {
+            return fmt.Errorf("integrity check failed: %v", err)
+        }
+    }
+
+    return s.logRestoreSummary(p.containerName, time.Since(p.startTime), stats, report)
+}
+
+// cleanTarget deletes the blobs of containerName the restore replaces when
+// RESTORE_CLEAN_BEFORE is set: all of them, or those matching the path
+// filter. Otherwise the restored files are merged over the existing blobs.
+func (s *RestoreService) cleanTarget(ctx context.Context, azureService *AzureService, containerName string) error {
+    if !s.config.CleanBefore {
+        s.logger.Info("Merging restored files into container %s (RESTORE_CLEAN_BEFORE=false)", containerName)
+        return nil
+    }
+
+    s.logger.Info("Deleting existing blobs in container %s (RESTORE_CLEAN_BEFORE=true)...", containerName)
+    deleted, err := azureService.DeleteBlobs(ctx, containerName, s.filter)
+    if err != nil {
+        return fmt.Errorf("failed to clean container %s: %v", containerName, err)
+    }
+    s.logger.Info("Deleted %d existing blobs in container %s", deleted, containerName)
+    return nil
+}
+
+// logRestoreSummary logs the outcome of a restore and fails it when the
+// integrity check found missing or mismatched blobs
+func (s *RestoreService) logRestoreSummary(containerName string, duration time.Duration, stats *UploadStats, report *IntegrityReport) error {
     s.logger.Info("Restore completed for container %s in %v:", containerName, duration)
     s.logger.Info("- Files processed: %d", stats.FilesCount)
+    if s.config.SkipUnchanged {
+        s.logger.Info("- Files skipped (unchanged): %d", stats.SkippedFiles)
+    }
     s.logger.Info("- Total size: %.2f MB", float64(stats.TotalSize)/(1024*1024))
     s.logger.Info("- Average speed: %.2f MB/s", float64(stats.TotalSize)/(1024*1024)/duration.Seconds())
+    if report != nil {
+        s.logger.Info("- Integrity check: %d files checked, %d missing, %d mismatched",
+            report.Checked, len(report.Missing), len(report.Mismatched))
+        if !report.OK() {
+            return fmt.Errorf("restore of %s is incomplete: %d blobs missing, %d mismatched",
+                containerName, len(report.Missing), len(report.Mismatched))
+        }
+    }
 
     return nil
 }
 
+// groupBackupsByContainer groups full backups by the container name in their
+// file name, keeping the newest-first order
+func groupBackupsByContainer(backups []*gdrive.DriveBackup) map[string][]*gdrive.DriveBackup {
+    containerBackups := make(map[string][]*gdrive.DriveBackup)
+    for _, backup := range backups {
+        // Incremental backups are applied on top of their full backup
+        if gdrive.IsIncrementalBackup(backup.Name) {
+            continue
+        }
+
+        // Parse container name from backup file name, matching the timestamp
+        // suffix so underscores in the name are kept
+        // Example: "user_data_20241114_144123.zip" -> "user_data"
+        containerName, _, ok := gdrive.ParseBackupName(backup.Name)
+        if !ok {
+            continue
+        }
+        containerBackups[containerName] = append(containerBackups[containerName], backup)
+    }
+    return containerBackups
+}
+
 // Helper function to find backup closest to specified date
 func findClosestBackup(backups []*gdrive.DriveBackup, targetDate time.Time) *gdrive.DriveBackup {
     targetDate = time.Date(targetDate.Year(), targetDate.Month(), targetDate.Day(), 0, 0, 0, 0, targetDate.Location())
@@ -0,0 +1,190 @@
+package restore
+
+import (
+    "errors"
+    "fmt"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "shared/pkg/azure"
+    "shared/pkg/config"
+    "shared/pkg/gdrive"
+)
+
+func TestGroupBackupsByContainer(t *testing.T) {
+    backups := []*gdrive.DriveBackup{
+        {Name: "user_data_20241115_010000.zip"},
+        {Name: "user_20241115_010000.zip"},
+        {Name: "user_data_20241114_144123.zip"},
+        {Name: "inc_user_data_20241115_120000.zip"},
+        {Name: "a_b_c_20241114_144123.tar.gz.enc"},
+        {Name: "notes.txt"},
+    }
+
+    got := make(map[string][]string)
+    for container, group := range groupBackupsByContainer(backups) {
+        for _, backup := range group {
+            got[container] = append(got[container], backup.Name)
+        }
+    }
+
+    want := map[string][]string{
+        "user_data": {"user_data_20241115_010000.zip", "user_data_20241114_144123.zip"},
+        "user":      {"user_20241115_010000.zip"},
+        "a_b_c":     {"a_b_c_20241114_144123.tar.gz.enc"},
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("groupBackupsByContainer = %v, want %v", got, want)
+    }
+}
+
+func TestParseSince(t *testing.T) {
+    now := time.Date(2024, 11, 15, 12, 0, 0, 0, time.UTC)
+    tests := []struct {
+        value string
+        want  time.Time
+    }{
+        {"72h", time.Date(2024, 11, 12, 12, 0, 0, 0, time.UTC)},
+        {"3d", time.Date(2024, 11, 12, 12, 0, 0, 0, time.UTC)},
+        {"1d12h", time.Date(2024, 11, 14, 0, 0, 0, 0, time.UTC)},
+        {"90m", time.Date(2024, 11, 15, 10, 30, 0, 0, time.UTC)},
+        {"2024-11-10T08:00:00Z", time.Date(2024, 11, 10, 8, 0, 0, 0, time.UTC)},
+    }
+    for _, tt := range tests {
+        got, err := ParseSince(tt.value, now)
+        if err != nil {
+            t.Errorf("ParseSince(%q): %v", tt.value, err)
+            continue
+        }
+        if !got.Equal(tt.want) {
+            t.Errorf("ParseSince(%q) = %v, want %v", tt.value, got, tt.want)
+        }
+    }
+
+    for _, value := range []string{"", "3", "d", "3days", "-2h", "2024-11-10"} {
+        if _, err := ParseSince(value, now); err == nil {
+            t.Errorf("ParseSince(%q) accepted an invalid value", value)
+        }
+    }
+}
+
+func TestFindBackupAtOrBefore(t *testing.T) {
+    at := func(day, hour int) time.Time {
+        return time.Date(2024, 11, day, hour, 0, 0, 0, time.UTC)
+    }
+    // Newest first, as returned by groupBackupsByContainer
+    backups := []*gdrive.DriveBackup{
+        {Name: "c", CreatedTime: at(15, 1)},
+        {Name: "b", CreatedTime: at(14, 1)},
+        {Name: "a", CreatedTime: at(12, 1)},
+    }
+
+    tests := []struct {
+        before time.Time
+        want   string
+    }{
+        {at(16, 0), "c"},
+        {at(15, 1), "c"}, // exact match
+        {at(15, 0), "b"},
+        {at(13, 23), "a"},
+        {at(12, 0), ""},
+    }
+    for _, tt := range tests {
+        got := findBackupAtOrBefore(backups, tt.before)
+        name := ""
+        if got != nil {
+            name = got.Name
+        }
+        if name != tt.want {
+            t.Errorf("findBackupAtOrBefore(%v) = %q, want %q", tt.before, name, tt.want)
+        }
+    }
+}
+
+func TestBackupEntries(t *testing.T) {
+    backups := []*gdrive.DriveBackup{
+        {Name: "logs_20241114_010000.zip", CreatedTime: time.Date(2024, 11, 14, 1, 0, 0, 0, time.UTC)},
+        {Name: "assets_20241114_010000.zip", CreatedTime: time.Date(2024, 11, 14, 1, 0, 0, 0, time.UTC)},
+        {Name: "inc_assets_20241115_120000.zip", CreatedTime: time.Date(2024, 11, 15, 12, 0, 0, 0, time.UTC)},
+        {Name: "assets_20241115_010000.zip", CreatedTime: time.Date(2024, 11, 15, 1, 0, 0, 0, time.UTC)},
+        {Name: "notes.txt", CreatedTime: time.Date(2024, 11, 16, 1, 0, 0, 0, time.UTC)},
+    }
+
+    names := func(entries []BackupEntry) []string {
+        var result []string
+        for _, entry := range entries {
+            result = append(result, entry.Name)
+        }
+        return result
+    }
+
+    all := backupEntries(backups, "")
+    want := []string{
+        "inc_assets_20241115_120000.zip",
+        "assets_20241115_010000.zip",
+        "assets_20241114_010000.zip",
+        "logs_20241114_010000.zip",
+    }
+    if got := names(all); !reflect.DeepEqual(got, want) {
+        t.Errorf("backupEntries(all) = %v, want %v", got, want)
+    }
+    if !all[0].Incremental || all[1].Incremental {
+        t.Errorf("incremental flags = %v, %v, want true, false", all[0].Incremental, all[1].Incremental)
+    }
+
+    if got := names(backupEntries(backups, "logs")); !reflect.DeepEqual(got, []string{"logs_20241114_010000.zip"}) {
+        t.Errorf("backupEntries(logs) = %v", got)
+    }
+}
+
+func TestExitCode(t *testing.T) {
+    partial := containerErrors("restore failed for 1 containers: assets",
+        []error{fmt.Errorf("assets: %w", errors.New("extract failed"))})
+
+    tests := []struct {
+        name string
+        err  error
+        want int
+    }{
+        {"success", nil, 0},
+        {"not found", fmt.Errorf("failed to get backup: %w", fmt.Errorf("%w for container: assets", gdrive.ErrNoBackupFound)), ExitNotFound},
+        {"drive auth", fmt.Errorf("failed to initialize drive service: %w", gdrive.ErrDriveAuth), ExitAuth},
+        {"azure auth", fmt.Errorf("failed to upload to azure: %w", fmt.Errorf("failed to create container: %w", azure.AuthError(fmt.Errorf("%w: 403", ErrAzureAuth)))), ExitAuth},
+        {"upload errors", fmt.Errorf("failed to upload to azure: %w", fmt.Errorf("%w: encountered 3 upload errors", ErrPartialRestore)), ExitPartial},
+        {"failed containers", partial, ExitPartial},
+        {"other", errors.New("failed to extract backup"), ExitFailure},
+    }
+
+    for _, tt := range tests {
+        if got := ExitCode(tt.err); got != tt.want {
+            t.Errorf("%s: ExitCode() = %d, want %d", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestTargetContainerFor(t *testing.T) {
+    tests := []struct {
+        prefix, target, container string
+        want                      string
+        wantErr                   bool
+    }{
+        {"", "", "assets", "assets", false},
+        {"stg-", "", "assets", "stg-assets", false},
+        {"stg-", "assets-restore-test", "assets", "assets-restore-test", false},
+        {"stg-", "", strings.Repeat("a", 60), "", true},
+    }
+
+    for _, tt := range tests {
+        s := &RestoreService{
+            config:          &config.RestoreServiceConfig{TargetPrefix: tt.prefix},
+            targetContainer: tt.target,
+        }
+        got, err := s.targetContainerFor(tt.container)
+        if (err != nil) != tt.wantErr || got != tt.want {
+            t.Errorf("targetContainerFor(%q) with prefix %q = %q, %v; want %q, error %v",
+                tt.container, tt.prefix, got, err, tt.want, tt.wantErr)
+        }
+    }
+}
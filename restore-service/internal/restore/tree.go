@@ -0,0 +1,206 @@
+package restore
+
+import (
+    "context"
+    "crypto/md5"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/Azure/azure-storage-blob-go/azblob"
+    "shared/pkg/azure"
+    "shared/pkg/gdrive"
+    "shared/pkg/utils"
+)
+
+// restoreTree restores a tree backup by streaming each file from Drive
+// straight into its blob, without a local copy of the container
+func (s *RestoreService) restoreTree(ctx context.Context, azureService *AzureService, containerName, targetContainer string, backup *gdrive.DriveBackup) error {
+    startTime := time.Now()
+
+    s.logger.Info("Reading tree backup manifest...")
+    manifest, err := s.driveService.ReadTreeManifest(ctx, backup.ID)
+    if err != nil {
+        return fmt.Errorf("failed to read backup manifest: %v", err)
+    }
+
+    files := manifest.Files
+    if !s.filter.IsEmpty() {
+        files = nil
+        for _, file := range manifest.Files {
+            if s.filter.Match(file.Path) {
+                files = append(files, file)
+            }
+        }
+        s.logger.Info("Filter (prefix=%q, glob=%q): %d files matched, %d skipped",
+            s.filter.Prefix, s.filter.Glob, len(files), len(manifest.Files)-len(files))
+        if len(files) == 0 {
+            return fmt.Errorf("no files in backup %s match the filter", backup.Name)
+        }
+    }
+
+    if err := s.cleanTarget(ctx, azureService, targetContainer); err != nil {
+        return err
+    }
+
+    s.logger.Info("Streaming %d files to Azure Storage container %s...", len(files), targetContainer)
+    stats, err := azureService.UploadTree(ctx, files, targetContainer, s.driveService.OpenFile)
+    if err != nil {
+        return fmt.Errorf("failed to upload to azure: %w", err)
+    }
+
+    var report *IntegrityReport
+    if s.config.IntegrityCheck {
+        s.logger.Info("Checking restored blobs in container %s...", targetContainer)
+        report, err = azureService.CheckTreeIntegrity(ctx, files, targetContainer)
+        if err != nil {
+            return fmt.Errorf("integrity check failed: %v", err)
+        }
+    }
+
+    return s.logRestoreSummary(containerName, time.Since(startTime), stats, report)
+}
+
+// UploadTree streams files of a tree backup, opened with open, into
+// containerName. Each blob gets the MD5 recorded in the manifest as its
+// Content-MD5, and the streamed content is checked against it.
+func (s *AzureService) UploadTree(ctx context.Context, files []gdrive.TreeFile, containerName string,
+    open func(ctx context.Context, fileID string) (io.ReadCloser, error)) (*UploadStats, error) {
+    stats := &UploadStats{}
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+
+    containerURL := s.serviceURL.NewContainerURL(containerName)
+    _, err := containerURL.Create(ctx, azblob.Metadata{}, azblob.PublicAccessNone)
+    if err != nil && !strings.Contains(err.Error(), "ContainerAlreadyExists") {
+        return stats, fmt.Errorf("failed to create container: %w", azure.AuthError(err))
+    }
+
+    upload := func(file gdrive.TreeFile) {
+        blobURL := containerURL.NewBlockBlobURL(file.Path)
+        if s.config.SkipUnchanged && s.treeBlobUnchanged(ctx, blobURL, file) {
+            mu.Lock()
+            stats.SkippedFiles++
+            mu.Unlock()
+            s.logger.Debug("Skipped unchanged: %s", file.Path)
+            return
+        }
+
+        err := s.uploadTreeFile(ctx, blobURL, file, open)
+
+        mu.Lock()
+        defer mu.Unlock()
+        if err != nil {
+            stats.Errors = append(stats.Errors, fmt.Errorf("failed to upload %s: %v", file.Path, err))
+            return
+        }
+        stats.FilesCount++
+        stats.TotalSize += file.Size
+        s.logger.Info("Uploaded: %s", file.Path)
+    }
+
+    // A fixed pool of workers, so a container of millions of files does not
+    // start a goroutine for each of them
+    jobs := make(chan gdrive.TreeFile)
+    for i := 0; i < s.config.MaxConcurrent; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for file := range jobs {
+                upload(file)
+            }
+        }()
+    }
+    for _, file := range files {
+        jobs <- file
+    }
+    close(jobs)
+    wg.Wait()
+
+    if len(stats.Errors) > 0 {
+        return stats, fmt.Errorf("%w: encountered %d upload errors", ErrPartialRestore, len(stats.Errors))
+    }
+    return stats, nil
+}
+
+// uploadTreeFile streams a single Drive file into blobURL
+func (s *AzureService) uploadTreeFile(ctx context.Context, blobURL azblob.BlockBlobURL, file gdrive.TreeFile,
+    open func(ctx context.Context, fileID string) (io.ReadCloser, error)) error {
+    expectedMD5, err := hex.DecodeString(file.MD5)
+    if err != nil {
+        return fmt.Errorf("invalid manifest MD5 %q: %v", file.MD5, err)
+    }
+
+    body, err := open(ctx, file.ID)
+    if err != nil {
+        return err
+    }
+    defer body.Close()
+
+    hash := md5.New()
+    _, err = azblob.UploadStreamToBlockBlob(ctx, io.TeeReader(body, hash), blobURL, azblob.UploadStreamToBlockBlobOptions{
+        // The stream cannot be sniffed ahead of the upload, so the type
+        // comes from the extension alone
+        BlobHTTPHeaders: azblob.BlobHTTPHeaders{ContentMD5: expectedMD5, ContentType: utils.ContentTypeByExtension(file.Path)},
+        Metadata:        azblob.Metadata(file.Metadata),
+        BlobAccessTier:  s.accessTier(),
+    })
+    if err != nil {
+        return fmt.Errorf("failed to upload blob: %v", err)
+    }
+
+    // Azure stores the Content-MD5 of a block blob as given, so the data
+    // read from Drive is checked here
+    if actual := hash.Sum(nil); len(expectedMD5) > 0 && hex.EncodeToString(actual) != file.MD5 {
+        return fmt.Errorf("MD5 mismatch after upload: manifest %s, streamed %x", file.MD5, actual)
+    }
+    return nil
+}
+
+// treeBlobUnchanged reports whether the blob already exists with the size
+// and Content-MD5 recorded in the manifest
+func (s *AzureService) treeBlobUnchanged(ctx context.Context, blobURL azblob.BlockBlobURL, file gdrive.TreeFile) bool {
+    props, err := blobURL.GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+    if err != nil {
+        return false
+    }
+    remoteMD5 := props.ContentMD5()
+    return props.ContentLength() == file.Size && len(remoteMD5) > 0 && hex.EncodeToString(remoteMD5) == file.MD5
+}
+
+// CheckTreeIntegrity lists containerName and confirms that every file of a
+// tree backup exists as a blob with the size and MD5 from the manifest
+func (s *AzureService) CheckTreeIntegrity(ctx context.Context, files []gdrive.TreeFile, containerName string) (*IntegrityReport, error) {
+    blobs, err := s.listBlobProperties(ctx, containerName)
+    if err != nil {
+        return nil, err
+    }
+
+    report := &IntegrityReport{}
+    for _, file := range files {
+        report.Checked++
+        blob, exists := blobs[file.Path]
+        if !exists {
+            s.logger.Error("Integrity check: %s is missing from container %s", file.Path, containerName)
+            report.Missing = append(report.Missing, file.Path)
+            continue
+        }
+
+        var blobSize int64
+        if blob.ContentLength != nil {
+            blobSize = *blob.ContentLength
+        }
+        if blobSize != file.Size || (len(blob.ContentMD5) > 0 && hex.EncodeToString(blob.ContentMD5) != file.MD5) {
+            s.logger.Error("Integrity check: %s: size or MD5 differs from the backup manifest", file.Path)
+            report.Mismatched = append(report.Mismatched, file.Path)
+        }
+    }
+
+    sort.Strings(report.Missing)
+    sort.Strings(report.Mismatched)
+    return report, nil
+}
@@ -0,0 +1,168 @@
+package restore
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "time"
+
+    "shared/pkg/gdrive"
+    "shared/pkg/utils"
+)
+
+// VerifyResult is the outcome of checking a single container's backup
+type VerifyResult struct {
+    Container string
+    Backup    string
+    Entries   int
+    TotalSize int64
+    Checksum  string // SHA-256 over every entry's path and content
+    Err       error
+}
+
+// OK reports whether the backup was downloaded and extracted without errors
+func (r VerifyResult) OK() bool {
+    return r.Err == nil
+}
+
+// Verify checks that the backup chosen by sel of every configured container
+// can be downloaded, decrypted and fully extracted. Nothing is written to
+// Azure.
+func (s *RestoreService) Verify(ctx context.Context, sel Selection) ([]VerifyResult, error) {
+    targets := make(map[string]*gdrive.DriveBackup)
+
+    if s.config.Azure.ContainerName == "ALL" {
+        backups, err := s.driveService.ListAvailableBackups()
+        if err != nil {
+            return nil, fmt.Errorf("failed to list backups: %w", err)
+        }
+        for containerName, backups := range groupBackupsByContainer(backups) {
+            if backup := sel.find(backups); backup != nil {
+                targets[containerName] = backup
+            } else {
+                s.logger.Warn("No backup found for container %s %s", containerName, sel)
+            }
+        }
+    } else {
+        containerName := s.config.Azure.ContainerName
+        backup, err := s.getBackup(containerName, sel)
+        if err != nil {
+            return nil, fmt.Errorf("failed to get backup: %w", err)
+        }
+        targets[containerName] = backup
+    }
+
+    containers := make([]string, 0, len(targets))
+    for containerName := range targets {
+        containers = append(containers, containerName)
+    }
+    sort.Strings(containers)
+
+    results := make([]VerifyResult, 0, len(containers))
+    for _, containerName := range containers {
+        result := s.verifyBackup(ctx, containerName, targets[containerName])
+        if result.OK() {
+            s.logger.Info("[%s] OK: %s (%d entries, %.2f MB, sha256 %s)",
+                containerName, result.Backup, result.Entries,
+                float64(result.TotalSize)/(1024*1024), result.Checksum)
+        } else {
+            s.logger.Error("[%s] CORRUPT: %s: %v", containerName, result.Backup, result.Err)
+        }
+        results = append(results, result)
+    }
+
+    return results, nil
+}
+
+func (s *RestoreService) verifyBackup(ctx context.Context, containerName string, backup *gdrive.DriveBackup) VerifyResult {
+    result := VerifyResult{Container: containerName, Backup: backup.Name}
+    s.logger.Info("Verifying backup %s for container %s...", backup.Name, containerName)
+
+    tempDir := filepath.Join(s.config.TempDir, fmt.Sprintf("verify_%s_%s",
+        containerName,
+        time.Now().Format("20060102_150405")))
+    if err := os.MkdirAll(tempDir, 0755); err != nil {
+        result.Err = fmt.Errorf("failed to create temp directory: %v", err)
+        return result
+    }
+    defer os.RemoveAll(tempDir)
+
+    extractPath := filepath.Join(tempDir, "extracted")
+    if gdrive.IsTreeBackup(backup.Name) {
+        // DownloadTree checks every file against the manifest MD5
+        manifest, err := s.driveService.ReadTreeManifest(ctx, backup.ID)
+        if err != nil {
+            result.Err = fmt.Errorf("failed to read backup manifest: %v", err)
+            return result
+        }
+        if err := s.driveService.DownloadTree(ctx, manifest, extractPath); err != nil {
+            result.Err = fmt.Errorf("failed to download backup: %v", err)
+            return result
+        }
+    } else if err := s.downloadAndExtract(ctx, backup, tempDir, extractPath); err != nil {
+        result.Err = err
+        return result
+    }
+
+    hash := sha256.New()
+    err := filepath.Walk(extractPath, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if info.IsDir() {
+            return nil
+        }
+
+        relPath, err := filepath.Rel(extractPath, path)
+        if err != nil {
+            return err
+        }
+        file, err := os.Open(path)
+        if err != nil {
+            return err
+        }
+        defer file.Close()
+
+        io.WriteString(hash, filepath.ToSlash(relPath)+"\x00")
+        if _, err := io.Copy(hash, file); err != nil {
+            return fmt.Errorf("failed to read %s: %v", relPath, err)
+        }
+
+        result.Entries++
+        result.TotalSize += info.Size()
+        return nil
+    })
+    if err != nil {
+        result.Err = fmt.Errorf("failed to checksum extracted files: %v", err)
+        return result
+    }
+
+    result.Checksum = hex.EncodeToString(hash.Sum(nil))
+    return result
+}
+
+// downloadAndExtract downloads an archive backup, decrypting it when needed,
+// and extracts it to extractPath
+func (s *RestoreService) downloadAndExtract(ctx context.Context, backup *gdrive.DriveBackup, tempDir, extractPath string) error {
+    // DownloadBackup checks the Drive MD5 of every file before returning
+    archivePath := filepath.Join(tempDir, backup.Name)
+    if err := s.driveService.DownloadBackup(ctx, backup, archivePath); err != nil {
+        return fmt.Errorf("failed to download backup: %v", err)
+    }
+
+    archivePath, err := utils.DecryptIfNeeded(archivePath, s.config.EncryptionKey)
+    if err != nil {
+        return fmt.Errorf("failed to decrypt backup: %v", err)
+    }
+
+    // Extraction reads every entry, so truncated or corrupted data fails here
+    if err := utils.ExtractArchive(archivePath, extractPath, s.extractLimits()); err != nil {
+        return fmt.Errorf("failed to extract backup: %v", err)
+    }
+    return nil
+}
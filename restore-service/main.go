@@ -3,49 +3,205 @@ package main
 import (
     "context"
     "flag"
+    "fmt"
     "log"
+    "os"
+    "text/tabwriter"
     "time"
 
     "shared/pkg/config"
+    "shared/pkg/utils"
     "restore-service/internal/restore"
 )
 
 func main() {
     // Parse command line flags
     backupDate := flag.String("date", "", "Specific backup date to restore (format: YYYY-MM-DD)")
+    since := flag.String("since", "", "Restore the newest backup at or before this long ago (e.g. 72h, 3d) or this RFC3339 timestamp; takes precedence over -date")
+    prefix := flag.String("prefix", "", "Only restore files whose path starts with this prefix")
+    glob := flag.String("glob", "", "Only restore files whose path matches this glob (e.g. \"images/*.png\")")
+    targetContainer := flag.String("target-container", "", "Restore into this container instead of the backup's original container")
+    verify := flag.Bool("verify", false, "Download and extract the backup to check it is restorable, without writing to Azure")
+    listBackups := flag.Bool("list-backups", false, "List the backups stored in Google Drive per container and exit")
+    listDates := flag.Bool("list-dates", false, "List the date, size and Drive ID of every backup of -container (default: the configured container), newest first, and exit")
+    container := flag.String("container", "", "Only list backups of this container (with -list-backups and -list-dates)")
+    backupID := flag.String("backup-id", "", "Restore the backup archive with this Google Drive file ID")
+    backupName := flag.String("backup-name", "", "Restore the backup archive with this exact file name")
+    check := flag.Bool("check", false, "Check the configuration, Google Drive and target Azure access, print PASS/FAIL for each and exit")
     flag.Parse()
 
+    selectors := 0
+    for _, set := range []bool{*backupDate != "" || *since != "", *backupID != "", *backupName != ""} {
+        if set {
+            selectors++
+        }
+    }
+    if selectors > 1 {
+        log.Fatalf("Use only one of -date/-since, -backup-id and -backup-name")
+    }
+
     // Load configuration
     cfg, err := config.LoadRestoreConfig()
+    if *check {
+        if !utils.RunPreflight(context.Background(), os.Stdout, err, func() []utils.Check { return restore.Preflight(cfg) }) {
+            os.Exit(restore.ExitFailure)
+        }
+        os.Exit(0)
+    }
     if err != nil {
         log.Fatalf("Failed to load configuration: %v", err)
     }
 
-    // Create restore service
+    // Create restore service. The target Azure account is only contacted
+    // by restores, so listing and -verify need Google Drive credentials only.
     service, err := restore.NewRestoreService(cfg)
     if err != nil {
-        log.Fatalf("Failed to create restore service: %v", err)
+        fail("Failed to create restore service", err)
     }
 
-    // Create context with timeout
-    ctx, cancel := context.WithTimeout(context.Background(), 24*time.Hour)
+    if *listBackups || *listDates {
+        if *listDates {
+            printBackupDates(service, *container, cfg.Azure.ContainerName)
+            return
+        }
+
+        summaries, err := service.ListBackups(*container)
+        if err != nil {
+            fail("Failed to list backups", err)
+        }
+        if len(summaries) == 0 {
+            fmt.Println("No backups found")
+            return
+        }
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(w, "CONTAINER\tBACKUPS\tLATEST\tTOTAL SIZE")
+        for _, summary := range summaries {
+            fmt.Fprintf(w, "%s\t%d\t%s\t%s\n",
+                summary.Container,
+                summary.Count,
+                summary.Latest.Format("2006-01-02 15:04:05"),
+                utils.FormatBytes(summary.TotalSize))
+        }
+        w.Flush()
+        return
+    }
+
+    if err := service.SetFilter(restore.PathFilter{Prefix: *prefix, Glob: *glob}); err != nil {
+        log.Fatalf("Invalid filter: %v", err)
+    }
+
+    if *targetContainer != "" {
+        if err := service.SetTargetContainer(*targetContainer); err != nil {
+            log.Fatalf("Invalid target container: %v", err)
+        }
+    }
+
+    // Bound the whole run by RESTORE_TIMEOUT, 0 = no deadline
+    var ctx context.Context
+    var cancel context.CancelFunc
+    if cfg.Timeout > 0 {
+        ctx, cancel = context.WithTimeout(context.Background(), cfg.Timeout)
+        log.Printf("Restore deadline: %s (RESTORE_TIMEOUT=%v)", time.Now().Add(cfg.Timeout).Format(time.RFC3339), cfg.Timeout)
+    } else {
+        ctx, cancel = context.WithCancel(context.Background())
+        log.Printf("Restore deadline: none (RESTORE_TIMEOUT=0)")
+    }
     defer cancel()
 
-    // Start restore process
-    var restoreErr error
-    if *backupDate != "" {
-        // Restore specific backup
+    // -since is the more precise selector, so it wins over -date
+    var selection restore.Selection
+    if *since != "" {
+        if *backupDate != "" {
+            log.Printf("Both -date and -since are set, ignoring -date")
+        }
+        t, err := restore.ParseSince(*since, time.Now())
+        if err != nil {
+            log.Fatalf("Invalid -since value: %v", err)
+        }
+        log.Printf("Restoring the newest backup at or before %s", t.UTC().Format(time.RFC3339))
+        selection.Before = &t
+    } else if *backupDate != "" {
         t, err := time.Parse("2006-01-02", *backupDate)
         if err != nil {
             log.Fatalf("Invalid date format. Use YYYY-MM-DD: %v", err)
         }
-        restoreErr = service.RestoreFromDate(ctx, t)
+        selection.Date = &t
+    }
+
+    if *verify {
+        results, err := service.Verify(ctx, selection)
+        if err != nil {
+            fail("Verification failed", err)
+        }
+        failed := 0
+        for _, result := range results {
+            if !result.OK() {
+                failed++
+            }
+        }
+        if failed > 0 {
+            log.Printf("%d of %d backups failed verification", failed, len(results))
+            os.Exit(1)
+        }
+        log.Printf("All %d backups verified", len(results))
+        return
+    }
+
+    // Start restore process
+    var restoreErr error
+    if *backupID != "" {
+        // Restore one specific archive
+        restoreErr = service.RestoreBackupByID(ctx, *backupID)
+    } else if *backupName != "" {
+        restoreErr = service.RestoreBackupByName(ctx, *backupName)
     } else {
-        // Restore latest backup
-        restoreErr = service.RestoreLatest(ctx)
+        // Restore the latest backup, or the one picked by -date/-since
+        restoreErr = service.Restore(ctx, selection)
     }
 
     if restoreErr != nil {
-        log.Fatalf("Restore failed: %v", restoreErr)
+        fail("Restore failed", restoreErr)
+    }
+}
+
+// fail logs err and exits with the code restore.ExitCode assigns to it:
+// 2 when no backup was found, 3 when credentials were rejected, 4 when the
+// restore stopped partway and 1 for anything else
+func fail(msg string, err error) {
+    log.Printf("%s: %v", msg, err)
+    os.Exit(restore.ExitCode(err))
+}
+
+// printBackupDates prints the backups of container, or of defaultContainer
+// when it is empty, newest first. For ALL the backups are grouped by container.
+func printBackupDates(service *restore.RestoreService, container, defaultContainer string) {
+    if container == "" {
+        container = defaultContainer
+    }
+
+    entries, err := service.ListBackupDates(container)
+    if err != nil {
+        fail("Failed to list backups", err)
+    }
+    if len(entries) == 0 {
+        fmt.Println("No backups found")
+        return
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(w, "CONTAINER\tDATE\tCREATED\tTYPE\tSIZE\tDRIVE ID")
+    for _, entry := range entries {
+        kind := "full"
+        if entry.Incremental {
+            kind = "incremental"
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+            entry.Container,
+            entry.Created.Format("2006-01-02"),
+            entry.Created.Format("15:04:05"),
+            kind,
+            utils.FormatBytes(entry.Size),
+            entry.ID)
     }
-}
\ No newline at end of file
+    w.Flush()
+}
@@ -0,0 +1,149 @@
+package azure
+
+import (
+    "context"
+    "fmt"
+    "net/url"
+    "strings"
+
+    "github.com/Azure/azure-storage-blob-go/azblob"
+    "shared/pkg/config"
+)
+
+// NewServiceURL builds the Blob service client for cfg. It authenticates with
+// a connection string, a SAS token or the account key, in that order of
+// preference; config validation guarantees only one of them is set.
+// Requests are retried as set by the retry fields of cfg; zero values fall
+// back to the azblob defaults.
+func NewServiceURL(cfg config.AzureConfig) (azblob.ServiceURL, error) {
+    options := azblob.PipelineOptions{
+        Retry: azblob.RetryOptions{
+            MaxTries:      int32(cfg.MaxTries),
+            TryTimeout:    cfg.TryTimeout,
+            RetryDelay:    cfg.RetryDelay,
+            MaxRetryDelay: cfg.MaxRetryDelay,
+        },
+    }
+
+    endpoint := BlobEndpoint(cfg.AccountName, cfg.BlobEndpoint)
+    accountName, accountKey, sasToken := cfg.AccountName, cfg.AccountKey, cfg.SASToken
+
+    if cfg.ConnectionString != "" {
+        settings, err := ParseConnectionString(cfg.ConnectionString)
+        if err != nil {
+            return azblob.ServiceURL{}, err
+        }
+        endpoint = settings.BlobEndpoint
+        accountName, accountKey, sasToken = settings.AccountName, settings.AccountKey, settings.SharedAccessSignature
+    }
+
+    var credential azblob.Credential
+    if sasToken != "" {
+        // The SAS rides along as the query string of every request
+        credential = azblob.NewAnonymousCredential()
+        endpoint = strings.TrimSuffix(endpoint, "/") + "/?" + strings.TrimPrefix(sasToken, "?")
+    } else {
+        sharedKey, err := azblob.NewSharedKeyCredential(accountName, accountKey)
+        if err != nil {
+            return azblob.ServiceURL{}, fmt.Errorf("invalid credentials: %v", err)
+        }
+        credential = sharedKey
+    }
+
+    URL, err := url.Parse(endpoint)
+    if err != nil {
+        return azblob.ServiceURL{}, fmt.Errorf("invalid blob endpoint %q: %v", endpoint, err)
+    }
+
+    return azblob.NewServiceURL(*URL, azblob.NewPipeline(credential, options)), nil
+}
+
+// CheckContainerAccess verifies that the credentials of serviceURL are
+// accepted, by reading the properties of containerName or, when it is "ALL",
+// by listing the containers of the account
+func CheckContainerAccess(ctx context.Context, serviceURL azblob.ServiceURL, containerName string) error {
+    if containerName == "ALL" {
+        _, err := serviceURL.ListContainersSegment(ctx, azblob.Marker{}, azblob.ListContainersSegmentOptions{MaxResults: 1})
+        if err != nil {
+            return fmt.Errorf("failed to list containers: %w", err)
+        }
+        return nil
+    }
+
+    _, err := serviceURL.NewContainerURL(containerName).GetProperties(ctx, azblob.LeaseAccessConditions{})
+    if err != nil {
+        return fmt.Errorf("failed to access container %s: %w", containerName, err)
+    }
+    return nil
+}
+
+// BlobEndpoint returns the Blob service URL of accountName. endpoint is either
+// a host suffix such as "blob.core.usgovcloudapi.net", giving
+// https://<account>.<suffix>/, or a full URL used as is, such as the
+// path-style Azurite form http://127.0.0.1:10000/devstoreaccount1.
+// An empty endpoint means the public Azure cloud.
+func BlobEndpoint(accountName, endpoint string) string {
+    if endpoint == "" {
+        endpoint = "blob.core.windows.net"
+    }
+    if strings.Contains(endpoint, "://") {
+        return strings.TrimSuffix(endpoint, "/") + "/"
+    }
+    return fmt.Sprintf("https://%s.%s/", accountName, strings.Trim(endpoint, "./"))
+}
+
+// ConnectionSettings holds the parts of an Azure Storage connection string
+// needed to reach the Blob service
+type ConnectionSettings struct {
+    AccountName           string
+    AccountKey            string
+    SharedAccessSignature string
+    BlobEndpoint          string
+}
+
+// ParseConnectionString parses a "Key=Value;..." Azure Storage connection
+// string. The blob endpoint is derived from the account name, protocol and
+// endpoint suffix when BlobEndpoint is not given.
+func ParseConnectionString(connectionString string) (*ConnectionSettings, error) {
+    values := make(map[string]string)
+    for _, part := range strings.Split(connectionString, ";") {
+        part = strings.TrimSpace(part)
+        if part == "" {
+            continue
+        }
+        // Values such as base64 keys and SAS tokens may contain "="
+        key, value, ok := strings.Cut(part, "=")
+        if !ok {
+            return nil, fmt.Errorf("invalid connection string segment %q", part)
+        }
+        values[strings.ToLower(key)] = value
+    }
+
+    settings := &ConnectionSettings{
+        AccountName:           values["accountname"],
+        AccountKey:            values["accountkey"],
+        SharedAccessSignature: values["sharedaccesssignature"],
+        BlobEndpoint:          values["blobendpoint"],
+    }
+
+    if settings.BlobEndpoint == "" {
+        if settings.AccountName == "" {
+            return nil, fmt.Errorf("connection string needs AccountName or BlobEndpoint")
+        }
+        protocol := values["defaultendpointsprotocol"]
+        if protocol == "" {
+            protocol = "https"
+        }
+        suffix := values["endpointsuffix"]
+        if suffix == "" {
+            suffix = "core.windows.net"
+        }
+        settings.BlobEndpoint = fmt.Sprintf("%s://%s.blob.%s/", protocol, settings.AccountName, suffix)
+    }
+
+    if settings.SharedAccessSignature == "" && (settings.AccountName == "" || settings.AccountKey == "") {
+        return nil, fmt.Errorf("connection string needs AccountName and AccountKey, or SharedAccessSignature")
+    }
+
+    return settings, nil
+}
@@ -0,0 +1,70 @@
+package azure
+
+import "testing"
+
+func TestParseConnectionString(t *testing.T) {
+    tests := []struct {
+        name             string
+        connectionString string
+        wantEndpoint     string
+        wantSAS          string
+    }{
+        {
+            name:             "account key",
+            connectionString: "DefaultEndpointsProtocol=https;AccountName=myaccount;AccountKey=a2V5PT0=;EndpointSuffix=core.windows.net",
+            wantEndpoint:     "https://myaccount.blob.core.windows.net/",
+        },
+        {
+            name:             "sovereign cloud suffix",
+            connectionString: "AccountName=myaccount;AccountKey=a2V5;EndpointSuffix=core.chinacloudapi.cn",
+            wantEndpoint:     "https://myaccount.blob.core.chinacloudapi.cn/",
+        },
+        {
+            name:             "explicit endpoint with SAS",
+            connectionString: "BlobEndpoint=https://myaccount.blob.core.windows.net/;SharedAccessSignature=sv=2022-11-02&sig=abc%3D",
+            wantEndpoint:     "https://myaccount.blob.core.windows.net/",
+            wantSAS:          "sv=2022-11-02&sig=abc%3D",
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            settings, err := ParseConnectionString(tt.connectionString)
+            if err != nil {
+                t.Fatalf("ParseConnectionString: %v", err)
+            }
+            if settings.BlobEndpoint != tt.wantEndpoint {
+                t.Errorf("endpoint = %q, want %q", settings.BlobEndpoint, tt.wantEndpoint)
+            }
+            if settings.SharedAccessSignature != tt.wantSAS {
+                t.Errorf("SAS = %q, want %q", settings.SharedAccessSignature, tt.wantSAS)
+            }
+        })
+    }
+}
+
+func TestParseConnectionStringRejectsMissingCredentials(t *testing.T) {
+    if _, err := ParseConnectionString("AccountName=myaccount"); err == nil {
+        t.Fatal("expected an error for a connection string without a key or SAS")
+    }
+}
+
+func TestBlobEndpoint(t *testing.T) {
+    tests := []struct {
+        endpoint string
+        want     string
+    }{
+        {"", "https://myaccount.blob.core.windows.net/"},
+        {"blob.core.windows.net", "https://myaccount.blob.core.windows.net/"},
+        {"blob.core.usgovcloudapi.net", "https://myaccount.blob.core.usgovcloudapi.net/"},
+        {".blob.core.chinacloudapi.cn/", "https://myaccount.blob.core.chinacloudapi.cn/"},
+        {"http://127.0.0.1:10000/devstoreaccount1", "http://127.0.0.1:10000/devstoreaccount1/"},
+        {"http://azurite:10000/devstoreaccount1/", "http://azurite:10000/devstoreaccount1/"},
+    }
+
+    for _, tt := range tests {
+        if got := BlobEndpoint("myaccount", tt.endpoint); got != tt.want {
+            t.Errorf("BlobEndpoint(%q) = %q, want %q", tt.endpoint, got, tt.want)
+        }
+    }
+}
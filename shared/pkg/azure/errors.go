@@ -0,0 +1,69 @@
+package azure
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+
+    "github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+// Errors shared by the backup and restore services, wrapped with the details
+// of the failure. Check for them with errors.Is.
+var (
+    // ErrAzureAuth means Azure Storage rejected the account credentials
+    ErrAzureAuth = errors.New("azure storage authentication failed")
+    // ErrContainerNotAccessible means a container could not be read, e.g.
+    // it does not exist
+    ErrContainerNotAccessible = errors.New("container not accessible")
+)
+
+// AuthError wraps err with ErrAzureAuth when Azure Storage rejected the
+// credentials, and returns it unchanged otherwise
+func AuthError(err error) error {
+    if isAuthFailure(err) {
+        return fmt.Errorf("%w: %v", ErrAzureAuth, err)
+    }
+    return err
+}
+
+// ContainerError wraps err, returned while reaching a container, with
+// ErrAzureAuth for rejected credentials and ErrContainerNotAccessible for
+// anything else
+func ContainerError(err error) error {
+    if isAuthFailure(err) {
+        return fmt.Errorf("%w: %v", ErrAzureAuth, err)
+    }
+    return fmt.Errorf("%w: %v", ErrContainerNotAccessible, err)
+}
+
+// isAuthFailure reports whether err is a storage error for rejected credentials
+func isAuthFailure(err error) bool {
+    var storageErr azblob.StorageError
+    if !errors.As(err, &storageErr) {
+        return false
+    }
+    return storageErr.ServiceCode() == azblob.ServiceCodeAuthenticationFailed ||
+        (storageErr.Response() != nil && storageErr.Response().StatusCode == http.StatusForbidden)
+}
+
+// ContainerErrors reports the containers that failed in a run over several
+// containers; errors.Is matches the error of any of them
+type ContainerErrors struct {
+    msg  string
+    errs []error
+}
+
+// NewContainerErrors returns the error of a run whose containers failed with
+// errs, reported as msg
+func NewContainerErrors(msg string, errs ...error) *ContainerErrors {
+    return &ContainerErrors{msg: msg, errs: errs}
+}
+
+func (e *ContainerErrors) Error() string {
+    return e.msg
+}
+
+func (e *ContainerErrors) Unwrap() []error {
+    return e.errs
+}
@@ -2,57 +2,131 @@ package config
 
 import (
     "fmt"
+    "log"
     "os"
+    "path"
     "path/filepath"
     "strconv"
+    "strings"
     "time"
 
     "github.com/robfig/cron/v3"
 )
 
 type AzureConfig struct {
-    AccountName   string
-    AccountKey    string
-    ContainerName string  // "ALL" hoặc tên container cụ thể
+    AccountName      string        `yaml:"account_name" env:"AZURE_ACCOUNT_NAME"`
+    AccountKey       string        `yaml:"account_key" env:"AZURE_ACCOUNT_KEY"`
+    ConnectionString string        `yaml:"connection_string" env:"AZURE_CONNECTION_STRING"`    // Optional: thay cho account name/key
+    SASToken         string        `yaml:"sas_token" env:"AZURE_SAS_TOKEN"`                    // Optional: dùng cùng account name, thay cho account key
+    BlobEndpoint     string        `yaml:"blob_endpoint" env:"AZURE_BLOB_ENDPOINT"`            // Host suffix (vd "blob.core.usgovcloudapi.net") hoặc URL đầy đủ (Azurite)
+    ContainerName    string        `yaml:"container_name" env:"AZURE_CONTAINER_NAME"`          // "ALL" hoặc tên container cụ thể
+    BlobPrefix       string        `yaml:"blob_prefix" env:"AZURE_BLOB_PREFIX"`                // Optional (chỉ backup một container): chỉ backup blob có prefix này
+    ListPageSize     int           `yaml:"list_page_size" env:"AZURE_LIST_PAGE_SIZE"`          // Số blob/container mỗi trang khi list (1-5000)
+    MaxTries         int           `yaml:"max_tries" env:"AZURE_MAX_TRIES"`                    // Số lần thử tối đa cho mỗi request tới Azure (tính cả lần đầu)
+    TryTimeout       time.Duration `yaml:"try_timeout" env:"AZURE_TRY_TIMEOUT"`                // Thời gian tối đa cho mỗi lần thử
+    RetryDelay       time.Duration `yaml:"retry_delay" env:"AZURE_RETRY_DELAY"`                // Thời gian chờ trước lần thử lại đầu tiên, tăng dần theo cấp số nhân
+    MaxRetryDelay    time.Duration `yaml:"max_retry_delay" env:"AZURE_MAX_RETRY_DELAY"`        // Thời gian chờ tối đa giữa hai lần thử
+    ReaderMaxRetries int           `yaml:"reader_max_retries" env:"AZURE_READER_MAX_RETRIES"`  // Số lần nối lại khi stream tải blob bị ngắt giữa chừng
 }
 
 type GoogleDriveConfig struct {
-    CredentialsPath string
-    TokenPath       string
-    SharedDriveID   string
-    FolderID        string  // Optional: ID của folder trong Shared Drive
+    CredentialsPath    string   `yaml:"credentials_path" env:"GOOGLE_CREDENTIALS_PATH"`
+    TokenPath          string   `yaml:"token_path" env:"GOOGLE_TOKEN_PATH"`
+    TokenJSON          string   `yaml:"token_json" env:"GOOGLE_TOKEN_JSON"`                         // Optional: nội dung token.json, dùng thay cho TokenPath
+    SharedDriveID      string   `yaml:"shared_drive_id" env:"GOOGLE_SHARED_DRIVE_ID"`
+    SharedDriveIDs     []string `yaml:"shared_drive_ids" env:"GOOGLE_SHARED_DRIVE_IDS"`             // Optional (backup): upload mỗi backup lên nhiều Shared Drive, cách nhau bởi ","; drive đầu tiên là drive chính
+    FolderID           string   `yaml:"folder_id" env:"GOOGLE_FOLDER_ID"`                           // Optional: ID của folder trong Shared Drive
+    AuthMode           string   `yaml:"auth_mode" env:"GOOGLE_AUTH_MODE"`                           // "oauth", "service_account" hoặc "auto"
+    ImpersonateSubject string   `yaml:"impersonate_subject" env:"GOOGLE_IMPERSONATE_SUBJECT"`       // Optional: user được impersonate khi dùng service account
+    UploadChunkSize    int      `yaml:"upload_chunk_size_bytes" env:"GOOGLE_UPLOAD_CHUNK_SIZE_MB"`  // Kích thước chunk (bytes) cho resumable upload, 0 = mặc định
+    MaxRetries         int      `yaml:"max_retries" env:"GOOGLE_MAX_RETRIES"`                       // Số lần retry khi Drive API bị rate limit hoặc lỗi 5xx
+    QuotaCheck         bool     `yaml:"quota_check" env:"GOOGLE_QUOTA_CHECK"`                       // Kiểm tra quota của tài khoản đăng nhập trước khi upload, chỉ bật khi quota này giới hạn cả Shared Drive (vd pooled storage)
+    ListPageSize       int      `yaml:"list_page_size" env:"GDRIVE_LIST_PAGE_SIZE"`                 // Số file mỗi trang khi list trên Drive (1-1000), 0 = mặc định của Drive
 }
 
 type BackupConfig struct {
-    Schedule       string
-    RetentionDays  int
-    MaxConcurrent  int
-    BackupPath     string
-    TempDir        string
-    TimeZone       *time.Location
+    Schedule          string          `yaml:"schedule" env:"BACKUP_SCHEDULE"`                      // Một hoặc nhiều cron, cách nhau bởi ";", có thể gắn mode: "incremental:0 * * * *;full:0 1 * * *"
+    Schedules         []ScheduleEntry `yaml:"-"`                                                   // Các cron đã parse từ Schedule
+    RetentionDays     int             `yaml:"retention_days" env:"BACKUP_RETENTION_DAYS"`
+    RetentionCount    int             `yaml:"retention_count" env:"BACKUP_RETENTION_COUNT"`        // Luôn giữ N bản full backup gần nhất (kèm incremental) của mỗi container, 0 = chỉ theo số ngày
+    MaxConcurrent     int             `yaml:"max_concurrent" env:"MAX_CONCURRENT_OPERATIONS"`
+    BackupPath        string          `yaml:"backup_path" env:"BACKUP_PATH"`
+    TempDir           string          `yaml:"temp_dir" env:"TEMP_DIR"`
+    TempCleanupAge    time.Duration   `yaml:"temp_cleanup_age" env:"TEMP_CLEANUP_AGE"`             // Xóa file tạm còn sót lại cũ hơn thời gian này khi khởi động, 0 = tắt
+    TimeZone          *time.Location  `yaml:"-"`
+    EncryptionKey     string          `yaml:"encryption_key" env:"BACKUP_ENCRYPTION_KEY"`          // Optional: passphrase dùng để mã hóa file backup
+    BlobChunkSize     int64           `yaml:"blob_chunk_size_bytes" env:"BLOB_CHUNK_SIZE_MB"`      // Chia blob lớn thành các range download song song, 0 = tắt
+    WebhookURL        string          `yaml:"webhook_url" env:"BACKUP_WEBHOOK_URL"`                // Optional: URL nhận thông báo kết quả backup
+    WebhookFormat     string          `yaml:"webhook_format" env:"BACKUP_WEBHOOK_FORMAT"`          // "json" hoặc "slack"
+    ArchiveFormat     string          `yaml:"archive_format" env:"ARCHIVE_FORMAT"`                 // "zip" (mặc định), "targz" hoặc "zstd"
+    ArchiveSymlinks   string          `yaml:"archive_symlinks" env:"ARCHIVE_SYMLINKS"`             // "skip" (mặc định), "follow" hoặc "store"
+    DeterministicZip  bool            `yaml:"deterministic_zip" env:"BACKUP_DETERMINISTIC_ZIP"`    // Archive giống hệt nhau khi nội dung không đổi, bỏ qua upload trùng
+    CompressionLevel  int             `yaml:"compression_level" env:"BACKUP_COMPRESSION_LEVEL"`    // Mức nén 0 (không nén) đến 9 (nén tối đa)
+    SmartCompression  bool            `yaml:"smart_compression" env:"BACKUP_SMART_COMPRESSION"`    // Zip: không nén lại file đã nén sẵn (theo đuôi file hoặc 64KB đầu không nhỏ đi)
+    StoreExtensions   []string        `yaml:"incompressible_extensions" env:"BACKUP_INCOMPRESSIBLE_EXTENSIONS"` // Đuôi file coi là đã nén, rỗng = danh sách mặc định (.jpg, .mp4, .zip, ...)
+    StreamUpload      bool            `yaml:"stream_upload" env:"BACKUP_STREAM_UPLOAD"`            // Nén và upload trực tiếp lên Drive, không ghi file archive tạm ra đĩa
+    MaxVolumeSize     int64           `yaml:"max_volume_size_bytes" env:"BACKUP_MAX_VOLUME_SIZE"`  // Chia archive lớn hơn N GB thành các volume .001, .002, ..., 0 = tắt
+    Layout            string          `yaml:"layout" env:"BACKUP_LAYOUT"`                          // "zip" (mặc định) hoặc "tree": upload từng file thành cây thư mục trên Drive
+    Mode              string          `yaml:"mode" env:"BACKUP_MODE"`                              // "full" (mặc định) hoặc "incremental"
+    FullEveryDays     int             `yaml:"full_every_days" env:"FULL_BACKUP_INTERVAL_DAYS"`     // Chế độ incremental: số ngày giữa hai lần full backup
+    LocalMode         string          `yaml:"local_mode" env:"BACKUP_LOCAL_MODE"`                  // "mirror" (mặc định) hoặc "ephemeral": xóa bản local sau khi upload
+    DeleteGraceDays   int             `yaml:"delete_grace_days" env:"BACKUP_DELETE_GRACE_DAYS"`    // Giữ file đã bị xóa trên Azure thêm N ngày trước khi xóa khỏi bản local, 0 = xóa ngay
+    ContainerTimeout  time.Duration   `yaml:"container_timeout" env:"BACKUP_CONTAINER_TIMEOUT"`    // Thời gian tối đa để đồng bộ một container (vd "2h"), 0 = không giới hạn
+    UseSnapshots      bool            `yaml:"use_snapshots" env:"BACKUP_USE_SNAPSHOTS"`            // Snapshot các blob khi bắt đầu mỗi container và tải từ snapshot để có bản backup nhất quán
+    BlobMaxRetries    int             `yaml:"blob_max_retries" env:"BACKUP_BLOB_MAX_RETRIES"`      // Số lần tải lại các blob bị lỗi trước khi bỏ qua chúng
+    IncludeContainers []string        `yaml:"include_containers" env:"BACKUP_INCLUDE_CONTAINERS"`  // Chỉ backup các container khớp glob khi ContainerName=ALL, exclude được ưu tiên
+    ExcludeContainers []string        `yaml:"exclude_containers" env:"BACKUP_EXCLUDE_CONTAINERS"`  // Glob tên container không backup khi ContainerName=ALL
+    ExcludeBlobs      []string        `yaml:"exclude_blobs" env:"BACKUP_EXCLUDE_BLOBS"`            // Glob tên blob (hoặc tên file) không backup
+    MinBlobSize       int64           `yaml:"min_blob_size" env:"BACKUP_MIN_BLOB_SIZE"`            // Bỏ qua blob nhỏ hơn N byte, 0 = không giới hạn
+    MaxBlobSize       int64           `yaml:"max_blob_size" env:"BACKUP_MAX_BLOB_SIZE"`            // Bỏ qua blob lớn hơn N byte, 0 = không giới hạn
+    PreserveMetadata  bool            `yaml:"preserve_metadata" env:"BACKUP_PRESERVE_METADATA"`    // Lưu Content-Type, Cache-Control, ... và metadata của từng blob vào archive để restore lại
+    StorageReport     bool            `yaml:"storage_report" env:"BACKUP_STORAGE_REPORT"`          // Cuối mỗi lần backup, tính tổng dung lượng backup trên Drive và log ra
+    StorageHistory    bool            `yaml:"storage_history" env:"BACKUP_STORAGE_HISTORY"`        // Ghi thêm tổng dung lượng vào .storage_history.csv trong BackupPath (bật luôn StorageReport)
+    LockStaleAfter    time.Duration   `yaml:"lock_stale_after" env:"BACKUP_LOCK_STALE_AFTER"`      // Lock file của một host khác không được làm mới trong thời gian này thì coi như bị bỏ lại
+}
+
+// ScheduleEntry is one cron entry of BACKUP_SCHEDULE and the backup mode it runs
+type ScheduleEntry struct {
+    Spec string
+    Mode string  // "full" hoặc "incremental"
 }
 
 // Cấu hình chung
 type CommonConfig struct {
-    LogLevel      string
-    EnableMetrics bool
-    MetricsPort   int
+    LogLevel      string `yaml:"log_level" env:"LOG_LEVEL"`
+    LogFormat     string `yaml:"log_format" env:"LOG_FORMAT"`          // "text" hoặc "json"
+    EnableMetrics bool   `yaml:"enable_metrics" env:"ENABLE_METRICS"`
+    MetricsPort   int    `yaml:"metrics_port" env:"METRICS_PORT"`
 }
 
 // Config cho backup service
 type BackupServiceConfig struct {
-    Azure       AzureConfig
-    GoogleDrive GoogleDriveConfig
-    Backup      BackupConfig
-    Common      CommonConfig
+    Azure       AzureConfig       `yaml:"azure"`
+    GoogleDrive GoogleDriveConfig `yaml:"google_drive"`
+    Backup      BackupConfig      `yaml:"backup"`
+    Common      CommonConfig      `yaml:"common"`
 }
 
 // Config cho restore service
 type RestoreServiceConfig struct {
-    Azure       AzureConfig        // Target Azure Storage
-    GoogleDrive GoogleDriveConfig
-    TempDir     string
-    Common      CommonConfig
+    Azure          AzureConfig       `yaml:"azure" envprefix:"TARGET_"`                       // Target Azure Storage
+    GoogleDrive    GoogleDriveConfig `yaml:"google_drive"`
+    TempDir        string            `yaml:"temp_dir" env:"TEMP_DIR"`
+    TempCleanupAge time.Duration     `yaml:"temp_cleanup_age" env:"TEMP_CLEANUP_AGE"`         // Xóa file tạm còn sót lại cũ hơn thời gian này khi khởi động, 0 = tắt
+    EncryptionKey  string            `yaml:"encryption_key" env:"BACKUP_ENCRYPTION_KEY"`
+    MaxConcurrent  int               `yaml:"max_concurrent" env:"MAX_CONCURRENT_OPERATIONS"`  // Số blob upload song song
+    MaxContainers  int               `yaml:"max_concurrent_containers" env:"RESTORE_MAX_CONCURRENT_CONTAINERS"` // Số container upload lên Azure song song khi ContainerName=ALL
+    MaxDownloads   int               `yaml:"download_workers" env:"RESTORE_DOWNLOAD_WORKERS"` // Số container tải và giải nén song song khi ContainerName=ALL
+    AccessTier     string            `yaml:"access_tier" env:"TARGET_AZURE_ACCESS_TIER"`      // Optional: "Hot", "Cool" hoặc "Archive" cho blob được restore
+    IntegrityCheck bool              `yaml:"integrity_check" env:"RESTORE_INTEGRITY_CHECK"`   // Kiểm tra lại toàn bộ blob trong container sau khi restore
+    SkipUnchanged  bool              `yaml:"skip_unchanged" env:"RESTORE_SKIP_UNCHANGED"`     // Bỏ qua file đã có blob cùng kích thước và MD5 trên container đích
+    CleanBefore    bool              `yaml:"clean_before" env:"RESTORE_CLEAN_BEFORE"`         // Xóa blob cũ trong container đích trước khi restore, false = ghi đè/gộp
+    Timeout        time.Duration     `yaml:"timeout" env:"RESTORE_TIMEOUT"`                   // Thời gian tối đa cho cả lần restore (vd "24h"), 0 = không giới hạn
+    TargetPrefix   string            `yaml:"target_container_prefix" env:"TARGET_CONTAINER_PREFIX"` // Optional: thêm tiền tố vào tên container đích (vd "stg-"), để restore vào container staging riêng
+    MaxExtractSize int64             `yaml:"max_extract_size_bytes" env:"RESTORE_MAX_EXTRACT_SIZE"` // Dừng giải nén khi một archive bung ra quá N GB (chống zip bomb), 0 = không giới hạn
+    MaxEntries     int               `yaml:"max_entries" env:"RESTORE_MAX_ENTRIES"`           // Dừng giải nén khi một archive có quá N entry, 0 = không giới hạn
+    CacheSize      int64             `yaml:"cache_size_bytes" env:"RESTORE_CACHE_SIZE"`       // Giữ tối đa N GB archive đã tải trong TEMP_DIR/archive-cache để restore lại không phải tải lần nữa, 0 = tắt
+    Common         CommonConfig      `yaml:"common"`
 }
 
 // LoadBackupConfig loads configuration for backup service
@@ -64,33 +138,109 @@ func LoadBackupConfig() (*BackupServiceConfig, error) {
         return nil, fmt.Errorf("invalid timezone: %v", err)
     }
 
+    accountKey, err := getSecretEnv("AZURE_ACCOUNT_KEY")
+    if err != nil {
+        return nil, err
+    }
+    connectionString, err := getSecretEnv("AZURE_CONNECTION_STRING")
+    if err != nil {
+        return nil, err
+    }
+    sasToken, err := getSecretEnv("AZURE_SAS_TOKEN")
+    if err != nil {
+        return nil, err
+    }
+    encryptionKey, err := getSecretEnv("BACKUP_ENCRYPTION_KEY")
+    if err != nil {
+        return nil, err
+    }
+    tokenJSON, err := getSecretEnv("GOOGLE_TOKEN_JSON")
+    if err != nil {
+        return nil, err
+    }
+
     config := &BackupServiceConfig{
         Azure: AzureConfig{
-            AccountName:   os.Getenv("AZURE_ACCOUNT_NAME"),
-            AccountKey:    os.Getenv("AZURE_ACCOUNT_KEY"),
-            ContainerName: getEnvWithDefault("AZURE_CONTAINER_NAME", "ALL"),
+            AccountName:      os.Getenv("AZURE_ACCOUNT_NAME"),
+            AccountKey:       accountKey,
+            ConnectionString: connectionString,
+            SASToken:         sasToken,
+            BlobEndpoint:     getEnvWithDefault("AZURE_BLOB_ENDPOINT", "blob.core.windows.net"),
+            ContainerName:    getEnvWithDefault("AZURE_CONTAINER_NAME", "ALL"),
+            BlobPrefix:       os.Getenv("AZURE_BLOB_PREFIX"),
+            ListPageSize:     getEnvAsIntWithDefault("AZURE_LIST_PAGE_SIZE", 5000),
+            MaxTries:         getEnvAsIntWithDefault("AZURE_MAX_TRIES", 3),
+            ReaderMaxRetries: getEnvAsIntWithDefault("AZURE_READER_MAX_RETRIES", 3),
         },
         GoogleDrive: GoogleDriveConfig{
-            CredentialsPath: getEnvWithDefault("GOOGLE_CREDENTIALS_PATH", "/app/credentials.json"),
-            TokenPath:       getEnvWithDefault("GOOGLE_TOKEN_PATH", "/app/token.json"),
-            SharedDriveID:   os.Getenv("GOOGLE_SHARED_DRIVE_ID"),
-            FolderID:        os.Getenv("GOOGLE_FOLDER_ID"),
+            CredentialsPath:    getEnvWithDefault("GOOGLE_CREDENTIALS_PATH", "/app/credentials.json"),
+            TokenPath:          getEnvWithDefault("GOOGLE_TOKEN_PATH", "/app/token.json"),
+            TokenJSON:          tokenJSON,
+            SharedDriveID:      os.Getenv("GOOGLE_SHARED_DRIVE_ID"),
+            SharedDriveIDs:     getEnvAsList("GOOGLE_SHARED_DRIVE_IDS"),
+            FolderID:           os.Getenv("GOOGLE_FOLDER_ID"),
+            AuthMode:           getEnvWithDefault("GOOGLE_AUTH_MODE", "auto"),
+            ImpersonateSubject: os.Getenv("GOOGLE_IMPERSONATE_SUBJECT"),
+            MaxRetries:         getEnvAsIntWithDefault("GOOGLE_MAX_RETRIES", 5),
+            UploadChunkSize:    getEnvAsIntWithDefault("GOOGLE_UPLOAD_CHUNK_SIZE_MB", 0) * 1024 * 1024,
+            QuotaCheck:         getEnvAsBoolWithDefault("GOOGLE_QUOTA_CHECK", false),
+            ListPageSize:       getEnvAsIntWithDefault("GDRIVE_LIST_PAGE_SIZE", 0),
         },
         Backup: BackupConfig{
-            Schedule:      getEnvWithDefault("BACKUP_SCHEDULE", "0 1 * * *"),
-            RetentionDays: getEnvAsIntWithDefault("BACKUP_RETENTION_DAYS", 7),
-            MaxConcurrent: getEnvAsIntWithDefault("MAX_CONCURRENT_OPERATIONS", 10),
-            BackupPath:    getEnvWithDefault("BACKUP_PATH", "/app/backups"),
-            TempDir:       getEnvWithDefault("TEMP_DIR", "/app/temp"),
-            TimeZone:      location,
+            Schedule:          getEnvWithDefault("BACKUP_SCHEDULE", "0 1 * * *"),
+            RetentionDays:     getEnvAsIntWithDefault("BACKUP_RETENTION_DAYS", 7),
+            RetentionCount:    getEnvAsIntWithDefault("BACKUP_RETENTION_COUNT", 0),
+            MaxConcurrent:     getEnvAsIntWithDefault("MAX_CONCURRENT_OPERATIONS", 10),
+            BackupPath:        getEnvWithDefault("BACKUP_PATH", "/app/backups"),
+            TempDir:           getEnvWithDefault("TEMP_DIR", "/app/temp"),
+            TempCleanupAge:    getEnvAsDurationWithDefault("TEMP_CLEANUP_AGE", 24*time.Hour),
+            TimeZone:          location,
+            EncryptionKey:     encryptionKey,
+            BlobChunkSize:     int64(getEnvAsIntWithDefault("BLOB_CHUNK_SIZE_MB", 0)) * 1024 * 1024,
+            WebhookURL:        os.Getenv("BACKUP_WEBHOOK_URL"),
+            WebhookFormat:     getEnvWithDefault("BACKUP_WEBHOOK_FORMAT", "json"),
+            ArchiveFormat:     getEnvWithDefault("ARCHIVE_FORMAT", "zip"),
+            ArchiveSymlinks:   getEnvWithDefault("ARCHIVE_SYMLINKS", "skip"),
+            DeterministicZip:  getEnvAsBoolWithDefault("BACKUP_DETERMINISTIC_ZIP", false),
+            CompressionLevel:  getEnvAsIntWithDefault("BACKUP_COMPRESSION_LEVEL", 6),
+            SmartCompression:  getEnvAsBoolWithDefault("BACKUP_SMART_COMPRESSION", false),
+            StoreExtensions:   getEnvAsList("BACKUP_INCOMPRESSIBLE_EXTENSIONS"),
+            StreamUpload:      getEnvAsBoolWithDefault("BACKUP_STREAM_UPLOAD", false),
+            MaxVolumeSize:     int64(getEnvAsIntWithDefault("BACKUP_MAX_VOLUME_SIZE", 0)) * 1024 * 1024 * 1024,
+            Layout:            getEnvWithDefault("BACKUP_LAYOUT", "zip"),
+            Mode:              getEnvWithDefault("BACKUP_MODE", "full"),
+            FullEveryDays:     getEnvAsIntWithDefault("FULL_BACKUP_INTERVAL_DAYS", 7),
+            LocalMode:         getEnvWithDefault("BACKUP_LOCAL_MODE", "mirror"),
+            BlobMaxRetries:    getEnvAsIntWithDefault("BACKUP_BLOB_MAX_RETRIES", 3),
+            DeleteGraceDays:   getEnvAsIntWithDefault("BACKUP_DELETE_GRACE_DAYS", 0),
+            ContainerTimeout:  getEnvAsDurationWithDefault("BACKUP_CONTAINER_TIMEOUT", 0),
+            UseSnapshots:      getEnvAsBoolWithDefault("BACKUP_USE_SNAPSHOTS", false),
+            IncludeContainers: getEnvAsList("BACKUP_INCLUDE_CONTAINERS"),
+            ExcludeContainers: getEnvAsList("BACKUP_EXCLUDE_CONTAINERS"),
+            ExcludeBlobs:      getEnvAsList("BACKUP_EXCLUDE_BLOBS"),
+            MinBlobSize:       int64(getEnvAsIntWithDefault("BACKUP_MIN_BLOB_SIZE", 0)),
+            MaxBlobSize:       int64(getEnvAsIntWithDefault("BACKUP_MAX_BLOB_SIZE", 0)),
+            PreserveMetadata:  getEnvAsBoolWithDefault("BACKUP_PRESERVE_METADATA", false),
+            StorageReport:     getEnvAsBoolWithDefault("BACKUP_STORAGE_REPORT", false),
+            StorageHistory:    getEnvAsBoolWithDefault("BACKUP_STORAGE_HISTORY", false),
+            LockStaleAfter:    getEnvAsDurationWithDefault("BACKUP_LOCK_STALE_AFTER", time.Hour),
         },
         Common: CommonConfig{
             LogLevel:      getEnvWithDefault("LOG_LEVEL", "info"),
+            LogFormat:     getEnvWithDefault("LOG_FORMAT", "text"),
             EnableMetrics: getEnvAsBoolWithDefault("ENABLE_METRICS", true),
             MetricsPort:   getEnvAsIntWithDefault("METRICS_PORT", 9090),
         },
     }
 
+    if err := loadAzureRetryDelays(&config.Azure, "AZURE_"); err != nil {
+        return nil, err
+    }
+
+    if err := applyConfigFile(config); err != nil {
+        return nil, err
+    }
+
     if err := validateBackupConfig(config); err != nil {
         return nil, err
     }
@@ -99,26 +249,80 @@ func LoadBackupConfig() (*BackupServiceConfig, error) {
 }
 
 func LoadRestoreConfig() (*RestoreServiceConfig, error) {
+    accountKey, err := getSecretEnv("TARGET_AZURE_ACCOUNT_KEY")
+    if err != nil {
+        return nil, err
+    }
+    connectionString, err := getSecretEnv("TARGET_AZURE_CONNECTION_STRING")
+    if err != nil {
+        return nil, err
+    }
+    sasToken, err := getSecretEnv("TARGET_AZURE_SAS_TOKEN")
+    if err != nil {
+        return nil, err
+    }
+    encryptionKey, err := getSecretEnv("BACKUP_ENCRYPTION_KEY")
+    if err != nil {
+        return nil, err
+    }
+    tokenJSON, err := getSecretEnv("GOOGLE_TOKEN_JSON")
+    if err != nil {
+        return nil, err
+    }
+
     config := &RestoreServiceConfig{
         Azure: AzureConfig{
-            AccountName:   os.Getenv("TARGET_AZURE_ACCOUNT_NAME"),
-            AccountKey:    os.Getenv("TARGET_AZURE_ACCOUNT_KEY"),
-            ContainerName: getEnvWithDefault("TARGET_AZURE_CONTAINER_NAME", "ALL"),
+            AccountName:      os.Getenv("TARGET_AZURE_ACCOUNT_NAME"),
+            AccountKey:       accountKey,
+            ConnectionString: connectionString,
+            SASToken:         sasToken,
+            BlobEndpoint:     getEnvWithDefault("TARGET_AZURE_BLOB_ENDPOINT", "blob.core.windows.net"),
+            ContainerName:    getEnvWithDefault("TARGET_AZURE_CONTAINER_NAME", "ALL"),
+            ListPageSize:     getEnvAsIntWithDefault("TARGET_AZURE_LIST_PAGE_SIZE", 5000),
+            MaxTries:         getEnvAsIntWithDefault("TARGET_AZURE_MAX_TRIES", 3),
         },
         GoogleDrive: GoogleDriveConfig{
-            CredentialsPath: getEnvWithDefault("GOOGLE_CREDENTIALS_PATH", "/app/credentials.json"),
-            TokenPath:       getEnvWithDefault("GOOGLE_TOKEN_PATH", "/app/token.json"),
-            SharedDriveID:   os.Getenv("GOOGLE_SHARED_DRIVE_ID"),
-            FolderID:        os.Getenv("GOOGLE_FOLDER_ID"),
+            CredentialsPath:    getEnvWithDefault("GOOGLE_CREDENTIALS_PATH", "/app/credentials.json"),
+            TokenPath:          getEnvWithDefault("GOOGLE_TOKEN_PATH", "/app/token.json"),
+            TokenJSON:          tokenJSON,
+            SharedDriveID:      os.Getenv("GOOGLE_SHARED_DRIVE_ID"),
+            FolderID:           os.Getenv("GOOGLE_FOLDER_ID"),
+            AuthMode:           getEnvWithDefault("GOOGLE_AUTH_MODE", "auto"),
+            ImpersonateSubject: os.Getenv("GOOGLE_IMPERSONATE_SUBJECT"),
+            MaxRetries:         getEnvAsIntWithDefault("GOOGLE_MAX_RETRIES", 5),
+            ListPageSize:       getEnvAsIntWithDefault("GDRIVE_LIST_PAGE_SIZE", 0),
         },
-        TempDir: getEnvWithDefault("TEMP_DIR", "/app/temp"),
+        TempDir:        getEnvWithDefault("TEMP_DIR", "/app/temp"),
+        TempCleanupAge: getEnvAsDurationWithDefault("TEMP_CLEANUP_AGE", 24*time.Hour),
+        EncryptionKey:  encryptionKey,
+        MaxConcurrent:  getEnvAsIntWithDefault("MAX_CONCURRENT_OPERATIONS", 10),
+        MaxContainers:  getEnvAsIntWithDefault("RESTORE_MAX_CONCURRENT_CONTAINERS", 1),
+        MaxDownloads:   getEnvAsIntWithDefault("RESTORE_DOWNLOAD_WORKERS", 1),
+        AccessTier:     os.Getenv("TARGET_AZURE_ACCESS_TIER"),
+        IntegrityCheck: getEnvAsBoolWithDefault("RESTORE_INTEGRITY_CHECK", false),
+        SkipUnchanged:  getEnvAsBoolWithDefault("RESTORE_SKIP_UNCHANGED", false),
+        CleanBefore:    getEnvAsBoolWithDefault("RESTORE_CLEAN_BEFORE", false),
+        Timeout:        getEnvAsDurationWithDefault("RESTORE_TIMEOUT", 24*time.Hour),
+        TargetPrefix:   os.Getenv("TARGET_CONTAINER_PREFIX"),
+        MaxExtractSize: int64(getEnvAsIntWithDefault("RESTORE_MAX_EXTRACT_SIZE", 0)) * 1024 * 1024 * 1024,
+        MaxEntries:     getEnvAsIntWithDefault("RESTORE_MAX_ENTRIES", 0),
+        CacheSize:      int64(getEnvAsIntWithDefault("RESTORE_CACHE_SIZE", 0)) * 1024 * 1024 * 1024,
         Common: CommonConfig{
             LogLevel:      getEnvWithDefault("LOG_LEVEL", "info"),
+            LogFormat:     getEnvWithDefault("LOG_FORMAT", "text"),
             EnableMetrics: getEnvAsBoolWithDefault("ENABLE_METRICS", true),
             MetricsPort:   getEnvAsIntWithDefault("METRICS_PORT", 9090),
         },
     }
 
+    if err := loadAzureRetryDelays(&config.Azure, "TARGET_AZURE_"); err != nil {
+        return nil, err
+    }
+
+    if err := applyConfigFile(config); err != nil {
+        return nil, err
+    }
+
     if err := validateRestoreConfig(config); err != nil {
         return nil, err
     }
@@ -126,15 +330,50 @@ func LoadRestoreConfig() (*RestoreServiceConfig, error) {
     return config, nil
 }
 
+// resolveSharedDriveIDs fills in the shared drives backups are uploaded to.
+// Without GOOGLE_SHARED_DRIVE_IDS it is GOOGLE_SHARED_DRIVE_ID alone;
+// otherwise the first of GOOGLE_SHARED_DRIVE_IDS is the primary destination,
+// the one read from, and replaces GOOGLE_SHARED_DRIVE_ID.
+func resolveSharedDriveIDs(cfg *GoogleDriveConfig) error {
+    if len(cfg.SharedDriveIDs) == 0 && cfg.SharedDriveID != "" {
+        cfg.SharedDriveIDs = []string{cfg.SharedDriveID}
+    }
+    if len(cfg.SharedDriveIDs) == 0 {
+        return fmt.Errorf("google shared drive ID is required")
+    }
+
+    seen := make(map[string]bool)
+    for _, id := range cfg.SharedDriveIDs {
+        if seen[id] {
+            return fmt.Errorf("shared drive %s is listed more than once in GOOGLE_SHARED_DRIVE_IDS", id)
+        }
+        seen[id] = true
+    }
+    cfg.SharedDriveID = cfg.SharedDriveIDs[0]
+    return nil
+}
+
 func validateBackupConfig(cfg *BackupServiceConfig) error {
     // Validate Azure config
-    if cfg.Azure.AccountName == "" || cfg.Azure.AccountKey == "" {
-        return fmt.Errorf("azure storage account configuration is incomplete")
+    if err := validateAzureAuth(cfg.Azure); err != nil {
+        return fmt.Errorf("azure storage account configuration is incomplete: %v", err)
+    }
+    if cfg.Azure.BlobPrefix != "" && cfg.Azure.ContainerName == "ALL" {
+        return fmt.Errorf("AZURE_BLOB_PREFIX requires a single AZURE_CONTAINER_NAME")
+    }
+    if err := validateAzureListPageSize(cfg.Azure); err != nil {
+        return err
+    }
+    if err := validateAzureRetry(cfg.Azure); err != nil {
+        return err
     }
 
     // Validate Google Drive config
-    if cfg.GoogleDrive.SharedDriveID == "" {
-        return fmt.Errorf("google shared drive ID is required")
+    if err := resolveSharedDriveIDs(&cfg.GoogleDrive); err != nil {
+        return err
+    }
+    if err := validateDriveListPageSize(cfg.GoogleDrive); err != nil {
+        return err
     }
 
     // Validate paths
@@ -151,24 +390,308 @@ func validateBackupConfig(cfg *BackupServiceConfig) error {
         }
     }
 
-    // Validate schedule format
-    if _, err := cron.ParseStandard(cfg.Backup.Schedule); err != nil {
-        return fmt.Errorf("invalid backup schedule: %v", err)
+    // Validate archive format
+    switch cfg.Backup.ArchiveFormat {
+    case "zip", "targz", "zstd":
+    default:
+        return fmt.Errorf("invalid archive format: %s", cfg.Backup.ArchiveFormat)
+    }
+    switch cfg.Backup.ArchiveSymlinks {
+    case "skip", "follow", "store":
+    default:
+        return fmt.Errorf("invalid archive symlinks mode: %s", cfg.Backup.ArchiveSymlinks)
+    }
+    if cfg.Backup.CompressionLevel < 0 || cfg.Backup.CompressionLevel > 9 {
+        return fmt.Errorf("invalid compression level %d (expected 0-9)", cfg.Backup.CompressionLevel)
+    }
+
+    // A streamed archive is never complete on disk, so it cannot be hashed
+    // before deciding whether to upload it
+    if cfg.Backup.StreamUpload && cfg.Backup.DeterministicZip {
+        return fmt.Errorf("stream upload cannot be combined with deterministic archives")
+    }
+
+    // Volumes are cut from the finished archive file, which a streamed
+    // upload never writes
+    if cfg.Backup.MaxVolumeSize < 0 {
+        return fmt.Errorf("max volume size cannot be negative")
+    }
+    if cfg.Backup.MaxVolumeSize > 0 && cfg.Backup.StreamUpload {
+        return fmt.Errorf("BACKUP_MAX_VOLUME_SIZE cannot be combined with BACKUP_STREAM_UPLOAD")
+    }
+
+    // A streamed archive can only be read once, by a single upload
+    if cfg.Backup.StreamUpload && len(cfg.GoogleDrive.SharedDriveIDs) > 1 {
+        return fmt.Errorf("BACKUP_STREAM_UPLOAD cannot be combined with several GOOGLE_SHARED_DRIVE_IDS")
+    }
+
+    // A tree backup uploads the files as they are, so archive-only options
+    // have nothing to act on
+    switch cfg.Backup.Layout {
+    case "zip":
+    case "tree":
+        if cfg.Backup.EncryptionKey != "" {
+            return fmt.Errorf("BACKUP_LAYOUT=tree cannot be combined with BACKUP_ENCRYPTION_KEY")
+        }
+        if cfg.Backup.StreamUpload || cfg.Backup.DeterministicZip {
+            return fmt.Errorf("BACKUP_LAYOUT=tree cannot be combined with stream upload or deterministic archives")
+        }
+        if cfg.Backup.PreserveMetadata {
+            return fmt.Errorf("BACKUP_LAYOUT=tree cannot be combined with BACKUP_PRESERVE_METADATA")
+        }
+    default:
+        return fmt.Errorf("invalid backup layout: %s", cfg.Backup.Layout)
+    }
+
+    if cfg.Backup.RetentionCount < 0 {
+        return fmt.Errorf("backup retention count cannot be negative")
+    }
+
+    if cfg.Backup.BlobMaxRetries < 0 {
+        return fmt.Errorf("blob max retries cannot be negative")
+    }
+
+    if cfg.Backup.DeleteGraceDays < 0 {
+        return fmt.Errorf("delete grace days cannot be negative")
+    }
+
+    if cfg.Backup.ContainerTimeout < 0 {
+        return fmt.Errorf("container timeout cannot be negative")
+    }
+
+    if cfg.Backup.TempCleanupAge < 0 {
+        return fmt.Errorf("temp cleanup age cannot be negative")
+    }
+
+    if cfg.Backup.LockStaleAfter <= 0 {
+        return fmt.Errorf("lock stale timeout must be positive")
+    }
+
+    // Validate include/exclude patterns
+    for _, patterns := range [][]string{cfg.Backup.IncludeContainers, cfg.Backup.ExcludeContainers, cfg.Backup.ExcludeBlobs} {
+        for _, pattern := range patterns {
+            if _, err := path.Match(pattern, ""); err != nil {
+                return fmt.Errorf("invalid container or blob pattern %q: %v", pattern, err)
+            }
+        }
+    }
+
+    if cfg.Backup.MinBlobSize < 0 || cfg.Backup.MaxBlobSize < 0 {
+        return fmt.Errorf("blob size limits cannot be negative")
+    }
+    if cfg.Backup.MaxBlobSize > 0 && cfg.Backup.MinBlobSize > cfg.Backup.MaxBlobSize {
+        return fmt.Errorf("BACKUP_MIN_BLOB_SIZE (%d) is larger than BACKUP_MAX_BLOB_SIZE (%d)",
+            cfg.Backup.MinBlobSize, cfg.Backup.MaxBlobSize)
+    }
+
+    // Validate schedules and backup mode
+    schedules, err := parseSchedules(cfg.Backup.Schedule, cfg.Backup.Mode)
+    if err != nil {
+        return err
+    }
+    cfg.Backup.Schedules = schedules
+
+    incremental := false
+    for _, mode := range append([]string{cfg.Backup.Mode}, scheduleModes(schedules)...) {
+        switch mode {
+        case "full":
+        case "incremental":
+            incremental = true
+        default:
+            return fmt.Errorf("invalid backup mode: %s", mode)
+        }
+    }
+    if incremental && cfg.Backup.Layout == "tree" {
+        return fmt.Errorf("BACKUP_LAYOUT=tree cannot be combined with incremental backups")
+    }
+    if incremental && cfg.Backup.FullEveryDays < 1 {
+        return fmt.Errorf("full backup interval must be at least 1 day")
+    }
+
+    // Validate local mode. Ephemeral runs re-download every blob, so an
+    // incremental archive would always contain the whole container.
+    switch cfg.Backup.LocalMode {
+    case "mirror":
+    case "ephemeral":
+        if incremental {
+            return fmt.Errorf("BACKUP_LOCAL_MODE=ephemeral cannot be combined with incremental backups")
+        }
+        // Deleted blobs can only be kept while the local copy survives
+        if cfg.Backup.DeleteGraceDays > 0 {
+            return fmt.Errorf("BACKUP_LOCAL_MODE=ephemeral cannot be combined with BACKUP_DELETE_GRACE_DAYS")
+        }
+    default:
+        return fmt.Errorf("invalid backup local mode: %s", cfg.Backup.LocalMode)
     }
 
     return nil
 }
 
-func validateRestoreConfig(cfg *RestoreServiceConfig) error {
-    // Validate Target Azure config
-    if cfg.Azure.AccountName == "" || cfg.Azure.AccountKey == "" {
-        return fmt.Errorf("target azure storage account configuration is incomplete")
+// parseSchedules splits a semicolon-separated BACKUP_SCHEDULE into its cron
+// entries. An entry may be prefixed with "full:" or "incremental:"; untagged
+// entries run in defaultMode.
+func parseSchedules(schedule, defaultMode string) ([]ScheduleEntry, error) {
+    var entries []ScheduleEntry
+    for _, part := range strings.Split(schedule, ";") {
+        part = strings.TrimSpace(part)
+        if part == "" {
+            continue
+        }
+
+        entry := ScheduleEntry{Spec: part, Mode: defaultMode}
+        if mode, spec, found := strings.Cut(part, ":"); found {
+            entry.Mode = strings.TrimSpace(mode)
+            entry.Spec = strings.TrimSpace(spec)
+        }
+
+        if _, err := cron.ParseStandard(entry.Spec); err != nil {
+            return nil, fmt.Errorf("invalid backup schedule %q: %v", part, err)
+        }
+        entries = append(entries, entry)
     }
 
+    if len(entries) == 0 {
+        return nil, fmt.Errorf("backup schedule is required")
+    }
+    return entries, nil
+}
+
+// scheduleModes returns the backup mode of every schedule entry
+func scheduleModes(entries []ScheduleEntry) []string {
+    modes := make([]string, len(entries))
+    for i, entry := range entries {
+        modes[i] = entry.Mode
+    }
+    return modes
+}
+
+// validateAzureAuth checks that exactly one way to authenticate with Azure
+// is configured: a connection string, a SAS token or an account key
+func validateAzureAuth(cfg AzureConfig) error {
+    methods := 0
+    for _, value := range []string{cfg.ConnectionString, cfg.SASToken, cfg.AccountKey} {
+        if value != "" {
+            methods++
+        }
+    }
+    switch {
+    case methods == 0:
+        return fmt.Errorf("set an account key, a SAS token or a connection string")
+    case methods > 1:
+        return fmt.Errorf("only one of account key, SAS token and connection string may be set")
+    case cfg.ConnectionString == "" && cfg.AccountName == "":
+        return fmt.Errorf("account name is required")
+    }
+    return nil
+}
+
+// validateAzureListPageSize checks the page size of Azure list calls
+// against the 5000 results the service returns at most
+func validateAzureListPageSize(cfg AzureConfig) error {
+    if cfg.ListPageSize < 1 || cfg.ListPageSize > 5000 {
+        return fmt.Errorf("azure list page size must be between 1 and 5000, got %d", cfg.ListPageSize)
+    }
+    return nil
+}
+
+// validateAzureRetry checks the retry policy of Azure requests and of blob
+// download streams
+func validateAzureRetry(cfg AzureConfig) error {
+    if cfg.MaxTries < 1 {
+        return fmt.Errorf("azure max tries must be at least 1, got %d", cfg.MaxTries)
+    }
+    if cfg.TryTimeout <= 0 || cfg.RetryDelay <= 0 || cfg.MaxRetryDelay <= 0 {
+        return fmt.Errorf("azure try timeout, retry delay and max retry delay must be positive")
+    }
+    if cfg.RetryDelay > cfg.MaxRetryDelay {
+        return fmt.Errorf("azure retry delay (%v) is longer than the max retry delay (%v)", cfg.RetryDelay, cfg.MaxRetryDelay)
+    }
+    if cfg.ReaderMaxRetries < 0 {
+        return fmt.Errorf("azure reader max retries cannot be negative")
+    }
+    return nil
+}
+
+// validateDriveListPageSize checks the page size of Drive list calls, which
+// Drive caps at 1000; 0 keeps the Drive default
+func validateDriveListPageSize(cfg GoogleDriveConfig) error {
+    if cfg.ListPageSize < 0 || cfg.ListPageSize > 1000 {
+        return fmt.Errorf("google drive list page size must be between 1 and 1000 (0 = default), got %d", cfg.ListPageSize)
+    }
+    return nil
+}
+
+// ValidateTarget checks the target Azure account settings. Only restores
+// need them, so LoadRestoreConfig leaves them to be checked here and
+// read-only commands work with Google Drive settings alone.
+func (cfg *RestoreServiceConfig) ValidateTarget() error {
+    if err := validateAzureAuth(cfg.Azure); err != nil {
+        return fmt.Errorf("target azure storage account configuration is incomplete: %v", err)
+    }
+    return nil
+}
+
+func validateRestoreConfig(cfg *RestoreServiceConfig) error {
     // Validate Google Drive config
     if cfg.GoogleDrive.SharedDriveID == "" {
         return fmt.Errorf("google shared drive ID is required")
     }
+    if err := validateDriveListPageSize(cfg.GoogleDrive); err != nil {
+        return err
+    }
+    if err := validateAzureListPageSize(cfg.Azure); err != nil {
+        return err
+    }
+    if err := validateAzureRetry(cfg.Azure); err != nil {
+        return err
+    }
+
+    if cfg.MaxConcurrent < 1 {
+        return fmt.Errorf("max concurrent operations must be at least 1")
+    }
+    if cfg.MaxContainers < 1 {
+        return fmt.Errorf("max concurrent containers must be at least 1")
+    }
+    if cfg.MaxDownloads < 1 {
+        return fmt.Errorf("restore download workers must be at least 1")
+    }
+
+    // Validate access tier, normalizing case to what Azure expects
+    switch strings.ToLower(cfg.AccessTier) {
+    case "":
+    case "hot":
+        cfg.AccessTier = "Hot"
+    case "cool":
+        cfg.AccessTier = "Cool"
+    case "archive":
+        cfg.AccessTier = "Archive"
+    default:
+        return fmt.Errorf("invalid access tier %q (expected Hot, Cool or Archive)", cfg.AccessTier)
+    }
+
+    if cfg.TempCleanupAge < 0 {
+        return fmt.Errorf("temp cleanup age cannot be negative")
+    }
+    if cfg.Timeout < 0 {
+        return fmt.Errorf("restore timeout cannot be negative")
+    }
+    if cfg.CacheSize < 0 {
+        return fmt.Errorf("restore cache size cannot be negative")
+    }
+    if cfg.MaxExtractSize < 0 || cfg.MaxEntries < 0 {
+        return fmt.Errorf("restore extraction limits cannot be negative")
+    }
+
+    // The full name is checked per container once the source name is known
+    if strings.Trim(cfg.TargetPrefix, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" || strings.HasPrefix(cfg.TargetPrefix, "-") {
+        return fmt.Errorf("TARGET_CONTAINER_PREFIX %q may only contain lowercase letters, digits and hyphens, "+
+            "and must start with a letter or digit", cfg.TargetPrefix)
+    }
+
+    // Nothing is left to compare against once the container was cleaned
+    if cfg.CleanBefore && cfg.SkipUnchanged {
+        return fmt.Errorf("RESTORE_CLEAN_BEFORE cannot be combined with RESTORE_SKIP_UNCHANGED")
+    }
 
     // Validate paths
     paths := []string{
@@ -187,6 +710,24 @@ func validateRestoreConfig(cfg *RestoreServiceConfig) error {
 }
 
 // Helper functions
+// getSecretEnv returns the value of key, or the content of the file named by
+// key_FILE when that is set. The file wins if both are set.
+func getSecretEnv(key string) (string, error) {
+    path := os.Getenv(key + "_FILE")
+    if path == "" {
+        return os.Getenv(key), nil
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return "", fmt.Errorf("failed to read %s_FILE: %v", key, err)
+    }
+    if os.Getenv(key) != "" {
+        log.Printf("Warning: both %s and %s_FILE are set, using %s_FILE", key, key, key)
+    }
+    return strings.TrimRight(string(data), "\r\n"), nil
+}
+
 func getEnvWithDefault(key, defaultValue string) string {
     if value := os.Getenv(key); value != "" {
         return value
@@ -207,6 +748,60 @@ func getEnvAsIntWithDefault(key string, defaultValue int) int {
     return value
 }
 
+// getEnvAsDurationWithDefault parses a Go duration such as "90m" or "2h"
+func getEnvAsDurationWithDefault(key string, defaultValue time.Duration) time.Duration {
+    strValue := os.Getenv(key)
+    if strValue == "" {
+        return defaultValue
+    }
+
+    value, err := time.ParseDuration(strValue)
+    if err != nil {
+        return defaultValue
+    }
+    return value
+}
+
+// getEnvAsDuration is getEnvAsDurationWithDefault for settings where a typo
+// must not silently fall back to the default
+func getEnvAsDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+    strValue := os.Getenv(key)
+    if strValue == "" {
+        return defaultValue, nil
+    }
+
+    value, err := time.ParseDuration(strValue)
+    if err != nil {
+        return 0, fmt.Errorf("invalid %s %q: use a duration such as \"30s\" or \"2m\"", key, strValue)
+    }
+    return value, nil
+}
+
+// loadAzureRetryDelays reads the request timeout and retry delays of cfg
+// from <prefix>TRY_TIMEOUT, <prefix>RETRY_DELAY and <prefix>MAX_RETRY_DELAY
+func loadAzureRetryDelays(cfg *AzureConfig, prefix string) error {
+    var err error
+    if cfg.TryTimeout, err = getEnvAsDuration(prefix+"TRY_TIMEOUT", 2*time.Minute); err != nil {
+        return err
+    }
+    if cfg.RetryDelay, err = getEnvAsDuration(prefix+"RETRY_DELAY", 5*time.Second); err != nil {
+        return err
+    }
+    cfg.MaxRetryDelay, err = getEnvAsDuration(prefix+"MAX_RETRY_DELAY", 30*time.Second)
+    return err
+}
+
+// getEnvAsList splits a comma-separated variable, dropping empty items
+func getEnvAsList(key string) []string {
+    var values []string
+    for _, value := range strings.Split(os.Getenv(key), ",") {
+        if value = strings.TrimSpace(value); value != "" {
+            values = append(values, value)
+        }
+    }
+    return values
+}
+
 func getEnvAsBoolWithDefault(key string, defaultValue bool) bool {
     strValue := os.Getenv(key)
     if strValue == "" {
@@ -218,4 +813,4 @@ func getEnvAsBoolWithDefault(key string, defaultValue bool) bool {
         return defaultValue
     }
     return value
-}
\ No newline at end of file
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestGetSecretEnvPrefersFile(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "account_key")
+    if err := os.WriteFile(path, []byte("file-secret\n"), 0600); err != nil {
+        t.Fatalf("write secret: %v", err)
+    }
+    t.Setenv("AZURE_ACCOUNT_KEY", "env-secret")
+    t.Setenv("AZURE_ACCOUNT_KEY_FILE", path)
+
+    value, err := getSecretEnv("AZURE_ACCOUNT_KEY")
+    if err != nil {
+        t.Fatalf("getSecretEnv: %v", err)
+    }
+    if value != "file-secret" {
+        t.Errorf("got %q, want trimmed file content", value)
+    }
+}
+
+func TestGetSecretEnvMissingFile(t *testing.T) {
+    t.Setenv("AZURE_ACCOUNT_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+
+    if _, err := getSecretEnv("AZURE_ACCOUNT_KEY"); err == nil {
+        t.Fatal("expected an error for a missing secret file")
+    }
+}
+
+func TestParseSchedules(t *testing.T) {
+    entries, err := parseSchedules("incremental:0 * * * *; full: 0 1 * * * ;@every 6h", "full")
+    if err != nil {
+        t.Fatalf("parseSchedules: %v", err)
+    }
+    want := []ScheduleEntry{
+        {Spec: "0 * * * *", Mode: "incremental"},
+        {Spec: "0 1 * * *", Mode: "full"},
+        {Spec: "@every 6h", Mode: "full"},
+    }
+    if !reflect.DeepEqual(entries, want) {
+        t.Errorf("parseSchedules = %+v, want %+v", entries, want)
+    }
+
+    for _, schedule := range []string{"", " ; ", "full:not a cron"} {
+        if _, err := parseSchedules(schedule, "full"); err == nil {
+            t.Errorf("parseSchedules(%q): expected an error", schedule)
+        }
+    }
+}
+
+func TestResolveSharedDriveIDs(t *testing.T) {
+    single := GoogleDriveConfig{SharedDriveID: "drive-a"}
+    if err := resolveSharedDriveIDs(&single); err != nil {
+        t.Fatalf("resolveSharedDriveIDs: %v", err)
+    }
+    if !reflect.DeepEqual(single.SharedDriveIDs, []string{"drive-a"}) {
+        t.Errorf("SharedDriveIDs = %v, want [drive-a]", single.SharedDriveIDs)
+    }
+
+    multiple := GoogleDriveConfig{SharedDriveID: "drive-a", SharedDriveIDs: []string{"drive-b", "drive-c"}}
+    if err := resolveSharedDriveIDs(&multiple); err != nil {
+        t.Fatalf("resolveSharedDriveIDs: %v", err)
+    }
+    if multiple.SharedDriveID != "drive-b" {
+        t.Errorf("SharedDriveID = %q, want the first of SharedDriveIDs", multiple.SharedDriveID)
+    }
+
+    if err := resolveSharedDriveIDs(&GoogleDriveConfig{}); err == nil {
+        t.Error("expected an error without any shared drive")
+    }
+    duplicate := GoogleDriveConfig{SharedDriveIDs: []string{"drive-a", "drive-a"}}
+    if err := resolveSharedDriveIDs(&duplicate); err == nil {
+        t.Error("expected an error for a shared drive listed twice")
+    }
+}
+
+func TestValidateAzureRetry(t *testing.T) {
+    valid := AzureConfig{MaxTries: 3, TryTimeout: 2 * time.Minute, RetryDelay: 5 * time.Second, MaxRetryDelay: 30 * time.Second, ReaderMaxRetries: 3}
+    if err := validateAzureRetry(valid); err != nil {
+        t.Fatalf("validateAzureRetry(defaults): %v", err)
+    }
+
+    invalid := map[string]func(cfg *AzureConfig){
+        "no tries":              func(cfg *AzureConfig) { cfg.MaxTries = 0 },
+        "zero try timeout":      func(cfg *AzureConfig) { cfg.TryTimeout = 0 },
+        "delay above max delay": func(cfg *AzureConfig) { cfg.RetryDelay = time.Minute },
+        "negative reader":       func(cfg *AzureConfig) { cfg.ReaderMaxRetries = -1 },
+    }
+    for name, change := range invalid {
+        cfg := valid
+        change(&cfg)
+        if err := validateAzureRetry(cfg); err == nil {
+            t.Errorf("%s: expected an error", name)
+        }
+    }
+}
+
+func TestLoadAzureRetryDelaysRejectsInvalidDuration(t *testing.T) {
+    t.Setenv("TARGET_AZURE_TRY_TIMEOUT", "90s")
+    t.Setenv("TARGET_AZURE_RETRY_DELAY", "")
+    t.Setenv("TARGET_AZURE_MAX_RETRY_DELAY", "")
+
+    var cfg AzureConfig
+    if err := loadAzureRetryDelays(&cfg, "TARGET_AZURE_"); err != nil {
+        t.Fatalf("loadAzureRetryDelays: %v", err)
+    }
+    if cfg.TryTimeout != 90*time.Second || cfg.RetryDelay != 5*time.Second || cfg.MaxRetryDelay != 30*time.Second {
+        t.Errorf("got %v, %v, %v, want 90s and the defaults", cfg.TryTimeout, cfg.RetryDelay, cfg.MaxRetryDelay)
+    }
+
+    // A number without a unit is not a duration
+    t.Setenv("TARGET_AZURE_RETRY_DELAY", "5")
+    if err := loadAzureRetryDelays(&cfg, "TARGET_AZURE_"); err == nil || !strings.Contains(err.Error(), "TARGET_AZURE_RETRY_DELAY") {
+        t.Errorf("loadAzureRetryDelays with RETRY_DELAY=5 = %v, want an error naming the variable", err)
+    }
+}
@@ -4,29 +4,57 @@ import (
     "fmt"
     "os"
     "path/filepath"
+    "runtime"
     "time"
 )
 
-type SpacesConfig struct {
-    Endpoint        string
-    Region          string
-    AccessKeyID     string
-    SecretAccessKey string
-    BucketName      string
+// ObjectStoreConfig describes the restore target: an S3-compatible store
+// such as DigitalOcean Spaces or Backblaze B2, or Google Cloud Storage
+type ObjectStoreConfig struct {
+    Provider           string `yaml:"provider" env:"OBJECT_STORE"`                                                      // "s3" (mặc định, gồm Spaces/B2/MinIO) hoặc "gcs"
+    Endpoint           string `yaml:"endpoint" env:"OBJECT_STORE_ENDPOINT,SPACES_ENDPOINT"`
+    Region             string `yaml:"region" env:"OBJECT_STORE_REGION,SPACES_REGION"`
+    AccessKeyID        string `yaml:"access_key_id" env:"OBJECT_STORE_ACCESS_KEY_ID,SPACES_ACCESS_KEY_ID"`
+    SecretAccessKey    string `yaml:"secret_access_key" env:"OBJECT_STORE_SECRET_ACCESS_KEY,SPACES_SECRET_ACCESS_KEY"`
+    BucketName         string `yaml:"bucket_name" env:"OBJECT_STORE_BUCKET_NAME,SPACES_BUCKET_NAME"`
+    UsePathStyle       bool   `yaml:"use_path_style" env:"OBJECT_STORE_PATH_STYLE"`                                     // Bắt buộc với Backblaze B2 và MinIO
+    MultipartThreshold int64  `yaml:"multipart_threshold_bytes" env:"OBJECT_STORE_MULTIPART_THRESHOLD_MB"`              // File lớn hơn ngưỡng này (bytes) được upload bằng multipart
+    PartSize           int64  `yaml:"part_size_bytes" env:"OBJECT_STORE_PART_SIZE_MB"`                                  // Kích thước mỗi part (bytes), tối thiểu 5MB
+    UploadConcurrency  int    `yaml:"upload_concurrency" env:"OBJECT_STORE_UPLOAD_CONCURRENCY"`                         // Số part upload song song cho mỗi file
+    DeleteConcurrency  int    `yaml:"delete_concurrency" env:"OBJECT_STORE_DELETE_CONCURRENCY"`                         // Số batch (tối đa 1000 object) xóa song song khi dọn prefix
+    MaxConcurrent      int    `yaml:"max_concurrent" env:"SPACES_MAX_CONCURRENT"`                                       // Số file upload song song lên Spaces/S3, mặc định theo số CPU
+    UploadMaxAttempts  int    `yaml:"upload_max_attempts" env:"OBJECT_STORE_UPLOAD_MAX_ATTEMPTS"`                       // Số lần thử upload mỗi file khi gặp lỗi tạm thời (throttling, 5xx)
+    GCSCredentialsPath string `yaml:"gcs_credentials_path" env:"GCS_CREDENTIALS_PATH"`                                  // Optional: service account key cho GCS, mặc định dùng Application Default Credentials
 }
 
 type DORestoreConfig struct {
-    TempDir       string
-    ContainerName string
+    TempDir        string        `yaml:"temp_dir" env:"TEMP_DIR"`
+    TempCleanupAge time.Duration `yaml:"temp_cleanup_age" env:"TEMP_CLEANUP_AGE"`               // Xóa file tạm còn sót lại cũ hơn thời gian này khi khởi động, 0 = tắt
+    ContainerName  string        `yaml:"container_name" env:"RESTORE_CONTAINER_NAME"`
+    EncryptionKey  string        `yaml:"encryption_key" env:"BACKUP_ENCRYPTION_KEY"`
+    CleanBefore    bool          `yaml:"clean_before" env:"RESTORE_CLEAN_BEFORE"`               // Xóa object cũ dưới prefix trước khi upload, false = ghi đè/gộp
+    MaxExtractSize int64         `yaml:"max_extract_size_bytes" env:"RESTORE_MAX_EXTRACT_SIZE"` // Dừng giải nén khi một archive bung ra quá N GB (chống zip bomb), 0 = không giới hạn
+    MaxEntries     int           `yaml:"max_entries" env:"RESTORE_MAX_ENTRIES"`                 // Dừng giải nén khi một archive có quá N entry, 0 = không giới hạn
 }
 
 type DORestoreServiceConfig struct {
-    Azure       AzureConfig
-    GoogleDrive GoogleDriveConfig
-    Spaces      SpacesConfig
-    Restore     DORestoreConfig
-    TimeZone    *time.Location
-    Common      CommonConfig
+    Azure       AzureConfig       `yaml:"-"`
+    GoogleDrive GoogleDriveConfig `yaml:"google_drive"`
+    ObjectStore ObjectStoreConfig `yaml:"object_store"`
+    Restore     DORestoreConfig   `yaml:"restore"`
+    TimeZone    *time.Location    `yaml:"-"`
+    Common      CommonConfig      `yaml:"common"`
+}
+
+// DefaultUploadWorkers is the number of files uploaded to the object store at
+// once when SPACES_MAX_CONCURRENT is not set. Uploads mostly wait on the
+// network, so it is a few per CPU, capped to stay below the store's rate limits.
+func DefaultUploadWorkers() int {
+    workers := runtime.NumCPU() * 4
+    if workers > 32 {
+        workers = 32
+    }
+    return workers
 }
 
 func LoadDORestoreConfig() (*DORestoreServiceConfig, error) {
@@ -37,32 +65,75 @@ func LoadDORestoreConfig() (*DORestoreServiceConfig, error) {
         return nil, fmt.Errorf("invalid timezone: %v", err)
     }
 
+    secretAccessKey, err := getSecretEnv("OBJECT_STORE_SECRET_ACCESS_KEY")
+    if err != nil {
+        return nil, err
+    }
+    if secretAccessKey == "" {
+        if secretAccessKey, err = getSecretEnv("SPACES_SECRET_ACCESS_KEY"); err != nil {
+            return nil, err
+        }
+    }
+    encryptionKey, err := getSecretEnv("BACKUP_ENCRYPTION_KEY")
+    if err != nil {
+        return nil, err
+    }
+    tokenJSON, err := getSecretEnv("GOOGLE_TOKEN_JSON")
+    if err != nil {
+        return nil, err
+    }
+
     config := &DORestoreServiceConfig{
         Common: CommonConfig{
             LogLevel:      getEnvWithDefault("LOG_LEVEL", "info"),
+            LogFormat:     getEnvWithDefault("LOG_FORMAT", "text"),
             EnableMetrics: getEnvAsBoolWithDefault("ENABLE_METRICS", true),
             MetricsPort:   getEnvAsIntWithDefault("METRICS_PORT", 9090),
         },
         GoogleDrive: GoogleDriveConfig{
-            CredentialsPath: getEnvWithDefault("GOOGLE_CREDENTIALS_PATH", "/app/credentials.json"),
-            TokenPath:       getEnvWithDefault("GOOGLE_TOKEN_PATH", "/app/token.json"),
-            SharedDriveID:   os.Getenv("GOOGLE_SHARED_DRIVE_ID"),
-            FolderID:        os.Getenv("GOOGLE_FOLDER_ID"),
+            CredentialsPath:    getEnvWithDefault("GOOGLE_CREDENTIALS_PATH", "/app/credentials.json"),
+            TokenPath:          getEnvWithDefault("GOOGLE_TOKEN_PATH", "/app/token.json"),
+            TokenJSON:          tokenJSON,
+            SharedDriveID:      os.Getenv("GOOGLE_SHARED_DRIVE_ID"),
+            FolderID:           os.Getenv("GOOGLE_FOLDER_ID"),
+            AuthMode:           getEnvWithDefault("GOOGLE_AUTH_MODE", "auto"),
+            ImpersonateSubject: os.Getenv("GOOGLE_IMPERSONATE_SUBJECT"),
+            MaxRetries:         getEnvAsIntWithDefault("GOOGLE_MAX_RETRIES", 5),
+            ListPageSize:       getEnvAsIntWithDefault("GDRIVE_LIST_PAGE_SIZE", 0),
         },
-        Spaces: SpacesConfig{
-            Endpoint:        getEnvWithDefault("SPACES_ENDPOINT", "https://sgp1.digitaloceanspaces.com"),
-            Region:         getEnvWithDefault("SPACES_REGION", "sgp1"),
-            AccessKeyID:     os.Getenv("SPACES_ACCESS_KEY_ID"),
-            SecretAccessKey: os.Getenv("SPACES_SECRET_ACCESS_KEY"),
-            BucketName:     os.Getenv("SPACES_BUCKET_NAME"),
+        // OBJECT_STORE_* override the older SPACES_* variables
+        ObjectStore: ObjectStoreConfig{
+            Provider:           getEnvWithDefault("OBJECT_STORE", "s3"),
+            Endpoint:           getEnvWithDefault("OBJECT_STORE_ENDPOINT", getEnvWithDefault("SPACES_ENDPOINT", "https://sgp1.digitaloceanspaces.com")),
+            Region:             getEnvWithDefault("OBJECT_STORE_REGION", getEnvWithDefault("SPACES_REGION", "sgp1")),
+            AccessKeyID:        getEnvWithDefault("OBJECT_STORE_ACCESS_KEY_ID", os.Getenv("SPACES_ACCESS_KEY_ID")),
+            SecretAccessKey:    secretAccessKey,
+            BucketName:         getEnvWithDefault("OBJECT_STORE_BUCKET_NAME", os.Getenv("SPACES_BUCKET_NAME")),
+            UsePathStyle:       getEnvAsBoolWithDefault("OBJECT_STORE_PATH_STYLE", false),
+            MultipartThreshold: int64(getEnvAsIntWithDefault("OBJECT_STORE_MULTIPART_THRESHOLD_MB", 100)) * 1024 * 1024,
+            PartSize:           int64(getEnvAsIntWithDefault("OBJECT_STORE_PART_SIZE_MB", 16)) * 1024 * 1024,
+            UploadConcurrency:  getEnvAsIntWithDefault("OBJECT_STORE_UPLOAD_CONCURRENCY", 5),
+            DeleteConcurrency:  getEnvAsIntWithDefault("OBJECT_STORE_DELETE_CONCURRENCY", 4),
+            MaxConcurrent:      getEnvAsIntWithDefault("SPACES_MAX_CONCURRENT", DefaultUploadWorkers()),
+            UploadMaxAttempts:  getEnvAsIntWithDefault("OBJECT_STORE_UPLOAD_MAX_ATTEMPTS", 5),
+            GCSCredentialsPath: os.Getenv("GCS_CREDENTIALS_PATH"),
         },
         Restore: DORestoreConfig{
-            TempDir:       getEnvWithDefault("TEMP_DIR", "/app/temp"),
-            ContainerName: os.Getenv("RESTORE_CONTAINER_NAME"),
+            TempDir:        getEnvWithDefault("TEMP_DIR", "/app/temp"),
+            TempCleanupAge: getEnvAsDurationWithDefault("TEMP_CLEANUP_AGE", 24*time.Hour),
+            ContainerName:  os.Getenv("RESTORE_CONTAINER_NAME"),
+            EncryptionKey:  encryptionKey,
+            CleanBefore:    getEnvAsBoolWithDefault("RESTORE_CLEAN_BEFORE", true),
+            MaxExtractSize: int64(getEnvAsIntWithDefault("RESTORE_MAX_EXTRACT_SIZE", 0)) * 1024 * 1024 * 1024,
+            MaxEntries:     getEnvAsIntWithDefault("RESTORE_MAX_ENTRIES", 0),
         },
         TimeZone: location,
     }
 
+    if err := applyConfigFile(config); err != nil {
+        return nil, err
+    }
+
     if err := validateDORestoreConfig(config); err != nil {
         return nil, err
     }
@@ -75,13 +146,38 @@ func validateDORestoreConfig(cfg *DORestoreServiceConfig) error {
     if cfg.GoogleDrive.SharedDriveID == "" {
         return fmt.Errorf("google shared drive ID is required")
     }
+    if err := validateDriveListPageSize(cfg.GoogleDrive); err != nil {
+        return err
+    }
 
-    // Validate Spaces config
-    if cfg.Spaces.AccessKeyID == "" || cfg.Spaces.SecretAccessKey == "" {
-        return fmt.Errorf("spaces credentials are required")
+    // Validate object store config. GCS authenticates with a service account
+    // key or Application Default Credentials instead of access keys.
+    switch cfg.ObjectStore.Provider {
+    case "s3":
+        if cfg.ObjectStore.AccessKeyID == "" || cfg.ObjectStore.SecretAccessKey == "" {
+            return fmt.Errorf("object store credentials are required")
+        }
+    case "gcs":
+    default:
+        return fmt.Errorf("invalid object store: %s (expected s3 or gcs)", cfg.ObjectStore.Provider)
+    }
+    if cfg.ObjectStore.BucketName == "" {
+        return fmt.Errorf("object store bucket name is required")
+    }
+    if cfg.ObjectStore.PartSize < 5*1024*1024 {
+        return fmt.Errorf("object store part size must be at least 5 MB")
     }
-    if cfg.Spaces.BucketName == "" {
-        return fmt.Errorf("spaces bucket name is required")
+    if cfg.ObjectStore.UploadConcurrency < 1 {
+        return fmt.Errorf("object store upload concurrency must be at least 1")
+    }
+    if cfg.ObjectStore.DeleteConcurrency < 1 {
+        return fmt.Errorf("object store delete concurrency must be at least 1")
+    }
+    if cfg.ObjectStore.MaxConcurrent < 1 {
+        return fmt.Errorf("SPACES_MAX_CONCURRENT must be at least 1")
+    }
+    if cfg.ObjectStore.UploadMaxAttempts < 1 {
+        return fmt.Errorf("OBJECT_STORE_UPLOAD_MAX_ATTEMPTS must be at least 1")
     }
 
     // Validate Restore config
@@ -89,6 +185,13 @@ func validateDORestoreConfig(cfg *DORestoreServiceConfig) error {
         return fmt.Errorf("restore container name is required")
     }
 
+    if cfg.Restore.TempCleanupAge < 0 {
+        return fmt.Errorf("temp cleanup age cannot be negative")
+    }
+    if cfg.Restore.MaxExtractSize < 0 || cfg.Restore.MaxEntries < 0 {
+        return fmt.Errorf("restore extraction limits cannot be negative")
+    }
+
     // Validate paths
     paths := []string{
         cfg.Restore.TempDir,
@@ -103,4 +206,4 @@ func validateDORestoreConfig(cfg *DORestoreServiceConfig) error {
     }
 
     return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+    "fmt"
+    "os"
+    "reflect"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+// applyConfigFile overlays the YAML or JSON file named by CONFIG_FILE onto
+// cfg, which must already hold the values loaded from the environment.
+// Fields are matched by their yaml tag; a field keeps its environment value
+// when one of the variables in its env tag is set, so the environment always
+// wins over the file. Without CONFIG_FILE cfg is left unchanged.
+func applyConfigFile(cfg interface{}) error {
+    path := os.Getenv("CONFIG_FILE")
+    if path == "" {
+        return nil
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return fmt.Errorf("failed to read config file: %v", err)
+    }
+
+    // Decode over a copy so keys missing from the file keep their defaults.
+    // JSON is valid YAML, so the same decoder handles both formats.
+    current := reflect.ValueOf(cfg).Elem()
+    fromFile := reflect.New(current.Type())
+    fromFile.Elem().Set(current)
+    if err := yaml.Unmarshal(data, fromFile.Interface()); err != nil {
+        return fmt.Errorf("failed to parse config file %s: %v", path, err)
+    }
+
+    mergeFileValues(current, fromFile.Elem(), "")
+    return nil
+}
+
+// mergeFileValues copies every field of src into dst unless the environment
+// sets it. prefix is prepended to env tags, as set by envprefix on a parent.
+func mergeFileValues(dst, src reflect.Value, prefix string) {
+    t := dst.Type()
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        if field.Tag.Get("yaml") == "-" {
+            continue
+        }
+        if field.Type.Kind() == reflect.Struct {
+            mergeFileValues(dst.Field(i), src.Field(i), prefix+field.Tag.Get("envprefix"))
+            continue
+        }
+        if envIsSet(prefix, field.Tag.Get("env")) {
+            continue
+        }
+        dst.Field(i).Set(src.Field(i))
+    }
+}
+
+// envIsSet reports whether any of the comma-separated variables in names is
+// set, directly or as a <NAME>_FILE secret
+func envIsSet(prefix, names string) bool {
+    if names == "" {
+        return false
+    }
+    for _, name := range strings.Split(names, ",") {
+        if os.Getenv(prefix+name) != "" || os.Getenv(prefix+name+"_FILE") != "" {
+            return true
+        }
+    }
+    return false
+}
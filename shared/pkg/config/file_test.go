@@ -0,0 +1,68 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestApplyConfigFileEnvOverridesFile(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "config.yaml")
+    content := `
+azure:
+  account_name: from-file
+  account_key: file-key
+backup:
+  retention_days: 30
+common:
+  enable_metrics: false
+`
+    if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+        t.Fatalf("write config: %v", err)
+    }
+    t.Setenv("CONFIG_FILE", path)
+    t.Setenv("TARGET_AZURE_ACCOUNT_NAME", "")
+    t.Setenv("TARGET_AZURE_ACCOUNT_KEY", "env-key")
+
+    cfg := &RestoreServiceConfig{
+        Azure:         AzureConfig{AccountKey: "env-key", ContainerName: "ALL"},
+        MaxConcurrent: 10,
+        Common:        CommonConfig{EnableMetrics: true},
+    }
+    if err := applyConfigFile(cfg); err != nil {
+        t.Fatalf("applyConfigFile: %v", err)
+    }
+
+    if cfg.Azure.AccountName != "from-file" {
+        t.Errorf("AccountName = %q, want value from file", cfg.Azure.AccountName)
+    }
+    if cfg.Azure.AccountKey != "env-key" {
+        t.Errorf("AccountKey = %q, want environment value", cfg.Azure.AccountKey)
+    }
+    if cfg.Azure.ContainerName != "ALL" || cfg.MaxConcurrent != 10 {
+        t.Errorf("defaults not kept: container %q, max concurrent %d", cfg.Azure.ContainerName, cfg.MaxConcurrent)
+    }
+    if cfg.Common.EnableMetrics {
+        t.Errorf("EnableMetrics = true, want false from file")
+    }
+}
+
+func TestApplyConfigFileJSON(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "config.json")
+    content := `{"backup": {"schedule": "0 3 * * *", "retention_count": 5}}`
+    if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+        t.Fatalf("write config: %v", err)
+    }
+    t.Setenv("CONFIG_FILE", path)
+    t.Setenv("BACKUP_SCHEDULE", "")
+    t.Setenv("BACKUP_RETENTION_COUNT", "")
+
+    cfg := &BackupServiceConfig{Backup: BackupConfig{Schedule: "0 1 * * *"}}
+    if err := applyConfigFile(cfg); err != nil {
+        t.Fatalf("applyConfigFile: %v", err)
+    }
+
+    if cfg.Backup.Schedule != "0 3 * * *" || cfg.Backup.RetentionCount != 5 {
+        t.Errorf("got schedule %q, retention count %d", cfg.Backup.Schedule, cfg.Backup.RetentionCount)
+    }
+}
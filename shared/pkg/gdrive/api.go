@@ -0,0 +1,121 @@
+package gdrive
+
+import (
+    "context"
+    "io"
+    "net/http"
+
+    "google.golang.org/api/drive/v3"
+    "google.golang.org/api/googleapi"
+)
+
+// ListOptions selects the files returned by DriveAPI.ListFiles
+type ListOptions struct {
+    Query     string // Drive search query, empty lists every file
+    OrderBy   string
+    PageToken string
+    Fields    string // Partial response fields, e.g. "nextPageToken, files(id, name)"
+    PageSize  int64  // Files per page, 0 uses the Drive default
+}
+
+// DriveAPI is the subset of the Drive API used by GoogleDriveService. Every
+// call is scoped to a single shared drive. The real implementation wraps a
+// *drive.Service; tests can substitute a fake.
+type DriveAPI interface {
+    GetDrive(ctx context.Context) (*drive.Drive, error)
+    ListFiles(ctx context.Context, opts ListOptions) (*drive.FileList, error)
+    GetFile(ctx context.Context, fileID, fields string) (*drive.File, error)
+    // CreateFile creates file with the content of media; a nil media
+    // creates a file without content, such as a folder
+    CreateFile(ctx context.Context, file *drive.File, media io.Reader, fields string, options ...googleapi.MediaOption) (*drive.File, error)
+    Download(ctx context.Context, fileID string) (*http.Response, error)
+    DeleteFile(ctx context.Context, fileID string) error
+    StorageQuota(ctx context.Context) (*drive.AboutStorageQuota, error)
+}
+
+// driveAPI implements DriveAPI on top of a *drive.Service
+type driveAPI struct {
+    service *drive.Service
+    driveID string
+}
+
+// NewDriveAPI returns a DriveAPI backed by service, scoped to the shared
+// drive driveID
+func NewDriveAPI(service *drive.Service, driveID string) DriveAPI {
+    return &driveAPI{service: service, driveID: driveID}
+}
+
+func (a *driveAPI) GetDrive(ctx context.Context) (*drive.Drive, error) {
+    return a.service.Drives.Get(a.driveID).Context(ctx).Do()
+}
+
+func (a *driveAPI) ListFiles(ctx context.Context, opts ListOptions) (*drive.FileList, error) {
+    call := a.service.Files.List().
+        SupportsAllDrives(true).
+        IncludeItemsFromAllDrives(true).
+        Corpora("drive").
+        DriveId(a.driveID).
+        Context(ctx)
+    if opts.Query != "" {
+        call = call.Q(opts.Query)
+    }
+    if opts.OrderBy != "" {
+        call = call.OrderBy(opts.OrderBy)
+    }
+    if opts.PageToken != "" {
+        call = call.PageToken(opts.PageToken)
+    }
+    if opts.Fields != "" {
+        call = call.Fields(googleapi.Field(opts.Fields))
+    }
+    if opts.PageSize > 0 {
+        call = call.PageSize(opts.PageSize)
+    }
+    return call.Do()
+}
+
+func (a *driveAPI) GetFile(ctx context.Context, fileID, fields string) (*drive.File, error) {
+    return a.service.Files.Get(fileID).
+        SupportsAllDrives(true).
+        Fields(googleapi.Field(fields)).
+        Context(ctx).
+        Do()
+}
+
+func (a *driveAPI) CreateFile(ctx context.Context, file *drive.File, media io.Reader, fields string, options ...googleapi.MediaOption) (*drive.File, error) {
+    call := a.service.Files.Create(file).
+        SupportsAllDrives(true).
+        Context(ctx)
+    if media != nil {
+        call = call.Media(media, options...)
+    }
+    if fields != "" {
+        call = call.Fields(googleapi.Field(fields))
+    }
+    return call.Do()
+}
+
+func (a *driveAPI) Download(ctx context.Context, fileID string) (*http.Response, error) {
+    return a.service.Files.Get(fileID).
+        SupportsAllDrives(true).
+        Context(ctx).
+        Download()
+}
+
+func (a *driveAPI) DeleteFile(ctx context.Context, fileID string) error {
+    return a.service.Files.Delete(fileID).
+        SupportsAllDrives(true).
+        Context(ctx).
+        Do()
+}
+
+func (a *driveAPI) StorageQuota(ctx context.Context) (*drive.AboutStorageQuota, error) {
+    about, err := a.service.About.Get().
+        Fields("storageQuota").
+        Context(ctx).
+        Do()
+    if err != nil {
+        return nil, err
+    }
+    return about.StorageQuota, nil
+}
@@ -0,0 +1,297 @@
+package gdrive
+
+import (
+    "bytes"
+    "context"
+    "crypto/md5"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "google.golang.org/api/drive/v3"
+    "google.golang.org/api/googleapi"
+
+    "shared/pkg/utils"
+)
+
+// fakeDriveAPI serves a list of files. It does not evaluate queries: every
+// ListFiles call returns all files, pageSize (or the requested page size)
+// at a time, and the query and page size are recorded so tests can check
+// them. Created files are appended to the list
+// and their content is served by Download. Calls are serialised, so
+// concurrent uploads and downloads can share the fake.
+type fakeDriveAPI struct {
+    mu       sync.Mutex
+    files    []*drive.File
+    contents map[string][]byte
+    pageSize int
+    queries  []string
+    sizes    []int64
+    deleted  []string
+}
+
+func (f *fakeDriveAPI) GetDrive(ctx context.Context) (*drive.Drive, error) {
+    return &drive.Drive{Name: "fake"}, nil
+}
+
+func (f *fakeDriveAPI) ListFiles(ctx context.Context, opts ListOptions) (*drive.FileList, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.queries = append(f.queries, opts.Query)
+    f.sizes = append(f.sizes, opts.PageSize)
+
+    pageSize := f.pageSize
+    if pageSize == 0 {
+        pageSize = int(opts.PageSize)
+    }
+    start := 0
+    if opts.PageToken != "" {
+        start, _ = strconv.Atoi(opts.PageToken)
+    }
+    end := len(f.files)
+    if pageSize > 0 && start+pageSize < end {
+        end = start + pageSize
+    }
+
+    list := &drive.FileList{Files: f.files[start:end]}
+    if end < len(f.files) {
+        list.NextPageToken = strconv.Itoa(end)
+    }
+    return list, nil
+}
+
+func (f *fakeDriveAPI) GetFile(ctx context.Context, fileID, fields string) (*drive.File, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    for _, file := range f.files {
+        if file.Id == fileID {
+            return file, nil
+        }
+    }
+    return nil, &googleapi.Error{Code: http.StatusNotFound}
+}
+
+func (f *fakeDriveAPI) CreateFile(ctx context.Context, file *drive.File, media io.Reader, fields string, options ...googleapi.MediaOption) (*drive.File, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    created := *file
+    created.Id = fmt.Sprintf("new%d", len(f.files)+1)
+    created.CreatedTime = time.Now().UTC().Format(time.RFC3339)
+    if media != nil {
+        data, err := io.ReadAll(media)
+        if err != nil {
+            return nil, err
+        }
+        if f.contents == nil {
+            f.contents = make(map[string][]byte)
+        }
+        f.contents[created.Id] = data
+        created.Size = int64(len(data))
+        sum := md5.Sum(data)
+        created.Md5Checksum = hex.EncodeToString(sum[:])
+    }
+    f.files = append(f.files, &created)
+    return &created, nil
+}
+
+func (f *fakeDriveAPI) Download(ctx context.Context, fileID string) (*http.Response, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    data, ok := f.contents[fileID]
+    if !ok {
+        return nil, &googleapi.Error{Code: http.StatusNotFound}
+    }
+    return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeDriveAPI) DeleteFile(ctx context.Context, fileID string) error {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.deleted = append(f.deleted, fileID)
+    return nil
+}
+
+func (f *fakeDriveAPI) StorageQuota(ctx context.Context) (*drive.AboutStorageQuota, error) {
+    return nil, nil
+}
+
+func newFakeService(api *fakeDriveAPI) *GoogleDriveService {
+    return NewGoogleDriveServiceWithAPI(api, &DriveConfig{SharedDriveID: "drive"}, utils.NewLogger("[TEST]", "error", "text"))
+}
+
+func TestListAvailableBackupsUsesPageSize(t *testing.T) {
+    api := &fakeDriveAPI{
+        files: []*drive.File{
+            {Id: "1", Name: "assets_20241116_010000.zip", CreatedTime: "2024-11-16T01:00:00Z"},
+            {Id: "2", Name: "assets_20241115_010000.zip", CreatedTime: "2024-11-15T01:00:00Z"},
+            {Id: "3", Name: "assets_20241114_010000.zip", CreatedTime: "2024-11-14T01:00:00Z"},
+        },
+    }
+    service := NewGoogleDriveServiceWithAPI(api, &DriveConfig{SharedDriveID: "drive", ListPageSize: 2},
+        utils.NewLogger("[TEST]", "error", "text"))
+
+    backups, err := service.ListAvailableBackups()
+    if err != nil {
+        t.Fatalf("ListAvailableBackups: %v", err)
+    }
+    if len(backups) != 3 {
+        t.Errorf("got %d backups, want all 3 across pages", len(backups))
+    }
+    for _, size := range api.sizes {
+        if size != 2 {
+            t.Errorf("listed with page size %d, want 2", size)
+        }
+    }
+}
+
+func TestGetLatestBackupSkipsOtherContainers(t *testing.T) {
+    // Newest first, as requested with OrderBy; the first two pages hold no
+    // full backup of "assets"
+    api := &fakeDriveAPI{
+        pageSize: 2,
+        files: []*drive.File{
+            {Id: "1", Name: "assets-old_20241116_010000.zip", CreatedTime: "2024-11-16T01:00:00Z"},
+            {Id: "2", Name: "inc_assets_20241115_120000.zip", CreatedTime: "2024-11-15T12:00:00Z"},
+            {Id: "3", Name: "assets.zip", CreatedTime: "2024-11-15T06:00:00Z"},
+            {Id: "4", Name: "assets-old_20241115_010000.zip", CreatedTime: "2024-11-15T01:00:00Z"},
+            {Id: "5", Name: "assets_20241114_010000.zip", CreatedTime: "2024-11-14T01:00:00Z"},
+            {Id: "6", Name: "assets_20241113_010000.zip", CreatedTime: "2024-11-13T01:00:00Z"},
+        },
+    }
+
+    backup, err := newFakeService(api).GetLatestBackup("assets")
+    if err != nil {
+        t.Fatalf("GetLatestBackup: %v", err)
+    }
+    if backup.ID != "5" {
+        t.Errorf("GetLatestBackup picked %s (%s), want 5", backup.ID, backup.Name)
+    }
+    if len(api.queries) != 3 {
+        t.Errorf("listed %d pages, want 3", len(api.queries))
+    }
+    if !strings.Contains(api.queries[0], "name contains 'assets'") {
+        t.Errorf("query %q does not filter on the container name", api.queries[0])
+    }
+}
+
+func TestGetLatestBackupReturnsErrNoBackupFound(t *testing.T) {
+    api := &fakeDriveAPI{
+        files: []*drive.File{
+            {Id: "1", Name: "media_20241114_010000.zip", CreatedTime: "2024-11-14T01:00:00Z"},
+            {Id: "2", Name: "inc_assets_20241115_120000.zip", CreatedTime: "2024-11-15T12:00:00Z"},
+        },
+    }
+
+    _, err := newFakeService(api).GetLatestBackup("assets")
+    if !errors.Is(err, ErrNoBackupFound) {
+        t.Fatalf("GetLatestBackup error = %v, want ErrNoBackupFound", err)
+    }
+    if !strings.Contains(err.Error(), "assets") {
+        t.Errorf("error %q does not name the container", err)
+    }
+}
+
+func TestGoogleNativeFilesAreRejected(t *testing.T) {
+    api := &fakeDriveAPI{
+        files: []*drive.File{
+            {Id: "1", Name: "assets_20241115_010000.zip", MimeType: "application/vnd.google-apps.document", CreatedTime: "2024-11-15T01:00:00Z"},
+            {Id: "2", Name: "assets_20241114_010000.zip", MimeType: "application/zip", CreatedTime: "2024-11-14T01:00:00Z"},
+        },
+    }
+    service := newFakeService(api)
+
+    backups, err := service.ListAvailableBackups()
+    if err != nil {
+        t.Fatalf("ListAvailableBackups: %v", err)
+    }
+    if len(backups) != 1 || backups[0].ID != "2" {
+        t.Errorf("ListAvailableBackups returned %d backups, want only the zip archive", len(backups))
+    }
+
+    err = service.DownloadFile(context.Background(), "1", t.TempDir()+"/backup.zip")
+    if !errors.Is(err, ErrInvalidBackup) {
+        t.Fatalf("DownloadFile error = %v, want ErrInvalidBackup", err)
+    }
+    if !strings.Contains(err.Error(), "Google Docs document") {
+        t.Errorf("error %q does not say the file is a Google Docs document", err)
+    }
+}
+
+func TestGetIncrementalBackupsFiltersContainer(t *testing.T) {
+    api := &fakeDriveAPI{
+        files: []*drive.File{
+            {Id: "1", Name: "inc_assets_20241114_020000.zip", CreatedTime: "2024-11-14T02:00:00Z"},
+            {Id: "2", Name: "inc_assets-old_20241114_030000.zip", CreatedTime: "2024-11-14T03:00:00Z"},
+            {Id: "3", Name: "assets_20241114_040000.zip", CreatedTime: "2024-11-14T04:00:00Z"},
+            {Id: "4", Name: "inc_assets_20241114_050000.zip", CreatedTime: "2024-11-14T05:00:00Z"},
+        },
+    }
+
+    after := time.Date(2024, 11, 14, 1, 0, 0, 0, time.UTC)
+    backups, err := newFakeService(api).GetIncrementalBackups("assets", after, time.Time{})
+    if err != nil {
+        t.Fatalf("GetIncrementalBackups: %v", err)
+    }
+
+    var ids []string
+    for _, backup := range backups {
+        ids = append(ids, backup.ID)
+    }
+    if strings.Join(ids, ",") != "1,4" {
+        t.Errorf("GetIncrementalBackups = %v, want [1 4]", ids)
+    }
+    if !strings.Contains(api.queries[0], "createdTime > '2024-11-14T01:00:00Z'") {
+        t.Errorf("query %q does not filter on the creation time", api.queries[0])
+    }
+}
+
+func TestCleanupOldBackupsDeletesExpiredFolders(t *testing.T) {
+    old := time.Now().AddDate(0, 0, -30).UTC().Format(time.RFC3339)
+    older := time.Now().AddDate(0, 0, -31).UTC().Format(time.RFC3339)
+    recent := time.Now().AddDate(0, 0, -1).UTC().Format(time.RFC3339)
+
+    api := &fakeDriveAPI{
+        pageSize: 2,
+        files: []*drive.File{
+            {Id: "a1", Name: "backup_assets_20241114_010000", CreatedTime: recent},
+            {Id: "a2", Name: "backup_assets_20241014_010000", CreatedTime: old},
+            {Id: "l1", Name: "backup_logs_20241014_010000", CreatedTime: old},
+            {Id: "l2", Name: "backup_logs_20241013_010000", CreatedTime: older},
+            {Id: "x", Name: "backup_manual", CreatedTime: old},
+        },
+    }
+
+    if err := newFakeService(api).CleanupOldBackups(context.Background(), 7, 0, false); err != nil {
+        t.Fatalf("CleanupOldBackups: %v", err)
+    }
+
+    // The newest folder of each container is always kept
+    sort.Strings(api.deleted)
+    if got := strings.Join(api.deleted, ","); got != "a2,l2,x" {
+        t.Errorf("deleted %s, want a2,l2,x", got)
+    }
+}
+
+func TestCleanupOldBackupsDryRunDeletesNothing(t *testing.T) {
+    api := &fakeDriveAPI{
+        files: []*drive.File{
+            {Id: "a1", Name: "backup_assets_20241114_010000", CreatedTime: "2024-11-14T01:00:00Z"},
+            {Id: "a2", Name: "backup_assets_20241014_010000", CreatedTime: "2024-10-14T01:00:00Z"},
+        },
+    }
+
+    if err := newFakeService(api).CleanupOldBackups(context.Background(), 7, 0, true); err != nil {
+        t.Fatalf("CleanupOldBackups: %v", err)
+    }
+    if len(api.deleted) != 0 {
+        t.Errorf("dry run deleted %v", api.deleted)
+    }
+}
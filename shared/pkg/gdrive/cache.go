@@ -0,0 +1,153 @@
+package gdrive
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "shared/pkg/utils"
+)
+
+// DownloadCache keeps recently downloaded files on disk so a restore that is
+// run again does not fetch the same archives from Drive twice. Entries are
+// keyed by Drive file ID and md5Checksum, so a file whose content changed is
+// never served from the cache. A file's modification time records when it
+// was last used, and the least recently used entries are evicted once the
+// cache grows past its size budget.
+type DownloadCache struct {
+    dir      string
+    maxBytes int64
+    mu       sync.Mutex
+    logger   *utils.Logger
+}
+
+// NewDownloadCache creates a cache in dir holding at most maxBytes
+func NewDownloadCache(dir string, maxBytes int64, logger *utils.Logger) (*DownloadCache, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, fmt.Errorf("failed to create download cache directory: %v", err)
+    }
+    return &DownloadCache{dir: dir, maxBytes: maxBytes, logger: logger}, nil
+}
+
+// entryPath returns where the file with the given ID and checksum is cached
+func (c *DownloadCache) entryPath(fileID, md5Checksum string) string {
+    return filepath.Join(c.dir, fileID+"-"+md5Checksum)
+}
+
+// Fetch places the cached copy of the file at destinationPath and reports
+// whether there was one
+func (c *DownloadCache) Fetch(fileID, md5Checksum, destinationPath string) bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    path := c.entryPath(fileID, md5Checksum)
+    if _, err := os.Stat(path); err != nil {
+        return false
+    }
+    if err := linkOrCopy(path, destinationPath); err != nil {
+        c.logger.Warn("Failed to use cached copy of %s: %v", fileID, err)
+        return false
+    }
+    now := time.Now()
+    if err := os.Chtimes(path, now, now); err != nil {
+        c.logger.Debug("Failed to mark cached %s as used: %v", fileID, err)
+    }
+    return true
+}
+
+// Store adds the verified download at path to the cache and evicts the
+// least recently used entries while the cache is over its size budget.
+// A file larger than the whole budget is not cached.
+func (c *DownloadCache) Store(fileID, md5Checksum, path string, size int64) error {
+    if size > c.maxBytes {
+        c.logger.Debug("Not caching %s: %s exceeds the cache size", fileID, utils.FormatBytes(size))
+        return nil
+    }
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    entry := c.entryPath(fileID, md5Checksum)
+    tempPath := entry + ".tmp"
+    if err := linkOrCopy(path, tempPath); err != nil {
+        os.Remove(tempPath)
+        return fmt.Errorf("failed to add %s to the download cache: %v", fileID, err)
+    }
+    if err := os.Rename(tempPath, entry); err != nil {
+        os.Remove(tempPath)
+        return fmt.Errorf("failed to add %s to the download cache: %v", fileID, err)
+    }
+    now := time.Now()
+    os.Chtimes(entry, now, now)
+
+    return c.evict()
+}
+
+// evict removes the least recently used entries until the cache fits its
+// size budget. The caller holds c.mu.
+func (c *DownloadCache) evict() error {
+    dirEntries, err := os.ReadDir(c.dir)
+    if err != nil {
+        return fmt.Errorf("failed to read download cache: %v", err)
+    }
+
+    var entries []os.FileInfo
+    var total int64
+    for _, dirEntry := range dirEntries {
+        if dirEntry.IsDir() || strings.HasSuffix(dirEntry.Name(), ".tmp") {
+            continue
+        }
+        info, err := dirEntry.Info()
+        if err != nil {
+            continue
+        }
+        entries = append(entries, info)
+        total += info.Size()
+    }
+
+    sort.Slice(entries, func(i, j int) bool {
+        return entries[i].ModTime().Before(entries[j].ModTime())
+    })
+    for _, info := range entries {
+        if total <= c.maxBytes {
+            break
+        }
+        if err := os.Remove(filepath.Join(c.dir, info.Name())); err != nil {
+            return fmt.Errorf("failed to evict %s from the download cache: %v", info.Name(), err)
+        }
+        total -= info.Size()
+        c.logger.Debug("Evicted %s (%s) from the download cache", info.Name(), utils.FormatBytes(info.Size()))
+    }
+    return nil
+}
+
+// linkOrCopy hard-links src to dst, copying it when the two are on
+// different filesystems. A restore never writes to an archive it
+// downloaded, so sharing the inode with the cache is safe.
+func linkOrCopy(src, dst string) error {
+    os.Remove(dst)
+    if err := os.Link(src, dst); err == nil {
+        return nil
+    }
+
+    in, err := os.Open(src)
+    if err != nil {
+        return err
+    }
+    defer in.Close()
+
+    out, err := os.Create(dst)
+    if err != nil {
+        return err
+    }
+    if _, err := io.Copy(out, in); err != nil {
+        out.Close()
+        return err
+    }
+    return out.Close()
+}
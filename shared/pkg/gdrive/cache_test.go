@@ -0,0 +1,106 @@
+package gdrive
+
+import (
+    "context"
+    "crypto/md5"
+    "encoding/hex"
+    "net/http"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "google.golang.org/api/drive/v3"
+
+    "shared/pkg/utils"
+)
+
+// countingDriveAPI counts the downloads served by fakeDriveAPI
+type countingDriveAPI struct {
+    *fakeDriveAPI
+    downloads int
+}
+
+func (c *countingDriveAPI) Download(ctx context.Context, fileID string) (*http.Response, error) {
+    c.downloads++
+    return c.fakeDriveAPI.Download(ctx, fileID)
+}
+
+func newCachedService(t *testing.T, contents map[string]string, cacheSize int64) (*GoogleDriveService, *countingDriveAPI, *DownloadCache) {
+    t.Helper()
+    logger := utils.NewLogger("[TEST]", "error", "text")
+
+    fake := &fakeDriveAPI{contents: make(map[string][]byte)}
+    for id, content := range contents {
+        sum := md5.Sum([]byte(content))
+        fake.files = append(fake.files, &drive.File{
+            Id: id, Name: id + ".zip", Size: int64(len(content)), Md5Checksum: hex.EncodeToString(sum[:]),
+        })
+        fake.contents[id] = []byte(content)
+    }
+
+    cache, err := NewDownloadCache(t.TempDir(), cacheSize, logger)
+    if err != nil {
+        t.Fatal(err)
+    }
+    api := &countingDriveAPI{fakeDriveAPI: fake}
+    service := NewGoogleDriveServiceWithAPI(api, &DriveConfig{SharedDriveID: "drive", DownloadCache: cache}, logger)
+    return service, api, cache
+}
+
+func TestDownloadFileUsesCache(t *testing.T) {
+    service, api, _ := newCachedService(t, map[string]string{"1": "archive"}, 1024)
+    dir := t.TempDir()
+
+    for i, name := range []string{"first.zip", "second.zip"} {
+        path := filepath.Join(dir, name)
+        if err := service.DownloadFile(context.Background(), "1", path); err != nil {
+            t.Fatalf("download %d: %v", i+1, err)
+        }
+        data, err := os.ReadFile(path)
+        if err != nil || string(data) != "archive" {
+            t.Fatalf("download %d wrote %q (%v), want %q", i+1, data, err, "archive")
+        }
+    }
+    if api.downloads != 1 {
+        t.Errorf("file downloaded %d times, want 1", api.downloads)
+    }
+
+    // A changed checksum means new content, which must not come from the cache
+    api.files[0].Md5Checksum = "changed"
+    service.DownloadFile(context.Background(), "1", filepath.Join(dir, "third.zip"))
+    if api.downloads != 2 {
+        t.Errorf("file downloaded %d times after its checksum changed, want 2", api.downloads)
+    }
+}
+
+func TestDownloadCacheEvictsLeastRecentlyUsed(t *testing.T) {
+    service, api, cache := newCachedService(t, map[string]string{"1": "aaaa", "2": "bbbb", "3": "cccc", "4": "too large"}, 8)
+    dir := t.TempDir()
+    download := func(id string) {
+        t.Helper()
+        if err := service.DownloadFile(context.Background(), id, filepath.Join(dir, id+".zip")); err != nil {
+            t.Fatalf("download %s: %v", id, err)
+        }
+    }
+
+    download("1")
+    download("2")
+    download("1") // cache hit, so 2 becomes the least recently used
+    download("3")
+    download("4")
+
+    entries, err := os.ReadDir(cache.dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var cached []string
+    for _, entry := range entries {
+        cached = append(cached, entry.Name()[:1])
+    }
+    if len(cached) != 2 || cached[0] != "1" || cached[1] != "3" {
+        t.Errorf("cache holds %v, want files 1 and 3", cached)
+    }
+    if api.downloads != 4 {
+        t.Errorf("made %d downloads, want 4", api.downloads)
+    }
+}
@@ -0,0 +1,168 @@
+package gdrive
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+
+    "google.golang.org/api/drive/v3"
+)
+
+// ChecksumExt is appended to a backup's name to name its checksum file. The
+// checksum file is uploaded into the backup's folder, so retention deletes
+// it together with the backup.
+const ChecksumExt = ".sha256"
+
+// checksumMimeType is not matched by backupMimeQuery, so checksum files are
+// never listed as backups
+const checksumMimeType = "text/plain"
+
+// checksumSizeProperty holds the archive size on the checksum file
+const checksumSizeProperty = "size"
+
+// uploadChecksum stores the SHA-256 and size of the backup named name in a
+// checksum file inside folderID. The content uses the sha256sum format, so
+// a downloaded backup can also be checked with "sha256sum -c".
+func (s *GoogleDriveService) uploadChecksum(ctx context.Context, folderID, name, sum string, size int64) error {
+    checksumFile := &drive.File{
+        Name:       name + ChecksumExt,
+        MimeType:   checksumMimeType,
+        Parents:    []string{folderID},
+        Properties: map[string]string{checksumSizeProperty: strconv.FormatInt(size, 10)},
+    }
+    content := []byte(fmt.Sprintf("%s  %s\n", sum, name))
+
+    err := s.retry(ctx, "upload checksum", func() error {
+        _, err := s.api.CreateFile(ctx, checksumFile, bytes.NewReader(content), "id")
+        return err
+    })
+    if err != nil {
+        return fmt.Errorf("failed to upload checksum file: %v", err)
+    }
+    s.logger.Debug("Uploaded checksum file %s (sha256 %s)", checksumFile.Name, sum)
+    return nil
+}
+
+// VerifyBackup downloads the backup fileID and checks it against the SHA-256
+// and size stored in its checksum file. This does not rely on the md5Checksum
+// Drive keeps for the file. When fileID is one volume of a split backup,
+// every volume of the set is checked against its own checksum file.
+func (s *GoogleDriveService) VerifyBackup(ctx context.Context, fileID string) error {
+    var file *drive.File
+    err := s.retry(ctx, "get backup", func() (err error) {
+        file, err = s.api.GetFile(ctx, fileID, "id, name, size, parents")
+        return err
+    })
+    if err != nil {
+        return fmt.Errorf("failed to get backup file %s: %v", fileID, err)
+    }
+
+    backup, err := s.withVolumes(&DriveBackup{ID: file.Id, Name: file.Name, Size: file.Size}, file)
+    if err != nil {
+        return err
+    }
+    if len(backup.Volumes) == 0 {
+        return s.verifyFile(ctx, file)
+    }
+    for _, volume := range backup.Volumes {
+        if err := s.verifyFile(ctx, &drive.File{Id: volume.ID, Name: volume.Name, Parents: file.Parents}); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// verifyFile downloads file and checks it against its checksum file
+func (s *GoogleDriveService) verifyFile(ctx context.Context, file *drive.File) error {
+    checksumFile, err := s.findChecksumFile(ctx, file)
+    if err != nil {
+        return err
+    }
+
+    body, err := s.OpenFile(ctx, checksumFile.Id)
+    if err != nil {
+        return err
+    }
+    data, err := io.ReadAll(body)
+    body.Close()
+    if err != nil {
+        return fmt.Errorf("failed to read checksum file: %v", err)
+    }
+    expected, err := parseChecksumFile(data)
+    if err != nil {
+        return fmt.Errorf("invalid checksum file %s: %v", checksumFile.Name, err)
+    }
+
+    body, err = s.OpenFile(ctx, file.Id)
+    if err != nil {
+        return err
+    }
+    defer body.Close()
+
+    hash := sha256.New()
+    size, err := io.Copy(hash, body)
+    if err != nil {
+        return fmt.Errorf("failed to download backup: %v", err)
+    }
+
+    if value, ok := checksumFile.Properties[checksumSizeProperty]; ok {
+        if expectedSize, err := strconv.ParseInt(value, 10, 64); err == nil && expectedSize != size {
+            return fmt.Errorf("%w for %s: expected %d bytes, got %d", ErrChecksumMismatch, file.Name, expectedSize, size)
+        }
+    }
+    if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+        return fmt.Errorf("%w for %s: expected sha256 %s, got %s", ErrChecksumMismatch, file.Name, expected, actual)
+    }
+
+    s.logger.Info("Verified %s against its checksum file (sha256 %s)", file.Name, expected)
+    return nil
+}
+
+// findChecksumFile returns the checksum file stored next to file
+func (s *GoogleDriveService) findChecksumFile(ctx context.Context, file *drive.File) (*drive.File, error) {
+    if len(file.Parents) == 0 {
+        return nil, fmt.Errorf("backup %s has no parent folder", file.Name)
+    }
+
+    name := file.Name + ChecksumExt
+    query := fmt.Sprintf("name = '%s' and '%s' in parents and trashed=false",
+        escapeQueryValue(name), file.Parents[0])
+
+    var fileList *drive.FileList
+    err := s.retry(ctx, "find checksum file", func() (err error) {
+        fileList, err = s.listFiles(ctx, ListOptions{
+            Query:  query,
+            Fields: "files(id, name, parents, properties)",
+        })
+        return err
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to find checksum file: %v", err)
+    }
+
+    for _, f := range fileList.Files {
+        if f.Name == name {
+            return f, nil
+        }
+    }
+    return nil, fmt.Errorf("no checksum file found for %s", file.Name)
+}
+
+// parseChecksumFile returns the hex SHA-256 from the first line of a
+// checksum file in the sha256sum format
+func parseChecksumFile(data []byte) (string, error) {
+    fields := strings.Fields(string(data))
+    if len(fields) == 0 {
+        return "", fmt.Errorf("empty checksum file")
+    }
+    sum := strings.ToLower(fields[0])
+    if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != sha256.Size {
+        return "", fmt.Errorf("%q is not a SHA-256 checksum", fields[0])
+    }
+    return sum, nil
+}
@@ -0,0 +1,63 @@
+package gdrive
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestUploadBackupWritesVerifiableChecksum(t *testing.T) {
+    zipPath := filepath.Join(t.TempDir(), "assets_20241114_010000.zip")
+    if err := os.WriteFile(zipPath, []byte("archive content"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    api := &fakeDriveAPI{}
+    service := newFakeService(api)
+    ctx := context.Background()
+
+    backup, err := service.UploadBackup(ctx, zipPath, "assets")
+    if err != nil {
+        t.Fatalf("UploadBackup: %v", err)
+    }
+
+    var checksum string
+    for _, file := range api.files {
+        if file.Name == backup.Name+ChecksumExt {
+            checksum = string(api.contents[file.Id])
+            if file.Properties[checksumSizeProperty] != "15" {
+                t.Errorf("checksum file size property = %q, want 15", file.Properties[checksumSizeProperty])
+            }
+        }
+    }
+    // sha256sum format: "<hex>  <name>"
+    sum := sha256.Sum256([]byte("archive content"))
+    if want := hex.EncodeToString(sum[:]) + "  " + backup.Name + "\n"; checksum != want {
+        t.Errorf("checksum file content = %q, want %q", checksum, want)
+    }
+
+    if err := service.VerifyBackup(ctx, backup.ID); err != nil {
+        t.Errorf("VerifyBackup: %v", err)
+    }
+
+    api.contents[backup.ID] = []byte("archive c0ntent")
+    if err := service.VerifyBackup(ctx, backup.ID); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+        t.Errorf("VerifyBackup of a corrupted archive = %v, want a checksum mismatch", err)
+    }
+}
+
+func TestParseChecksumFile(t *testing.T) {
+    sum := strings.Repeat("ab", 32)
+    if got, err := parseChecksumFile([]byte(sum + "  backup.zip\n")); err != nil || got != sum {
+        t.Errorf("parseChecksumFile = %q, %v, want %q", got, err, sum)
+    }
+    for _, data := range []string{"", "\n", "xyz  backup.zip", strings.Repeat("ab", 16)} {
+        if _, err := parseChecksumFile([]byte(data)); err == nil {
+            t.Errorf("parseChecksumFile(%q) accepted an invalid checksum", data)
+        }
+    }
+}
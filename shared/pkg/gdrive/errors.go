@@ -0,0 +1,59 @@
+package gdrive
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+
+    "golang.org/x/oauth2"
+    "google.golang.org/api/googleapi"
+)
+
+// Errors returned by GoogleDriveService, wrapped with the details of the
+// failure. Check for them with errors.Is.
+var (
+    // ErrNoBackupFound means no backup matched the requested container,
+    // date, ID or name
+    ErrNoBackupFound = errors.New("no backup found")
+    // ErrInvalidBackup means a file was found but is not a backup this
+    // service may restore, e.g. it lies outside the configured folder
+    ErrInvalidBackup = errors.New("not a valid backup")
+    // ErrDriveAuth means the credentials or token were rejected
+    ErrDriveAuth = errors.New("google drive authentication failed")
+    // ErrDriveNotAccessible means the shared drive or folder could not be
+    // reached with valid credentials, e.g. it does not exist or is not shared
+    ErrDriveNotAccessible = errors.New("google drive not accessible")
+    // ErrDriveQuota means the shared drive has too little free space left
+    ErrDriveQuota = errors.New("not enough Drive storage")
+    // ErrChecksumMismatch means a downloaded backup differs from its
+    // checksum file
+    ErrChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// accessError wraps err, returned while reaching the shared drive or folder,
+// with ErrDriveAuth for rejected credentials and ErrDriveNotAccessible for
+// anything else
+func accessError(err error) error {
+    if isAuthError(err) {
+        return fmt.Errorf("%w: %v", ErrDriveAuth, err)
+    }
+    return fmt.Errorf("%w: %v", ErrDriveNotAccessible, err)
+}
+
+// isAuthError reports whether err is a 401 from the Drive API or a failed
+// token exchange
+func isAuthError(err error) bool {
+    var retrieveErr *oauth2.RetrieveError
+    if errors.As(err, &retrieveErr) {
+        return true
+    }
+
+    var apiErr *googleapi.Error
+    return errors.As(err, &apiErr) && apiErr.Code == http.StatusUnauthorized
+}
+
+// isNotFound reports whether err is a 404 from the Drive API
+func isNotFound(err error) bool {
+    var apiErr *googleapi.Error
+    return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
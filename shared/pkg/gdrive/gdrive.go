@@ -2,27 +2,101 @@ package gdrive
 
 import (
     "context"
+    "crypto/md5"
+    "crypto/sha256"
+    "encoding/hex"
     "encoding/json"
     "fmt"
     "io"
+    "net/http"
     "os"
     "path/filepath"
+    "regexp"
     "sort"
+    "strings"
     "time"
 
     "golang.org/x/oauth2"
     "golang.org/x/oauth2/google"
     "google.golang.org/api/drive/v3"
+    "google.golang.org/api/googleapi"
     "google.golang.org/api/option"
 
     "shared/pkg/utils"
 )
 
+// backupMimeQuery matches zip, tar.gz and tar.zst archives, encrypted (.enc) archives
+// and tree backup manifests
+const backupMimeQuery = "(mimeType='application/zip' or mimeType='application/gzip' or mimeType='application/zstd' or " +
+    "mimeType='application/x-gzip' or mimeType='application/octet-stream' or mimeType='application/json')"
+
+// backupMimeTypes are the MIME types matched by backupMimeQuery
+var backupMimeTypes = map[string]bool{
+    "application/zip":          true,
+    "application/gzip":         true,
+    "application/x-gzip":       true,
+    "application/zstd":         true,
+    "application/octet-stream": true,
+    "application/json":         true,
+}
+
+// googleAppsMimePrefix starts the MIME type of Google-native files (Docs,
+// Sheets, Slides, ...), which have no binary content and can only be exported
+const googleAppsMimePrefix = "application/vnd.google-apps."
+
+// googleNativeKinds names the common Google-native file types in errors
+var googleNativeKinds = map[string]string{
+    googleAppsMimePrefix + "document":     "Google Docs document",
+    googleAppsMimePrefix + "spreadsheet":  "Google Sheets spreadsheet",
+    googleAppsMimePrefix + "presentation": "Google Slides presentation",
+    googleAppsMimePrefix + "folder":       "folder",
+}
+
+// googleNativeKind returns a readable name for mimeType if it is the type of
+// a Google-native file, which cannot be downloaded as a backup
+func googleNativeKind(mimeType string) (string, bool) {
+    if !strings.HasPrefix(mimeType, googleAppsMimePrefix) {
+        return "", false
+    }
+    if kind, ok := googleNativeKinds[mimeType]; ok {
+        return kind, true
+    }
+    return "Google Workspace file", true
+}
+
+// googleNativeError explains why the Google-native file name cannot be
+// restored and what to do about it
+func googleNativeError(name, kind string) error {
+    return fmt.Errorf("%w: %s is a %s, which can only be exported, not downloaded; "+
+        "backups must be the archives uploaded by the backup service, so move it out of the backups folder",
+        ErrInvalidBackup, name, kind)
+}
+
+// backupFileFields are the Drive fields needed to validate a single backup
+const backupFileFields = "id, name, mimeType, createdTime, size, parents, driveId, trashed"
+
+// Supported values for DriveConfig.AuthMode
+const (
+    AuthModeAuto           = "auto"
+    AuthModeOAuth          = "oauth"
+    AuthModeServiceAccount = "service_account"
+)
+
 type DriveConfig struct {
-    CredentialsPath string
-    TokenPath       string
-    SharedDriveID   string
-    FolderID        string
+    CredentialsPath    string
+    TokenPath          string
+    TokenJSON          string             // Optional: token.json content, used instead of TokenPath
+    TokenProvider      TokenProvider      // Optional: source of the OAuth token, overrides TokenJSON and TokenPath
+    SharedDriveID      string
+    FolderID           string
+    AuthMode           string
+    ImpersonateSubject string
+    UploadChunkSize    int                // Resumable upload chunk size in bytes, 0 uses the library default
+    MaxRetries         int                // Retries for rate-limited or failed Drive API calls
+    QuotaCheck         bool               // Check the free space of the authenticated account before uploading
+    ListPageSize       int                // Files per page of list calls, 0 uses the Drive default
+    Progress           utils.ProgressSink // Optional: receives upload progress, defaults to logging it
+    DownloadCache      *DownloadCache     // Optional: reuses recently downloaded files instead of fetching them again
 }
 
 type DriveBackup struct {
@@ -30,12 +104,14 @@ type DriveBackup struct {
     Name        string
     CreatedTime time.Time
     Size        int64
+    Volumes     []*DriveBackup // Parts of a backup split into volumes, in order; nil for a single file
 }
 
 type GoogleDriveService struct {
-    service *drive.Service
-    config  *DriveConfig
-    logger  *utils.Logger
+    api      DriveAPI
+    config   *DriveConfig
+    logger   *utils.Logger
+    progress utils.ProgressSink
 }
 
 func NewGoogleDriveService(cfg *DriveConfig, logger *utils.Logger) (*GoogleDriveService, error) {
@@ -43,40 +119,61 @@ func NewGoogleDriveService(cfg *DriveConfig, logger *utils.Logger) (*GoogleDrive
 
     b, err := os.ReadFile(cfg.CredentialsPath)
     if err != nil {
-        return nil, fmt.Errorf("unable to read credentials file: %v", err)
+        return nil, fmt.Errorf("%w: unable to read credentials file: %v", ErrDriveAuth, err)
     }
 
-    config, err := google.ConfigFromJSON(b, drive.DriveScope)
+    tokenSource, err := newTokenSource(ctx, cfg, b, logger)
     if err != nil {
-        return nil, fmt.Errorf("unable to parse credentials: %v", err)
+        return nil, fmt.Errorf("%w: %v", ErrDriveAuth, err)
     }
 
-    token, err := loadToken(cfg.TokenPath)
+    service, err := drive.NewService(ctx, option.WithTokenSource(tokenSource))
     if err != nil {
-        return nil, fmt.Errorf("unable to load token: %v", err)
+        return nil, fmt.Errorf("unable to create drive service: %v", err)
     }
 
-    service, err := drive.NewService(ctx,
-        option.WithTokenSource(config.TokenSource(ctx, token)))
-    if err != nil {
-        return nil, fmt.Errorf("unable to create drive service: %v", err)
+    return newVerifiedService(ctx, NewDriveAPI(service, cfg.SharedDriveID), cfg, logger)
+}
+
+// NewGoogleDriveServiceWithAPI returns a GoogleDriveService that talks to
+// Drive through api, without checking access first. Tests use it with a fake.
+func NewGoogleDriveServiceWithAPI(api DriveAPI, cfg *DriveConfig, logger *utils.Logger) *GoogleDriveService {
+    var progress utils.ProgressSink = utils.NewLogProgressSink(logger, "Uploading")
+    if cfg.Progress != nil {
+        progress = cfg.Progress
     }
 
+    return &GoogleDriveService{
+        api:      api,
+        config:   cfg,
+        logger:   logger,
+        progress: progress,
+    }
+}
+
+// newVerifiedService checks that the shared drive and, when set, the folder
+// are reachable through api before returning the service
+func newVerifiedService(ctx context.Context, api DriveAPI, cfg *DriveConfig, logger *utils.Logger) (*GoogleDriveService, error) {
     // Verify Shared Drive access
-    drive, err := service.Drives.Get(cfg.SharedDriveID).Do()
+    var sharedDrive *drive.Drive
+    err := withRetry(ctx, cfg.MaxRetries, logger, "get shared drive", func() (err error) {
+        sharedDrive, err = api.GetDrive(ctx)
+        return err
+    })
     if err != nil {
-        return nil, fmt.Errorf("failed to access shared drive: %v", err)
+        return nil, fmt.Errorf("failed to access shared drive: %w", accessError(err))
     }
-    logger.Info("Connected to Shared Drive: %s", drive.Name)
+    logger.Info("Connected to Shared Drive: %s", sharedDrive.Name)
 
     // Verify folder access if specified
     if cfg.FolderID != "" {
-        folder, err := service.Files.Get(cfg.FolderID).
-            SupportsAllDrives(true).
-            Fields("id, name, parents").
-            Do()
+        var folder *drive.File
+        err := withRetry(ctx, cfg.MaxRetries, logger, "get folder", func() (err error) {
+            folder, err = api.GetFile(ctx, cfg.FolderID, "id, name, parents")
+            return err
+        })
         if err != nil {
-            return nil, fmt.Errorf("failed to access specified folder: %v", err)
+            return nil, fmt.Errorf("failed to access specified folder: %w", accessError(err))
         }
 
         var inSharedDrive bool
@@ -87,53 +184,117 @@ func NewGoogleDriveService(cfg *DriveConfig, logger *utils.Logger) (*GoogleDrive
             }
         }
         if !inSharedDrive {
-            return nil, fmt.Errorf("specified folder is not in the configured shared drive")
+            return nil, fmt.Errorf("%w: specified folder is not in the configured shared drive", ErrDriveNotAccessible)
         }
         logger.Info("Using folder: %s", folder.Name)
     }
 
-    return &GoogleDriveService{
-        service: service,
-        config:  cfg,
-        logger:  logger,
-    }, nil
+    return NewGoogleDriveServiceWithAPI(api, cfg, logger), nil
 }
 
-func loadToken(path string) (*oauth2.Token, error) {
-    f, err := os.Open(path)
-    if err != nil {
-        return nil, err
+// newTokenSource builds the token source for the configured auth mode.
+// In auto mode, a credentials file with "type": "service_account" selects
+// the service account flow, anything else falls back to OAuth + token.json.
+func newTokenSource(ctx context.Context, cfg *DriveConfig, credentials []byte, logger *utils.Logger) (oauth2.TokenSource, error) {
+    mode := cfg.AuthMode
+    if mode == "" || mode == AuthModeAuto {
+        mode = AuthModeOAuth
+        if isServiceAccount(credentials) {
+            mode = AuthModeServiceAccount
+        }
     }
-    defer f.Close()
 
-    token := &oauth2.Token{}
-    err = json.NewDecoder(f).Decode(token)
-    return token, err
+    switch mode {
+    case AuthModeServiceAccount:
+        jwtConfig, err := google.JWTConfigFromJSON(credentials, drive.DriveScope)
+        if err != nil {
+            return nil, fmt.Errorf("unable to parse service account credentials: %v", err)
+        }
+        jwtConfig.Subject = cfg.ImpersonateSubject
+        if cfg.ImpersonateSubject != "" {
+            logger.Info("Using service account %s impersonating %s", jwtConfig.Email, cfg.ImpersonateSubject)
+        } else {
+            logger.Info("Using service account %s", jwtConfig.Email)
+        }
+        return jwtConfig.TokenSource(ctx), nil
+
+    case AuthModeOAuth:
+        config, err := google.ConfigFromJSON(credentials, drive.DriveScope)
+        if err != nil {
+            return nil, fmt.Errorf("unable to parse credentials: %v", err)
+        }
+
+        provider := tokenProvider(cfg)
+        token, err := provider.Token()
+        if err != nil {
+            return nil, fmt.Errorf("unable to load token: %v", err)
+        }
+
+        // Tokens read from TokenPath are written back when refreshed;
+        // other providers own their storage
+        if fileProvider, ok := provider.(FileTokenProvider); ok {
+            return &persistingTokenSource{
+                base:   config.TokenSource(ctx, token),
+                path:   fileProvider.Path,
+                logger: logger,
+                last:   token,
+            }, nil
+        }
+        return config.TokenSource(ctx, token), nil
+
+    default:
+        return nil, fmt.Errorf("unsupported auth mode: %s", cfg.AuthMode)
+    }
+}
+
+func isServiceAccount(credentials []byte) bool {
+    var f struct {
+        Type string `json:"type"`
+    }
+    if err := json.Unmarshal(credentials, &f); err != nil {
+        return false
+    }
+    return f.Type == "service_account"
+}
+
+// listFiles lists one page of files with the configured page size
+func (s *GoogleDriveService) listFiles(ctx context.Context, opts ListOptions) (*drive.FileList, error) {
+    opts.PageSize = int64(s.config.ListPageSize)
+    return s.api.ListFiles(ctx, opts)
 }
 
 func (s *GoogleDriveService) ListAvailableBackups() ([]*DriveBackup, error) {
-    query := "mimeType='application/zip' and trashed=false"
+    query := backupMimeQuery + " and trashed=false"
+
+    parents, err := s.backupParents()
+    if err != nil {
+        return nil, err
+    }
 
     var backups []*DriveBackup
     pageToken := ""
 
     for {
-        fileList, err := s.service.Files.List().
-            Q(query).
-            OrderBy("createdTime desc").
-            PageToken(pageToken).
-            SupportsAllDrives(true).
-            IncludeItemsFromAllDrives(true).
-            Corpora("drive").
-            DriveId(s.config.SharedDriveID).
-            Fields("nextPageToken, files(id, name, createdTime, size, parents)").
-            Do()
+        var fileList *drive.FileList
+        err := s.retry(context.Background(), "list backups", func() (err error) {
+            fileList, err = s.listFiles(context.Background(), ListOptions{
+                Query:     query,
+                OrderBy:   "createdTime desc",
+                PageToken: pageToken,
+                Fields:    "nextPageToken, files(id, name, mimeType, createdTime, size, parents)",
+            })
+            return err
+        })
 
         if err != nil {
             return nil, fmt.Errorf("failed to list backup files: %v", err)
         }
 
-        for _, file := range fileList.Files {
+        for _, file := range filterByParents(fileList.Files, parents) {
+            if kind, native := googleNativeKind(file.MimeType); native {
+                s.logger.Warn("Skipping %s: it is a %s, not a backup archive", file.Name, kind)
+                continue
+            }
             createdTime, err := time.Parse(time.RFC3339, file.CreatedTime)
             if err != nil {
                 s.logger.Warn("Failed to parse creation time for %s: %v", file.Name, err)
@@ -157,16 +318,17 @@ func (s *GoogleDriveService) ListAvailableBackups() ([]*DriveBackup, error) {
             break
         }
     }
+    backups = groupVolumes(backups)
 
     if len(backups) == 0 {
         // List all files for debugging
-        allFiles, err := s.service.Files.List().
-            SupportsAllDrives(true).
-            IncludeItemsFromAllDrives(true).
-            Corpora("drive").
-            DriveId(s.config.SharedDriveID).
-            Fields("files(id, name, mimeType, parents)").
-            Do()
+        var allFiles *drive.FileList
+        err := s.retry(context.Background(), "list files", func() (err error) {
+            allFiles, err = s.listFiles(context.Background(), ListOptions{
+                Fields: "files(id, name, mimeType, parents)",
+            })
+            return err
+        })
         if err != nil {
             s.logger.Error("Failed to list all files: %v", err)
         } else {
@@ -175,7 +337,7 @@ func (s *GoogleDriveService) ListAvailableBackups() ([]*DriveBackup, error) {
                 s.logger.Info("- Name: %s, Type: %s, Parent: %v", f.Name, f.MimeType, f.Parents)
             }
         }
-        return nil, fmt.Errorf("no backup files found in drive")
+        return nil, fmt.Errorf("%w in drive", ErrNoBackupFound)
     }
 
     // Sort backups by time (newest first)
@@ -188,33 +350,22 @@ func (s *GoogleDriveService) ListAvailableBackups() ([]*DriveBackup, error) {
 
 func (s *GoogleDriveService) GetLatestBackup(containerName string) (*DriveBackup, error) {
     query := fmt.Sprintf(
-        "mimeType='application/zip' and name contains '%s' and name contains '.zip' and trashed=false",
-        containerName,
+        "%s and name contains '%s' and trashed=false",
+        backupMimeQuery, containerName,
     )
 
     s.logger.Debug("Searching for backups with query: %s", query)
-    fileList, err := s.service.Files.List().
-        Q(query).
-        OrderBy("createdTime desc").
-        PageSize(1).
-        SupportsAllDrives(true).
-        IncludeItemsFromAllDrives(true).
-        Corpora("drive").
-        DriveId(s.config.SharedDriveID).
-        Fields("files(id, name, createdTime, size, parents)").
-        Do()
-
+    file, err := s.findContainerBackup(query, containerName)
     if err != nil {
-        return nil, fmt.Errorf("failed to list backup files: %v", err)
+        return nil, err
     }
 
-    if len(fileList.Files) == 0 {
+    if file == nil {
         s.logger.Debug("No backups found. Checking available files...")
         s.ListAvailableBackups()
-        return nil, fmt.Errorf("no backup files found for container: %s", containerName)
+        return nil, fmt.Errorf("%w for container: %s", ErrNoBackupFound, containerName)
     }
 
-    file := fileList.Files[0]
     createdTime, err := time.Parse(time.RFC3339, file.CreatedTime)
     if err != nil {
         return nil, fmt.Errorf("failed to parse creation time: %v", err)
@@ -225,12 +376,12 @@ func (s *GoogleDriveService) GetLatestBackup(containerName string) (*DriveBackup
         createdTime.Format(time.RFC3339),
         utils.FormatBytes(file.Size))
 
-    return &DriveBackup{
+    return s.withVolumes(&DriveBackup{
         ID:          file.Id,
         Name:        file.Name,
         CreatedTime: createdTime,
         Size:        file.Size,
-    }, nil
+    }, file)
 }
 
 func (s *GoogleDriveService) GetBackupFromDate(date time.Time, containerName string) (*DriveBackup, error) {
@@ -238,34 +389,24 @@ func (s *GoogleDriveService) GetBackupFromDate(date time.Time, containerName str
     endDate := date.Add(24*time.Hour).Format("2006-01-02") + "T00:00:00Z"
 
     query := fmt.Sprintf(
-        "mimeType='application/zip' and name contains '%s' and name contains '.zip' "+
+        "%s and name contains '%s' "+
             "and createdTime >= '%s' and createdTime < '%s' and trashed=false",
-        containerName, startDate, endDate,
+        backupMimeQuery, containerName, startDate, endDate,
     )
 
     s.logger.Debug("Searching for backups with query: %s", query)
-    fileList, err := s.service.Files.List().
-        Q(query).
-        OrderBy("createdTime desc").
-        SupportsAllDrives(true).
-        IncludeItemsFromAllDrives(true).
-        Corpora("drive").
-        DriveId(s.config.SharedDriveID).
-        Fields("files(id, name, createdTime, size)").
-        Do()
-
+    file, err := s.findContainerBackup(query, containerName)
     if err != nil {
-        return nil, fmt.Errorf("failed to list backup files: %v", err)
+        return nil, err
     }
 
-    if len(fileList.Files) == 0 {
+    if file == nil {
         s.logger.Debug("No backups found. Checking available files...")
         s.ListAvailableBackups()
-        return nil, fmt.Errorf("no backup found for container %s on date %s",
+        return nil, fmt.Errorf("%w for container %s on date %s", ErrNoBackupFound,
             containerName, date.Format("2006-01-02"))
     }
 
-    file := fileList.Files[0]
     createdTime, err := time.Parse(time.RFC3339, file.CreatedTime)
     if err != nil {
         return nil, fmt.Errorf("failed to parse creation time: %v", err)
@@ -276,21 +417,433 @@ func (s *GoogleDriveService) GetBackupFromDate(date time.Time, containerName str
         file.Name,
         utils.FormatBytes(file.Size))
 
-    return &DriveBackup{
+    return s.withVolumes(&DriveBackup{
         ID:          file.Id,
         Name:        file.Name,
         CreatedTime: createdTime,
         Size:        file.Size,
-    }, nil
+    }, file)
+}
+
+// GetBackupBefore returns the newest full backup of containerName created at
+// or before the given instant
+func (s *GoogleDriveService) GetBackupBefore(before time.Time, containerName string) (*DriveBackup, error) {
+    query := fmt.Sprintf(
+        "%s and name contains '%s' and createdTime <= '%s' and trashed=false",
+        backupMimeQuery, containerName, before.UTC().Format(time.RFC3339),
+    )
+
+    s.logger.Debug("Searching for backups with query: %s", query)
+    file, err := s.findContainerBackup(query, containerName)
+    if err != nil {
+        return nil, err
+    }
+
+    if file == nil {
+        return nil, fmt.Errorf("%w for container %s at or before %s", ErrNoBackupFound,
+            containerName, before.UTC().Format(time.RFC3339))
+    }
+
+    createdTime, err := time.Parse(time.RFC3339, file.CreatedTime)
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse creation time: %v", err)
+    }
+
+    s.logger.Info("Found backup at or before %s: %s (Created: %s, Size: %s)",
+        before.UTC().Format(time.RFC3339),
+        file.Name,
+        createdTime.Format(time.RFC3339),
+        utils.FormatBytes(file.Size))
+
+    return s.withVolumes(&DriveBackup{
+        ID:          file.Id,
+        Name:        file.Name,
+        CreatedTime: createdTime,
+        Size:        file.Size,
+    }, file)
+}
+
+// GetBackupByID returns the backup archive with the given Drive file ID
+func (s *GoogleDriveService) GetBackupByID(fileID string) (*DriveBackup, error) {
+    var file *drive.File
+    err := s.retry(context.Background(), "get backup", func() (err error) {
+        file, err = s.api.GetFile(context.Background(), fileID, backupFileFields)
+        return err
+    })
+    if isNotFound(err) {
+        return nil, fmt.Errorf("%w with ID %s", ErrNoBackupFound, fileID)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get backup file %s: %v", fileID, err)
+    }
+
+    return s.validateBackupFile(file)
+}
+
+// GetBackupByName returns the backup archive named exactly name. If several
+// files share the name, the newest one is used. The name of a backup split
+// into volumes finds the whole volume set.
+func (s *GoogleDriveService) GetBackupByName(name string) (*DriveBackup, error) {
+    parents, err := s.backupParents()
+    if err != nil {
+        return nil, err
+    }
+
+    query := fmt.Sprintf("(name = '%s' or name = '%s') and trashed=false",
+        escapeQueryValue(name), escapeQueryValue(utils.VolumeName(name, 1)))
+    var fileList *drive.FileList
+    err = s.retry(context.Background(), "find backup", func() (err error) {
+        fileList, err = s.listFiles(context.Background(), ListOptions{
+            Query:   query,
+            OrderBy: "createdTime desc",
+            Fields:  "files(" + backupFileFields + ")",
+        })
+        return err
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to find backup %s: %v", name, err)
+    }
+
+    files := filterByParents(fileList.Files, parents)
+    if len(files) == 0 {
+        return nil, fmt.Errorf("%w named %s", ErrNoBackupFound, name)
+    }
+    if len(files) > 1 {
+        s.logger.Warn("Found %d files named %s, using the newest (%s)", len(files), name, files[0].Id)
+    }
+
+    return s.validateBackupFile(files[0])
+}
+
+// validateBackupFile checks that file is a backup archive in the configured
+// shared drive and folder before it is downloaded
+func (s *GoogleDriveService) validateBackupFile(file *drive.File) (*DriveBackup, error) {
+    if file.DriveId != s.config.SharedDriveID {
+        return nil, fmt.Errorf("%w: file %s is not in the configured shared drive", ErrInvalidBackup, file.Name)
+    }
+    if file.Trashed {
+        return nil, fmt.Errorf("%w: file %s is in the trash", ErrInvalidBackup, file.Name)
+    }
+
+    parents, err := s.backupParents()
+    if err != nil {
+        return nil, err
+    }
+    if len(filterByParents([]*drive.File{file}, parents)) == 0 {
+        return nil, fmt.Errorf("%w: file %s is not in the configured folder", ErrInvalidBackup, file.Name)
+    }
+
+    if kind, native := googleNativeKind(file.MimeType); native {
+        return nil, googleNativeError(file.Name, kind)
+    }
+    if !backupMimeTypes[file.MimeType] {
+        return nil, fmt.Errorf("%w: file %s is not a backup archive (type %s)", ErrInvalidBackup, file.Name, file.MimeType)
+    }
+    if _, _, ok := ParseBackupName(file.Name); !ok {
+        return nil, fmt.Errorf("%w: file %s does not follow the <container>_<YYYYMMDD>_<HHMMSS> backup naming", ErrInvalidBackup, file.Name)
+    }
+
+    createdTime, err := time.Parse(time.RFC3339, file.CreatedTime)
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse creation time: %v", err)
+    }
+
+    s.logger.Info("Found backup: %s (Created: %s, Size: %s)",
+        file.Name,
+        createdTime.Format(time.RFC3339),
+        utils.FormatBytes(file.Size))
+
+    return s.withVolumes(&DriveBackup{
+        ID:          file.Id,
+        Name:        file.Name,
+        CreatedTime: createdTime,
+        Size:        file.Size,
+    }, file)
+}
+
+// escapeQueryValue escapes a value for use inside single quotes in a Drive query
+func escapeQueryValue(value string) string {
+    return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+}
+
+// findContainerBackup pages through the query results (newest first) and
+// returns the first file whose name belongs exactly to containerName.
+// Drive's "name contains" also matches containers sharing a prefix, so the
+// results are filtered against the <container>_<timestamp> naming convention.
+func (s *GoogleDriveService) findContainerBackup(query string, containerName string) (*drive.File, error) {
+    parents, err := s.backupParents()
+    if err != nil {
+        return nil, err
+    }
+
+    pageToken := ""
+    for {
+        var fileList *drive.FileList
+        err := s.retry(context.Background(), "list backups", func() (err error) {
+            fileList, err = s.listFiles(context.Background(), ListOptions{
+                Query:     query,
+                OrderBy:   "createdTime desc",
+                PageToken: pageToken,
+                Fields:    "nextPageToken, files(id, name, createdTime, size, parents)",
+            })
+            return err
+        })
+        if err != nil {
+            return nil, fmt.Errorf("failed to list backup files: %v", err)
+        }
+
+        if file := selectContainerBackup(filterByParents(fileList.Files, parents), containerName); file != nil {
+            return file, nil
+        }
+
+        pageToken = fileList.NextPageToken
+        if pageToken == "" {
+            return nil, nil
+        }
+    }
+}
+
+// backupParents returns the folders backups may live in when FolderID is
+// set: FolderID itself and the backup folders created directly inside it.
+// Drive cannot query by ancestor, so results are filtered on their parent.
+// A nil map means backups are not scoped to a folder.
+func (s *GoogleDriveService) backupParents() (map[string]bool, error) {
+    if s.config.FolderID == "" {
+        return nil, nil
+    }
+
+    parents := map[string]bool{s.config.FolderID: true}
+    query := fmt.Sprintf("mimeType='application/vnd.google-apps.folder' and '%s' in parents and trashed=false",
+        s.config.FolderID)
+
+    pageToken := ""
+    for {
+        var fileList *drive.FileList
+        err := s.retry(context.Background(), "list backup folders", func() (err error) {
+            fileList, err = s.listFiles(context.Background(), ListOptions{
+                Query:     query,
+                PageToken: pageToken,
+                Fields:    "nextPageToken, files(id)",
+            })
+            return err
+        })
+        if err != nil {
+            return nil, fmt.Errorf("failed to list folders in %s: %v", s.config.FolderID, err)
+        }
+
+        for _, folder := range fileList.Files {
+            parents[folder.Id] = true
+        }
+
+        pageToken = fileList.NextPageToken
+        if pageToken == "" {
+            return parents, nil
+        }
+    }
+}
+
+// StoredBytes returns the total size of every file below the folder backups
+// are stored in, FolderID or else the shared drive root: archives and all
+// their volumes, checksum files and the files of tree backups. Drive cannot
+// query by ancestor, so the folders are walked one by one.
+func (s *GoogleDriveService) StoredBytes(ctx context.Context) (int64, error) {
+    root := s.config.FolderID
+    if root == "" {
+        root = s.config.SharedDriveID
+    }
+
+    var total int64
+    seen := map[string]bool{root: true}
+    folders := []string{root}
+    for len(folders) > 0 {
+        folderID := folders[0]
+        folders = folders[1:]
+
+        query := fmt.Sprintf("'%s' in parents and trashed=false", folderID)
+        pageToken := ""
+        for {
+            var fileList *drive.FileList
+            err := s.retry(ctx, "list stored files", func() (err error) {
+                fileList, err = s.listFiles(ctx, ListOptions{
+                    Query:     query,
+                    PageToken: pageToken,
+                    Fields:    "nextPageToken, files(id, mimeType, size)",
+                })
+                return err
+            })
+            if err != nil {
+                return 0, fmt.Errorf("failed to list files in %s: %v", folderID, err)
+            }
+
+            for _, file := range fileList.Files {
+                if seen[file.Id] {
+                    continue
+                }
+                seen[file.Id] = true
+                if file.MimeType == folderMimeType {
+                    folders = append(folders, file.Id)
+                } else {
+                    total += file.Size
+                }
+            }
+
+            pageToken = fileList.NextPageToken
+            if pageToken == "" {
+                break
+            }
+        }
+    }
+    return total, nil
+}
+
+// filterByParents keeps the files that have one of the given parents. A nil
+// parents map keeps every file.
+func filterByParents(files []*drive.File, parents map[string]bool) []*drive.File {
+    if parents == nil {
+        return files
+    }
+    var filtered []*drive.File
+    for _, file := range files {
+        for _, parent := range file.Parents {
+            if parents[parent] {
+                filtered = append(filtered, file)
+                break
+            }
+        }
+    }
+    return filtered
+}
+
+// selectContainerBackup returns the first file that is a full backup of exactly containerName
+func selectContainerBackup(files []*drive.File, containerName string) *drive.File {
+    for _, file := range files {
+        if IsIncrementalBackup(file.Name) {
+            continue
+        }
+        if name, _, ok := ParseBackupName(file.Name); ok && name == containerName {
+            return file
+        }
+    }
+    return nil
+}
+
+// IncrementalPrefix marks archives holding only the blobs changed since the
+// previous backup. Azure container names cannot contain "_", so the prefix
+// never clashes with a container name.
+const IncrementalPrefix = "inc_"
+
+// IsIncrementalBackup reports whether name is an incremental backup archive
+func IsIncrementalBackup(name string) bool {
+    return strings.HasPrefix(name, IncrementalPrefix)
+}
+
+// backupNamePattern matches names produced by the backup service:
+// [inc_]<container>_<YYYYMMDD>_<HHMMSS>.zip|.tar.gz|.tar.zst|.tree, optionally
+// followed by .enc and by the .001, .002, ... suffix of a volume
+var backupNamePattern = regexp.MustCompile(`^(?:inc_)?(.+)_(\d{8}_\d{6})\.(zip|tar\.gz|tar\.zst|tree)(\.enc)?(?:\.\d{3,})?$`)
+
+// ParseBackupName extracts the container name and timestamp from a full or
+// incremental backup file name
+func ParseBackupName(name string) (string, time.Time, bool) {
+    m := backupNamePattern.FindStringSubmatch(name)
+    if m == nil {
+        return "", time.Time{}, false
+    }
+    ts, err := time.Parse("20060102_150405", m[2])
+    if err != nil {
+        return "", time.Time{}, false
+    }
+    return m[1], ts, true
+}
+
+// GetIncrementalBackups returns the incremental backups of containerName
+// created after the given time and, unless until is zero, before until.
+// They are returned oldest first, in the order they must be applied.
+func (s *GoogleDriveService) GetIncrementalBackups(containerName string, after, until time.Time) ([]*DriveBackup, error) {
+    query := fmt.Sprintf(
+        "%s and name contains '%s%s_' and createdTime > '%s' and trashed=false",
+        backupMimeQuery, IncrementalPrefix, containerName, after.UTC().Format(time.RFC3339),
+    )
+    if !until.IsZero() {
+        query += fmt.Sprintf(" and createdTime < '%s'", until.UTC().Format(time.RFC3339))
+    }
+
+    parents, err := s.backupParents()
+    if err != nil {
+        return nil, err
+    }
+
+    var backups []*DriveBackup
+    pageToken := ""
+    for {
+        var fileList *drive.FileList
+        err := s.retry(context.Background(), "list incremental backups", func() (err error) {
+            fileList, err = s.listFiles(context.Background(), ListOptions{
+                Query:     query,
+                OrderBy:   "createdTime",
+                PageToken: pageToken,
+                Fields:    "nextPageToken, files(id, name, createdTime, size, parents)",
+            })
+            return err
+        })
+        if err != nil {
+            return nil, fmt.Errorf("failed to list incremental backups: %v", err)
+        }
+
+        for _, file := range filterByParents(fileList.Files, parents) {
+            if name, _, ok := ParseBackupName(file.Name); !ok || name != containerName || !IsIncrementalBackup(file.Name) {
+                continue
+            }
+            createdTime, err := time.Parse(time.RFC3339, file.CreatedTime)
+            if err != nil {
+                s.logger.Warn("Failed to parse creation time for %s: %v", file.Name, err)
+                continue
+            }
+            backups = append(backups, &DriveBackup{
+                ID:          file.Id,
+                Name:        file.Name,
+                CreatedTime: createdTime,
+                Size:        file.Size,
+            })
+        }
+
+        pageToken = fileList.NextPageToken
+        if pageToken == "" {
+            return groupVolumes(backups), nil
+        }
+    }
 }
 
 func (s *GoogleDriveService) DownloadFile(ctx context.Context, fileID string, destinationPath string) error {
     startTime := time.Now()
     s.logger.Info("Starting download of file: %s", fileID)
 
-    res, err := s.service.Files.Get(fileID).
-        SupportsAllDrives(true).
-        Download()
+    // Fetch checksum and size so the download can be verified
+    var meta *drive.File
+    err := s.retry(ctx, "get file metadata", func() (err error) {
+        meta, err = s.api.GetFile(ctx, fileID, "id, name, mimeType, size, md5Checksum")
+        return err
+    })
+    if err != nil {
+        return fmt.Errorf("failed to get file metadata: %v", err)
+    }
+    // Google-native files have no content to download; the API would only
+    // answer with an opaque 403 asking for an export
+    if kind, native := googleNativeKind(meta.MimeType); native {
+        return googleNativeError(meta.Name, kind)
+    }
+
+    cache := s.config.DownloadCache
+    if cache != nil && meta.Md5Checksum != "" && cache.Fetch(fileID, meta.Md5Checksum, destinationPath) {
+        s.logger.Info("Using cached copy of %s (%s)", meta.Name, utils.FormatBytes(meta.Size))
+        return nil
+    }
+
+    var res *http.Response
+    err = s.retry(ctx, "download file", func() (err error) {
+        res, err = s.api.Download(ctx, fileID)
+        return err
+    })
     if err != nil {
         return fmt.Errorf("failed to download file: %v", err)
     }
@@ -302,7 +855,8 @@ func (s *GoogleDriveService) DownloadFile(ctx context.Context, fileID string, de
         return fmt.Errorf("failed to create temp file: %v", err)
     }
 
-    written, err := io.Copy(out, res.Body)
+    hash := md5.New()
+    written, err := io.Copy(io.MultiWriter(out, hash), res.Body)
     out.Close()
 
     if err != nil {
@@ -310,12 +864,34 @@ func (s *GoogleDriveService) DownloadFile(ctx context.Context, fileID string, de
         return fmt.Errorf("failed to save file: %v", err)
     }
 
+    // Verify integrity before replacing the destination
+    if meta.Md5Checksum != "" {
+        actual := hex.EncodeToString(hash.Sum(nil))
+        if actual != meta.Md5Checksum {
+            os.Remove(tempPath)
+            return fmt.Errorf("checksum mismatch for %s: expected md5 %s, got %s",
+                meta.Name, meta.Md5Checksum, actual)
+        }
+        s.logger.Debug("Checksum verified: %s", actual)
+    } else if written != meta.Size {
+        os.Remove(tempPath)
+        return fmt.Errorf("size mismatch for %s: expected %d bytes, got %d",
+            meta.Name, meta.Size, written)
+    }
+
     // Atomic rename
     if err := os.Rename(tempPath, destinationPath); err != nil {
         os.Remove(tempPath)
         return fmt.Errorf("failed to rename temp file: %v", err)
     }
 
+    // A failure to cache only costs the next restore a download
+    if cache != nil && meta.Md5Checksum != "" {
+        if err := cache.Store(fileID, meta.Md5Checksum, destinationPath, written); err != nil {
+            s.logger.Warn("%v", err)
+        }
+    }
+
     duration := time.Since(startTime)
     speed := float64(written) / duration.Seconds() / 1024 / 1024 // MB/s
     s.logger.Info("Download completed: %s (%.2f MB/s)", utils.FormatBytes(written), speed)
@@ -323,110 +899,320 @@ func (s *GoogleDriveService) DownloadFile(ctx context.Context, fileID string, de
     return nil
 }
 
-func (s *GoogleDriveService) UploadBackup(ctx context.Context, zipPath string, containerName string) error {
-    // Create folder name with timestamp
-    folderName := fmt.Sprintf("backup_%s_%s", containerName, time.Now().Format("20060102_150405"))
-
-    // Create folder in Drive
-    folder := &drive.File{
-        Name:     folderName,
-        MimeType: "application/vnd.google-apps.folder",
+// UploadBackup uploads the archive at zipPath into a new backup folder and
+// returns the created Drive file. The folder is removed again if the upload fails.
+func (s *GoogleDriveService) UploadBackup(ctx context.Context, zipPath string, containerName string) (_ *DriveBackup, err error) {
+    file, err := os.Open(zipPath)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open zip file: %v", err)
     }
+    defer file.Close()
 
-    if s.config.SharedDriveID != "" {
-        folder.Parents = []string{s.config.SharedDriveID}
-        if s.config.FolderID != "" {
-            folder.Parents = []string{s.config.FolderID}
-        }
+    fileInfo, err := file.Stat()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get file info: %v", err)
     }
 
-    createdFolder, err := s.service.Files.Create(folder).
-        SupportsAllDrives(true).
-        Fields("id, name").
-        Do()
-    if err != nil {
-        return fmt.Errorf("failed to create folder: %v", err)
+    // Checked before the folder is created, so a full drive leaves nothing behind
+    if err := s.checkQuota(fileInfo.Size()); err != nil {
+        return nil, err
     }
 
-    // Upload zip file
-    file, err := os.Open(zipPath)
+    createdFolder, err := s.createBackupFolder(containerName)
     if err != nil {
-        return fmt.Errorf("failed to open zip file: %v", err)
+        return nil, err
     }
-    defer file.Close()
+    defer func() {
+        if err != nil {
+            s.removeFailedUpload(createdFolder)
+        }
+    }()
 
-    fileInfo, err := file.Stat()
+    startTime := time.Now()
+    result, err := s.uploadArchive(ctx, file, fileInfo.Size(), filepath.Base(zipPath), createdFolder.Id)
     if err != nil {
-        return fmt.Errorf("failed to get file info: %v", err)
+        return nil, err
     }
 
+    return &DriveBackup{
+        ID:          result.Id,
+        Name:        result.Name,
+        CreatedTime: startTime,
+        Size:        fileInfo.Size(),
+    }, nil
+}
+
+// uploadArchive uploads size bytes read from r into folderID under the file
+// name name, along with its checksum file, retrying failed uploads
+func (s *GoogleDriveService) uploadArchive(ctx context.Context, r io.ReadSeeker, size int64, name, folderID string) (*drive.File, error) {
     zipFile := &drive.File{
-        Name:    filepath.Base(zipPath),
-        Parents: []string{createdFolder.Id},
+        Name:     name,
+        MimeType: archiveMimeType(name),
+        Parents:  []string{folderID},
     }
 
     startTime := time.Now()
-    s.logger.Info("Starting upload of %s (%s)", filepath.Base(zipPath), utils.FormatBytes(fileInfo.Size()))
+    s.logger.Info("Starting upload of %s (%s)", name, utils.FormatBytes(size))
 
     // Create progress reader
     progressReader := &utils.ProgressReader{
-        Reader: file,
-        Total:  fileInfo.Size(),
-        OnProgress: func(uploaded, total int64) {
-            if uploaded == total {
-                return // Skip 100% progress
-            }
-            percent := float64(uploaded) / float64(total) * 100
-            elapsed := time.Since(startTime)
-            speed := float64(uploaded) / elapsed.Seconds() / 1024 / 1024 // MB/s
-            s.logger.Info("Upload progress: %.1f%% (%.2f MB/s)", percent, speed)
-        },
+        Reader: r,
+        Name:   zipFile.Name,
+        Total:  size,
+        Sink:   s.progress,
     }
+    defer progressReader.Done()
+
+    var result *drive.File
+    err := s.retry(ctx, "upload file", func() (err error) {
+        // Rewind so a retried upload sends the whole file again
+        if _, err := r.Seek(0, io.SeekStart); err != nil {
+            return err
+        }
+        progressReader.Reset()
 
-    result, err := s.service.Files.Create(zipFile).
-        Media(progressReader).
-        SupportsAllDrives(true).
-        Do()
+        result, err = s.api.CreateFile(ctx, zipFile, progressReader, "", s.uploadMediaOptions()...)
+        return err
+    })
     if err != nil {
-        return fmt.Errorf("upload failed: %v", err)
+        return nil, fmt.Errorf("upload failed: %v", err)
     }
 
     duration := time.Since(startTime)
-    speed := float64(fileInfo.Size()) / duration.Seconds() / 1024 / 1024 // MB/s
+    speed := float64(size) / duration.Seconds() / 1024 / 1024 // MB/s
 
     s.logger.Info("Upload completed: %s (%s, %.2f MB/s)",
         result.Name,
-        utils.FormatBytes(fileInfo.Size()),
+        utils.FormatBytes(size),
         speed)
+
+    // The checksum is an extra integrity trail; the backup itself is complete
+    if _, err := r.Seek(0, io.SeekStart); err != nil {
+        s.logger.Warn("Failed to compute checksum of %s: %v", result.Name, err)
+    } else if sum, err := utils.ReaderSHA256(r); err != nil {
+        s.logger.Warn("Failed to compute checksum of %s: %v", result.Name, err)
+    } else if err := s.uploadChecksum(ctx, folderID, result.Name, sum, size); err != nil {
+        s.logger.Warn("%v", err)
+    }
+
+    return result, nil
+}
+
+// UploadBackupStream uploads a backup of unknown size read from r under the
+// file name name. The stream cannot be rewound, so the upload is not retried
+// as a whole; with resumable uploads each failed chunk is still resent.
+// It returns the created Drive file.
+func (s *GoogleDriveService) UploadBackupStream(ctx context.Context, r io.Reader, name string, containerName string) (_ *DriveBackup, err error) {
+    createdFolder, err := s.createBackupFolder(containerName)
+    if err != nil {
+        return nil, err
+    }
+    defer func() {
+        if err != nil {
+            s.removeFailedUpload(createdFolder)
+        }
+    }()
+
+    backupFile := &drive.File{
+        Name:     name,
+        MimeType: archiveMimeType(name),
+        Parents:  []string{createdFolder.Id},
+    }
+
+    startTime := time.Now()
+    s.logger.Info("Starting streaming upload of %s", name)
+
+    hash := sha256.New()
+    progressReader := &utils.ProgressReader{
+        Reader: io.TeeReader(r, hash),
+        Name:   name,
+        Sink:   s.progress,
+    }
+    defer progressReader.Done()
+
+    result, err := s.api.CreateFile(ctx, backupFile, progressReader, "", s.uploadMediaOptions()...)
+    if err != nil {
+        return nil, fmt.Errorf("upload failed: %v", err)
+    }
+
+    duration := time.Since(startTime)
+    speed := float64(progressReader.Uploaded) / duration.Seconds() / 1024 / 1024 // MB/s
+
+    s.logger.Info("Upload completed: %s (%s, %.2f MB/s)",
+        result.Name,
+        utils.FormatBytes(progressReader.Uploaded),
+        speed)
+
+    sum := hex.EncodeToString(hash.Sum(nil))
+    if err := s.uploadChecksum(ctx, createdFolder.Id, result.Name, sum, progressReader.Uploaded); err != nil {
+        s.logger.Warn("%v", err)
+    }
+
+    return &DriveBackup{
+        ID:          result.Id,
+        Name:        result.Name,
+        CreatedTime: startTime,
+        Size:        progressReader.Uploaded,
+    }, nil
+}
+
+// removeFailedUpload deletes the backup folder of a failed upload along with
+// anything uploaded into it, so it does not linger until retention removes it
+func (s *GoogleDriveService) removeFailedUpload(folder *drive.File) {
+    err := s.retry(context.Background(), "delete folder", func() error {
+        return s.api.DeleteFile(context.Background(), folder.Id)
+    })
+    if err != nil {
+        s.logger.Warn("Failed to remove folder %s of failed upload: %v", folder.Name, err)
+        return
+    }
+    s.logger.Info("Removed folder %s of failed upload", folder.Name)
+}
+
+// checkQuota fails when the drive reports less free space than size bytes.
+// Drive only reports the quota of the authenticated user or service
+// account, not the capacity of a Shared Drive, so the check is opt-in for
+// setups where that quota does bound the drive, such as pooled storage.
+func (s *GoogleDriveService) checkQuota(size int64) error {
+    if !s.config.QuotaCheck {
+        return nil
+    }
+
+    var quota *drive.AboutStorageQuota
+    err := s.retry(context.Background(), "get storage quota", func() (err error) {
+        quota, err = s.api.StorageQuota(context.Background())
+        return err
+    })
+    if err != nil {
+        return fmt.Errorf("failed to check storage quota: %v", err)
+    }
+
+    return checkFreeSpace(quota, size)
+}
+
+// checkFreeSpace compares size against the free space left in quota. A
+// quota without a limit is unlimited, or not reported for this drive.
+func checkFreeSpace(quota *drive.AboutStorageQuota, size int64) error {
+    if quota == nil || quota.Limit == 0 {
+        return nil
+    }
+    if free := quota.Limit - quota.Usage; free < size {
+        return fmt.Errorf("%w: upload needs %s but only %s of %s is free", ErrDriveQuota,
+            utils.FormatBytes(size), utils.FormatBytes(max(free, 0)), utils.FormatBytes(quota.Limit))
+    }
     return nil
 }
 
-func (s *GoogleDriveService) CleanupOldBackups(ctx context.Context, retentionDays int) error {
+// uploadMediaOptions sends large files with the resumable protocol; failed
+// chunks are retried from the buffered chunk instead of restarting the
+// whole upload
+func (s *GoogleDriveService) uploadMediaOptions() []googleapi.MediaOption {
+    var mediaOptions []googleapi.MediaOption
+    if s.config.UploadChunkSize > 0 {
+        mediaOptions = append(mediaOptions,
+            googleapi.ChunkSize(s.config.UploadChunkSize),
+            googleapi.ChunkRetryDeadline(5*time.Minute))
+    }
+    return mediaOptions
+}
+
+// createBackupFolder creates the timestamped folder a backup of
+// containerName is uploaded into
+func (s *GoogleDriveService) createBackupFolder(containerName string) (*drive.File, error) {
+    // Create folder name with timestamp
+    folderName := fmt.Sprintf("backup_%s_%s", containerName, time.Now().Format("20060102_150405"))
+
+    // Create folder in Drive
+    folder := &drive.File{
+        Name:     folderName,
+        MimeType: folderMimeType,
+    }
+
+    if s.config.SharedDriveID != "" {
+        folder.Parents = []string{s.config.SharedDriveID}
+        if s.config.FolderID != "" {
+            folder.Parents = []string{s.config.FolderID}
+        }
+    }
+
+    var createdFolder *drive.File
+    err := s.retry(context.Background(), "create folder", func() (err error) {
+        createdFolder, err = s.api.CreateFile(context.Background(), folder, nil, "id, name")
+        return err
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to create folder: %v", err)
+    }
+
+    return createdFolder, nil
+}
+
+// archiveMimeType returns the mime type a backup file is stored with in Drive
+func archiveMimeType(path string) string {
+    switch {
+    case isVolume(path), strings.HasSuffix(path, utils.EncryptedExt):
+        return "application/octet-stream"
+    case IsTreeBackup(path):
+        return "application/json"
+    case strings.HasSuffix(path, ".tar.gz"):
+        return "application/gzip"
+    case strings.HasSuffix(path, ".tar.zst"):
+        return "application/zstd"
+    default:
+        return "application/zip"
+    }
+}
+
+// CleanupOldBackups deletes backup folders created more than retentionDays
+// ago. The retentionCount most recent full backups of each container and
+// their incrementals are kept regardless of age, and the newest full backup of a container and the
+// incrementals after it are never deleted. An incremental backup is only
+// deleted together with the full backup it is based on.
+func (s *GoogleDriveService) CleanupOldBackups(ctx context.Context, retentionDays, retentionCount int, dryRun bool) error {
     cutoffTime := time.Now().AddDate(0, 0, -retentionDays)
 
-    query := fmt.Sprintf(
-        "mimeType='application/vnd.google-apps.folder' and name contains 'backup_' "+
-            "and createdTime < '%s' and trashed=false",
-        cutoffTime.Format(time.RFC3339),
-    )
+    query := "mimeType='application/vnd.google-apps.folder' and name contains 'backup_' and trashed=false"
+    if s.config.FolderID != "" {
+        query += fmt.Sprintf(" and '%s' in parents", s.config.FolderID)
+    }
 
-    fileList, err := s.service.Files.List().
-        Q(query).
-        SupportsAllDrives(true).
-        IncludeItemsFromAllDrives(true).
-        Corpora("drive").
-        DriveId(s.config.SharedDriveID).
-        Fields("files(id, name, createdTime)").
-        Do()
+    var folders []*drive.File
+    pageToken := ""
+    for {
+        var fileList *drive.FileList
+        err := s.retry(ctx, "list backup folders", func() (err error) {
+            fileList, err = s.listFiles(ctx, ListOptions{
+                Query:     query,
+                PageToken: pageToken,
+                Fields:    "nextPageToken, files(id, name, createdTime)",
+            })
+            return err
+        })
+        if err != nil {
+            return fmt.Errorf("failed to list old backups: %v", err)
+        }
+
+        folders = append(folders, fileList.Files...)
+        pageToken = fileList.NextPageToken
+        if pageToken == "" {
+            break
+        }
+    }
 
+    incremental, err := s.incrementalFolders(ctx)
     if err != nil {
-        return fmt.Errorf("failed to list old backups: %v", err)
+        return err
     }
 
-    for _, file := range fileList.Files {
-        err := s.service.Files.Delete(file.Id).
-            SupportsAllDrives(true).
-            Do()
+    for _, file := range selectFoldersToDelete(folders, incremental, cutoffTime, retentionCount) {
+        if dryRun {
+            s.logger.Info("[DRY RUN] Would delete old backup: %s (Created: %s)", file.Name, file.CreatedTime)
+            continue
+        }
+
+        err := s.retry(ctx, "delete backup", func() error {
+            return s.api.DeleteFile(ctx, file.Id)
+        })
 
         if err != nil {
             s.logger.Error("Failed to delete old backup %s: %v", file.Name, err)
@@ -438,18 +1224,119 @@ func (s *GoogleDriveService) CleanupOldBackups(ctx context.Context, retentionDay
     return nil
 }
 
+// incrementalFolders returns the IDs of the backup folders holding an
+// incremental archive. Folder names do not tell full and incremental
+// backups apart, the archive inside does.
+func (s *GoogleDriveService) incrementalFolders(ctx context.Context) (map[string]bool, error) {
+    query := fmt.Sprintf("%s and name contains '%s' and trashed=false", backupMimeQuery, IncrementalPrefix)
+
+    folders := make(map[string]bool)
+    pageToken := ""
+    for {
+        var fileList *drive.FileList
+        err := s.retry(ctx, "list incremental backups", func() (err error) {
+            fileList, err = s.listFiles(ctx, ListOptions{
+                Query:     query,
+                PageToken: pageToken,
+                Fields:    "nextPageToken, files(id, name, parents)",
+            })
+            return err
+        })
+        if err != nil {
+            return nil, fmt.Errorf("failed to list incremental backups: %v", err)
+        }
+
+        for _, file := range fileList.Files {
+            if !IsIncrementalBackup(file.Name) {
+                continue
+            }
+            for _, parent := range file.Parents {
+                folders[parent] = true
+            }
+        }
+        pageToken = fileList.NextPageToken
+        if pageToken == "" {
+            break
+        }
+    }
+    return folders, nil
+}
+
+// backupFolderPattern matches folders created by UploadBackup:
+// backup_<container>_<YYYYMMDD>_<HHMMSS>
+var backupFolderPattern = regexp.MustCompile(`^backup_(.+)_(\d{8}_\d{6})$`)
+
+// selectFoldersToDelete applies the retention policy to backup folders.
+// Folders are grouped by container, and within a group into chains of a full
+// backup followed by the incrementals based on it, as marked in incremental.
+// A chain is deleted as a whole, once it is not among the keepCount most
+// recent chains and none of its folders is newer than cutoff; the newest
+// chain is always kept. Folders whose name does not follow the naming scheme only obey cutoff.
+func selectFoldersToDelete(folders []*drive.File, incremental map[string]bool, cutoff time.Time, keepCount int) []*drive.File {
+    type folder struct {
+        file    *drive.File
+        created time.Time
+    }
+
+    groups := make(map[string][]folder)
+    var toDelete []*drive.File
+    for _, file := range folders {
+        created, err := time.Parse(time.RFC3339, file.CreatedTime)
+        if err != nil {
+            continue
+        }
+
+        m := backupFolderPattern.FindStringSubmatch(file.Name)
+        if m == nil {
+            if created.Before(cutoff) {
+                toDelete = append(toDelete, file)
+            }
+            continue
+        }
+        groups[m[1]] = append(groups[m[1]], folder{file, created})
+    }
+
+    for _, group := range groups {
+        // Oldest first, so every incremental follows the full backup it is based on
+        sort.Slice(group, func(i, j int) bool {
+            return group[i].created.Before(group[j].created)
+        })
+        var chains [][]folder
+        for _, f := range group {
+            if len(chains) == 0 || !incremental[f.file.Id] {
+                chains = append(chains, nil)
+            }
+            chains[len(chains)-1] = append(chains[len(chains)-1], f)
+        }
+
+        // Only full backups count towards keepCount, so frequent
+        // incrementals cannot push the full backup they need out of it
+        for i, chain := range chains {
+            newer := len(chains) - 1 - i
+            newest := chain[len(chain)-1]
+            if newer > 0 && newer >= keepCount && newest.created.Before(cutoff) {
+                for _, f := range chain {
+                    toDelete = append(toDelete, f.file)
+                }
+            }
+        }
+    }
+
+    return toDelete
+}
+
 func (s *GoogleDriveService) ListAvailableFolders() error {
     query := fmt.Sprintf("mimeType='application/vnd.google-apps.folder' and '%s' in parents and trashed=false",
         s.config.SharedDriveID)
 
-    fileList, err := s.service.Files.List().
-        Q(query).
-        SupportsAllDrives(true).
-        IncludeItemsFromAllDrives(true).
-        Corpora("drive").
-        DriveId(s.config.SharedDriveID).
-        Fields("files(id, name, createdTime)").
-        Do()
+    var fileList *drive.FileList
+    err := s.retry(context.Background(), "list folders", func() (err error) {
+        fileList, err = s.listFiles(context.Background(), ListOptions{
+            Query:  query,
+            Fields: "files(id, name, createdTime)",
+        })
+        return err
+    })
 
     if err != nil {
         return fmt.Errorf("failed to list folders: %v", err)
@@ -0,0 +1,199 @@
+package gdrive
+
+import (
+    "errors"
+    "sort"
+    "strings"
+    "testing"
+    "time"
+
+    "google.golang.org/api/drive/v3"
+)
+
+func TestSelectContainerBackupOverlappingNames(t *testing.T) {
+    // Newest first, as returned by the Drive query
+    files := []*drive.File{
+        {Id: "0", Name: "inc_data_20241115_020000.zip"},
+        {Id: "1", Name: "data2_20241115_010000.zip"},
+        {Id: "2", Name: "data_archive_20241115_005000.zip"},
+        {Id: "3", Name: "data_20241114_010000.zip"},
+        {Id: "4", Name: "data_20241113_010000.zip"},
+    }
+
+    tests := []struct {
+        container string
+        wantID    string
+    }{
+        {"data", "3"},
+        {"data2", "1"},
+        {"data_archive", "2"},
+        {"dat", ""},
+    }
+
+    for _, tt := range tests {
+        got := selectContainerBackup(files, tt.container)
+        gotID := ""
+        if got != nil {
+            gotID = got.Id
+        }
+        if gotID != tt.wantID {
+            t.Errorf("container %q: got backup %q, want %q", tt.container, gotID, tt.wantID)
+        }
+    }
+}
+
+func TestParseBackupName(t *testing.T) {
+    tests := []struct {
+        name      string
+        container string
+        ok        bool
+    }{
+        {"assets_20241114_144123.zip", "assets", true},
+        {"assets_20241114_144123.tar.gz", "assets", true},
+        {"assets_20241114_144123.zip.enc", "assets", true},
+        {"my-container_20241114_144123.zip", "my-container", true},
+        {"inc_assets_20241114_144123.zip", "assets", true},
+        {"user_data_20241114_144123.zip", "user_data", true},
+        {"inc_user_data_20241114_144123.tar.gz.enc", "user_data", true},
+        {"user_data_20241114_144123.tree", "user_data", true},
+        {"assets.zip", "", false},
+        {"assets_20241114.zip", "", false},
+    }
+
+    for _, tt := range tests {
+        container, _, ok := ParseBackupName(tt.name)
+        if ok != tt.ok || container != tt.container {
+            t.Errorf("ParseBackupName(%q) = %q, %v; want %q, %v", tt.name, container, ok, tt.container, tt.ok)
+        }
+    }
+}
+
+func TestSelectFoldersToDelete(t *testing.T) {
+    now := time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC)
+    daysAgo := func(d int) string {
+        return now.AddDate(0, 0, -d).Format(time.RFC3339)
+    }
+
+    folders := []*drive.File{
+        {Id: "a1", Name: "backup_assets_20241119_010000", CreatedTime: daysAgo(1)},
+        {Id: "a2", Name: "backup_assets_20241110_010000", CreatedTime: daysAgo(10)},
+        {Id: "a3", Name: "backup_assets_20241105_010000", CreatedTime: daysAgo(15)},
+        {Id: "a4", Name: "backup_assets_20241101_010000", CreatedTime: daysAgo(19)},
+        {Id: "l1", Name: "backup_logs_20241001_010000", CreatedTime: daysAgo(50)},
+        {Id: "l2", Name: "backup_logs_20240901_010000", CreatedTime: daysAgo(80)},
+        {Id: "x1", Name: "backup_manual", CreatedTime: daysAgo(30)},
+    }
+    cutoff := now.AddDate(0, 0, -7)
+
+    tests := []struct {
+        name      string
+        keepCount int
+        want      []string
+    }{
+        // Days only: everything past the cutoff goes, except each container's newest
+        {"days only", 0, []string{"a2", "a3", "a4", "l2", "x1"}},
+        {"count 1 behaves like days only", 1, []string{"a2", "a3", "a4", "l2", "x1"}},
+        // Count keeps old backups that would otherwise expire
+        {"count 3", 3, []string{"a4", "x1"}},
+        // Count never deletes recent backups
+        {"count larger than backups", 10, []string{"x1"}},
+    }
+
+    for _, tt := range tests {
+        var got []string
+        for _, f := range selectFoldersToDelete(folders, nil, cutoff, tt.keepCount) {
+            got = append(got, f.Id)
+        }
+        sort.Strings(got)
+        if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+            t.Errorf("%s: deleted %v, want %v", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestSelectFoldersToDeleteKeepsRecent(t *testing.T) {
+    now := time.Now()
+    folders := []*drive.File{
+        {Id: "1", Name: "backup_assets_20241119_010000", CreatedTime: now.Add(-time.Hour).Format(time.RFC3339)},
+        {Id: "2", Name: "backup_assets_20241118_010000", CreatedTime: now.Add(-2 * time.Hour).Format(time.RFC3339)},
+    }
+    if got := selectFoldersToDelete(folders, nil, now.AddDate(0, 0, -7), 1); len(got) != 0 {
+        t.Errorf("deleted %d folders within the retention window, want 0", len(got))
+    }
+}
+
+func TestSelectFoldersToDeleteKeepsIncrementalChains(t *testing.T) {
+    now := time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC)
+    daysAgo := func(d int) string {
+        return now.AddDate(0, 0, -d).Format(time.RFC3339)
+    }
+
+    folders := []*drive.File{
+        {Id: "f1", Name: "backup_assets_20241101_010000", CreatedTime: daysAgo(19)},
+        {Id: "i1", Name: "backup_assets_20241102_010000", CreatedTime: daysAgo(18)},
+        {Id: "f2", Name: "backup_assets_20241112_010000", CreatedTime: daysAgo(8)},
+        {Id: "i2", Name: "backup_assets_20241113_010000", CreatedTime: daysAgo(7)},
+        {Id: "i3", Name: "backup_assets_20241119_010000", CreatedTime: daysAgo(1)},
+        // Incrementals whose full backup is past the cutoff, and nothing newer
+        {Id: "g1", Name: "backup_logs_20241101_010000", CreatedTime: daysAgo(19)},
+        {Id: "j1", Name: "backup_logs_20241102_010000", CreatedTime: daysAgo(18)},
+        {Id: "j2", Name: "backup_logs_20241103_010000", CreatedTime: daysAgo(17)},
+    }
+    incremental := map[string]bool{"i1": true, "i2": true, "i3": true, "j1": true, "j2": true}
+    cutoff := now.AddDate(0, 0, -7)
+
+    tests := []struct {
+        name      string
+        keepCount int
+        want      []string
+    }{
+        // f2 is past the cutoff but i2 and i3 need it; the older chain goes as a whole
+        {"days only", 0, []string{"f1", "i1"}},
+        // Incrementals do not count: f1 is the second most recent full backup
+        {"count 2", 2, nil},
+    }
+
+    for _, tt := range tests {
+        var got []string
+        for _, f := range selectFoldersToDelete(folders, incremental, cutoff, tt.keepCount) {
+            got = append(got, f.Id)
+        }
+        sort.Strings(got)
+        if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+            t.Errorf("%s: deleted %v, want %v", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestEscapeQueryValue(t *testing.T) {
+    got := escapeQueryValue(`it's a \ name.zip`)
+    want := `it\'s a \\ name.zip`
+    if got != want {
+        t.Errorf("escapeQueryValue = %q, want %q", got, want)
+    }
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+    tests := []struct {
+        name    string
+        quota   *drive.AboutStorageQuota
+        size    int64
+        wantErr bool
+    }{
+        {"no quota reported", nil, 1 << 40, false},
+        {"unlimited", &drive.AboutStorageQuota{Usage: 1 << 30}, 1 << 40, false},
+        {"enough room", &drive.AboutStorageQuota{Limit: 100, Usage: 40}, 60, false},
+        {"too large", &drive.AboutStorageQuota{Limit: 100, Usage: 40}, 61, true},
+        {"over quota", &drive.AboutStorageQuota{Limit: 100, Usage: 120}, 1, true},
+    }
+
+    for _, tt := range tests {
+        err := checkFreeSpace(tt.quota, tt.size)
+        if (err != nil) != tt.wantErr {
+            t.Errorf("%s: checkFreeSpace() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+        }
+        if err != nil && !errors.Is(err, ErrDriveQuota) {
+            t.Errorf("%s: checkFreeSpace() error = %v, want ErrDriveQuota", tt.name, err)
+        }
+    }
+}
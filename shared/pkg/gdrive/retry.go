@@ -0,0 +1,82 @@
+package gdrive
+
+import (
+    "context"
+    "errors"
+    "math/rand"
+    "net/http"
+    "time"
+
+    "google.golang.org/api/googleapi"
+
+    "shared/pkg/utils"
+)
+
+const (
+    retryBaseDelay = 1 * time.Second
+    retryMaxDelay  = 64 * time.Second
+)
+
+// withRetry runs fn and retries it with exponential backoff and jitter
+// while it fails with a rate-limit or server error. Waiting for the next
+// attempt stops as soon as ctx is cancelled
+func withRetry(ctx context.Context, maxRetries int, logger *utils.Logger, op string, fn func() error) error {
+    if maxRetries < 0 {
+        maxRetries = 0
+    }
+
+    var err error
+    for attempt := 0; ; attempt++ {
+        err = fn()
+        if err == nil || !isRetryable(err) || attempt >= maxRetries {
+            return err
+        }
+
+        delay := backoffDelay(attempt)
+        logger.Warn("%s failed (attempt %d/%d), retrying in %v: %v",
+            op, attempt+1, maxRetries+1, delay.Round(time.Millisecond), err)
+        timer := time.NewTimer(delay)
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return ctx.Err()
+        case <-timer.C:
+        }
+    }
+}
+
+// retry wraps a Drive API call using the service's configured retry limit
+func (s *GoogleDriveService) retry(ctx context.Context, op string, fn func() error) error {
+    return withRetry(ctx, s.config.MaxRetries, s.logger, op, fn)
+}
+
+// backoffDelay returns base*2^attempt capped at retryMaxDelay, plus up to one second of jitter
+func backoffDelay(attempt int) time.Duration {
+    delay := retryBaseDelay << uint(attempt)
+    if delay <= 0 || delay > retryMaxDelay {
+        delay = retryMaxDelay
+    }
+    return delay + time.Duration(rand.Int63n(int64(time.Second)))
+}
+
+// isRetryable reports whether err is a 429, a 5xx, or a 403 caused by rate limiting
+func isRetryable(err error) bool {
+    var apiErr *googleapi.Error
+    if !errors.As(err, &apiErr) {
+        return false
+    }
+
+    switch {
+    case apiErr.Code == http.StatusTooManyRequests:
+        return true
+    case apiErr.Code >= 500:
+        return true
+    case apiErr.Code == http.StatusForbidden:
+        for _, item := range apiErr.Errors {
+            if item.Reason == "userRateLimitExceeded" || item.Reason == "rateLimitExceeded" {
+                return true
+            }
+        }
+    }
+    return false
+}
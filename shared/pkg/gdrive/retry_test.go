@@ -0,0 +1,68 @@
+package gdrive
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "testing"
+    "time"
+
+    "google.golang.org/api/googleapi"
+
+    "shared/pkg/utils"
+)
+
+func TestIsRetryable(t *testing.T) {
+    rateLimited := func(reason string) error {
+        return &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: reason}}}
+    }
+
+    tests := []struct {
+        err  error
+        want bool
+    }{
+        {&googleapi.Error{Code: http.StatusTooManyRequests}, true},
+        {&googleapi.Error{Code: http.StatusInternalServerError}, true},
+        {&googleapi.Error{Code: http.StatusServiceUnavailable}, true},
+        {rateLimited("userRateLimitExceeded"), true},
+        {fmt.Errorf("list files: %w", rateLimited("rateLimitExceeded")), true},
+        {rateLimited("insufficientFilePermissions"), false},
+        {&googleapi.Error{Code: http.StatusForbidden}, false},
+        {&googleapi.Error{Code: http.StatusNotFound}, false},
+        {errors.New("connection reset"), false},
+        {context.Canceled, false},
+    }
+    for _, tt := range tests {
+        if got := isRetryable(tt.err); got != tt.want {
+            t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+        }
+    }
+}
+
+func TestWithRetryStopsWhenCancelled(t *testing.T) {
+    logger := utils.NewLogger("[TEST]", "error", "text")
+    ctx, cancel := context.WithCancel(context.Background())
+
+    calls := 0
+    go func() {
+        time.Sleep(50 * time.Millisecond)
+        cancel()
+    }()
+
+    start := time.Now()
+    err := withRetry(ctx, 5, logger, "list files", func() error {
+        calls++
+        return &googleapi.Error{Code: http.StatusTooManyRequests}
+    })
+    if !errors.Is(err, context.Canceled) {
+        t.Errorf("withRetry = %v, want context.Canceled", err)
+    }
+    if calls != 1 {
+        t.Errorf("fn called %d times, want 1", calls)
+    }
+    // The first backoff is at least retryBaseDelay
+    if elapsed := time.Since(start); elapsed >= retryBaseDelay {
+        t.Errorf("withRetry returned after %v, want it to stop waiting on cancel", elapsed)
+    }
+}
@@ -0,0 +1,146 @@
+package gdrive
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "os"
+    "strings"
+    "sync"
+
+    "golang.org/x/oauth2"
+
+    "shared/pkg/utils"
+)
+
+// TokenProvider supplies the stored OAuth token used for the OAuth auth
+// mode. Implementations can read it from a file, the environment or a
+// secret manager; the token is refreshed in memory once loaded.
+type TokenProvider interface {
+    Token() (*oauth2.Token, error)
+}
+
+// FileTokenProvider reads a token.json file written by the token generator
+type FileTokenProvider struct {
+    Path string
+}
+
+func (p FileTokenProvider) Token() (*oauth2.Token, error) {
+    return loadToken(p.Path)
+}
+
+// JSONTokenProvider parses a token from token.json content, such as the
+// value of GOOGLE_TOKEN_JSON or a mounted secret
+type JSONTokenProvider struct {
+    JSON string
+}
+
+func (p JSONTokenProvider) Token() (*oauth2.Token, error) {
+    token := &oauth2.Token{}
+    if err := json.NewDecoder(strings.NewReader(p.JSON)).Decode(token); err != nil {
+        return nil, fmt.Errorf("invalid token JSON: %v", err)
+    }
+    return token, nil
+}
+
+// tokenProvider returns cfg.TokenProvider, or the default provider for the
+// token JSON or token file in cfg
+func tokenProvider(cfg *DriveConfig) TokenProvider {
+    switch {
+    case cfg.TokenProvider != nil:
+        return cfg.TokenProvider
+    case cfg.TokenJSON != "":
+        return JSONTokenProvider{JSON: cfg.TokenJSON}
+    default:
+        return FileTokenProvider{Path: cfg.TokenPath}
+    }
+}
+
+func loadToken(path string) (*oauth2.Token, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    token := &oauth2.Token{}
+    err = json.NewDecoder(f).Decode(token)
+    return token, err
+}
+
+// saveToken writes token to path through a temp file and rename, so a crash
+// never leaves a truncated token.json behind
+func saveToken(path string, token *oauth2.Token) error {
+    var buf bytes.Buffer
+    encoder := json.NewEncoder(&buf)
+    encoder.SetIndent("", "    ")
+    if err := encoder.Encode(token); err != nil {
+        return fmt.Errorf("failed to encode token: %v", err)
+    }
+
+    tempPath := path + ".tmp"
+    file, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+    if err != nil {
+        return fmt.Errorf("failed to create temp token file: %v", err)
+    }
+    if _, err := file.Write(buf.Bytes()); err != nil {
+        file.Close()
+        os.Remove(tempPath)
+        return fmt.Errorf("failed to write token: %v", err)
+    }
+    if err := file.Sync(); err != nil {
+        file.Close()
+        os.Remove(tempPath)
+        return fmt.Errorf("failed to sync token file: %v", err)
+    }
+    if err := file.Close(); err != nil {
+        os.Remove(tempPath)
+        return fmt.Errorf("failed to close token file: %v", err)
+    }
+
+    if err := os.Rename(tempPath, path); err != nil {
+        os.Remove(tempPath)
+        // A token.json bind-mounted as a single file cannot be replaced by
+        // rename, so overwrite it in place instead
+        if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+            return fmt.Errorf("failed to save token file: %v", err)
+        }
+    }
+
+    return nil
+}
+
+// persistingTokenSource saves every newly obtained token back to path, so a
+// restart after weeks of refreshes, or a rotated refresh token, still finds a
+// valid token.json
+type persistingTokenSource struct {
+    base   oauth2.TokenSource
+    path   string
+    logger *utils.Logger
+    mu     sync.Mutex
+    last   *oauth2.Token
+}
+
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+    token, err := s.base.Token()
+    if err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.last != nil && token.AccessToken == s.last.AccessToken && token.RefreshToken == s.last.RefreshToken {
+        return token, nil
+    }
+    s.last = token
+
+    if err := saveToken(s.path, token); err != nil {
+        s.logger.Warn("OAuth token refreshed but could not be saved to %s: %v", s.path, err)
+    } else {
+        s.logger.Info("OAuth token refreshed and saved to %s (expires %s)",
+            s.path, token.Expiry.Format("2006-01-02 15:04:05"))
+    }
+
+    return token, nil
+}
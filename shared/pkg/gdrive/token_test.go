@@ -0,0 +1,74 @@
+package gdrive
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+
+    "golang.org/x/oauth2"
+
+    "shared/pkg/utils"
+)
+
+func TestTokenProviderDefaults(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "token.json")
+    if err := os.WriteFile(path, []byte(`{"access_token":"from-file","refresh_token":"r1"}`), 0600); err != nil {
+        t.Fatalf("write token: %v", err)
+    }
+
+    token, err := tokenProvider(&DriveConfig{TokenPath: path}).Token()
+    if err != nil {
+        t.Fatalf("file provider: %v", err)
+    }
+    if token.AccessToken != "from-file" {
+        t.Errorf("AccessToken = %q, want token from TokenPath", token.AccessToken)
+    }
+
+    cfg := &DriveConfig{
+        TokenPath: path,
+        TokenJSON: `{"access_token":"from-json","refresh_token":"r2"}`,
+    }
+    token, err = tokenProvider(cfg).Token()
+    if err != nil {
+        t.Fatalf("JSON provider: %v", err)
+    }
+    if token.AccessToken != "from-json" || token.RefreshToken != "r2" {
+        t.Errorf("got %+v, want token from TokenJSON", token)
+    }
+}
+
+func TestJSONTokenProviderInvalid(t *testing.T) {
+    if _, err := (JSONTokenProvider{JSON: "not json"}).Token(); err == nil {
+        t.Fatal("expected an error for invalid token JSON")
+    }
+}
+
+func TestPersistingTokenSourceSavesRefreshedToken(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "token.json")
+    initial := &oauth2.Token{AccessToken: "old", RefreshToken: "r1"}
+    if err := saveToken(path, initial); err != nil {
+        t.Fatalf("saveToken: %v", err)
+    }
+
+    refreshed := &oauth2.Token{AccessToken: "new", RefreshToken: "r2"}
+    source := &persistingTokenSource{
+        base:   oauth2.StaticTokenSource(refreshed),
+        path:   path,
+        logger: utils.NewLogger("[TEST]", "error", "text"),
+        last:   initial,
+    }
+    if _, err := source.Token(); err != nil {
+        t.Fatalf("Token: %v", err)
+    }
+
+    saved, err := loadToken(path)
+    if err != nil {
+        t.Fatalf("loadToken: %v", err)
+    }
+    if saved.AccessToken != "new" || saved.RefreshToken != "r2" {
+        t.Errorf("saved %+v, want the refreshed token", saved)
+    }
+    if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+        t.Errorf("temp file left behind: %v", err)
+    }
+}
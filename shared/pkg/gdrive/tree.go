@@ -0,0 +1,375 @@
+package gdrive
+
+import (
+    "bytes"
+    "context"
+    "crypto/md5"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "google.golang.org/api/drive/v3"
+
+    "shared/pkg/utils"
+)
+
+// TreeManifestExt marks the manifest of a backup stored with the tree
+// layout: instead of one archive, the container's files are uploaded one by
+// one into a "files" folder tree next to the manifest
+const TreeManifestExt = ".tree"
+
+// treeFilesFolder holds the mirrored files inside a tree backup folder
+const treeFilesFolder = "files"
+
+const folderMimeType = "application/vnd.google-apps.folder"
+
+// TreeManifest lists the files of a tree backup
+type TreeManifest struct {
+    Container string     `json:"container"`
+    Files     []TreeFile `json:"files"`
+}
+
+// TreeFile is a single file of a tree backup
+type TreeFile struct {
+    Path     string            `json:"path"`               // slash-separated path in the container
+    ID       string            `json:"id"`                 // Drive file ID
+    Size     int64             `json:"size"`
+    MD5      string            `json:"md5"`                // hex md5Checksum reported by Drive
+    Metadata map[string]string `json:"metadata,omitempty"` // original mtime and permissions
+}
+
+// IsTreeBackup reports whether name is the manifest of a tree backup
+func IsTreeBackup(name string) bool {
+    return strings.HasSuffix(name, TreeManifestExt)
+}
+
+// treeUploadJob is one file handed by the UploadTree walk to its workers
+type treeUploadJob struct {
+    path     string
+    relPath  string
+    info     os.FileInfo
+    parentID string
+}
+
+// UploadTree uploads every file below sourceDir into a new backup folder,
+// mirroring the directory structure, and finishes with a manifest named name.
+// Up to concurrency files are uploaded at once. It returns the manifest file.
+func (s *GoogleDriveService) UploadTree(ctx context.Context, sourceDir, name, containerName string, concurrency int) (_ *DriveBackup, err error) {
+    size, err := utils.DirSize(sourceDir)
+    if err != nil {
+        return nil, fmt.Errorf("failed to measure %s: %v", sourceDir, err)
+    }
+    if err := s.checkQuota(size); err != nil {
+        return nil, err
+    }
+
+    backupFolder, err := s.createBackupFolder(containerName)
+    if err != nil {
+        return nil, err
+    }
+    defer func() {
+        if err != nil {
+            s.removeFailedUpload(backupFolder)
+        }
+    }()
+
+    filesFolder, err := s.createFolder(treeFilesFolder, backupFolder.Id)
+    if err != nil {
+        return nil, err
+    }
+
+    startTime := time.Now()
+    s.logger.Info("Starting tree upload of %s", containerName)
+
+    manifest := &TreeManifest{Container: containerName}
+    folders := map[string]string{".": filesFolder.Id}
+    var totalSize int64
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    var uploadErr error
+
+    upload := func(job treeUploadJob) {
+        file, err := s.uploadTreeFile(ctx, job.path, job.info.Name(), job.parentID)
+
+        mu.Lock()
+        defer mu.Unlock()
+        if err != nil {
+            if uploadErr == nil {
+                uploadErr = fmt.Errorf("failed to upload %s: %v", job.relPath, err)
+            }
+            return
+        }
+        manifest.Files = append(manifest.Files, TreeFile{
+            Path:     filepath.ToSlash(job.relPath),
+            ID:       file.Id,
+            Size:     job.info.Size(),
+            MD5:      file.Md5Checksum,
+            Metadata: utils.FileMetadata(job.info),
+        })
+        totalSize += job.info.Size()
+        s.logger.Debug("Uploaded %s (%s)", job.relPath, utils.FormatBytes(job.info.Size()))
+    }
+
+    jobs := make(chan treeUploadJob)
+    for i := 0; i < max(concurrency, 1); i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for job := range jobs {
+                upload(job)
+            }
+        }()
+    }
+
+    // Folders are created during the walk, so a parent always exists before
+    // its children; files are handed to the upload workers
+    walkErr := filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+
+        relPath, err := filepath.Rel(sourceDir, path)
+        if err != nil {
+            return fmt.Errorf("failed to get relative path: %v", err)
+        }
+        parentID := folders[filepath.Dir(relPath)]
+
+        if info.IsDir() {
+            if relPath == "." {
+                return nil
+            }
+            folder, err := s.createFolder(info.Name(), parentID)
+            if err != nil {
+                return err
+            }
+            folders[relPath] = folder.Id
+            return nil
+        }
+        if !info.Mode().IsRegular() {
+            return nil
+        }
+
+        mu.Lock()
+        failed := uploadErr != nil
+        mu.Unlock()
+        if failed {
+            return filepath.SkipAll
+        }
+
+        jobs <- treeUploadJob{path: path, relPath: relPath, info: info, parentID: parentID}
+        return nil
+    })
+    close(jobs)
+    wg.Wait()
+
+    if walkErr != nil {
+        return nil, fmt.Errorf("failed to walk %s: %v", sourceDir, walkErr)
+    }
+    if uploadErr != nil {
+        return nil, uploadErr
+    }
+
+    sort.Slice(manifest.Files, func(i, j int) bool {
+        return manifest.Files[i].Path < manifest.Files[j].Path
+    })
+    data, err := json.Marshal(manifest)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode manifest: %v", err)
+    }
+
+    // The manifest is written last, so a backup is only listed once complete
+    manifestFile := &drive.File{
+        Name:     name,
+        MimeType: archiveMimeType(name),
+        Parents:  []string{backupFolder.Id},
+    }
+    var result *drive.File
+    err = s.retry(ctx, "upload manifest", func() (err error) {
+        result, err = s.api.CreateFile(ctx, manifestFile, bytes.NewReader(data), "")
+        return err
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to upload manifest: %v", err)
+    }
+
+    duration := time.Since(startTime)
+    speed := float64(totalSize) / duration.Seconds() / 1024 / 1024 // MB/s
+    s.logger.Info("Upload completed: %s (%d files, %s, %.2f MB/s)",
+        result.Name, len(manifest.Files), utils.FormatBytes(totalSize), speed)
+
+    return &DriveBackup{
+        ID:          result.Id,
+        Name:        result.Name,
+        CreatedTime: startTime,
+        Size:        totalSize,
+    }, nil
+}
+
+// createFolder creates a folder named name inside parentID
+func (s *GoogleDriveService) createFolder(name, parentID string) (*drive.File, error) {
+    folder := &drive.File{
+        Name:     name,
+        MimeType: folderMimeType,
+        Parents:  []string{parentID},
+    }
+
+    var created *drive.File
+    err := s.retry(context.Background(), "create folder", func() (err error) {
+        created, err = s.api.CreateFile(context.Background(), folder, nil, "id, name")
+        return err
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to create folder %s: %v", name, err)
+    }
+    return created, nil
+}
+
+// uploadTreeFile uploads the file at path into parentID
+func (s *GoogleDriveService) uploadTreeFile(ctx context.Context, path, name, parentID string) (*drive.File, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open file: %v", err)
+    }
+    defer file.Close()
+
+    target := &drive.File{
+        Name:    name,
+        Parents: []string{parentID},
+    }
+
+    var result *drive.File
+    err = s.retry(ctx, "upload file", func() (err error) {
+        // Rewind so a retried upload sends the whole file again
+        if _, err := file.Seek(0, io.SeekStart); err != nil {
+            return err
+        }
+        result, err = s.api.CreateFile(ctx, target, file, "id, md5Checksum", s.uploadMediaOptions()...)
+        return err
+    })
+    return result, err
+}
+
+// ReadTreeManifest downloads and decodes the manifest of a tree backup
+func (s *GoogleDriveService) ReadTreeManifest(ctx context.Context, fileID string) (*TreeManifest, error) {
+    body, err := s.OpenFile(ctx, fileID)
+    if err != nil {
+        return nil, err
+    }
+    defer body.Close()
+
+    manifest := &TreeManifest{}
+    if err := json.NewDecoder(body).Decode(manifest); err != nil {
+        return nil, fmt.Errorf("invalid tree manifest: %v", err)
+    }
+    return manifest, nil
+}
+
+// OpenFile starts a download of fileID and returns its content as a stream
+func (s *GoogleDriveService) OpenFile(ctx context.Context, fileID string) (io.ReadCloser, error) {
+    var res *http.Response
+    err := s.retry(ctx, "download file", func() (err error) {
+        res, err = s.api.Download(ctx, fileID)
+        return err
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to download file: %v", err)
+    }
+    return res.Body, nil
+}
+
+// DownloadTree downloads every file of manifest below destDir, restoring the
+// original modification times and permissions. Up to concurrency files are
+// downloaded at once.
+func (s *GoogleDriveService) DownloadTree(ctx context.Context, manifest *TreeManifest, destDir string, concurrency int) error {
+    // Every path is checked before anything is written, so a crafted
+    // manifest cannot leave a partial download behind
+    targets := make([]string, len(manifest.Files))
+    for i, file := range manifest.Files {
+        targetPath, err := utils.SafeJoin(destDir, file.Path)
+        if err != nil {
+            return err
+        }
+        targets[i] = targetPath
+    }
+
+    var wg sync.WaitGroup
+    var mu sync.Mutex
+    var firstErr error
+
+    jobs := make(chan int)
+    for i := 0; i < max(concurrency, 1); i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for index := range jobs {
+                file := manifest.Files[index]
+                if err := s.downloadTreeFile(ctx, file, targets[index]); err != nil {
+                    mu.Lock()
+                    if firstErr == nil {
+                        firstErr = fmt.Errorf("failed to download %s: %v", file.Path, err)
+                    }
+                    mu.Unlock()
+                }
+            }
+        }()
+    }
+    for index := range manifest.Files {
+        jobs <- index
+    }
+    close(jobs)
+    wg.Wait()
+
+    return firstErr
+}
+
+// downloadTreeFile downloads a single tree file to targetPath and checks it
+// against the MD5 in the manifest
+func (s *GoogleDriveService) downloadTreeFile(ctx context.Context, file TreeFile, targetPath string) error {
+    if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+        return fmt.Errorf("failed to create directory: %v", err)
+    }
+
+    body, err := s.OpenFile(ctx, file.ID)
+    if err != nil {
+        return err
+    }
+    defer body.Close()
+
+    out, err := os.Create(targetPath)
+    if err != nil {
+        return fmt.Errorf("failed to create file: %v", err)
+    }
+
+    hash := md5.New()
+    _, err = io.Copy(io.MultiWriter(out, hash), body)
+    if closeErr := out.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        return fmt.Errorf("failed to save file: %v", err)
+    }
+
+    if actual := hex.EncodeToString(hash.Sum(nil)); file.MD5 != "" && actual != file.MD5 {
+        return fmt.Errorf("checksum mismatch: expected md5 %s, got %s", file.MD5, actual)
+    }
+
+    modTime, mode, hasTime, hasMode := utils.ParseFileMetadata(file.Metadata)
+    if hasMode {
+        os.Chmod(targetPath, mode)
+    }
+    if hasTime {
+        os.Chtimes(targetPath, modTime, modTime)
+    }
+    return nil
+}
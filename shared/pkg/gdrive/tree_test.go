@@ -0,0 +1,80 @@
+package gdrive
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestUploadTreeManifestRoundTrip(t *testing.T) {
+    sourceDir := t.TempDir()
+    contents := map[string]string{
+        "a.txt":          "first file",
+        "sub/b.txt":      "second file",
+        "sub/deep/c.bin": "third file, a little longer",
+    }
+    for path, content := range contents {
+        full := filepath.Join(sourceDir, filepath.FromSlash(path))
+        if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    api := &fakeDriveAPI{}
+    service := newFakeService(api)
+    ctx := context.Background()
+
+    backup, err := service.UploadTree(ctx, sourceDir, "assets_20241114_010000"+TreeManifestExt, "assets", 2)
+    if err != nil {
+        t.Fatalf("UploadTree: %v", err)
+    }
+
+    manifest, err := service.ReadTreeManifest(ctx, backup.ID)
+    if err != nil {
+        t.Fatalf("ReadTreeManifest: %v", err)
+    }
+    if manifest.Container != "assets" || len(manifest.Files) != len(contents) {
+        t.Fatalf("manifest of %q lists %d files, want %d of assets", manifest.Container, len(manifest.Files), len(contents))
+    }
+    for i, want := range []string{"a.txt", "sub/b.txt", "sub/deep/c.bin"} {
+        file := manifest.Files[i]
+        if file.Path != want || file.Size != int64(len(contents[want])) || file.MD5 == "" {
+            t.Errorf("manifest file %d = %s (%d bytes, md5 %q), want %s with its size and md5", i, file.Path, file.Size, file.MD5, want)
+        }
+    }
+
+    destDir := t.TempDir()
+    if err := service.DownloadTree(ctx, manifest, destDir, 2); err != nil {
+        t.Fatalf("DownloadTree: %v", err)
+    }
+    for path, want := range contents {
+        got, err := os.ReadFile(filepath.Join(destDir, filepath.FromSlash(path)))
+        if err != nil || string(got) != want {
+            t.Errorf("restored %s = %q (%v), want %q", path, got, err, want)
+        }
+    }
+
+    api.contents[manifest.Files[1].ID] = []byte("changed on Drive")
+    if err := service.DownloadTree(ctx, manifest, t.TempDir(), 2); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+        t.Errorf("DownloadTree of a changed file = %v, want a checksum mismatch", err)
+    }
+}
+
+func TestDownloadTreeRejectsEscapingPaths(t *testing.T) {
+    api := &fakeDriveAPI{contents: map[string][]byte{"1": []byte("ok"), "2": []byte("evil")}}
+    service := newFakeService(api)
+    manifest := &TreeManifest{Files: []TreeFile{{Path: "ok.txt", ID: "1"}, {Path: "../evil.txt", ID: "2"}}}
+
+    destDir := filepath.Join(t.TempDir(), "dest")
+    if err := service.DownloadTree(context.Background(), manifest, destDir, 2); err == nil {
+        t.Fatal("DownloadTree accepted a path outside the destination")
+    }
+    if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+        t.Errorf("DownloadTree wrote files before rejecting the manifest")
+    }
+}
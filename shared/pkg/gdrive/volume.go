@@ -0,0 +1,267 @@
+package gdrive
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strconv"
+    "time"
+
+    "google.golang.org/api/drive/v3"
+
+    "shared/pkg/utils"
+)
+
+// volumeNamePattern matches the .001, .002, ... suffix utils.VolumeName
+// appends to the volumes of a split backup
+var volumeNamePattern = regexp.MustCompile(`^(.+)\.(\d{3,})$`)
+
+// splitVolumeName returns the name of the backup a volume belongs to and
+// the volume's index. ok is false for names that are not backup volumes.
+func splitVolumeName(name string) (base string, index int, ok bool) {
+    m := volumeNamePattern.FindStringSubmatch(name)
+    if m == nil {
+        return "", 0, false
+    }
+    if _, _, ok := ParseBackupName(m[1]); !ok {
+        return "", 0, false
+    }
+    index, err := strconv.Atoi(m[2])
+    if err != nil {
+        return "", 0, false
+    }
+    return m[1], index, true
+}
+
+// isVolume reports whether path names one volume of a split backup
+func isVolume(path string) bool {
+    _, _, ok := splitVolumeName(filepath.Base(path))
+    return ok
+}
+
+// groupVolumes merges the volumes of each split backup in backups into one
+// logical backup named after the unsplit archive, with the ID and creation
+// time of its first volume and the size of all of them. Backups keep the
+// position of their first listed file.
+func groupVolumes(backups []*DriveBackup) []*DriveBackup {
+    var grouped []*DriveBackup
+    sets := make(map[string]*DriveBackup)
+    for _, backup := range backups {
+        base, _, ok := splitVolumeName(backup.Name)
+        if !ok {
+            grouped = append(grouped, backup)
+            continue
+        }
+        set, found := sets[base]
+        if !found {
+            set = &DriveBackup{Name: base}
+            sets[base] = set
+            grouped = append(grouped, set)
+        }
+        set.Volumes = append(set.Volumes, backup)
+        set.Size += backup.Size
+    }
+
+    for _, set := range sets {
+        sort.Slice(set.Volumes, func(i, j int) bool {
+            _, a, _ := splitVolumeName(set.Volumes[i].Name)
+            _, b, _ := splitVolumeName(set.Volumes[j].Name)
+            return a < b
+        })
+        set.ID = set.Volumes[0].ID
+        set.CreatedTime = set.Volumes[0].CreatedTime
+    }
+    return grouped
+}
+
+// withVolumes returns backup, built from file, unchanged unless file is one
+// volume of a split backup. Then the other volumes are looked up in the
+// same folder and the whole set is returned.
+func (s *GoogleDriveService) withVolumes(backup *DriveBackup, file *drive.File) (*DriveBackup, error) {
+    base, _, ok := splitVolumeName(file.Name)
+    if !ok || len(file.Parents) == 0 {
+        return backup, nil
+    }
+
+    query := fmt.Sprintf("'%s' in parents and name contains '%s' and trashed=false",
+        file.Parents[0], escapeQueryValue(base))
+
+    var volumes []*DriveBackup
+    pageToken := ""
+    for {
+        var fileList *drive.FileList
+        err := s.retry(context.Background(), "list backup volumes", func() (err error) {
+            fileList, err = s.listFiles(context.Background(), ListOptions{
+                Query:     query,
+                PageToken: pageToken,
+                Fields:    "nextPageToken, files(id, name, createdTime, size)",
+            })
+            return err
+        })
+        if err != nil {
+            return nil, fmt.Errorf("failed to list volumes of %s: %v", base, err)
+        }
+
+        for _, f := range fileList.Files {
+            if name, _, ok := splitVolumeName(f.Name); !ok || name != base {
+                continue
+            }
+            createdTime, err := time.Parse(time.RFC3339, f.CreatedTime)
+            if err != nil {
+                return nil, fmt.Errorf("failed to parse creation time of %s: %v", f.Name, err)
+            }
+            volumes = append(volumes, &DriveBackup{
+                ID:          f.Id,
+                Name:        f.Name,
+                CreatedTime: createdTime,
+                Size:        f.Size,
+            })
+        }
+
+        pageToken = fileList.NextPageToken
+        if pageToken == "" {
+            break
+        }
+    }
+
+    if len(volumes) == 0 {
+        return backup, nil
+    }
+    set := groupVolumes(volumes)[0]
+    s.logger.Info("Backup %s is split into %d volumes (%s)", set.Name, len(set.Volumes), utils.FormatBytes(set.Size))
+    return set, nil
+}
+
+// UploadBackupVolumes uploads the archive at path split into volumes of at
+// most volumeSize bytes, named like the archive with a .001, .002, ...
+// suffix, into one new backup folder and returns them as a single backup.
+// Each volume is uploaded straight from its section of the archive, so
+// splitting needs no disk space besides the archive itself. The folder is
+// removed again if any volume fails to upload.
+func (s *GoogleDriveService) UploadBackupVolumes(ctx context.Context, path string, volumeSize int64, containerName string) (_ *DriveBackup, err error) {
+    if volumeSize <= 0 {
+        return nil, fmt.Errorf("invalid volume size %d", volumeSize)
+    }
+    base := filepath.Base(path)
+    if !isVolume(utils.VolumeName(base, 1)) {
+        return nil, fmt.Errorf("%s is not a backup archive", base)
+    }
+
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open archive: %v", err)
+    }
+    defer file.Close()
+
+    fileInfo, err := file.Stat()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get file info: %v", err)
+    }
+    total := fileInfo.Size()
+    count := int((total + volumeSize - 1) / volumeSize)
+    if count == 0 {
+        return nil, fmt.Errorf("no volumes to upload: %s is empty", base)
+    }
+
+    // Checked before the folder is created, so a full drive leaves nothing behind
+    if err := s.checkQuota(total); err != nil {
+        return nil, err
+    }
+
+    createdFolder, err := s.createBackupFolder(containerName)
+    if err != nil {
+        return nil, err
+    }
+    defer func() {
+        if err != nil {
+            s.removeFailedUpload(createdFolder)
+        }
+    }()
+
+    startTime := time.Now()
+    backup := &DriveBackup{Name: base, CreatedTime: startTime, Size: total}
+    for i := 0; i < count; i++ {
+        offset := int64(i) * volumeSize
+        size := min(volumeSize, total-offset)
+        s.logger.Info("Uploading volume %d/%d of %s", i+1, count, base)
+        volume, err := s.uploadVolume(ctx, io.NewSectionReader(file, offset, size), size, utils.VolumeName(base, i+1), createdFolder.Id)
+        if err != nil {
+            return nil, err
+        }
+        backup.Volumes = append(backup.Volumes, volume)
+    }
+    backup.ID = backup.Volumes[0].ID
+
+    return backup, nil
+}
+
+// uploadVolume uploads one volume, size bytes read from r, into folderID
+// under the file name name
+func (s *GoogleDriveService) uploadVolume(ctx context.Context, r io.ReadSeeker, size int64, name, folderID string) (*DriveBackup, error) {
+    startTime := time.Now()
+    result, err := s.uploadArchive(ctx, r, size, name, folderID)
+    if err != nil {
+        return nil, err
+    }
+    return &DriveBackup{
+        ID:          result.Id,
+        Name:        result.Name,
+        CreatedTime: startTime,
+        Size:        size,
+    }, nil
+}
+
+// DownloadBackup downloads backup to destinationPath. The volumes of a
+// split backup are downloaded one after another and joined into the
+// original archive; a gap in the volume numbers fails the download.
+func (s *GoogleDriveService) DownloadBackup(ctx context.Context, backup *DriveBackup, destinationPath string) error {
+    if len(backup.Volumes) == 0 {
+        return s.DownloadFile(ctx, backup.ID, destinationPath)
+    }
+
+    for i, volume := range backup.Volumes {
+        if _, index, _ := splitVolumeName(volume.Name); index != i+1 {
+            return fmt.Errorf("%w: %s is missing volume %03d", ErrInvalidBackup, backup.Name, i+1)
+        }
+    }
+
+    out, err := os.Create(destinationPath)
+    if err != nil {
+        return fmt.Errorf("failed to create %s: %v", destinationPath, err)
+    }
+
+    volumePath := destinationPath + ".volume"
+    for i, volume := range backup.Volumes {
+        s.logger.Info("Downloading volume %d/%d of %s", i+1, len(backup.Volumes), backup.Name)
+        if err = s.DownloadFile(ctx, volume.ID, volumePath); err == nil {
+            err = appendFile(out, volumePath)
+        }
+        os.Remove(volumePath)
+        if err != nil {
+            out.Close()
+            os.Remove(destinationPath)
+            return fmt.Errorf("failed to download volume %s: %w", volume.Name, err)
+        }
+    }
+
+    if err := out.Close(); err != nil {
+        os.Remove(destinationPath)
+        return fmt.Errorf("failed to write %s: %v", destinationPath, err)
+    }
+    return nil
+}
+
+// appendFile copies the content of the file at path to out
+func appendFile(out io.Writer, path string) error {
+    in, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer in.Close()
+    _, err = io.Copy(out, in)
+    return err
+}
@@ -0,0 +1,126 @@
+package gdrive
+
+import (
+    "bytes"
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestUploadBackupVolumesRoundTrip(t *testing.T) {
+    dir := t.TempDir()
+    zipPath := filepath.Join(dir, "assets_20241114_010000.zip")
+    content := bytes.Repeat([]byte("0123456789"), 25)
+    if err := os.WriteFile(zipPath, content, 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    api := &fakeDriveAPI{}
+    service := newFakeService(api)
+    ctx := context.Background()
+
+    uploaded, err := service.UploadBackupVolumes(ctx, zipPath, 100, "assets")
+    if err != nil {
+        t.Fatalf("UploadBackupVolumes: %v", err)
+    }
+    if len(uploaded.Volumes) != 3 || uploaded.Volumes[2].Name != "assets_20241114_010000.zip.003" || uploaded.Volumes[2].Size != 50 {
+        t.Fatalf("uploaded %d volumes, want 3 with the last one .003 of 50 bytes", len(uploaded.Volumes))
+    }
+    if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+        t.Errorf("upload left %d files in the archive directory, want only the archive", len(entries))
+    }
+
+    backup, err := service.GetLatestBackup("assets")
+    if err != nil {
+        t.Fatalf("GetLatestBackup: %v", err)
+    }
+    if backup.Name != "assets_20241114_010000.zip" || len(backup.Volumes) != 3 || backup.Size != int64(len(content)) {
+        t.Fatalf("backup = %s with %d volumes of %d bytes, want the 3 volumes of assets_20241114_010000.zip",
+            backup.Name, len(backup.Volumes), backup.Size)
+    }
+
+    listed, err := service.ListAvailableBackups()
+    if err != nil {
+        t.Fatalf("ListAvailableBackups: %v", err)
+    }
+    // The fake lists every file, so skip the folder and checksum files
+    var names []string
+    for _, b := range listed {
+        if _, _, ok := ParseBackupName(b.Name); ok {
+            names = append(names, b.Name)
+        }
+    }
+    if len(names) != 1 || names[0] != backup.Name {
+        t.Errorf("ListAvailableBackups returned %v, want the volume set as one backup", names)
+    }
+
+    restored := filepath.Join(dir, "restored.zip")
+    if err := service.DownloadBackup(ctx, backup, restored); err != nil {
+        t.Fatalf("DownloadBackup: %v", err)
+    }
+    if got, _ := os.ReadFile(restored); !bytes.Equal(got, content) {
+        t.Errorf("joined volumes differ from the original archive")
+    }
+
+    backup.Volumes = backup.Volumes[1:]
+    if err := service.DownloadBackup(ctx, backup, restored); err == nil {
+        t.Errorf("DownloadBackup with a missing volume succeeded")
+    }
+}
+
+func TestVerifyBackupChecksEveryVolume(t *testing.T) {
+    zipPath := filepath.Join(t.TempDir(), "assets_20241114_010000.zip")
+    if err := os.WriteFile(zipPath, bytes.Repeat([]byte("0123456789"), 25), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    api := &fakeDriveAPI{}
+    service := newFakeService(api)
+    ctx := context.Background()
+
+    backup, err := service.UploadBackupVolumes(ctx, zipPath, 100, "assets")
+    if err != nil {
+        t.Fatalf("UploadBackupVolumes: %v", err)
+    }
+    if err := service.VerifyBackup(ctx, backup.ID); err != nil {
+        t.Errorf("VerifyBackup: %v", err)
+    }
+
+    // Only the last volume is damaged, but verifying the first must catch it
+    last := backup.Volumes[2].ID
+    api.contents[last][0] = 'x'
+    if err := service.VerifyBackup(ctx, backup.ID); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+        t.Errorf("VerifyBackup with a corrupted last volume = %v, want a checksum mismatch", err)
+    }
+}
+
+func TestStoredBytesCountsEveryFile(t *testing.T) {
+    zipPath := filepath.Join(t.TempDir(), "assets_20241114_010000.zip")
+    if err := os.WriteFile(zipPath, bytes.Repeat([]byte("0123456789"), 25), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    api := &fakeDriveAPI{}
+    service := newFakeService(api)
+    if _, err := service.UploadBackupVolumes(context.Background(), zipPath, 100, "assets"); err != nil {
+        t.Fatalf("UploadBackupVolumes: %v", err)
+    }
+
+    // Three volumes and their three checksum files
+    var want int64
+    for _, data := range api.contents {
+        want += int64(len(data))
+    }
+    if want <= 250 {
+        t.Fatalf("uploaded %d bytes, want the volumes and their checksum files", want)
+    }
+    got, err := service.StoredBytes(context.Background())
+    if err != nil {
+        t.Fatalf("StoredBytes: %v", err)
+    }
+    if got != want {
+        t.Errorf("StoredBytes = %d, want %d", got, want)
+    }
+}
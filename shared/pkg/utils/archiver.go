@@ -0,0 +1,521 @@
+package utils
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/klauspost/compress/zstd"
+)
+
+// Supported archive formats
+const (
+    ArchiveZip     = "zip"
+    ArchiveTarGz   = "targz"
+    ArchiveTarZstd = "zstd"
+)
+
+// Archiver writes and reads backup archives of one format. Extraction
+// rejects entries that would land outside the destination directory and
+// writes each file under a temporary name that is renamed into place.
+type Archiver interface {
+    // Archive writes an archive of everything below srcDir to w
+    Archive(srcDir string, w io.Writer) error
+    // Extract unpacks the archive read from r into destDir, failing with
+    // ErrExtractLimit once it holds more than limits allow
+    Extract(r io.Reader, destDir string, limits ExtractLimits) error
+    // List returns the regular files in the archive read from r without
+    // extracting them
+    List(r io.Reader) ([]ArchiveEntry, error)
+    // Extension returns the file name suffix of the format, such as ".zip"
+    Extension() string
+}
+
+// ArchiveEntry is a regular file stored in an archive
+type ArchiveEntry struct {
+    Name    string // slash-separated path inside the archive
+    Size    int64
+    ModTime time.Time
+}
+
+// NewArchiver returns the Archiver for format, writing archives with opts
+func NewArchiver(format string, opts ArchiveOptions) (Archiver, error) {
+    switch format {
+    case ArchiveZip, "":
+        return zipArchiver{opts: opts}, nil
+    case ArchiveTarGz:
+        return tarArchiver{opts: opts, codec: gzipCodec{}}, nil
+    case ArchiveTarZstd:
+        return tarArchiver{opts: opts, codec: zstdCodec{}}, nil
+    default:
+        return nil, fmt.Errorf("unsupported archive format: %s", format)
+    }
+}
+
+// ArchiverFor returns the Archiver that reads the archive named name,
+// based on its extension. An encrypted archive must be decrypted first.
+func ArchiverFor(name string) (Archiver, error) {
+    switch {
+    case strings.HasSuffix(name, ".zip"):
+        return zipArchiver{}, nil
+    case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+        return tarArchiver{codec: gzipCodec{}}, nil
+    case strings.HasSuffix(name, ".tar.zst"):
+        return tarArchiver{codec: zstdCodec{}}, nil
+    default:
+        return nil, fmt.Errorf("unknown archive format: %s", filepath.Base(name))
+    }
+}
+
+// ArchiveExt returns the file extension used for the given archive format
+func ArchiveExt(format string) string {
+    archiver, err := NewArchiver(format, ArchiveOptions{})
+    if err != nil {
+        return ".zip"
+    }
+    return archiver.Extension()
+}
+
+// ArchiveDirectory creates an archive of source in the given format
+func ArchiveDirectory(format, source, target string, opts ArchiveOptions) error {
+    archiver, err := NewArchiver(format, opts)
+    if err != nil {
+        return err
+    }
+    return ArchiveToFile(archiver, source, target)
+}
+
+// ArchiveToFile writes an archive of source to the file target
+func ArchiveToFile(archiver Archiver, source, target string) error {
+    file, err := os.Create(target)
+    if err != nil {
+        return fmt.Errorf("failed to create archive file: %v", err)
+    }
+    defer file.Close()
+
+    if err := archiver.Archive(source, file); err != nil {
+        return err
+    }
+    return file.Close()
+}
+
+// WriteArchive streams an archive of source in the given format to w, for
+// uploads that should not go through a temporary file
+func WriteArchive(format, source string, w io.Writer, opts ArchiveOptions) error {
+    archiver, err := NewArchiver(format, opts)
+    if err != nil {
+        return err
+    }
+    return archiver.Archive(source, w)
+}
+
+// ExtractArchive picks the extractor based on the archive's extension
+func ExtractArchive(archivePath, destPath string, limits ExtractLimits) error {
+    archiver, err := ArchiverFor(archivePath)
+    if err != nil {
+        return err
+    }
+
+    file, err := os.Open(archivePath)
+    if err != nil {
+        return fmt.Errorf("failed to open archive: %v", err)
+    }
+    defer file.Close()
+
+    return archiver.Extract(file, destPath, limits)
+}
+
+// ListArchive lists the files of the archive at archivePath, picking the
+// format based on its extension
+func ListArchive(archivePath string) ([]ArchiveEntry, error) {
+    archiver, err := ArchiverFor(archivePath)
+    if err != nil {
+        return nil, err
+    }
+
+    file, err := os.Open(archivePath)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open archive: %v", err)
+    }
+    defer file.Close()
+
+    return archiver.List(file)
+}
+
+// ReadArchiveFile returns the content of the regular file name in the
+// archive at archivePath, picking the format based on its extension
+func ReadArchiveFile(archivePath, name string) ([]byte, error) {
+    archiver, err := ArchiverFor(archivePath)
+    if err != nil {
+        return nil, err
+    }
+
+    file, err := os.Open(archivePath)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open archive: %v", err)
+    }
+    defer file.Close()
+
+    switch a := archiver.(type) {
+    case zipArchiver:
+        var data []byte
+        err := withZipReader(file, os.TempDir(), func(reader *zip.Reader) error {
+            entry, err := reader.Open(name)
+            if err != nil {
+                return err
+            }
+            defer entry.Close()
+            data, err = io.ReadAll(entry)
+            return err
+        })
+        if err != nil {
+            return nil, fmt.Errorf("failed to read %s from archive: %v", name, err)
+        }
+        return data, nil
+    case tarArchiver:
+        reader, err := a.codec.NewReader(file)
+        if err != nil {
+            return nil, fmt.Errorf("failed to open %s stream: %v", a.codec.Extension(), err)
+        }
+        defer reader.Close()
+
+        tarReader := tar.NewReader(reader)
+        for {
+            header, err := tarReader.Next()
+            if err == io.EOF {
+                return nil, fmt.Errorf("failed to read %s from archive: %w", name, os.ErrNotExist)
+            }
+            if err != nil {
+                return nil, fmt.Errorf("failed to read archive: %v", err)
+            }
+            if header.Typeflag == tar.TypeReg && header.Name == name {
+                return io.ReadAll(tarReader)
+            }
+        }
+    default:
+        return nil, fmt.Errorf("unsupported archive: %s", filepath.Base(archivePath))
+    }
+}
+
+// zipArchiver reads and writes zip archives
+type zipArchiver struct {
+    opts ArchiveOptions
+}
+
+func (a zipArchiver) Archive(srcDir string, w io.Writer) error {
+    return writeZip(w, srcDir, a.opts)
+}
+
+// Extract needs random access to the central directory at the end of the
+// archive: files are read in place, other streams are first copied to a
+// temporary file next to destDir
+func (a zipArchiver) Extract(r io.Reader, destDir string, limits ExtractLimits) error {
+    return withZipReader(r, filepath.Dir(destDir), func(reader *zip.Reader) error {
+        return extractZip(reader, destDir, limits)
+    })
+}
+
+// List reads the central directory; streams are spooled to a temporary file
+// in the system temp directory first
+func (a zipArchiver) List(r io.Reader) ([]ArchiveEntry, error) {
+    var entries []ArchiveEntry
+    err := withZipReader(r, os.TempDir(), func(reader *zip.Reader) error {
+        for _, file := range reader.File {
+            if !file.Mode().IsRegular() {
+                continue
+            }
+            entries = append(entries, ArchiveEntry{
+                Name:    file.Name,
+                Size:    int64(file.UncompressedSize64),
+                ModTime: file.Modified,
+            })
+        }
+        return nil
+    })
+    return entries, err
+}
+
+// withZipReader calls fn with a zip.Reader over r, which is read in place
+// when it is a file and otherwise copied to a temporary file in spoolDir
+func withZipReader(r io.Reader, spoolDir string, fn func(reader *zip.Reader) error) error {
+    file, ok := r.(*os.File)
+    if !ok {
+        spool, err := os.CreateTemp(spoolDir, ".extract-*.zip")
+        if err != nil {
+            return fmt.Errorf("failed to create temporary file: %v", err)
+        }
+        defer os.Remove(spool.Name())
+        defer spool.Close()
+
+        if _, err := io.Copy(spool, r); err != nil {
+            return fmt.Errorf("failed to read zip archive: %v", err)
+        }
+        file = spool
+    }
+
+    info, err := file.Stat()
+    if err != nil {
+        return fmt.Errorf("failed to stat zip archive: %v", err)
+    }
+    reader, err := zip.NewReader(file, info.Size())
+    if err != nil {
+        return fmt.Errorf("failed to open zip file: %v", err)
+    }
+    return fn(reader)
+}
+
+func (a zipArchiver) Extension() string {
+    return ".zip"
+}
+
+// tarCodec compresses the tar stream of a tarArchiver
+type tarCodec interface {
+    NewWriter(w io.Writer, opts ArchiveOptions) (io.WriteCloser, error)
+    NewReader(r io.Reader) (io.ReadCloser, error)
+    Extension() string
+}
+
+// tarArchiver reads and writes compressed tar archives
+type tarArchiver struct {
+    opts  ArchiveOptions
+    codec tarCodec
+}
+
+func (a tarArchiver) Archive(srcDir string, w io.Writer) error {
+    return writeTar(w, srcDir, a.opts, a.codec)
+}
+
+func (a tarArchiver) Extract(r io.Reader, destDir string, limits ExtractLimits) error {
+    reader, err := a.codec.NewReader(r)
+    if err != nil {
+        return fmt.Errorf("failed to open %s stream: %v", a.codec.Extension(), err)
+    }
+    defer reader.Close()
+
+    return extractTar(reader, destDir, limits)
+}
+
+// List reads the tar headers, skipping over the file contents
+func (a tarArchiver) List(r io.Reader) ([]ArchiveEntry, error) {
+    reader, err := a.codec.NewReader(r)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open %s stream: %v", a.codec.Extension(), err)
+    }
+    defer reader.Close()
+
+    var entries []ArchiveEntry
+    tarReader := tar.NewReader(reader)
+    for {
+        header, err := tarReader.Next()
+        if err == io.EOF {
+            return entries, nil
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to read archive: %v", err)
+        }
+        if header.Typeflag != tar.TypeReg {
+            continue
+        }
+        entries = append(entries, ArchiveEntry{
+            Name:    header.Name,
+            Size:    header.Size,
+            ModTime: header.ModTime,
+        })
+    }
+}
+
+func (a tarArchiver) Extension() string {
+    return ".tar" + a.codec.Extension()
+}
+
+// gzipCodec compresses tar archives with gzip
+type gzipCodec struct{}
+
+func (gzipCodec) NewWriter(w io.Writer, opts ArchiveOptions) (io.WriteCloser, error) {
+    return gzip.NewWriterLevel(w, opts.compressionLevel())
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+    return gzip.NewReader(r)
+}
+
+func (gzipCodec) Extension() string {
+    return ".gz"
+}
+
+// zstdCodec compresses tar archives with Zstandard
+type zstdCodec struct{}
+
+func (zstdCodec) NewWriter(w io.Writer, opts ArchiveOptions) (io.WriteCloser, error) {
+    level := zstd.SpeedDefault
+    switch {
+    case opts.Store:
+        level = zstd.SpeedFastest
+    case opts.Level > 0:
+        level = zstd.EncoderLevelFromZstd(opts.Level)
+    }
+    // A single encoder goroutine keeps deterministic archives reproducible
+    return zstd.NewWriter(w, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+    decoder, err := zstd.NewReader(r)
+    if err != nil {
+        return nil, err
+    }
+    return decoder.IOReadCloser(), nil
+}
+
+func (zstdCodec) Extension() string {
+    return ".zst"
+}
+
+func TarGzDirectory(source, target string, opts ArchiveOptions) error {
+    return ArchiveDirectory(ArchiveTarGz, source, target, opts)
+}
+
+func UntarGzFile(archivePath, destPath string, limits ExtractLimits) error {
+    file, err := os.Open(archivePath)
+    if err != nil {
+        return fmt.Errorf("failed to open archive: %v", err)
+    }
+    defer file.Close()
+
+    return tarArchiver{codec: gzipCodec{}}.Extract(file, destPath, limits)
+}
+
+// writeTar writes a tar archive of source to w, compressed with codec
+func writeTar(w io.Writer, source string, opts ArchiveOptions, codec tarCodec) error {
+    compressor, err := codec.NewWriter(w, opts)
+    if err != nil {
+        return fmt.Errorf("failed to create %s writer: %v", codec.Extension(), err)
+    }
+    defer compressor.Close()
+
+    archive := tar.NewWriter(compressor)
+    defer archive.Close()
+
+    // Walk through the directory tree
+    err = walkArchive(source, opts, func(entry archiveEntry) error {
+        header, err := tar.FileInfoHeader(entry.info, entry.linkTarget)
+        if err != nil {
+            return fmt.Errorf("failed to create tar header: %v", err)
+        }
+        header.Name = entry.name
+        if entry.info.IsDir() {
+            header.Name += "/"
+        }
+        if opts.Deterministic {
+            header.ModTime = deterministicModTime
+            header.AccessTime = time.Time{}
+            header.ChangeTime = time.Time{}
+            header.Uid, header.Gid = 0, 0
+            header.Uname, header.Gname = "", ""
+            // PAX records would otherwise carry sub-second timestamps
+            header.Format = tar.FormatGNU
+        }
+
+        if err := archive.WriteHeader(header); err != nil {
+            return fmt.Errorf("failed to write tar header: %v", err)
+        }
+
+        if !entry.info.Mode().IsRegular() {
+            return nil
+        }
+
+        f, err := os.Open(entry.path)
+        if err != nil {
+            return fmt.Errorf("failed to open file: %v", err)
+        }
+        defer f.Close()
+
+        if _, err := io.Copy(archive, f); err != nil {
+            return fmt.Errorf("failed to write file to archive: %v", err)
+        }
+
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+
+    // Flush the tar trailer and compressed stream footer before reporting success
+    if err := archive.Close(); err != nil {
+        return fmt.Errorf("failed to finish tar archive: %v", err)
+    }
+    if err := compressor.Close(); err != nil {
+        return fmt.Errorf("failed to finish %s stream: %v", codec.Extension(), err)
+    }
+    return nil
+}
+
+// extractTar extracts the tar stream r below destPath. Entries are only
+// known as they are read, so limits are enforced while extracting and the
+// files written so far are removed again when they are exceeded.
+func extractTar(r io.Reader, destPath string, limits ExtractLimits) error {
+    if err := os.MkdirAll(destPath, 0755); err != nil {
+        return fmt.Errorf("failed to create destination directory: %v", err)
+    }
+
+    budget := &extractBudget{limits: limits}
+    reader := tar.NewReader(r)
+    for {
+        header, err := reader.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return fmt.Errorf("failed to read archive: %v", err)
+        }
+
+        err = budget.addEntry()
+        if err == nil {
+            err = extractTarEntry(reader, header, destPath, budget)
+        }
+        if err != nil {
+            if errors.Is(err, ErrExtractLimit) {
+                budget.removeWritten()
+            }
+            return fmt.Errorf("failed to extract file %s: %w", header.Name, err)
+        }
+    }
+
+    return nil
+}
+
+func extractTarEntry(reader io.Reader, header *tar.Header, destPath string, budget *extractBudget) error {
+    filePath, err := safeExtractPath(destPath, header.Name)
+    if err != nil {
+        return err
+    }
+
+    switch header.Typeflag {
+    case tar.TypeDir:
+        if err := os.MkdirAll(filePath, 0755); err != nil {
+            return fmt.Errorf("failed to create directory: %v", err)
+        }
+        return nil
+    case tar.TypeSymlink:
+        if err := createSymlink(destPath, filePath, header.Linkname); err != nil {
+            return err
+        }
+        budget.track(filePath)
+        return nil
+    case tar.TypeReg:
+        if err := writeExtractedFile(filePath, budget.reader(reader), os.FileMode(header.Mode), header.ModTime); err != nil {
+            return err
+        }
+        budget.track(filePath)
+        return nil
+    default:
+        // Skip hard links and special files
+        return nil
+    }
+}
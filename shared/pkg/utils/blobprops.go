@@ -0,0 +1,60 @@
+package utils
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+)
+
+// BlobPropertiesFile is the sidecar written next to the blobs of a backup
+// when BACKUP_PRESERVE_METADATA is set. It maps each blob name to the
+// content headers and metadata the blob had in Azure. A blob of the same
+// name at the root of the container would be shadowed by it.
+const BlobPropertiesFile = ".azure-blob-properties.json"
+
+// BlobProperties are the content headers and custom metadata of a blob
+type BlobProperties struct {
+    ContentType        string            `json:"contentType,omitempty"`
+    ContentEncoding    string            `json:"contentEncoding,omitempty"`
+    ContentLanguage    string            `json:"contentLanguage,omitempty"`
+    ContentDisposition string            `json:"contentDisposition,omitempty"`
+    CacheControl       string            `json:"cacheControl,omitempty"`
+    Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+// WriteBlobProperties writes properties, keyed by blob name, into dir
+func WriteBlobProperties(dir string, properties map[string]BlobProperties) error {
+    data, err := json.MarshalIndent(properties, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to encode blob properties: %v", err)
+    }
+    if err := os.WriteFile(filepath.Join(dir, BlobPropertiesFile), data, 0644); err != nil {
+        return fmt.Errorf("failed to write blob properties: %v", err)
+    }
+    return nil
+}
+
+// TakeBlobProperties reads the blob properties written into dir by
+// WriteBlobProperties and removes the file, so it is not restored as a blob
+// itself. A backup taken without BACKUP_PRESERVE_METADATA has none, which
+// returns a nil map.
+func TakeBlobProperties(dir string) (map[string]BlobProperties, error) {
+    path := filepath.Join(dir, BlobPropertiesFile)
+    data, err := os.ReadFile(path)
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to read blob properties: %v", err)
+    }
+    if err := os.Remove(path); err != nil {
+        return nil, fmt.Errorf("failed to remove blob properties: %v", err)
+    }
+
+    var properties map[string]BlobProperties
+    if err := json.Unmarshal(data, &properties); err != nil {
+        return nil, fmt.Errorf("failed to parse blob properties: %v", err)
+    }
+    return properties, nil
+}
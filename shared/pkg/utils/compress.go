@@ -2,47 +2,243 @@ package utils
 
 import (
     "archive/zip"
+    "compress/flate"
+    "errors"
     "fmt"
     "io"
+    "math"
     "os"
     "path/filepath"
+    "strings"
+    "time"
 )
 
-func ZipDirectory(source, target string) error {
+// Symlink handling modes for ArchiveOptions
+const (
+    SymlinksSkip   = "skip"   // leave symlinks out of the archive
+    SymlinksFollow = "follow" // archive the content the link points to
+    SymlinksStore  = "store"  // archive the link itself
+)
+
+// ArchiveOptions controls how directories are archived
+type ArchiveOptions struct {
+    Symlinks      string // SymlinksSkip (default), SymlinksFollow or SymlinksStore
+    Deterministic bool   // Normalize timestamps and ownership so identical content gives identical bytes
+    Level         int    // Compression level from 1 (fastest) to 9 (smallest), 0 = library default
+    Store         bool   // Write entries uncompressed, for content that is already compressed
+    // SmartCompression stores zip entries that are already compressed
+    // instead of deflating them again: files with an extension in
+    // IncompressibleExts, and files whose first 64KB do not shrink
+    SmartCompression   bool
+    IncompressibleExts []string // Extensions with a leading dot, nil = DefaultIncompressibleExts
+}
+
+// DefaultIncompressibleExts are formats that are compressed already, so
+// deflating them costs CPU for next to no gain
+var DefaultIncompressibleExts = []string{
+    ".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic", ".avif",
+    ".mp3", ".m4a", ".aac", ".ogg", ".opus", ".flac",
+    ".mp4", ".m4v", ".mov", ".mkv", ".webm", ".avi",
+    ".zip", ".gz", ".tgz", ".bz2", ".xz", ".zst", ".7z", ".rar",
+    ".docx", ".xlsx", ".pptx", ".woff", ".woff2", ".enc",
+}
+
+// compressionSampleSize is how much of a file is deflated to decide whether
+// the whole file is worth compressing
+const compressionSampleSize = 64 * 1024
+
+// isIncompressible reports whether name has one of the extensions
+// configured as incompressible
+func (opts ArchiveOptions) isIncompressible(name string) bool {
+    exts := opts.IncompressibleExts
+    if exts == nil {
+        exts = DefaultIncompressibleExts
+    }
+    ext := filepath.Ext(name)
+    for _, candidate := range exts {
+        if strings.EqualFold(ext, candidate) {
+            return true
+        }
+    }
+    return false
+}
+
+// sampleCompresses reports whether deflating sample at the fastest level
+// saves at least 5%, which is taken as a sign the whole file compresses
+func sampleCompresses(sample []byte) bool {
+    if len(sample) == 0 {
+        return false
+    }
+    var compressed countingWriter
+    w, _ := flate.NewWriter(&compressed, flate.BestSpeed)
+    w.Write(sample)
+    w.Close()
+    return compressed.n < int64(len(sample))*95/100
+}
+
+// countingWriter discards what is written to it and counts the bytes
+type countingWriter struct {
+    n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+    w.n += int64(len(p))
+    return len(p), nil
+}
+
+// compressionLevel returns the flate/gzip level selected by opts
+func (opts ArchiveOptions) compressionLevel() int {
+    switch {
+    case opts.Store:
+        return flate.NoCompression
+    case opts.Level == 0:
+        return flate.DefaultCompression
+    default:
+        return opts.Level
+    }
+}
+
+// deterministicModTime replaces entry timestamps in deterministic archives.
+// It is the earliest time the zip format can represent.
+var deterministicModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// archiveEntry is a file, directory or stored symlink found by walkArchive
+type archiveEntry struct {
+    name       string // slash-separated path inside the archive
+    path       string // file to read the content from
+    info       os.FileInfo
+    linkTarget string // set for stored symlinks
+}
+
+// walkArchive calls fn for every entry below source in lexical order,
+// handling symlinks according to opts
+func walkArchive(source string, opts ArchiveOptions, fn func(entry archiveEntry) error) error {
+    visited := make(map[string]bool) // followed directories, to break link loops
+
+    var walk func(root, prefix string) error
+    walk = func(root, prefix string) error {
+        return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+            if err != nil {
+                return fmt.Errorf("error walking directory: %v", err)
+            }
+
+            relPath, err := filepath.Rel(root, path)
+            if err != nil {
+                return fmt.Errorf("failed to get relative path: %v", err)
+            }
+            if relPath == "." {
+                if prefix == "" {
+                    return nil
+                }
+                relPath = ""
+            }
+            name := filepath.ToSlash(filepath.Join(prefix, relPath))
+
+            if info.Mode()&os.ModeSymlink == 0 {
+                return fn(archiveEntry{name: name, path: path, info: info})
+            }
+
+            switch opts.Symlinks {
+            case SymlinksStore:
+                target, err := os.Readlink(path)
+                if err != nil {
+                    return fmt.Errorf("failed to read symlink: %v", err)
+                }
+                return fn(archiveEntry{name: name, path: path, info: info, linkTarget: target})
+            case SymlinksFollow:
+                realPath, err := filepath.EvalSymlinks(path)
+                if err != nil {
+                    return fmt.Errorf("failed to resolve symlink: %v", err)
+                }
+                targetInfo, err := os.Stat(realPath)
+                if err != nil {
+                    return fmt.Errorf("failed to stat symlink target: %v", err)
+                }
+                if !targetInfo.IsDir() {
+                    return fn(archiveEntry{name: name, path: realPath, info: targetInfo})
+                }
+                if visited[realPath] {
+                    return nil
+                }
+                visited[realPath] = true
+                return walk(realPath, name)
+            default:
+                return nil
+            }
+        })
+    }
+
+    if realSource, err := filepath.EvalSymlinks(source); err == nil {
+        visited[realSource] = true
+    }
+    return walk(source, "")
+}
+
+func ZipDirectory(source, target string, opts ArchiveOptions) error {
     zipfile, err := os.Create(target)
     if err != nil {
         return fmt.Errorf("failed to create zip file: %v", err)
     }
     defer zipfile.Close()
 
-    archive := zip.NewWriter(zipfile)
-    defer archive.Close()
+    return writeZip(zipfile, source, opts)
+}
 
-    // Walk through the directory tree
-    err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
-        if err != nil {
-            return fmt.Errorf("error walking directory: %v", err)
-        }
+// writeZip writes a zip archive of source to w
+func writeZip(w io.Writer, source string, opts ArchiveOptions) error {
+    archive := zip.NewWriter(w)
 
+    // The stock Deflate compressor always uses the default level
+    level := opts.compressionLevel()
+    archive.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+        return flate.NewWriter(out, level)
+    })
+
+    // Walk through the directory tree
+    err := walkArchive(source, opts, func(entry archiveEntry) error {
         // Create zip header
-        header, err := zip.FileInfoHeader(info)
+        header, err := zip.FileInfoHeader(entry.info)
         if err != nil {
             return fmt.Errorf("failed to create zip header: %v", err)
         }
 
         // Ensure consistent paths on Windows and Unix
-        relPath, err := filepath.Rel(source, path)
-        if err != nil {
-            return fmt.Errorf("failed to get relative path: %v", err)
+        header.Name = entry.name
+        if opts.Deterministic {
+            header.Modified = deterministicModTime
         }
-        if relPath == "." {
-            return nil
+
+        // Regular files are opened first, so smart compression can sample them
+        var file *os.File
+        var sample []byte
+        if !entry.info.IsDir() && entry.linkTarget == "" {
+            file, err = os.Open(entry.path)
+            if err != nil {
+                return fmt.Errorf("failed to open file: %v", err)
+            }
+            defer file.Close()
+
+            if opts.SmartCompression && !opts.Store && !opts.isIncompressible(entry.name) {
+                sample = make([]byte, compressionSampleSize)
+                n, err := io.ReadFull(file, sample)
+                if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+                    return fmt.Errorf("failed to read file: %v", err)
+                }
+                sample = sample[:n]
+            }
         }
-        header.Name = filepath.ToSlash(relPath)
 
-        if info.IsDir() {
+        switch {
+        case entry.info.IsDir():
             header.Name += "/"
-        } else {
+        case entry.linkTarget != "":
+            // The link target is stored as the entry's content
+            header.Method = zip.Store
+        case opts.Store:
+            header.Method = zip.Store
+        case opts.SmartCompression && (opts.isIncompressible(entry.name) || !sampleCompresses(sample)):
+            header.Method = zip.Store
+        default:
             header.Method = zip.Deflate
         }
 
@@ -51,13 +247,17 @@ func ZipDirectory(source, target string) error {
             return fmt.Errorf("failed to create zip entry: %v", err)
         }
 
-        if !info.IsDir() {
-            file, err := os.Open(path)
-            if err != nil {
-                return fmt.Errorf("failed to open file: %v", err)
+        if entry.linkTarget != "" {
+            if _, err := writer.Write([]byte(entry.linkTarget)); err != nil {
+                return fmt.Errorf("failed to write symlink to zip: %v", err)
             }
-            defer file.Close()
+            return nil
+        }
 
+        if file != nil {
+            if _, err := writer.Write(sample); err != nil {
+                return fmt.Errorf("failed to write file to zip: %v", err)
+            }
             _, err = io.Copy(writer, file)
             if err != nil {
                 return fmt.Errorf("failed to write file to zip: %v", err)
@@ -66,33 +266,159 @@ func ZipDirectory(source, target string) error {
 
         return nil
     })
+    if err != nil {
+        archive.Close()
+        return err
+    }
 
-    return err
+    // Close writes the central directory
+    if err := archive.Close(); err != nil {
+        return fmt.Errorf("failed to finish zip archive: %v", err)
+    }
+    return nil
 }
 
-func UnzipFile(zipPath, destPath string) error {
+func UnzipFile(zipPath, destPath string, limits ExtractLimits) error {
     reader, err := zip.OpenReader(zipPath)
     if err != nil {
         return fmt.Errorf("failed to open zip file: %v", err)
     }
     defer reader.Close()
 
+    return extractZip(&reader.Reader, destPath, limits)
+}
+
+// extractZip extracts every entry of reader below destPath. When limits are
+// exceeded the files written so far are removed again.
+func extractZip(reader *zip.Reader, destPath string, limits ExtractLimits) error {
     if err := os.MkdirAll(destPath, 0755); err != nil {
         return fmt.Errorf("failed to create destination directory: %v", err)
     }
 
+    // Reject the whole archive before writing anything if an entry would
+    // land outside destPath, or if the central directory already declares
+    // more than the limits allow
+    budget := &extractBudget{limits: limits}
+    var declared int64
     for _, file := range reader.File {
-        err := extractFile(file, destPath)
+        if _, err := SafeJoin(destPath, file.Name); err != nil {
+            return fmt.Errorf("refusing to extract archive: %v", err)
+        }
+        if err := budget.addEntry(); err != nil {
+            return fmt.Errorf("refusing to extract archive: %w", err)
+        }
+        // Checked per entry, so the sum cannot overflow
+        declared += int64(min(file.UncompressedSize64, math.MaxInt64/2))
+        if err := budget.checkSize(declared); err != nil {
+            return fmt.Errorf("refusing to extract archive: %w", err)
+        }
+    }
+
+    for _, file := range reader.File {
+        err := extractFile(file, destPath, budget)
         if err != nil {
-            return fmt.Errorf("failed to extract file %s: %v", file.Name, err)
+            if errors.Is(err, ErrExtractLimit) {
+                budget.removeWritten()
+            }
+            return fmt.Errorf("failed to extract file %s: %w", file.Name, err)
         }
     }
 
     return nil
 }
 
-func extractFile(file *zip.File, destPath string) error {
-    filePath := filepath.Join(destPath, file.Name)
+// createSymlink recreates a stored symlink at linkPath. Links that are
+// absolute or point outside destPath are rejected, since later entries could
+// otherwise be written through them.
+func createSymlink(destPath, linkPath, target string) error {
+    if filepath.IsAbs(target) {
+        return fmt.Errorf("illegal symlink target %q is absolute", target)
+    }
+    if !withinDir(destPath, filepath.Join(filepath.Dir(linkPath), target)) {
+        return fmt.Errorf("illegal symlink target %q escapes the destination directory", target)
+    }
+
+    if err := os.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+        return fmt.Errorf("failed to create parent directory: %v", err)
+    }
+    os.Remove(linkPath)
+    if err := os.Symlink(target, linkPath); err != nil {
+        return fmt.Errorf("failed to create symlink: %v", err)
+    }
+    return nil
+}
+
+// SafeJoin joins an archive entry or file name onto destPath, rejecting names that
+// would resolve outside destPath ("zip slip")
+func SafeJoin(destPath, name string) (string, error) {
+    filePath := filepath.Join(destPath, name)
+    if !withinDir(destPath, filePath) {
+        return "", fmt.Errorf("illegal path %q escapes the destination directory", name)
+    }
+    return filePath, nil
+}
+
+// safeExtractPath is SafeJoin for an entry about to be written. SafeJoin
+// only looks at the name, but an earlier entry may have created a link such
+// as s -> . that makes a harmless looking name like s/s/l/evil resolve
+// outside destPath on disk, so nothing is written through a directory that
+// is a symlink.
+func safeExtractPath(destPath, name string) (string, error) {
+    filePath, err := SafeJoin(destPath, name)
+    if err != nil {
+        return "", err
+    }
+
+    rel, err := filepath.Rel(destPath, filepath.Dir(filePath))
+    if err != nil || rel == "." {
+        return filePath, err
+    }
+    parent := destPath
+    for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+        parent = filepath.Join(parent, part)
+        info, err := os.Lstat(parent)
+        if os.IsNotExist(err) {
+            break
+        }
+        if err != nil {
+            return "", fmt.Errorf("failed to inspect %s: %v", parent, err)
+        }
+        if info.Mode()&os.ModeSymlink != 0 {
+            return "", fmt.Errorf("illegal path %q passes through symlink %q", name, part)
+        }
+    }
+    return filePath, nil
+}
+
+// withinDir reports whether path is dir itself or lies below it
+func withinDir(dir, path string) bool {
+    dir = filepath.Clean(dir)
+    path = filepath.Clean(path)
+    return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+func extractFile(file *zip.File, destPath string, budget *extractBudget) error {
+    filePath, err := safeExtractPath(destPath, file.Name)
+    if err != nil {
+        return err
+    }
+
+    if file.Mode()&os.ModeSymlink != 0 {
+        src, err := file.Open()
+        if err != nil {
+            return fmt.Errorf("failed to open source file: %v", err)
+        }
+        target, err := io.ReadAll(io.LimitReader(src, 4096))
+        src.Close()
+        if err != nil {
+            return fmt.Errorf("failed to read symlink target: %v", err)
+        }
+        if err := createSymlink(destPath, filePath, string(target)); err != nil {
+            return err
+        }
+        budget.track(filePath)
+        return nil
+    }
 
     if file.FileInfo().IsDir() {
         if err := os.MkdirAll(filePath, file.Mode()); err != nil {
@@ -101,31 +427,45 @@ func extractFile(file *zip.File, destPath string) error {
         return nil
     }
 
+    src, err := file.Open()
+    if err != nil {
+        return fmt.Errorf("failed to open source file: %v", err)
+    }
+    defer src.Close()
+
+    if err := writeExtractedFile(filePath, budget.reader(src), file.Mode(), file.Modified); err != nil {
+        return err
+    }
+    budget.track(filePath)
+    return nil
+}
+
+// writeExtractedFile writes the content of an extracted file to filePath,
+// which safeExtractPath has already checked. The content goes to a temporary
+// file that is renamed into place, so an interrupted extraction never leaves
+// a truncated file under the final name. The original modification time is
+// kept.
+func writeExtractedFile(filePath string, r io.Reader, mode os.FileMode, modTime time.Time) error {
     if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
         return fmt.Errorf("failed to create parent directory: %v", err)
     }
 
-    // Create temp file
+    // Create temp file. O_EXCL does not follow a symlink an earlier entry
+    // may have stored under the temp name.
     tempPath := filePath + ".tmp"
-    dest, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, file.Mode())
+    os.Remove(tempPath)
+    dest, err := os.OpenFile(tempPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm())
     if err != nil {
         return fmt.Errorf("failed to create destination file: %v", err)
     }
 
-    src, err := file.Open()
-    if err != nil {
-        dest.Close()
-        os.Remove(tempPath)
-        return fmt.Errorf("failed to open source file: %v", err)
+    _, err = io.Copy(dest, r)
+    if closeErr := dest.Close(); err == nil {
+        err = closeErr
     }
-
-    _, err = io.Copy(dest, src)
-    src.Close()
-    dest.Close()
-
     if err != nil {
         os.Remove(tempPath)
-        return fmt.Errorf("failed to extract file content: %v", err)
+        return fmt.Errorf("failed to extract file content: %w", err)
     }
 
     // Atomic rename
@@ -134,5 +474,10 @@ func extractFile(file *zip.File, destPath string) error {
         return fmt.Errorf("failed to rename temp file: %v", err)
     }
 
+    // Keep the original modification time
+    if err := os.Chtimes(filePath, modTime, modTime); err != nil {
+        return fmt.Errorf("failed to set modification time: %v", err)
+    }
+
     return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,602 @@
+package utils
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "bytes"
+    "compress/gzip"
+    "errors"
+    "io"
+    "math/rand"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestArchiveRoundTripPreservesModTime(t *testing.T) {
+    for _, format := range []string{ArchiveZip, ArchiveTarGz, ArchiveTarZstd} {
+        t.Run(format, func(t *testing.T) {
+            tmp := t.TempDir()
+            source := filepath.Join(tmp, "source")
+            if err := os.MkdirAll(filepath.Join(source, "dir"), 0755); err != nil {
+                t.Fatal(err)
+            }
+
+            filePath := filepath.Join(source, "dir", "file.txt")
+            if err := os.WriteFile(filePath, []byte("hello"), 0640); err != nil {
+                t.Fatal(err)
+            }
+            modTime := time.Date(2023, 6, 1, 12, 30, 45, 0, time.UTC)
+            if err := os.Chtimes(filePath, modTime, modTime); err != nil {
+                t.Fatal(err)
+            }
+
+            archivePath := filepath.Join(tmp, "backup"+ArchiveExt(format))
+            if err := ArchiveDirectory(format, source, archivePath, ArchiveOptions{}); err != nil {
+                t.Fatalf("archive failed: %v", err)
+            }
+
+            dest := filepath.Join(tmp, "restored")
+            if err := ExtractArchive(archivePath, dest, ExtractLimits{}); err != nil {
+                t.Fatalf("extract failed: %v", err)
+            }
+
+            info, err := os.Stat(filepath.Join(dest, "dir", "file.txt"))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if diff := info.ModTime().Sub(modTime); diff > time.Second || diff < -time.Second {
+                t.Errorf("mtime = %v, want %v", info.ModTime().UTC(), modTime)
+            }
+            if info.Mode().Perm() != 0640 {
+                t.Errorf("mode = %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+            }
+
+            // The metadata written on restore must carry the same values
+            restoredTime, mode, hasTime, hasMode := ParseFileMetadata(FileMetadata(info))
+            if !hasTime || !restoredTime.Equal(info.ModTime().Truncate(time.Second)) {
+                t.Errorf("metadata mtime = %v, want %v", restoredTime, info.ModTime())
+            }
+            if !hasMode || mode != 0640 {
+                t.Errorf("metadata mode = %v, want %v", mode, os.FileMode(0640))
+            }
+        })
+    }
+}
+
+func TestExtractRejectsPathTraversal(t *testing.T) {
+    tmp := t.TempDir()
+    dest := filepath.Join(tmp, "dest")
+
+    zipPath := filepath.Join(tmp, "evil.zip")
+    f, err := os.Create(zipPath)
+    if err != nil {
+        t.Fatal(err)
+    }
+    w := zip.NewWriter(f)
+    for _, name := range []string{"good.txt", "../evil"} {
+        entry, err := w.Create(name)
+        if err != nil {
+            t.Fatal(err)
+        }
+        entry.Write([]byte("payload"))
+    }
+    if err := w.Close(); err != nil {
+        t.Fatal(err)
+    }
+    f.Close()
+
+    if err := UnzipFile(zipPath, dest, ExtractLimits{}); err == nil {
+        t.Fatal("expected extraction of ../evil to be rejected")
+    }
+    if _, err := os.Stat(filepath.Join(tmp, "evil")); !os.IsNotExist(err) {
+        t.Errorf("file was written outside the destination: %v", err)
+    }
+    if _, err := os.Stat(filepath.Join(dest, "good.txt")); !os.IsNotExist(err) {
+        t.Errorf("archive was partially extracted: %v", err)
+    }
+
+    tarPath := filepath.Join(tmp, "evil.tar.gz")
+    f, err = os.Create(tarPath)
+    if err != nil {
+        t.Fatal(err)
+    }
+    gz := gzip.NewWriter(f)
+    tw := tar.NewWriter(gz)
+    payload := []byte("payload")
+    if err := tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0644, Size: int64(len(payload)), Typeflag: tar.TypeReg}); err != nil {
+        t.Fatal(err)
+    }
+    tw.Write(payload)
+    tw.Close()
+    gz.Close()
+    f.Close()
+
+    if err := UntarGzFile(tarPath, dest, ExtractLimits{}); err == nil {
+        t.Fatal("expected extraction of ../evil from tar to be rejected")
+    }
+    if _, err := os.Stat(filepath.Join(tmp, "evil")); !os.IsNotExist(err) {
+        t.Errorf("file was written outside the destination: %v", err)
+    }
+}
+
+func TestExtractRejectsChainedSymlinks(t *testing.T) {
+    // Each link passes a name-only check: s points at the destination
+    // itself and s/s/s/l lexically resolves to the destination too. On disk
+    // s/s/s is the destination, so l points three levels above it.
+    type entry struct {
+        name, link, content string
+    }
+    entries := []entry{
+        {name: "s", link: "."},
+        {name: "s/s/s/l", link: "../../.."},
+        {name: "s/s/s/l/evil", content: "payload"},
+    }
+
+    for _, format := range []string{ArchiveZip, ArchiveTarGz} {
+        t.Run(format, func(t *testing.T) {
+            tmp := t.TempDir()
+            archivePath := filepath.Join(tmp, "evil"+ArchiveExt(format))
+            f, err := os.Create(archivePath)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if format == ArchiveZip {
+                zw := zip.NewWriter(f)
+                for _, e := range entries {
+                    header := &zip.FileHeader{Name: e.name}
+                    body := e.content
+                    if e.link != "" {
+                        header.SetMode(os.ModeSymlink | 0777)
+                        body = e.link
+                    }
+                    w, err := zw.CreateHeader(header)
+                    if err != nil {
+                        t.Fatal(err)
+                    }
+                    w.Write([]byte(body))
+                }
+                zw.Close()
+            } else {
+                gz := gzip.NewWriter(f)
+                tw := tar.NewWriter(gz)
+                for _, e := range entries {
+                    header := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.content))}
+                    if e.link != "" {
+                        header = &tar.Header{Name: e.name, Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: e.link}
+                    }
+                    if err := tw.WriteHeader(header); err != nil {
+                        t.Fatal(err)
+                    }
+                    tw.Write([]byte(e.content))
+                }
+                tw.Close()
+                gz.Close()
+            }
+            f.Close()
+
+            dest := filepath.Join(tmp, "a", "b", "dest")
+            if err := ExtractArchive(archivePath, dest, ExtractLimits{}); err == nil {
+                t.Error("expected extraction through a symlinked directory to be rejected")
+            }
+            if _, err := os.Stat(filepath.Join(tmp, "evil")); !os.IsNotExist(err) {
+                t.Errorf("file was written outside the destination: %v", err)
+            }
+        })
+    }
+}
+
+func TestExtractLimits(t *testing.T) {
+    tmp := t.TempDir()
+    // 8 MB of zeros compresses to a few KB
+    bomb := make([]byte, 8<<20)
+
+    zipPath := filepath.Join(tmp, "bomb.zip")
+    f, err := os.Create(zipPath)
+    if err != nil {
+        t.Fatal(err)
+    }
+    zw := zip.NewWriter(f)
+    for name, content := range map[string][]byte{"small.txt": []byte("small"), "bomb.bin": bomb, "other.txt": []byte("other")} {
+        entry, err := zw.Create(name)
+        if err != nil {
+            t.Fatal(err)
+        }
+        entry.Write(content)
+    }
+    if err := zw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    f.Close()
+
+    tarPath := filepath.Join(tmp, "bomb.tar.gz")
+    f, err = os.Create(tarPath)
+    if err != nil {
+        t.Fatal(err)
+    }
+    gz := gzip.NewWriter(f)
+    tw := tar.NewWriter(gz)
+    for _, entry := range []struct {
+        name    string
+        content []byte
+    }{{"small.txt", []byte("small")}, {"bomb.bin", bomb}} {
+        if err := tw.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}); err != nil {
+            t.Fatal(err)
+        }
+        tw.Write(entry.content)
+    }
+    tw.Close()
+    gz.Close()
+    f.Close()
+
+    tests := []struct {
+        name    string
+        archive string
+        limits  ExtractLimits
+        wantErr bool
+    }{
+        {"zip size", zipPath, ExtractLimits{MaxSize: 1 << 20}, true},
+        {"zip entries", zipPath, ExtractLimits{MaxEntries: 2}, true},
+        {"zip within limits", zipPath, ExtractLimits{MaxSize: 16 << 20, MaxEntries: 3}, false},
+        {"tar size", tarPath, ExtractLimits{MaxSize: 1 << 20}, true},
+        {"tar entries", tarPath, ExtractLimits{MaxEntries: 1}, true},
+        {"tar within limits", tarPath, ExtractLimits{MaxSize: 16 << 20, MaxEntries: 2}, false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dest := filepath.Join(t.TempDir(), "extracted")
+            err := ExtractArchive(tt.archive, dest, tt.limits)
+            if !tt.wantErr {
+                if err != nil {
+                    t.Fatalf("extract failed: %v", err)
+                }
+                return
+            }
+
+            if !errors.Is(err, ErrExtractLimit) {
+                t.Fatalf("error = %v, want ErrExtractLimit", err)
+            }
+            // Nothing extracted before the limit was hit is left behind
+            var left []string
+            filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+                if err == nil && !info.IsDir() {
+                    left = append(left, path)
+                }
+                return nil
+            })
+            if len(left) > 0 {
+                t.Errorf("files left after exceeding the limit: %v", left)
+            }
+        })
+    }
+}
+
+func TestArchiveSymlinkModes(t *testing.T) {
+    for _, format := range []string{ArchiveZip, ArchiveTarGz, ArchiveTarZstd} {
+        t.Run(format, func(t *testing.T) {
+            tmp := t.TempDir()
+            source := filepath.Join(tmp, "source")
+            if err := os.MkdirAll(source, 0755); err != nil {
+                t.Fatal(err)
+            }
+            if err := os.WriteFile(filepath.Join(source, "target.txt"), []byte("content"), 0644); err != nil {
+                t.Fatal(err)
+            }
+            if err := os.Symlink("target.txt", filepath.Join(source, "link.txt")); err != nil {
+                t.Skipf("symlinks not supported: %v", err)
+            }
+
+            extract := func(mode string) string {
+                archivePath := filepath.Join(tmp, mode+ArchiveExt(format))
+                if err := ArchiveDirectory(format, source, archivePath, ArchiveOptions{Symlinks: mode}); err != nil {
+                    t.Fatalf("%s: archive failed: %v", mode, err)
+                }
+                dest := filepath.Join(tmp, "restored-"+mode)
+                if err := ExtractArchive(archivePath, dest, ExtractLimits{}); err != nil {
+                    t.Fatalf("%s: extract failed: %v", mode, err)
+                }
+                return filepath.Join(dest, "link.txt")
+            }
+
+            if _, err := os.Lstat(extract(SymlinksSkip)); !os.IsNotExist(err) {
+                t.Errorf("skip: link was archived: %v", err)
+            }
+
+            followed := extract(SymlinksFollow)
+            if info, err := os.Lstat(followed); err != nil || info.Mode()&os.ModeSymlink != 0 {
+                t.Errorf("follow: expected a regular file, got %v, %v", info, err)
+            }
+            if data, _ := os.ReadFile(followed); string(data) != "content" {
+                t.Errorf("follow: content = %q", data)
+            }
+
+            stored := extract(SymlinksStore)
+            if target, err := os.Readlink(stored); err != nil || target != "target.txt" {
+                t.Errorf("store: link target = %q, %v", target, err)
+            }
+        })
+    }
+}
+
+func TestDeterministicArchiveIsByteIdentical(t *testing.T) {
+    for _, format := range []string{ArchiveZip, ArchiveTarGz, ArchiveTarZstd} {
+        t.Run(format, func(t *testing.T) {
+            tmp := t.TempDir()
+            source := filepath.Join(tmp, "source")
+            if err := os.MkdirAll(filepath.Join(source, "dir"), 0755); err != nil {
+                t.Fatal(err)
+            }
+            filePath := filepath.Join(source, "dir", "file.txt")
+            if err := os.WriteFile(filePath, []byte("hello"), 0644); err != nil {
+                t.Fatal(err)
+            }
+
+            archive := func(name string, modTime time.Time) []byte {
+                for _, path := range []string{filePath, filepath.Join(source, "dir")} {
+                    if err := os.Chtimes(path, modTime, modTime); err != nil {
+                        t.Fatal(err)
+                    }
+                }
+                archivePath := filepath.Join(tmp, name+ArchiveExt(format))
+                if err := ArchiveDirectory(format, source, archivePath, ArchiveOptions{Deterministic: true}); err != nil {
+                    t.Fatalf("archive failed: %v", err)
+                }
+                data, err := os.ReadFile(archivePath)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                return data
+            }
+
+            first := archive("first", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+            second := archive("second", time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+            if !bytes.Equal(first, second) {
+                t.Error("archives of identical content differ")
+            }
+        })
+    }
+}
+
+func TestZipStoreWritesUncompressedEntries(t *testing.T) {
+    tmp := t.TempDir()
+    source := filepath.Join(tmp, "source")
+    if err := os.MkdirAll(source, 0755); err != nil {
+        t.Fatal(err)
+    }
+    content := bytes.Repeat([]byte("compressible "), 1000)
+    if err := os.WriteFile(filepath.Join(source, "file.txt"), content, 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    archivePath := filepath.Join(tmp, "backup.zip")
+    if err := ZipDirectory(source, archivePath, ArchiveOptions{Store: true}); err != nil {
+        t.Fatalf("archive failed: %v", err)
+    }
+
+    reader, err := zip.OpenReader(archivePath)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer reader.Close()
+
+    if len(reader.File) != 1 {
+        t.Fatalf("got %d entries, want 1", len(reader.File))
+    }
+    entry := reader.File[0]
+    if entry.Method != zip.Store {
+        t.Errorf("method = %d, want zip.Store", entry.Method)
+    }
+    if entry.CompressedSize64 != uint64(len(content)) {
+        t.Errorf("compressed size = %d, want %d", entry.CompressedSize64, len(content))
+    }
+}
+
+func TestZipSmartCompressionStoresCompressedContent(t *testing.T) {
+    tmp := t.TempDir()
+    source := filepath.Join(tmp, "source")
+    if err := os.MkdirAll(source, 0755); err != nil {
+        t.Fatal(err)
+    }
+    text := bytes.Repeat([]byte("compressible "), 10000)
+    random := make([]byte, 100*1024)
+    rand.New(rand.NewSource(1)).Read(random)
+    files := map[string][]byte{
+        "notes.txt": text,   // compresses well
+        "photo.JPG": text,   // listed extension, not sampled
+        "blob.bin":  random, // sample does not shrink
+    }
+    for name, content := range files {
+        if err := os.WriteFile(filepath.Join(source, name), content, 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    archivePath := filepath.Join(tmp, "backup.zip")
+    if err := ZipDirectory(source, archivePath, ArchiveOptions{SmartCompression: true}); err != nil {
+        t.Fatalf("archive failed: %v", err)
+    }
+
+    reader, err := zip.OpenReader(archivePath)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer reader.Close()
+
+    want := map[string]uint16{"notes.txt": zip.Deflate, "photo.JPG": zip.Store, "blob.bin": zip.Store}
+    for _, entry := range reader.File {
+        if entry.Method != want[entry.Name] {
+            t.Errorf("%s: method = %d, want %d", entry.Name, entry.Method, want[entry.Name])
+        }
+
+        // The sampled bytes must not be lost
+        r, err := entry.Open()
+        if err != nil {
+            t.Fatal(err)
+        }
+        data, err := io.ReadAll(r)
+        r.Close()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !bytes.Equal(data, files[entry.Name]) {
+            t.Errorf("%s: content differs after extraction", entry.Name)
+        }
+    }
+}
+
+func TestZipCompressionLevelIsApplied(t *testing.T) {
+    tmp := t.TempDir()
+    source := filepath.Join(tmp, "source")
+    if err := os.MkdirAll(source, 0755); err != nil {
+        t.Fatal(err)
+    }
+    var content []byte
+    for i := 0; i < 20000; i++ {
+        content = append(content, []byte(time.Duration(i*7919).String())...)
+    }
+    if err := os.WriteFile(filepath.Join(source, "file.txt"), content, 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    size := func(level int) int64 {
+        archivePath := filepath.Join(tmp, "backup.zip")
+        if err := ZipDirectory(source, archivePath, ArchiveOptions{Level: level}); err != nil {
+            t.Fatalf("archive failed: %v", err)
+        }
+        info, err := os.Stat(archivePath)
+        if err != nil {
+            t.Fatal(err)
+        }
+        return info.Size()
+    }
+
+    if fast, best := size(1), size(9); best >= fast {
+        t.Errorf("level 9 archive (%d bytes) is not smaller than level 1 (%d bytes)", best, fast)
+    }
+}
+
+func TestWriteArchiveStreamsExtractableArchive(t *testing.T) {
+    for _, format := range []string{ArchiveZip, ArchiveTarGz, ArchiveTarZstd} {
+        t.Run(format, func(t *testing.T) {
+            tmp := t.TempDir()
+            source := filepath.Join(tmp, "source")
+            if err := os.MkdirAll(filepath.Join(source, "dir"), 0755); err != nil {
+                t.Fatal(err)
+            }
+            if err := os.WriteFile(filepath.Join(source, "dir", "file.txt"), []byte("hello"), 0644); err != nil {
+                t.Fatal(err)
+            }
+
+            var buf bytes.Buffer
+            if err := WriteArchive(format, source, &buf, ArchiveOptions{}); err != nil {
+                t.Fatalf("archive failed: %v", err)
+            }
+
+            archivePath := filepath.Join(tmp, "backup"+ArchiveExt(format))
+            if err := os.WriteFile(archivePath, buf.Bytes(), 0644); err != nil {
+                t.Fatal(err)
+            }
+            dest := filepath.Join(tmp, "restored")
+            if err := ExtractArchive(archivePath, dest, ExtractLimits{}); err != nil {
+                t.Fatalf("extract failed: %v", err)
+            }
+
+            data, err := os.ReadFile(filepath.Join(dest, "dir", "file.txt"))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if string(data) != "hello" {
+                t.Errorf("content = %q, want %q", data, "hello")
+            }
+        })
+    }
+}
+
+func TestArchiverExtractsFromStream(t *testing.T) {
+    for _, format := range []string{ArchiveZip, ArchiveTarGz, ArchiveTarZstd} {
+        t.Run(format, func(t *testing.T) {
+            tmp := t.TempDir()
+            source := filepath.Join(tmp, "source")
+            if err := os.MkdirAll(source, 0755); err != nil {
+                t.Fatal(err)
+            }
+            if err := os.WriteFile(filepath.Join(source, "file.txt"), []byte("hello"), 0644); err != nil {
+                t.Fatal(err)
+            }
+
+            archiver, err := NewArchiver(format, ArchiveOptions{})
+            if err != nil {
+                t.Fatal(err)
+            }
+            var buf bytes.Buffer
+            if err := archiver.Archive(source, &buf); err != nil {
+                t.Fatalf("archive failed: %v", err)
+            }
+
+            // The extension written by the archiver selects the same format again
+            reader, err := ArchiverFor("backup" + archiver.Extension())
+            if err != nil {
+                t.Fatal(err)
+            }
+            dest := filepath.Join(tmp, "restored")
+            if err := reader.Extract(&buf, dest, ExtractLimits{}); err != nil {
+                t.Fatalf("extract failed: %v", err)
+            }
+
+            data, err := os.ReadFile(filepath.Join(dest, "file.txt"))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if string(data) != "hello" {
+                t.Errorf("content = %q, want %q", data, "hello")
+            }
+        })
+    }
+
+    if _, err := NewArchiver("rar", ArchiveOptions{}); err == nil {
+        t.Error("expected an unsupported format to be rejected")
+    }
+}
+
+func TestListArchive(t *testing.T) {
+    for _, format := range []string{ArchiveZip, ArchiveTarGz, ArchiveTarZstd} {
+        t.Run(format, func(t *testing.T) {
+            tmp := t.TempDir()
+            source := filepath.Join(tmp, "source")
+            if err := os.MkdirAll(filepath.Join(source, "dir"), 0755); err != nil {
+                t.Fatal(err)
+            }
+            if err := os.WriteFile(filepath.Join(source, "a.txt"), []byte("hello"), 0644); err != nil {
+                t.Fatal(err)
+            }
+            if err := os.WriteFile(filepath.Join(source, "dir", "b.txt"), []byte("hello world"), 0644); err != nil {
+                t.Fatal(err)
+            }
+
+            archivePath := filepath.Join(tmp, "backup"+ArchiveExt(format))
+            if err := ArchiveDirectory(format, source, archivePath, ArchiveOptions{}); err != nil {
+                t.Fatalf("archive failed: %v", err)
+            }
+
+            entries, err := ListArchive(archivePath)
+            if err != nil {
+                t.Fatalf("list failed: %v", err)
+            }
+            sizes := map[string]int64{}
+            for _, entry := range entries {
+                sizes[entry.Name] = entry.Size
+            }
+            want := map[string]int64{"a.txt": 5, "dir/b.txt": 11}
+            if len(sizes) != len(want) {
+                t.Fatalf("entries = %v, want %v", sizes, want)
+            }
+            for name, size := range want {
+                if sizes[name] != size {
+                    t.Errorf("%s size = %d, want %d", name, sizes[name], size)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+    "io"
+    "mime"
+    "net/http"
+    "os"
+    "path/filepath"
+)
+
+// DefaultContentType is used when the type of a file cannot be determined
+const DefaultContentType = "application/octet-stream"
+
+// ContentTypeByExtension returns the MIME type registered for the extension
+// of name, or "" when there is none
+func ContentTypeByExtension(name string) string {
+    return mime.TypeByExtension(filepath.Ext(name))
+}
+
+// ContentType guesses the MIME type of the file at path from its extension,
+// falling back to sniffing its first 512 bytes; empty or unreadable files
+// get DefaultContentType. Restored files get it as
+// their Content-Type so buckets and containers can serve them to browsers.
+func ContentType(path string) string {
+    if contentType := ContentTypeByExtension(path); contentType != "" {
+        return contentType
+    }
+
+    file, err := os.Open(path)
+    if err != nil {
+        return DefaultContentType
+    }
+    defer file.Close()
+
+    head := make([]byte, 512)
+    n, err := io.ReadFull(file, head)
+    if n == 0 || (err != nil && err != io.ErrUnexpectedEOF) {
+        return DefaultContentType
+    }
+    return http.DetectContentType(head[:n])
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestContentType(t *testing.T) {
+    dir := t.TempDir()
+    files := map[string]string{
+        "page.html":  "hello",
+        "style.css":  "body {}",
+        "README":     "<!DOCTYPE html><html></html>",
+        "blob":       "\x00\x01\x02\x03",
+        "empty-file": "",
+    }
+    for name, content := range files {
+        if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    tests := []struct {
+        name string
+        want string
+    }{
+        {"page.html", "text/html"},
+        {"style.css", "text/css"},
+        {"README", "text/html"},
+        {"blob", DefaultContentType},
+        {"empty-file", DefaultContentType},
+        {"missing", DefaultContentType},
+    }
+    for _, tt := range tests {
+        got := ContentType(filepath.Join(dir, tt.name))
+        if !strings.HasPrefix(got, tt.want) {
+            t.Errorf("ContentType(%s) = %q, want %q", tt.name, got, tt.want)
+        }
+    }
+}
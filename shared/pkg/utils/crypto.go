@@ -0,0 +1,254 @@
+package utils
+
+import (
+    "bufio"
+    "bytes"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+
+    "golang.org/x/crypto/scrypt"
+)
+
+// EncryptedExt is appended to the name of encrypted backup archives
+const EncryptedExt = ".enc"
+
+const (
+    encMagic     = "AZBE"
+    encVersion   = byte(1)
+    encSaltSize  = 16
+    encNonceSize = 12
+    encChunkSize = 64 * 1024
+)
+
+// deriveKey derives an AES-256 key from the passphrase using scrypt
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+    return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+// chunkNonce mixes the chunk counter into the base nonce so every chunk
+// is sealed with a unique nonce
+func chunkNonce(base []byte, counter uint64) []byte {
+    nonce := make([]byte, len(base))
+    copy(nonce, base)
+    var ctr [8]byte
+    binary.BigEndian.PutUint64(ctr[:], counter)
+    for i := 0; i < 8; i++ {
+        nonce[len(nonce)-8+i] ^= ctr[i]
+    }
+    return nonce
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+    key, err := deriveKey(passphrase, salt)
+    if err != nil {
+        return nil, fmt.Errorf("failed to derive key: %v", err)
+    }
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create cipher: %v", err)
+    }
+    return cipher.NewGCM(block)
+}
+
+// EncryptFile encrypts source into target with AES-256-GCM. The output starts
+// with a header carrying the salt and nonce needed to decrypt it again.
+func EncryptFile(source, target, passphrase string) error {
+    in, err := os.Open(source)
+    if err != nil {
+        return fmt.Errorf("failed to open source file: %v", err)
+    }
+    defer in.Close()
+
+    out, err := os.Create(target)
+    if err != nil {
+        return fmt.Errorf("failed to create encrypted file: %v", err)
+    }
+
+    if err := EncryptStream(in, out, passphrase); err != nil {
+        out.Close()
+        os.Remove(target)
+        return err
+    }
+    if err := out.Close(); err != nil {
+        os.Remove(target)
+        return fmt.Errorf("failed to close encrypted file: %v", err)
+    }
+
+    return nil
+}
+
+// EncryptStream encrypts everything read from in and writes it to out in the
+// EncryptFile format, so archives can be encrypted on their way to an upload
+func EncryptStream(in io.Reader, out io.Writer, passphrase string) error {
+    salt := make([]byte, encSaltSize)
+    nonce := make([]byte, encNonceSize)
+    if _, err := rand.Read(salt); err != nil {
+        return fmt.Errorf("failed to generate salt: %v", err)
+    }
+    if _, err := rand.Read(nonce); err != nil {
+        return fmt.Errorf("failed to generate nonce: %v", err)
+    }
+
+    gcm, err := newGCM(passphrase, salt)
+    if err != nil {
+        return err
+    }
+
+    w := bufio.NewWriter(out)
+    header := append([]byte(encMagic), encVersion)
+    header = append(header, salt...)
+    header = append(header, nonce...)
+    if _, err := w.Write(header); err != nil {
+        return fmt.Errorf("failed to write header: %v", err)
+    }
+
+    // Every chunk is full-size except the last one, which may be empty.
+    // The final flag is authenticated so truncation is detected on decrypt.
+    buf := make([]byte, encChunkSize)
+    var lenBuf [4]byte
+    for counter := uint64(0); ; counter++ {
+        n, readErr := io.ReadFull(in, buf)
+        if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+            return fmt.Errorf("failed to read source file: %v", readErr)
+        }
+        final := n < encChunkSize
+
+        sealed := gcm.Seal(nil, chunkNonce(nonce, counter), buf[:n], chunkAAD(final))
+        binary.BigEndian.PutUint32(lenBuf[:], uint32(len(sealed)))
+        _, err := w.Write(lenBuf[:])
+        if err == nil {
+            _, err = w.Write(sealed)
+        }
+        if err != nil {
+            return fmt.Errorf("failed to write encrypted data: %v", err)
+        }
+
+        if final {
+            break
+        }
+    }
+
+    if err := w.Flush(); err != nil {
+        return fmt.Errorf("failed to flush encrypted file: %v", err)
+    }
+
+    return nil
+}
+
+// DecryptFile reverses EncryptFile, writing the plaintext to target
+func DecryptFile(source, target, passphrase string) error {
+    in, err := os.Open(source)
+    if err != nil {
+        return fmt.Errorf("failed to open encrypted file: %v", err)
+    }
+    defer in.Close()
+
+    r := bufio.NewReader(in)
+    header := make([]byte, len(encMagic)+1+encSaltSize+encNonceSize)
+    if _, err := io.ReadFull(r, header); err != nil {
+        return fmt.Errorf("failed to read header: %v", err)
+    }
+    if !bytes.Equal(header[:len(encMagic)], []byte(encMagic)) {
+        return fmt.Errorf("file is not an encrypted backup")
+    }
+    if header[len(encMagic)] != encVersion {
+        return fmt.Errorf("unsupported encryption version: %d", header[len(encMagic)])
+    }
+    salt := header[len(encMagic)+1 : len(encMagic)+1+encSaltSize]
+    nonce := header[len(encMagic)+1+encSaltSize:]
+
+    gcm, err := newGCM(passphrase, salt)
+    if err != nil {
+        return err
+    }
+
+    tempPath := target + ".tmp"
+    out, err := os.Create(tempPath)
+    if err != nil {
+        return fmt.Errorf("failed to create decrypted file: %v", err)
+    }
+
+    fail := func(format string, v ...interface{}) error {
+        out.Close()
+        os.Remove(tempPath)
+        return fmt.Errorf(format, v...)
+    }
+
+    var lenBuf [4]byte
+    maxSealed := encChunkSize + gcm.Overhead()
+    sealed := make([]byte, maxSealed)
+    for counter := uint64(0); ; counter++ {
+        if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+            return fail("encrypted file is truncated")
+        }
+        size := int(binary.BigEndian.Uint32(lenBuf[:]))
+        if size < gcm.Overhead() || size > maxSealed {
+            return fail("invalid chunk size: %d", size)
+        }
+        if _, err := io.ReadFull(r, sealed[:size]); err != nil {
+            return fail("encrypted file is truncated")
+        }
+
+        final := size-gcm.Overhead() < encChunkSize
+        plain, err := gcm.Open(nil, chunkNonce(nonce, counter), sealed[:size], chunkAAD(final))
+        if err != nil {
+            return fail("failed to decrypt (wrong key or corrupted file): %v", err)
+        }
+        if _, err := out.Write(plain); err != nil {
+            return fail("failed to write decrypted data: %v", err)
+        }
+
+        if final {
+            break
+        }
+    }
+
+    if _, err := r.ReadByte(); err != io.EOF {
+        return fail("unexpected data after final chunk")
+    }
+
+    if err := out.Close(); err != nil {
+        os.Remove(tempPath)
+        return fmt.Errorf("failed to close decrypted file: %v", err)
+    }
+
+    // Atomic rename
+    if err := os.Rename(tempPath, target); err != nil {
+        os.Remove(tempPath)
+        return fmt.Errorf("failed to rename temp file: %v", err)
+    }
+
+    return nil
+}
+
+// DecryptIfNeeded decrypts an archive carrying EncryptedExt next to itself and
+// returns the path of the plain archive. Other files are returned unchanged.
+func DecryptIfNeeded(path, passphrase string) (string, error) {
+    if !strings.HasSuffix(path, EncryptedExt) {
+        return path, nil
+    }
+    if passphrase == "" {
+        return "", fmt.Errorf("backup is encrypted but BACKUP_ENCRYPTION_KEY is not set")
+    }
+
+    plainPath := strings.TrimSuffix(path, EncryptedExt)
+    if err := DecryptFile(path, plainPath, passphrase); err != nil {
+        return "", err
+    }
+    os.Remove(path)
+
+    return plainPath, nil
+}
+
+func chunkAAD(final bool) []byte {
+    if final {
+        return []byte{1}
+    }
+    return []byte{0}
+}
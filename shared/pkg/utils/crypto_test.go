@@ -0,0 +1,74 @@
+package utils
+
+import (
+    "bytes"
+    "math/rand"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// encryptTestFile encrypts plain with passphrase and returns the path of the
+// encrypted file
+func encryptTestFile(t *testing.T, dir string, plain []byte, passphrase string) string {
+    t.Helper()
+    source := filepath.Join(dir, "backup.zip")
+    if err := os.WriteFile(source, plain, 0644); err != nil {
+        t.Fatal(err)
+    }
+    target := source + EncryptedExt
+    if err := EncryptFile(source, target, passphrase); err != nil {
+        t.Fatalf("EncryptFile: %v", err)
+    }
+    return target
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+    // Spans several chunks and ends in a partial one
+    plain := make([]byte, 2*encChunkSize+1234)
+    rand.New(rand.NewSource(1)).Read(plain)
+
+    dir := t.TempDir()
+    encrypted := encryptTestFile(t, dir, plain, "secret")
+    if data, _ := os.ReadFile(encrypted); bytes.Contains(data, plain[:64]) {
+        t.Fatalf("encrypted file contains the plain text")
+    }
+
+    decrypted, err := DecryptIfNeeded(encrypted, "secret")
+    if err != nil {
+        t.Fatalf("DecryptIfNeeded: %v", err)
+    }
+    if got, _ := os.ReadFile(decrypted); !bytes.Equal(got, plain) {
+        t.Errorf("decrypted content differs from the original")
+    }
+    if _, err := os.Stat(encrypted); !os.IsNotExist(err) {
+        t.Errorf("DecryptIfNeeded left the encrypted file behind")
+    }
+}
+
+func TestDecryptRejectsFlippedByte(t *testing.T) {
+    dir := t.TempDir()
+    encrypted := encryptTestFile(t, dir, bytes.Repeat([]byte("backup data "), 1000), "secret")
+
+    data, err := os.ReadFile(encrypted)
+    if err != nil {
+        t.Fatal(err)
+    }
+    data[len(data)/2] ^= 0x01
+    if err := os.WriteFile(encrypted, data, 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    if err := DecryptFile(encrypted, filepath.Join(dir, "out.zip"), "secret"); err == nil {
+        t.Errorf("DecryptFile accepted a modified file")
+    }
+}
+
+func TestDecryptRejectsWrongKey(t *testing.T) {
+    dir := t.TempDir()
+    encrypted := encryptTestFile(t, dir, []byte("backup data"), "secret")
+
+    if err := DecryptFile(encrypted, filepath.Join(dir, "out.zip"), "wrong"); err == nil {
+        t.Errorf("DecryptFile accepted the wrong passphrase")
+    }
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "os"
+)
+
+// ErrExtractLimit is returned when an archive holds more entries or
+// uncompressed bytes than the ExtractLimits it is extracted with allow
+var ErrExtractLimit = errors.New("archive exceeds extraction limits")
+
+// ExtractLimits bounds what extracting an archive may write, so a crafted
+// or corrupt archive that inflates far beyond its own size cannot fill the
+// disk. The zero value sets no limits.
+type ExtractLimits struct {
+    MaxSize    int64 // Total uncompressed bytes of all files, 0 = unlimited
+    MaxEntries int   // Number of entries, directories included, 0 = unlimited
+}
+
+// extractBudget tracks an extraction against its limits and remembers the
+// files it wrote, so they can be removed when a limit is exceeded
+type extractBudget struct {
+    limits  ExtractLimits
+    entries int
+    size    int64
+    written []string
+}
+
+// addEntry counts one more archive entry
+func (b *extractBudget) addEntry() error {
+    b.entries++
+    if b.limits.MaxEntries > 0 && b.entries > b.limits.MaxEntries {
+        return fmt.Errorf("%w: more than %d entries", ErrExtractLimit, b.limits.MaxEntries)
+    }
+    return nil
+}
+
+// checkSize fails once size bytes would take the extraction over MaxSize
+func (b *extractBudget) checkSize(size int64) error {
+    if b.limits.MaxSize > 0 && size > b.limits.MaxSize {
+        return fmt.Errorf("%w: more than %s uncompressed", ErrExtractLimit, FormatBytes(b.limits.MaxSize))
+    }
+    return nil
+}
+
+// reader counts the bytes read from r against MaxSize. The declared sizes
+// in archive headers are not trusted, only what actually decompresses.
+func (b *extractBudget) reader(r io.Reader) io.Reader {
+    return &budgetReader{r: r, budget: b}
+}
+
+// track records a file written by the extraction
+func (b *extractBudget) track(path string) {
+    b.written = append(b.written, path)
+}
+
+// removeWritten deletes every file the extraction wrote
+func (b *extractBudget) removeWritten() {
+    for _, path := range b.written {
+        os.Remove(path)
+    }
+    b.written = nil
+}
+
+type budgetReader struct {
+    r      io.Reader
+    budget *extractBudget
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+    n, err := r.r.Read(p)
+    r.budget.size += int64(n)
+    if limitErr := r.budget.checkSize(r.budget.size); limitErr != nil {
+        return n, limitErr
+    }
+    return n, err
+}
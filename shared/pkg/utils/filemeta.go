@@ -0,0 +1,39 @@
+package utils
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "time"
+)
+
+// Metadata keys carrying the original file attributes on restored blobs/objects
+const (
+    MetaMtime = "mtime"
+    MetaMode  = "mode"
+)
+
+// FileMetadata returns the modification time and permissions of info as
+// blob/object metadata
+func FileMetadata(info os.FileInfo) map[string]string {
+    return map[string]string{
+        MetaMtime: info.ModTime().UTC().Format(time.RFC3339),
+        MetaMode:  fmt.Sprintf("%04o", info.Mode().Perm()),
+    }
+}
+
+// ParseFileMetadata reads back the attributes written by FileMetadata. The
+// returned flags report whether each value was present and valid.
+func ParseFileMetadata(metadata map[string]string) (modTime time.Time, mode os.FileMode, hasTime, hasMode bool) {
+    if v, ok := metadata[MetaMtime]; ok {
+        if t, err := time.Parse(time.RFC3339, v); err == nil {
+            modTime, hasTime = t, true
+        }
+    }
+    if v, ok := metadata[MetaMode]; ok {
+        if m, err := strconv.ParseUint(v, 8, 32); err == nil {
+            mode, hasMode = os.FileMode(m).Perm(), true
+        }
+    }
+    return
+}
@@ -3,25 +3,84 @@ package utils
 import (
     "fmt"
     "io"
+    "time"
 )
 
-// ProgressReader wraps an io.Reader to provide progress updates
+const (
+    // progressInterval is the minimum time between two progress callbacks
+    progressInterval = time.Second
+    // speedSmoothing is the weight of the latest interval in the moving-average speed
+    speedSmoothing = 0.3
+)
+
+// Progress is a snapshot of a transfer reported by ProgressReader
+type Progress struct {
+    Done    int64
+    Total   int64
+    Percent float64
+    Speed   float64       // Moving-average speed in bytes per second
+    ETA     time.Duration // Estimated time remaining, 0 while unknown
+}
+
+// ProgressReader wraps an io.Reader to provide progress updates, reported
+// at most once per second to OnProgress and to Sink. Sink gets one last
+// report when the reader reaches EOF; a reader of unknown Total then reports
+// the bytes read as the total, so sinks can tell the transfer finished.
 type ProgressReader struct {
     io.Reader
-    Total     int64
-    Uploaded  int64
-    OnProgress func(uploaded, total int64)
+    Name       string // Name the transfer is reported under to Sink
+    Total      int64
+    Uploaded   int64
+    OnProgress func(p Progress)
+    Sink       ProgressSink
+
+    meter progressMeter
 }
 
 func (pr *ProgressReader) Read(p []byte) (int, error) {
     n, err := pr.Reader.Read(p)
     pr.Uploaded += int64(n)
+    if pr.OnProgress == nil && pr.Sink == nil {
+        return n, err
+    }
+
+    if err == io.EOF && pr.Sink != nil {
+        total := pr.Total
+        if total <= 0 {
+            total = pr.Uploaded
+        }
+        pr.Sink.OnProgress(pr.Name, pr.Uploaded, total)
+        return n, err
+    }
+
+    progress, ok := pr.meter.update(pr.Uploaded, pr.Total, time.Now(), progressInterval)
+    if !ok {
+        return n, err
+    }
     if pr.OnProgress != nil {
-        pr.OnProgress(pr.Uploaded, pr.Total)
+        pr.OnProgress(progress)
+    }
+    if pr.Sink != nil {
+        pr.Sink.OnProgress(pr.Name, pr.Uploaded, pr.Total)
     }
+
     return n, err
 }
 
+// Done tells Sink the transfer ended, completed or not. Call it once the
+// reader is no longer used, typically deferred.
+func (pr *ProgressReader) Done() {
+    if pr.Sink != nil {
+        FinishProgress(pr.Sink, pr.Name)
+    }
+}
+
+// Reset rewinds the progress state so the reader can report a retried transfer
+func (pr *ProgressReader) Reset() {
+    pr.Uploaded = 0
+    pr.meter = progressMeter{}
+}
+
 // FormatBytes converts bytes to human readable string format
 func FormatBytes(bytes int64) string {
     const unit = 1024
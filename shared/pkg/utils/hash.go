@@ -0,0 +1,28 @@
+package utils
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "io"
+    "os"
+)
+
+// FileSHA256 returns the hex-encoded SHA-256 of the file at path
+func FileSHA256(path string) (string, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return "", err
+    }
+    defer file.Close()
+
+    return ReaderSHA256(file)
+}
+
+// ReaderSHA256 returns the hex-encoded SHA-256 of everything read from r
+func ReaderSHA256(r io.Reader) (string, error) {
+    hash := sha256.New()
+    if _, err := io.Copy(hash, r); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(hash.Sum(nil)), nil
+}
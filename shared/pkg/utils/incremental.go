@@ -0,0 +1,146 @@
+package utils
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+)
+
+// IncrementalManifest is the file inside an incremental archive listing every
+// blob that existed when it was taken, so restores can replay deletions
+const IncrementalManifest = ".azure-backup-manifest"
+
+// WriteIncrementalManifest writes the list of current blob paths into dir
+func WriteIncrementalManifest(dir string, files []string) error {
+    f, err := os.Create(filepath.Join(dir, IncrementalManifest))
+    if err != nil {
+        return fmt.Errorf("failed to create manifest: %v", err)
+    }
+
+    w := bufio.NewWriter(f)
+    for _, name := range files {
+        if _, err := w.WriteString(filepath.ToSlash(name) + "\n"); err != nil {
+            f.Close()
+            return fmt.Errorf("failed to write manifest: %v", err)
+        }
+    }
+    if err := w.Flush(); err != nil {
+        f.Close()
+        return fmt.Errorf("failed to write manifest: %v", err)
+    }
+    return f.Close()
+}
+
+// ApplyIncrementalArchive decrypts the downloaded incremental archive at
+// archivePath when needed, extracts it next to itself and merges it into
+// extractPath with ApplyIncremental. The archive and the extracted copy are
+// removed afterwards.
+func ApplyIncrementalArchive(archivePath, extractPath, passphrase string, limits ExtractLimits) error {
+    defer os.Remove(archivePath)
+
+    archivePath, err := DecryptIfNeeded(archivePath, passphrase)
+    if err != nil {
+        return fmt.Errorf("failed to decrypt: %v", err)
+    }
+    defer os.Remove(archivePath)
+
+    stagingPath := filepath.Join(filepath.Dir(archivePath), "incremental")
+    defer os.RemoveAll(stagingPath)
+    if err := ExtractArchive(archivePath, stagingPath, limits); err != nil {
+        return fmt.Errorf("failed to extract: %v", err)
+    }
+
+    return ApplyIncremental(stagingPath, extractPath)
+}
+
+// ApplyIncremental moves the files of an extracted incremental archive from
+// srcDir over destDir, then removes files from destDir that are missing from
+// the archive's manifest
+func ApplyIncremental(srcDir, destDir string) error {
+    manifestPath := filepath.Join(srcDir, IncrementalManifest)
+    keep, err := readIncrementalManifest(manifestPath)
+    if err != nil {
+        return err
+    }
+    os.Remove(manifestPath)
+
+    // Overlay changed files
+    err = filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if info.IsDir() {
+            return nil
+        }
+
+        relPath, err := filepath.Rel(srcDir, path)
+        if err != nil {
+            return fmt.Errorf("failed to get relative path: %v", err)
+        }
+        target := filepath.Join(destDir, relPath)
+        if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+            return fmt.Errorf("failed to create parent directory: %v", err)
+        }
+        if err := os.Rename(path, target); err != nil {
+            return fmt.Errorf("failed to move %s: %v", relPath, err)
+        }
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+
+    // Replay deletions
+    return filepath.Walk(destDir, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if info.IsDir() {
+            return nil
+        }
+
+        relPath, err := filepath.Rel(destDir, path)
+        if err != nil {
+            return fmt.Errorf("failed to get relative path: %v", err)
+        }
+        // The blob properties are not a blob, so the manifest never lists them
+        if relPath == BlobPropertiesFile {
+            return nil
+        }
+        if _, ok := keep[filepath.ToSlash(relPath)]; !ok {
+            if err := os.Remove(path); err != nil {
+                return fmt.Errorf("failed to remove deleted file %s: %v", relPath, err)
+            }
+        }
+        return nil
+    })
+}
+
+func readIncrementalManifest(path string) (map[string]struct{}, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("incremental archive has no manifest: %v", err)
+    }
+    defer f.Close()
+
+    return ParseIncrementalManifest(f)
+}
+
+// ParseIncrementalManifest returns the set of blob paths listed in the
+// incremental manifest read from r
+func ParseIncrementalManifest(r io.Reader) (map[string]struct{}, error) {
+    keep := make(map[string]struct{})
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    for scanner.Scan() {
+        if line := scanner.Text(); line != "" {
+            keep[line] = struct{}{}
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read manifest: %v", err)
+    }
+    return keep, nil
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+    t.Helper()
+    for name, content := range files {
+        path := filepath.Join(dir, filepath.FromSlash(name))
+        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+}
+
+func TestApplyIncrementalArchive(t *testing.T) {
+    tmp := t.TempDir()
+
+    // The full backup as extracted by a restore
+    extractPath := filepath.Join(tmp, "extracted")
+    writeTestFiles(t, extractPath, map[string]string{
+        "kept.txt":         "unchanged",
+        "changed.txt":      "old content",
+        "dir/deleted.txt":  "removed since the full backup",
+        BlobPropertiesFile: "{}",
+    })
+
+    // The incremental backup holds the changed and new files, and lists
+    // every blob that still existed when it was taken
+    source := filepath.Join(tmp, "source")
+    writeTestFiles(t, source, map[string]string{
+        "changed.txt":   "new content",
+        "dir/added.txt": "added since the full backup",
+    })
+    if err := WriteIncrementalManifest(source, []string{"kept.txt", "changed.txt", "dir/added.txt"}); err != nil {
+        t.Fatal(err)
+    }
+    archivePath := filepath.Join(tmp, "assets_20241115_010000_inc.zip")
+    if err := ArchiveDirectory(ArchiveZip, source, archivePath, ArchiveOptions{}); err != nil {
+        t.Fatal(err)
+    }
+
+    if err := ApplyIncrementalArchive(archivePath, extractPath, "", ExtractLimits{}); err != nil {
+        t.Fatalf("ApplyIncrementalArchive: %v", err)
+    }
+
+    want := map[string]string{
+        "kept.txt":         "unchanged",
+        "changed.txt":      "new content",
+        "dir/added.txt":    "added since the full backup",
+        BlobPropertiesFile: "{}",
+    }
+    for name, content := range want {
+        got, err := os.ReadFile(filepath.Join(extractPath, filepath.FromSlash(name)))
+        if err != nil || string(got) != content {
+            t.Errorf("%s = %q (%v), want %q", name, got, err, content)
+        }
+    }
+    if _, err := os.Stat(filepath.Join(extractPath, "dir", "deleted.txt")); !os.IsNotExist(err) {
+        t.Errorf("deleted.txt was not removed: %v", err)
+    }
+    if _, err := os.Stat(filepath.Join(extractPath, IncrementalManifest)); !os.IsNotExist(err) {
+        t.Errorf("the incremental manifest was restored as a file")
+    }
+
+    // The downloaded archive and its extracted copy are cleaned up
+    entries, err := os.ReadDir(tmp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, entry := range entries {
+        if entry.Name() != "extracted" && entry.Name() != "source" {
+            t.Errorf("%s was left behind", entry.Name())
+        }
+    }
+}
+
+func TestApplyIncrementalRequiresManifest(t *testing.T) {
+    tmp := t.TempDir()
+    src := filepath.Join(tmp, "incremental")
+    writeTestFiles(t, src, map[string]string{"file.txt": "content"})
+    dest := filepath.Join(tmp, "extracted")
+    writeTestFiles(t, dest, map[string]string{"file.txt": "old"})
+
+    // Without a manifest every existing file would look deleted
+    if err := ApplyIncremental(src, dest); err == nil {
+        t.Fatal("ApplyIncremental accepted an archive without a manifest")
+    }
+    if got, _ := os.ReadFile(filepath.Join(dest, "file.txt")); string(got) != "old" {
+        t.Errorf("file.txt = %q, want it untouched", got)
+    }
+}
+
+func TestReadArchiveFileReadsManifest(t *testing.T) {
+    for _, format := range []string{ArchiveZip, ArchiveTarGz} {
+        t.Run(format, func(t *testing.T) {
+            tmp := t.TempDir()
+            source := filepath.Join(tmp, "source")
+            writeTestFiles(t, source, map[string]string{"dir/file.txt": "content"})
+            if err := WriteIncrementalManifest(source, []string{"dir/file.txt", "other.txt"}); err != nil {
+                t.Fatal(err)
+            }
+            archivePath := filepath.Join(tmp, "backup"+ArchiveExt(format))
+            if err := ArchiveDirectory(format, source, archivePath, ArchiveOptions{}); err != nil {
+                t.Fatal(err)
+            }
+
+            data, err := ReadArchiveFile(archivePath, IncrementalManifest)
+            if err != nil {
+                t.Fatalf("ReadArchiveFile: %v", err)
+            }
+            if string(data) != "dir/file.txt\nother.txt\n" {
+                t.Errorf("manifest = %q", data)
+            }
+            if _, err := ReadArchiveFile(archivePath, "missing.txt"); err == nil {
+                t.Errorf("ReadArchiveFile of a missing file succeeded")
+            }
+        })
+    }
+}
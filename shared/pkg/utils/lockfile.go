@@ -0,0 +1,123 @@
+package utils
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+    "sync"
+    "syscall"
+    "time"
+)
+
+// ErrLocked is returned by AcquireFileLock when another process holds the lock
+var ErrLocked = errors.New("lock is held by another process")
+
+// FileLock is an exclusive lock on a lock file, held until Release
+type FileLock struct {
+    file    *os.File
+    stop    chan struct{}
+    stopped sync.WaitGroup
+}
+
+// AcquireFileLock takes an exclusive flock on the file at path, creating it
+// if needed, and records the holder's host, PID and start time in it.
+//
+// The kernel drops a flock when its process exits, crashed or not, so a lock
+// left behind on the same host is taken over at once. A flock does not
+// always reach other hosts sharing the directory over a network filesystem,
+// so while the lock is held its file is touched every staleAfter/4 as a
+// heartbeat, and a record written by another host is honoured until it has
+// not been touched for staleAfter.
+func AcquireFileLock(path string, staleAfter time.Duration, logger *Logger) (*FileLock, error) {
+    file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open lock file: %v", err)
+    }
+
+    if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+        holder := readLockHolder(file)
+        file.Close()
+        if errors.Is(err, syscall.EWOULDBLOCK) {
+            return nil, fmt.Errorf("%w (%s)", ErrLocked, holder)
+        }
+        return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+    }
+
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return nil, fmt.Errorf("failed to stat lock file: %v", err)
+    }
+    if holder := readLockHolder(file); holder != "" {
+        host, _ := os.Hostname()
+        age := time.Since(info.ModTime())
+        if !strings.HasPrefix(holder, "host="+host+" ") && age < staleAfter {
+            file.Close()
+            return nil, fmt.Errorf("%w (%s, last seen %v ago)", ErrLocked, holder, age.Round(time.Second))
+        }
+        logger.Warn("Taking over stale lock %s (%s, last seen %v ago)", path, holder, age.Round(time.Second))
+    }
+
+    if err := writeLockHolder(file); err != nil {
+        file.Close()
+        return nil, fmt.Errorf("failed to write lock file: %v", err)
+    }
+
+    lock := &FileLock{file: file, stop: make(chan struct{})}
+    interval := staleAfter / 4
+    if interval < time.Second {
+        interval = time.Second
+    }
+    lock.stopped.Add(1)
+    go func() {
+        defer lock.stopped.Done()
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-lock.stop:
+                return
+            case <-ticker.C:
+                now := time.Now()
+                if err := os.Chtimes(path, now, now); err != nil {
+                    logger.Warn("Failed to refresh lock file %s: %v", path, err)
+                }
+            }
+        }
+    }()
+
+    return lock, nil
+}
+
+// Release clears the holder record and drops the lock
+func (l *FileLock) Release() error {
+    close(l.stop)
+    l.stopped.Wait()
+
+    err := l.file.Truncate(0)
+    syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+    if closeErr := l.file.Close(); err == nil {
+        err = closeErr
+    }
+    return err
+}
+
+// readLockHolder returns the holder record of a lock file, or "" if it is
+// empty because the last holder released it
+func readLockHolder(file *os.File) string {
+    data := make([]byte, 256)
+    n, _ := file.ReadAt(data, 0)
+    return strings.TrimSpace(string(data[:n]))
+}
+
+// writeLockHolder replaces the holder record with the current process
+func writeLockHolder(file *os.File) error {
+    host, _ := os.Hostname()
+    record := fmt.Sprintf("host=%s pid=%d since=%s\n", host, os.Getpid(), time.Now().Format(time.RFC3339))
+    if err := file.Truncate(0); err != nil {
+        return err
+    }
+    _, err := file.WriteAt([]byte(record), 0)
+    return err
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestFileLockExcludesSecondHolder(t *testing.T) {
+    logger := NewLogger("[TEST]", "error", "text")
+    path := filepath.Join(t.TempDir(), ".backup.lock")
+
+    lock, err := AcquireFileLock(path, time.Hour, logger)
+    if err != nil {
+        t.Fatalf("AcquireFileLock: %v", err)
+    }
+    if _, err := AcquireFileLock(path, time.Hour, logger); !errors.Is(err, ErrLocked) {
+        t.Fatalf("second AcquireFileLock = %v, want ErrLocked", err)
+    }
+
+    if err := lock.Release(); err != nil {
+        t.Fatalf("Release: %v", err)
+    }
+    lock, err = AcquireFileLock(path, time.Hour, logger)
+    if err != nil {
+        t.Fatalf("AcquireFileLock after release: %v", err)
+    }
+    lock.Release()
+}
+
+func TestFileLockHonoursOtherHostUntilStale(t *testing.T) {
+    logger := NewLogger("[TEST]", "error", "text")
+    path := filepath.Join(t.TempDir(), ".backup.lock")
+    if err := os.WriteFile(path, []byte("host=elsewhere pid=1 since=2024-11-14T01:00:00Z\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    if _, err := AcquireFileLock(path, time.Hour, logger); !errors.Is(err, ErrLocked) {
+        t.Fatalf("AcquireFileLock with a fresh record = %v, want ErrLocked", err)
+    }
+
+    old := time.Now().Add(-2 * time.Hour)
+    if err := os.Chtimes(path, old, old); err != nil {
+        t.Fatal(err)
+    }
+    lock, err := AcquireFileLock(path, time.Hour, logger)
+    if err != nil {
+        t.Fatalf("AcquireFileLock with a stale record: %v", err)
+    }
+    lock.Release()
+}
+
+func TestFileLockTakesOverRecordOfSameHost(t *testing.T) {
+    logger := NewLogger("[TEST]", "error", "text")
+    path := filepath.Join(t.TempDir(), ".backup.lock")
+    host, _ := os.Hostname()
+    if err := os.WriteFile(path, []byte("host="+host+" pid=1 since=2024-11-14T01:00:00Z\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    // The flock is free, so the process that wrote the record is gone
+    lock, err := AcquireFileLock(path, time.Hour, logger)
+    if err != nil {
+        t.Fatalf("AcquireFileLock: %v", err)
+    }
+    lock.Release()
+}
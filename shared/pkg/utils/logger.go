@@ -1,9 +1,14 @@
 package utils
 
 import (
+    "encoding/json"
+    "fmt"
+    "io"
     "log"
     "os"
+    "strings"
     "sync"
+    "time"
 )
 
 type LogLevel int
@@ -15,17 +20,46 @@ const (
     ERROR
 )
 
+var levelNames = map[LogLevel]string{
+    DEBUG: "debug",
+    INFO:  "info",
+    WARN:  "warn",
+    ERROR: "error",
+}
+
 type Logger struct {
     *log.Logger
-    level LogLevel
-    mu    sync.Mutex
+    level  LogLevel
+    prefix string
+    json   bool
+    mu     sync.Mutex
+}
+
+// logEntry is a single line emitted in JSON format
+type logEntry struct {
+    Level  string `json:"level"`
+    Ts     string `json:"ts"`
+    Prefix string `json:"prefix"`
+    Msg    string `json:"msg"`
+}
+
+// logOutput is where loggers created by NewLogger write
+var logOutput io.Writer = os.Stdout
+
+// SetLogOutput changes where loggers created afterwards write, e.g. to
+// stderr when stdout carries machine-readable output
+func SetLogOutput(w io.Writer) {
+    logOutput = w
 }
 
-func NewLogger(prefix string, levelStr string) *Logger {
+// NewLogger creates a logger. format is "text" (default) or "json".
+func NewLogger(prefix string, levelStr string, format string) *Logger {
     level := parseLogLevel(levelStr)
     return &Logger{
-        Logger: log.New(os.Stdout, prefix+" ", log.LstdFlags|log.Lmsgprefix),
+        Logger: log.New(logOutput, prefix+" ", log.LstdFlags|log.Lmsgprefix),
         level:  level,
+        prefix: strings.Trim(prefix, "[]"),
+        json:   format == "json",
     }
 }
 
@@ -44,34 +78,43 @@ func parseLogLevel(level string) LogLevel {
     }
 }
 
-func (l *Logger) Debug(format string, v ...interface{}) {
-    if l.level <= DEBUG {
-        l.mu.Lock()
-        l.Printf("[DEBUG] "+format, v...)
-        l.mu.Unlock()
+func (l *Logger) output(level LogLevel, format string, v ...interface{}) {
+    if l.level > level {
+        return
+    }
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    if !l.json {
+        l.Printf("["+strings.ToUpper(levelNames[level])+"] "+format, v...)
+        return
+    }
+
+    line, err := json.Marshal(logEntry{
+        Level:  levelNames[level],
+        Ts:     time.Now().Format(time.RFC3339Nano),
+        Prefix: l.prefix,
+        Msg:    fmt.Sprintf(format, v...),
+    })
+    if err != nil {
+        return
     }
+    l.Writer().Write(append(line, '\n'))
+}
+
+func (l *Logger) Debug(format string, v ...interface{}) {
+    l.output(DEBUG, format, v...)
 }
 
 func (l *Logger) Info(format string, v ...interface{}) {
-    if l.level <= INFO {
-        l.mu.Lock()
-        l.Printf("[INFO] "+format, v...)
-        l.mu.Unlock()
-    }
+    l.output(INFO, format, v...)
 }
 
 func (l *Logger) Warn(format string, v ...interface{}) {
-    if l.level <= WARN {
-        l.mu.Lock()
-        l.Printf("[WARN] "+format, v...)
-        l.mu.Unlock()
-    }
+    l.output(WARN, format, v...)
 }
 
 func (l *Logger) Error(format string, v ...interface{}) {
-    if l.level <= ERROR {
-        l.mu.Lock()
-        l.Printf("[ERROR] "+format, v...)
-        l.mu.Unlock()
-    }
-}
\ No newline at end of file
+    l.output(ERROR, format, v...)
+}
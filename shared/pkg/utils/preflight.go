@@ -0,0 +1,43 @@
+package utils
+
+import (
+    "context"
+    "fmt"
+    "io"
+)
+
+// Check is one step of a preflight (-check) run
+type Check struct {
+    Name string
+    Run  func(ctx context.Context) error
+}
+
+// RunPreflight prints the result of loading the configuration, which failed
+// with configErr unless it is nil, and then runs the checks returned by
+// checks. It reports whether everything passed; checks is only called once
+// the configuration loaded.
+func RunPreflight(ctx context.Context, w io.Writer, configErr error, checks func() []Check) bool {
+    if configErr != nil {
+        fmt.Fprintf(w, "[FAIL] Configuration: %v\n", configErr)
+        return false
+    }
+    fmt.Fprintln(w, "[PASS] Configuration")
+
+    return RunChecks(ctx, w, checks()) == 0
+}
+
+// RunChecks runs checks in order, printing a PASS or FAIL line for each to
+// w, and returns the number of checks that failed. A failed check does not
+// stop the ones after it.
+func RunChecks(ctx context.Context, w io.Writer, checks []Check) int {
+    failed := 0
+    for _, check := range checks {
+        if err := check.Run(ctx); err != nil {
+            fmt.Fprintf(w, "[FAIL] %s: %v\n", check.Name, err)
+            failed++
+            continue
+        }
+        fmt.Fprintf(w, "[PASS] %s\n", check.Name)
+    }
+    return failed
+}
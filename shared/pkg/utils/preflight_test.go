@@ -0,0 +1,46 @@
+package utils
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "testing"
+)
+
+func TestRunChecksContinuesAfterFailure(t *testing.T) {
+    var ran []string
+    checks := []Check{
+        {Name: "first", Run: func(ctx context.Context) error { ran = append(ran, "first"); return errors.New("denied") }},
+        {Name: "second", Run: func(ctx context.Context) error { ran = append(ran, "second"); return nil }},
+    }
+
+    var out bytes.Buffer
+    if failed := RunChecks(context.Background(), &out, checks); failed != 1 {
+        t.Errorf("RunChecks = %d failed, want 1", failed)
+    }
+    if len(ran) != 2 {
+        t.Errorf("ran %v, want both checks", ran)
+    }
+    if want := "[FAIL] first: denied\n[PASS] second\n"; out.String() != want {
+        t.Errorf("output = %q, want %q", out.String(), want)
+    }
+}
+
+func TestRunPreflightStopsOnConfigError(t *testing.T) {
+    called := false
+    checks := func() []Check {
+        called = true
+        return nil
+    }
+
+    var out bytes.Buffer
+    if RunPreflight(context.Background(), &out, errors.New("AZURE_ACCOUNT_NAME is required"), checks) {
+        t.Errorf("RunPreflight passed with a configuration error")
+    }
+    if called {
+        t.Errorf("checks were built without a configuration")
+    }
+    if want := "[FAIL] Configuration: AZURE_ACCOUNT_NAME is required\n"; out.String() != want {
+        t.Errorf("output = %q, want %q", out.String(), want)
+    }
+}
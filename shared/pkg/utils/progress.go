@@ -0,0 +1,160 @@
+package utils
+
+import (
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// ProgressSink receives the progress of uploads and downloads so it can be
+// logged, exported as metrics or shown in a UI. uploaded == total marks a
+// finished transfer; total is 0 while the size is unknown.
+type ProgressSink interface {
+    OnProgress(name string, uploaded, total int64)
+}
+
+// ProgressDoneSink is implemented by sinks that keep state for each
+// transfer. OnDone is called once a transfer ends, whether it completed,
+// failed or was cancelled, so that state can be released.
+type ProgressDoneSink interface {
+    OnDone(name string)
+}
+
+// FinishProgress tells sink that the transfer name ended, if it wants to know
+func FinishProgress(sink ProgressSink, name string) {
+    if done, ok := sink.(ProgressDoneSink); ok {
+        done.OnDone(name)
+    }
+}
+
+// progressMeter turns successive byte counts into Progress snapshots with a
+// moving-average speed
+type progressMeter struct {
+    lastReport time.Time
+    lastBytes  int64
+    speed      float64
+}
+
+// update records that done bytes were transferred by now. ok is false when
+// the last snapshot is less than interval old, or for the first call, which
+// only starts the clock.
+func (m *progressMeter) update(done, total int64, now time.Time, interval time.Duration) (_ Progress, ok bool) {
+    if m.lastReport.IsZero() {
+        m.lastReport = now
+        return Progress{}, false
+    }
+    elapsed := now.Sub(m.lastReport)
+    if elapsed <= 0 || elapsed < interval {
+        return Progress{}, false
+    }
+
+    current := float64(done-m.lastBytes) / elapsed.Seconds()
+    if m.speed == 0 {
+        m.speed = current
+    } else {
+        m.speed = speedSmoothing*current + (1-speedSmoothing)*m.speed
+    }
+    m.lastReport = now
+    m.lastBytes = done
+
+    progress := Progress{
+        Done:  done,
+        Total: total,
+        Speed: m.speed,
+    }
+    if total > 0 {
+        progress.Percent = float64(done) / float64(total) * 100
+    }
+    if m.speed > 0 && total > done {
+        seconds := float64(total-done) / m.speed
+        progress.ETA = (time.Duration(seconds) * time.Second).Round(time.Second)
+    }
+    return progress, true
+}
+
+// ProgressMeter tracks a transfer whose bytes arrive from several goroutines,
+// such as a download split into concurrent ranges. Add is safe for
+// concurrent use and calls OnProgress at most once per second.
+type ProgressMeter struct {
+    Total      int64
+    OnProgress func(p Progress)
+
+    done  atomic.Int64
+    mu    sync.Mutex
+    meter progressMeter
+}
+
+// Add records n more transferred bytes
+func (m *ProgressMeter) Add(n int64) {
+    done := m.done.Add(n)
+    if m.OnProgress == nil {
+        return
+    }
+    // Another goroutine is reporting already; its snapshot is recent enough
+    if !m.mu.TryLock() {
+        return
+    }
+    defer m.mu.Unlock()
+    if progress, ok := m.meter.update(done, m.Total, time.Now(), progressInterval); ok {
+        m.OnProgress(progress)
+    }
+}
+
+// Done returns the bytes transferred so far
+func (m *ProgressMeter) Done() int64 {
+    return m.done.Load()
+}
+
+// LogProgressSink logs progress with the speed and estimated time remaining
+// of each transfer. Finished transfers are not logged.
+type LogProgressSink struct {
+    logger *Logger
+    verb   string
+
+    mu     sync.Mutex
+    meters map[string]*progressMeter
+}
+
+// NewLogProgressSink returns a sink logging "<verb> <name>: <progress>",
+// e.g. with verb "Uploading"
+func NewLogProgressSink(logger *Logger, verb string) *LogProgressSink {
+    return &LogProgressSink{
+        logger: logger,
+        verb:   verb,
+        meters: make(map[string]*progressMeter),
+    }
+}
+
+// OnDone forgets the speed of the transfer name
+func (s *LogProgressSink) OnDone(name string) {
+    s.mu.Lock()
+    delete(s.meters, name)
+    s.mu.Unlock()
+}
+
+func (s *LogProgressSink) OnProgress(name string, uploaded, total int64) {
+    s.mu.Lock()
+    if total > 0 && uploaded >= total {
+        delete(s.meters, name)
+        s.mu.Unlock()
+        return // Skip 100% progress
+    }
+    meter, ok := s.meters[name]
+    if !ok {
+        // Start the clock one interval back, so the first report is logged
+        meter = &progressMeter{lastReport: time.Now().Add(-progressInterval)}
+        s.meters[name] = meter
+    }
+    // The reader already limits how often it reports
+    p, ok := meter.update(uploaded, total, time.Now(), 0)
+    s.mu.Unlock()
+    if !ok {
+        return
+    }
+
+    if total > 0 {
+        s.logger.Info("%s %s: %.1f%% (%.2f MB/s, ETA %v)", s.verb, name, p.Percent, p.Speed/1024/1024, p.ETA)
+    } else {
+        s.logger.Info("%s %s: %s (%.2f MB/s)", s.verb, name, FormatBytes(uploaded), p.Speed/1024/1024)
+    }
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+    "bytes"
+    "io"
+    "sync"
+    "testing"
+    "time"
+)
+
+type recordingSink struct {
+    uploaded, total int64
+    calls           int
+    done            []string
+}
+
+func (r *recordingSink) OnProgress(name string, uploaded, total int64) {
+    r.uploaded, r.total = uploaded, total
+    r.calls++
+}
+
+func (r *recordingSink) OnDone(name string) {
+    r.done = append(r.done, name)
+}
+
+func TestProgressReaderReportsCompletion(t *testing.T) {
+    for _, total := range []int64{0, 1000} {
+        sink := &recordingSink{}
+        reader := &ProgressReader{Reader: bytes.NewReader(make([]byte, 1000)), Name: "a.zip", Total: total, Sink: sink}
+        if _, err := io.Copy(io.Discard, reader); err != nil {
+            t.Fatal(err)
+        }
+        if sink.calls == 0 || sink.uploaded != 1000 || sink.total != 1000 {
+            t.Errorf("total %d: last report %d of %d after %d calls, want 1000 of 1000",
+                total, sink.uploaded, sink.total, sink.calls)
+        }
+    }
+}
+
+func TestProgressReaderDoneAfterFailedTransfer(t *testing.T) {
+    sink := &recordingSink{}
+    reader := &ProgressReader{Reader: io.LimitReader(bytes.NewReader(make([]byte, 1000)), 400), Name: "a.zip", Total: 1000, Sink: sink}
+    io.Copy(io.Discard, reader)
+    reader.Done()
+
+    // The transfer stopped short of its total, so only Done marks its end
+    if len(sink.done) != 1 || sink.done[0] != "a.zip" {
+        t.Errorf("OnDone called for %v, want a.zip once", sink.done)
+    }
+}
+
+func TestProgressMeterConcurrentAdd(t *testing.T) {
+    var reports []Progress
+    meter := &ProgressMeter{Total: 8000, OnProgress: func(p Progress) { reports = append(reports, p) }}
+
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 10; j++ {
+                meter.Add(100)
+            }
+        }()
+    }
+    wg.Wait()
+    if meter.Done() != 8000 {
+        t.Fatalf("Done() = %d, want 8000", meter.Done())
+    }
+
+    // Past the report interval the next Add reports the running total
+    meter.meter.lastReport = time.Now().Add(-2 * progressInterval)
+    meter.Add(0)
+    if len(reports) == 0 || reports[len(reports)-1].Done != 8000 || reports[len(reports)-1].Percent != 100 {
+        t.Errorf("reports = %+v, want a last report of 8000 bytes at 100%%", reports)
+    }
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+    "io/fs"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// CleanupTempDir removes what a crashed run left behind in dir: top-level
+// entries whose name matches one of patterns and *.tmp files at any depth.
+// Only entries untouched for maxAge are removed, so the work and the
+// atomic-rename temps of a concurrently running instance are left alone;
+// a directory counts as old only if nothing inside it is newer.
+// It returns the number of entries removed.
+func CleanupTempDir(dir string, maxAge time.Duration, patterns []string, logger *Logger) int {
+    cutoff := time.Now().Add(-maxAge)
+    var removed int
+
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        if !os.IsNotExist(err) {
+            logger.Warn("Failed to read temp directory %s: %v", dir, err)
+        }
+        return 0
+    }
+
+    for _, entry := range entries {
+        path := filepath.Join(dir, entry.Name())
+        if !matchAny(patterns, entry.Name()) {
+            continue
+        }
+        newest, err := newestModTime(path)
+        if err != nil {
+            logger.Warn("Failed to inspect %s: %v", path, err)
+            continue
+        }
+        if newest.After(cutoff) {
+            continue
+        }
+        if err := os.RemoveAll(path); err != nil {
+            logger.Warn("Failed to remove leftover %s: %v", path, err)
+            continue
+        }
+        logger.Info("Removed leftover temp entry %s (last modified %s)", path, newest.Format("2006-01-02 15:04:05"))
+        removed++
+    }
+
+    // Stray atomic-rename temps outside the directories removed above
+    filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+        if err != nil || d.IsDir() || !strings.HasSuffix(d.Name(), ".tmp") {
+            return nil
+        }
+        info, err := d.Info()
+        if err != nil || info.ModTime().After(cutoff) {
+            return nil
+        }
+        if err := os.Remove(path); err != nil {
+            logger.Warn("Failed to remove leftover %s: %v", path, err)
+            return nil
+        }
+        logger.Info("Removed leftover temp file %s", path)
+        removed++
+        return nil
+    })
+
+    return removed
+}
+
+// matchAny reports whether name matches any of the globs
+func matchAny(patterns []string, name string) bool {
+    for _, pattern := range patterns {
+        if matched, _ := filepath.Match(pattern, name); matched {
+            return true
+        }
+    }
+    return false
+}
+
+// newestModTime returns the latest modification time of path and, for a
+// directory, of everything below it
+func newestModTime(path string) (time.Time, error) {
+    var newest time.Time
+    err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        info, err := d.Info()
+        if err != nil {
+            return err
+        }
+        if info.ModTime().After(newest) {
+            newest = info.ModTime()
+        }
+        return nil
+    })
+    return newest, err
+}
+
+// DirSize returns the total size of the regular files below dir
+func DirSize(dir string) (int64, error) {
+    var size int64
+    err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if info.Mode().IsRegular() {
+            size += info.Size()
+        }
+        return nil
+    })
+    return size, err
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestCleanupTempDir(t *testing.T) {
+    dir := t.TempDir()
+    old := time.Now().Add(-48 * time.Hour)
+
+    write := func(rel string, modTime time.Time) {
+        path := filepath.Join(dir, rel)
+        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.Chtimes(path, modTime, modTime); err != nil {
+            t.Fatal(err)
+        }
+    }
+    touchDir := func(rel string, modTime time.Time) {
+        if err := os.Chtimes(filepath.Join(dir, rel), modTime, modTime); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    write("restore_old/data/file.txt", old)
+    touchDir("restore_old/data", old)
+    touchDir("restore_old", old)
+
+    // An old directory with one recently written file is still in use
+    write("restore_active/old.txt", old)
+    write("restore_active/new.txt", time.Now())
+    touchDir("restore_active", old)
+
+    write("stale.tmp", old)
+    write("fresh.tmp", time.Now())
+    write("keep.txt", old)
+
+    logger := NewLogger("[TEST]", "error", "text")
+    if removed := CleanupTempDir(dir, 24*time.Hour, []string{"restore_*"}, logger); removed != 2 {
+        t.Errorf("removed = %d, want 2", removed)
+    }
+
+    for rel, wantExists := range map[string]bool{
+        "restore_old":    false,
+        "restore_active": true,
+        "stale.tmp":      false,
+        "fresh.tmp":      true,
+        "keep.txt":       true,
+    } {
+        _, err := os.Stat(filepath.Join(dir, rel))
+        if exists := err == nil; exists != wantExists {
+            t.Errorf("%s exists = %v, want %v", rel, exists, wantExists)
+        }
+    }
+}
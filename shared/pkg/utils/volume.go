@@ -0,0 +1,9 @@
+package utils
+
+import "fmt"
+
+// VolumeName returns the path of the index-th volume (counting from 1) of
+// the file at path: path.001, path.002, ...
+func VolumeName(path string, index int) string {
+    return fmt.Sprintf("%s.%03d", path, index)
+}